@@ -3,15 +3,73 @@ package v10
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/update"
 )
 
+const (
+	SortByCreated = "created"
+	SortBySemver  = "semver"
+)
+
 type ListImagesOptions struct {
 	Spec                    update.ResourceSpec
 	OverrideContainerFields []string
+
+	// These choose which of the available images are listed, for
+	// each container. TagFilter is a pattern as for tag policies,
+	// e.g., `semver:~1.2` or `regexp:^build-\d+$` (and a glob if not
+	// prefixed); Sort is SortByCreated or SortBySemver; and a Limit
+	// of zero means no limit.
+	TagFilter string `json:",omitempty"`
+	Sort      string `json:",omitempty"`
+	Limit     int    `json:",omitempty"`
+}
+
+// Validate returns an error if the options can't be used as given.
+func (opts ListImagesOptions) Validate() error {
+	switch opts.Sort {
+	case "", SortByCreated, SortBySemver:
+	default:
+		return fmt.Errorf("unknown sort order %q; expected %q or %q", opts.Sort, SortByCreated, SortBySemver)
+	}
+	if opts.Limit < 0 {
+		return fmt.Errorf("limit must not be negative, got %d", opts.Limit)
+	}
+	return policy.ValidatePattern(opts.TagFilter)
+}
+
+// SelectImages gives the images chosen by the options, from those
+// given. Without a sort order, images are listed as given or, if
+// there's a tag filter, newest first by the filter's ordering.
+func (opts ListImagesOptions) SelectImages(images []image.Info) []image.Info {
+	if images == nil {
+		return nil
+	}
+	selected := update.ImageInfos(images)
+	if opts.TagFilter != "" {
+		selected = selected.FilterAndSort(policy.NewPattern(opts.TagFilter))
+		if selected == nil {
+			selected = update.ImageInfos{}
+		}
+	} else if opts.Sort != "" {
+		selected = append(update.ImageInfos{}, selected...)
+	}
+	switch opts.Sort {
+	case SortByCreated:
+		image.Sort(selected, image.NewerByCreated)
+	case SortBySemver:
+		image.Sort(selected, image.NewerBySemver)
+	}
+	if opts.Limit > 0 && len(selected) > opts.Limit {
+		selected = selected[:opts.Limit]
+	}
+	return selected
 }
 
 type Server interface {
@@ -0,0 +1,85 @@
+package v10
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func images(t *testing.T, tags ...string) []image.Info {
+	name, err := image.ParseRef("quay.io/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each image is an hour older than the one before it
+	var infos []image.Info
+	now := time.Now()
+	for i, tag := range tags {
+		infos = append(infos, image.Info{ID: name.Name.ToRef(tag), CreatedAt: now.Add(-time.Duration(i) * time.Hour)})
+	}
+	return infos
+}
+
+func tags(infos []image.Info) []string {
+	var ts []string
+	for _, info := range infos {
+		ts = append(ts, info.ID.Tag)
+	}
+	return ts
+}
+
+func TestSelectImages(t *testing.T) {
+	available := images(t, "1.3.0", "build-12", "1.2.10", "1.2.2", "1.1.0", "latest")
+	for _, c := range []struct {
+		opts     ListImagesOptions
+		expected []string
+	}{
+		{ListImagesOptions{}, []string{"1.3.0", "build-12", "1.2.10", "1.2.2", "1.1.0", "latest"}},
+		{ListImagesOptions{Limit: 2}, []string{"1.3.0", "build-12"}},
+		{ListImagesOptions{TagFilter: "semver:~1.2"}, []string{"1.2.10", "1.2.2"}},
+		{ListImagesOptions{TagFilter: "semver:*", Sort: SortByCreated, Limit: 3}, []string{"1.3.0", "1.2.10", "1.2.2"}},
+		{ListImagesOptions{TagFilter: `regexp:^build-\d+$`}, []string{"build-12"}},
+		{ListImagesOptions{TagFilter: "1.*", Sort: SortBySemver}, []string{"1.3.0", "1.2.10", "1.2.2", "1.1.0"}},
+		{ListImagesOptions{TagFilter: "semver:>2"}, nil},
+	} {
+		selected := c.opts.SelectImages(available)
+		if got := tags(selected); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%+v: expected %v, got %v", c.opts, c.expected, got)
+		}
+		if selected == nil {
+			t.Errorf("%+v: expected an empty list rather than nil", c.opts)
+		}
+	}
+
+	// The images given aren't reordered in place
+	if got := tags(available); got[0] != "1.3.0" || got[1] != "build-12" {
+		t.Errorf("images given were changed: %v", got)
+	}
+	if selected := (ListImagesOptions{TagFilter: "semver:*"}).SelectImages(nil); selected != nil {
+		t.Errorf("expected no images to stay nil, got %v", selected)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, opts := range []ListImagesOptions{
+		{Sort: "alphabetical"},
+		{Limit: -1},
+		{TagFilter: "semver:>>1"},
+		{TagFilter: "regexp:build-("},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", opts)
+		}
+	}
+	for _, opts := range []ListImagesOptions{
+		{},
+		{TagFilter: "semver:~1.2", Sort: SortBySemver, Limit: 5},
+		{TagFilter: "master-*", Sort: SortByCreated},
+	} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %s", opts, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// This package defines the types for Flux API version 11.
+package v11
+
+import (
+	"context"
+
+	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/cluster"
+)
+
+// LintReport is the outcome of linting the manifests in the git
+// repo, as of the last sync.
+type LintReport struct {
+	// Revision is the commit linted; if empty, there's been no sync
+	// since the daemon started, so nothing has been linted yet.
+	Revision string
+	Findings []cluster.LintFinding
+}
+
+// ManifestsReport is the outcome of loading the manifests in the
+// git repo, as of the last sync.
+type ManifestsReport struct {
+	// Revision is the commit the manifests were loaded from; if
+	// empty, there's been no attempt to sync since the daemon
+	// started.
+	Revision string
+	// Error is the error that stopped the manifests being loaded, if
+	// there was one. It has a path (and line), if it was found in a
+	// particular file.
+	Error *cluster.FileError `json:",omitempty"`
+	// Skipped gives the files that weren't loaded, and why
+	Skipped []cluster.SkippedFile
+}
+
+// DriftOptions says what to include in a drift report.
+type DriftOptions struct {
+	// Diff says whether to give the fields that differ, for each
+	// resource that's modified.
+	Diff bool
+}
+
+// DriftReport is the outcome of comparing the manifests in the git
+// repos, at the revisions last synced, with the resources in the
+// cluster.
+type DriftReport struct {
+	// Revisions gives the revision compared for each repo, by URL.
+	// Repos that have not been synced yet are left out.
+	Revisions map[string]string
+	// Extraneous says whether resources that were synced, but no
+	// longer have manifests, could be looked for; this depends on
+	// synced resources being marked for garbage collection.
+	Extraneous bool
+	Resources  []cluster.ResourceDrift
+}
+
+type Server interface {
+	v10.Server
+
+	LintReport(context.Context) (LintReport, error)
+	ManifestsReport(context.Context) (ManifestsReport, error)
+	DriftReport(context.Context, DriftOptions) (DriftReport, error)
+}
+
+type Upstream interface {
+	v10.Upstream
+}
@@ -2,6 +2,7 @@ package v6
 
 import (
 	"context"
+	"time"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/git"
@@ -40,6 +41,14 @@ type ControllerStatus struct {
 	Locked     bool
 	Ignore     bool
 	Policies   map[string]string
+	Held       *HeldUpdate `json:",omitempty"`
+}
+
+// HeldUpdate is an automated update that is being held back until
+// the release window of the controller opens.
+type HeldUpdate struct {
+	Changes []update.ContainerUpdate
+	Until   time.Time
 }
 
 // --- config types
@@ -3,6 +3,7 @@ package v6
 import (
 	"github.com/pkg/errors"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/update"
 )
@@ -26,7 +27,7 @@ type Container struct {
 }
 
 // NewContainer creates a Container given a list of images and the current image
-func NewContainer(name string, images update.ImageInfos, currentImage image.Info, tagPattern string, fields []string) (Container, error) {
+func NewContainer(name string, images update.ImageInfos, currentImage image.Info, tagPattern policy.Pattern, fields []string) (Container, error) {
 	// All images
 	imagesCount := len(images)
 	imagesErr := ""
@@ -42,11 +43,11 @@ func NewContainer(name string, images update.ImageInfos, currentImage image.Info
 	newImagesCount := len(newImages)
 
 	// Filtered images
-	filteredImages := images.Filter(tagPattern)
+	filteredImages := images.FilterAndSort(tagPattern)
 	filteredImagesCount := len(filteredImages)
 	var newFilteredImages []image.Info
 	for _, img := range filteredImages {
-		if img.CreatedAt.After(currentImage.CreatedAt) {
+		if !img.ID.Equivalent(currentImage.ID) && tagPattern.Newer(&img, &currentImage) {
 			newFilteredImages = append(newFilteredImages, img)
 		}
 	}
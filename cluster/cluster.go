@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/ssh"
 )
@@ -17,10 +18,22 @@ type Cluster interface {
 	SomeControllers([]flux.ResourceID) ([]Controller, error)
 	Ping() error
 	Export() ([]byte, error)
+	// Export the resources marked as applied in the sync set named
+	ExportSyncSet(name string) ([]byte, error)
 	Sync(SyncDef) error
 	PublicSSHKey(regenerate bool) (ssh.PublicKey, error)
 }
 
+// ApplyOrderer is implemented by clusters in which some resources
+// must be applied before others; e.g., a namespace before the
+// resources in it. Sync puts the resources it's given in order
+// itself; this is for when they're synced in more than one batch.
+type ApplyOrderer interface {
+	// ApplyRank gives the rank of the resource given: it's to be
+	// applied after all those of a lower rank.
+	ApplyRank(resource.Resource) int
+}
+
 // Controller describes a cluster resource that declares versioned images.
 type Controller struct {
 	ID     flux.ResourceID
@@ -35,6 +48,10 @@ type Controller struct {
 	// in this field.
 	Antecedent flux.ResourceID
 	Labels     map[string]string
+	// The platform the controller's pods are constrained to run on
+	// (e.g., by a node selector), if any. This decides which image
+	// is considered, for multi-platform images.
+	Platform image.Platform
 
 	Containers ContainersOrExcuse
 }
@@ -58,6 +75,28 @@ func (s Controller) ContainersOrError() ([]resource.Container, error) {
 	return s.Containers.Containers, err
 }
 
+// WithFileContainers returns the controller with the containers the
+// workload given has in other files than its manifest (see
+// resource.ContainersInFiles) added to those the cluster reports.
+func (s Controller) WithFileContainers(wl resource.Workload) Controller {
+	inFiles, ok := wl.(resource.ContainersInFiles)
+	if !ok || s.Containers.Excuse != "" {
+		return s
+	}
+	have := map[string]bool{}
+	for _, c := range s.Containers.Containers {
+		have[c.Name] = true
+	}
+	containers := append([]resource.Container{}, s.Containers.Containers...)
+	for _, c := range inFiles.FileContainers() {
+		if !have[c.Name] {
+			containers = append(containers, c)
+		}
+	}
+	s.Containers.Containers = containers
+	return s
+}
+
 // These errors all represent logical problems with cluster
 // configuration, and may be recoverable; e.g., it might be fine if a
 // service does not have a matching RC/deployment.
@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+// The ways a resource in the cluster can differ (or not) from its
+// manifest.
+const (
+	// the fields given in the manifest have the same values in the
+	// cluster
+	DriftInSync = "in-sync"
+	// some of the fields given in the manifest have different values
+	// in the cluster
+	DriftModified = "modified"
+	// there's a manifest, but no such resource in the cluster
+	DriftMissing = "missing"
+	// the resource was synced, but there's no longer a manifest for it
+	DriftExtraneous = "extraneous"
+)
+
+// FieldDrift is a field of a resource that has a different value in
+// the cluster than in its manifest. The values are given as JSON;
+// the value in the cluster is empty if it doesn't have the field.
+type FieldDrift struct {
+	Path    string
+	Git     string
+	Cluster string `json:",omitempty"`
+}
+
+// ResourceDrift says how a resource in the cluster compares with its
+// manifest.
+type ResourceDrift struct {
+	ID     flux.ResourceID
+	Source string `json:",omitempty"` // the file the manifest is in, if there is one
+	Status string
+	// The fields that differ, if the resource is modified and the
+	// differences were asked for
+	Diff []FieldDrift `json:",omitempty"`
+}
+
+// DriftDetector is implemented by Clusters that can compare the
+// resources in them with manifests.
+type DriftDetector interface {
+	// Drift compares each of the resources given with that in the
+	// cluster, in order of resource ID, and includes the fields that
+	// differ if asked to. If a sync set is named, the resources marked
+	// as applied in it but not among those given are reported as
+	// extraneous.
+	Drift(resources map[string]resource.Resource, syncSetName string, withDiff bool) ([]ResourceDrift, error)
+}
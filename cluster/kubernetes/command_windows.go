@@ -0,0 +1,14 @@
+package kubernetes
+
+import (
+	"os/exec"
+)
+
+// There are no process groups to speak of on Windows; the command
+// alone is killed.
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
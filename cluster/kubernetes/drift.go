@@ -0,0 +1,227 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	k8syaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+// redacted is given in place of the values of fields of Secrets,
+// when reporting differences.
+const redacted = "<redacted>"
+
+var _ cluster.DriftDetector = &Cluster{}
+
+// Drift compares the resources given, as loaded from manifests, with
+// those in the cluster. Only the fields given in a manifest are
+// compared, since the API server fills in defaults (and status)
+// besides; so a resource is in sync if everything said about it in
+// git is true of it in the cluster.
+func (c *Cluster) Drift(resources map[string]resource.Resource, syncSetName string, withDiff bool) ([]cluster.ResourceDrift, error) {
+	finder := &apiResourceFinder{client: c, lists: map[string]*meta_v1.APIResourceList{}}
+	var drifts []cluster.ResourceDrift
+	for _, res := range resources {
+		drift, err := c.resourceDrift(finder, res, withDiff)
+		if err != nil {
+			return nil, errors.Wrapf(err, "comparing %s", res.ResourceID())
+		}
+		drifts = append(drifts, drift)
+	}
+
+	if syncSetName != "" {
+		exported, err := c.ExportSyncSet(syncSetName)
+		if err != nil {
+			return nil, errors.Wrap(err, "exporting synced resources")
+		}
+		synced, err := kresource.ParseMultidoc(exported, "exported")
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing synced resources")
+		}
+		for id, res := range synced {
+			if _, ok := resources[id]; !ok {
+				drifts = append(drifts, cluster.ResourceDrift{ID: res.ResourceID(), Status: cluster.DriftExtraneous})
+			}
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].ID.String() < drifts[j].ID.String()
+	})
+	return drifts, nil
+}
+
+func (c *Cluster) resourceDrift(finder *apiResourceFinder, res resource.Resource, withDiff bool) (cluster.ResourceDrift, error) {
+	drift := cluster.ResourceDrift{ID: res.ResourceID(), Source: res.Source()}
+	desiredJSON, err := k8syaml.YAMLToJSON(res.Bytes())
+	if err != nil {
+		return drift, err
+	}
+	var desired map[string]interface{}
+	if err := json.Unmarshal(desiredJSON, &desired); err != nil {
+		return drift, err
+	}
+	apiVersion, _ := desired["apiVersion"].(string)
+	kind, _ := desired["kind"].(string)
+
+	apiResource, ok, err := finder.find(apiVersion, kind)
+	if err != nil {
+		return drift, err
+	}
+	if !ok {
+		// Without the kind defined, there can't be any such resource
+		drift.Status = cluster.DriftMissing
+		return drift, nil
+	}
+	ns, _, name := res.ResourceID().Components()
+	p := path.Join(apiPathFor(apiVersion), apiResource.Name, name)
+	if apiResource.Namespaced {
+		p = path.Join(apiPathFor(apiVersion), "namespaces", ns, apiResource.Name, name)
+	}
+	body, err := c.client.CoreV1Interface.RESTClient().Get().AbsPath(p).DoRaw()
+	if apierrors.IsNotFound(err) {
+		drift.Status = cluster.DriftMissing
+		return drift, nil
+	}
+	if err != nil {
+		return drift, err
+	}
+	var live map[string]interface{}
+	if err := json.Unmarshal(body, &live); err != nil {
+		return drift, err
+	}
+
+	// The status, if given, is not applied; and a Secret's stringData
+	// is written into its data, and not kept.
+	delete(desired, "status")
+	if kind == "Secret" {
+		delete(desired, "stringData")
+	}
+	fields := compareFields("", desired, live)
+	if len(fields) == 0 {
+		drift.Status = cluster.DriftInSync
+		return drift, nil
+	}
+	drift.Status = cluster.DriftModified
+	if withDiff {
+		if kind == "Secret" {
+			for i := range fields {
+				fields[i].Git, fields[i].Cluster = redacted, redacted
+			}
+		}
+		drift.Diff = fields
+	}
+	return drift, nil
+}
+
+// compareFields returns the fields that have a value in `desired`
+// and a different value (or none) in `live`, in order of path. Maps
+// are compared key by key, and lists item by item, if they are the
+// same length; otherwise, the list as a whole is different.
+func compareFields(path string, desired, live interface{}) []cluster.FieldDrift {
+	switch d := desired.(type) {
+	case nil:
+		// A null (or empty) field in a manifest is taken to mean
+		// nothing in particular, as when applying it.
+		return nil
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			break
+		}
+		var keys []string
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var fields []cluster.FieldDrift
+		for _, k := range keys {
+			fields = append(fields, compareFields(joinPath(path, k), d[k], l[k])...)
+		}
+		return fields
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			break
+		}
+		var fields []cluster.FieldDrift
+		for i := range d {
+			fields = append(fields, compareFields(fmt.Sprintf("%s[%d]", path, i), d[i], l[i])...)
+		}
+		return fields
+	default:
+		if reflect.DeepEqual(desired, live) {
+			return nil
+		}
+	}
+	return []cluster.FieldDrift{{Path: path, Git: jsonString(desired), Cluster: jsonString(live)}}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonString gives the value as JSON, or the empty string if it's
+// not there at all.
+func jsonString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(bytes)
+}
+
+// apiPathFor gives the path under which the API version given is
+// served; the core API is at a different path to the others.
+func apiPathFor(apiVersion string) string {
+	if !strings.Contains(apiVersion, "/") {
+		return path.Join("/api", apiVersion)
+	}
+	return path.Join("/apis", apiVersion)
+}
+
+// apiResourceFinder looks up the API resource for kinds, remembering
+// the resources of each API version it's asked about.
+type apiResourceFinder struct {
+	client *Cluster
+	lists  map[string]*meta_v1.APIResourceList
+}
+
+// find returns the API resource for the kind given, in the API
+// version given, and false if the server has no such kind.
+func (f *apiResourceFinder) find(apiVersion, kind string) (meta_v1.APIResource, bool, error) {
+	list, ok := f.lists[apiVersion]
+	if !ok {
+		var err error
+		list, err = f.client.client.ServerResourcesForGroupVersion(apiVersion)
+		if apierrors.IsNotFound(err) {
+			list = &meta_v1.APIResourceList{}
+		} else if err != nil {
+			return meta_v1.APIResource{}, false, errors.Wrapf(err, "getting API resources for %s", apiVersion)
+		}
+		f.lists[apiVersion] = list
+	}
+	for _, r := range list.APIResources {
+		if r.Kind == kind && !strings.Contains(r.Name, "/") {
+			return r, true, nil
+		}
+	}
+	return meta_v1.APIResource{}, false, nil
+}
@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux/cluster"
+)
+
+func TestCompareFields(t *testing.T) {
+	live := `{
+  "metadata": {"name": "helloworld", "namespace": "default", "uid": "abc", "labels": {"app": "helloworld"}},
+  "spec": {
+    "replicas": 2,
+    "template": {"spec": {"containers": [{"name": "greeter", "image": "quay.io/weaveworks/helloworld:master-a000001", "imagePullPolicy": "IfNotPresent"}]}}
+  },
+  "status": {"replicas": 2}
+}`
+
+	for _, c := range []struct {
+		name     string
+		desired  string
+		expected []cluster.FieldDrift
+	}{
+		{
+			name: "in sync, with defaults and status in the cluster",
+			desired: `{
+  "metadata": {"name": "helloworld", "namespace": "default", "labels": {"app": "helloworld"}},
+  "spec": {"replicas": 2, "template": {"spec": {"containers": [{"name": "greeter", "image": "quay.io/weaveworks/helloworld:master-a000001"}]}}}
+}`,
+		},
+		{
+			name: "null fields are passed over",
+			desired: `{
+  "metadata": {"name": "helloworld", "annotations": null},
+  "spec": {"replicas": 2}
+}`,
+		},
+		{
+			name: "different values",
+			desired: `{
+  "metadata": {"name": "helloworld"},
+  "spec": {"replicas": 3, "template": {"spec": {"containers": [{"name": "greeter", "image": "quay.io/weaveworks/helloworld:master-a000002"}]}}}
+}`,
+			expected: []cluster.FieldDrift{
+				{Path: "spec.replicas", Git: "3", Cluster: "2"},
+				{Path: "spec.template.spec.containers[0].image", Git: `"quay.io/weaveworks/helloworld:master-a000002"`, Cluster: `"quay.io/weaveworks/helloworld:master-a000001"`},
+			},
+		},
+		{
+			name: "absent in the cluster",
+			desired: `{
+  "metadata": {"name": "helloworld", "labels": {"team": "greeters"}}
+}`,
+			expected: []cluster.FieldDrift{
+				{Path: "metadata.labels.team", Git: `"greeters"`},
+			},
+		},
+		{
+			name: "lists of different lengths",
+			desired: `{
+  "spec": {"template": {"spec": {"containers": [{"name": "greeter"}, {"name": "sidecar"}]}}}
+}`,
+			expected: []cluster.FieldDrift{
+				{
+					Path:    "spec.template.spec.containers",
+					Git:     `[{"name":"greeter"},{"name":"sidecar"}]`,
+					Cluster: `[{"image":"quay.io/weaveworks/helloworld:master-a000001","imagePullPolicy":"IfNotPresent","name":"greeter"}]`,
+				},
+			},
+		},
+	} {
+		var desiredObj, liveObj interface{}
+		if err := json.Unmarshal([]byte(c.desired), &desiredObj); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(live), &liveObj); err != nil {
+			t.Fatal(err)
+		}
+		got := compareFields("", desiredObj, liveObj)
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %#v, got %#v", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestAPIPathFor(t *testing.T) {
+	for apiVersion, expected := range map[string]string{
+		"v1":                       "/api/v1",
+		"apps/v1":                  "/apis/apps/v1",
+		"flux.weave.works/v1beta1": "/apis/flux.weave.works/v1beta1",
+	} {
+		if got := apiPathFor(apiVersion); got != expected {
+			t.Errorf("expected %q for %s, got %q", expected, apiVersion, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+)
+
+// gcMarkLabel is the label put on resources applied as part of a
+// sync set. Its value is the mark made by makeGCMark.
+const gcMarkLabel = kresource.PolicyPrefix + "sync-gc-mark"
+
+// makeGCMark gives the mark for a resource in a sync set. It depends
+// on the resource ID as well as the sync set, so that a copy of a
+// resource (e.g., one made with `kubectl get -o yaml`, then renamed)
+// isn't taken to be part of the sync set. It's a hash, since label
+// values are limited in length and in the characters they can use.
+func makeGCMark(syncSetName, resourceID string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(syncSetName))
+	hasher.Write([]byte(resourceID))
+	return hex.EncodeToString(hasher.Sum(nil)[:24])
+}
+
+// markForGC gives the resource definition, labelled with the mark
+// given.
+func markForGC(def []byte, mark string) ([]byte, error) {
+	var obj map[interface{}]interface{}
+	if err := yaml.Unmarshal(def, &obj); err != nil {
+		return nil, errors.Wrap(err, "marking resource for garbage collection")
+	}
+	meta, ok := obj["metadata"].(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("marking resource for garbage collection: no metadata")
+	}
+	labels, ok := meta["labels"].(map[interface{}]interface{})
+	if !ok {
+		labels = map[interface{}]interface{}{}
+		meta["labels"] = labels
+	}
+	labels[gcMarkLabel] = mark
+	return yaml.Marshal(obj)
+}
+
+// ExportSyncSet exports the resources in the cluster, of any kind,
+// that are marked as applied in the sync set named. As with Export,
+// only the namespaces in the whitelist (if there is one) are looked
+// in.
+func (c *Cluster) ExportSyncSet(syncSetName string) ([]byte, error) {
+	// If some API groups can't be discovered, the resources of the
+	// others can still be exported; those missed won't be garbage
+	// collected this time around, which is the safe way to fail.
+	apiResources, err := c.client.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, errors.Wrap(err, "getting API resources")
+	}
+
+	namespaces, err := c.getAllowedNamespaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting namespaces")
+	}
+
+	var config bytes.Buffer
+	exported := map[string]bool{}
+	for _, list := range apiResources {
+		apiPath := "/apis/" + list.GroupVersion
+		if list.GroupVersion == "v1" {
+			apiPath = "/api/v1"
+		}
+		for _, res := range list.APIResources {
+			if strings.Contains(res.Name, "/") || !hasVerbs(res, "list", "delete") {
+				continue
+			}
+			// Everything can be listed at once, unless restricted to
+			// some namespaces; in which case, cluster-scoped
+			// resources are out of bounds.
+			var paths []string
+			switch {
+			case len(c.nsWhitelist) == 0:
+				paths = []string{path.Join(apiPath, res.Name)}
+			case res.Namespaced:
+				for _, ns := range namespaces {
+					paths = append(paths, path.Join(apiPath, "namespaces", ns.Name, res.Name))
+				}
+			}
+			for _, p := range paths {
+				body, err := c.client.CoreV1Interface.RESTClient().Get().AbsPath(p).Param("labelSelector", gcMarkLabel).DoRaw()
+				if err != nil {
+					if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+						continue
+					}
+					return nil, errors.Wrapf(err, "listing %s", res.Name)
+				}
+				if err := appendMarked(&config, exported, syncSetName, list.GroupVersion, res.Kind, body); err != nil {
+					return nil, errors.Wrapf(err, "exporting %s", res.Name)
+				}
+			}
+		}
+	}
+	return config.Bytes(), nil
+}
+
+// appendMarked appends the items in the list given that are marked
+// as being in the sync set, and not already exported (under another
+// API group, say), as YAML.
+func appendMarked(buffer *bytes.Buffer, exported map[string]bool, syncSetName, apiVersion, kind string, listJSON []byte) error {
+	var list struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(listJSON, &list); err != nil {
+		return err
+	}
+	for _, item := range list.Items {
+		var meta struct {
+			Name      string            `json:"name"`
+			Namespace string            `json:"namespace"`
+			Labels    map[string]string `json:"labels"`
+		}
+		metaJSON, err := json.Marshal(item["metadata"])
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(metaJSON, &meta); err != nil {
+			return err
+		}
+		// The ID is made as it would be from a manifest, since that is
+		// what's given when the resource is marked
+		ns := meta.Namespace
+		if ns == "" {
+			ns = "default"
+		}
+		id := flux.MakeResourceID(ns, kind, meta.Name).String()
+		if exported[id] || meta.Labels[gcMarkLabel] != makeGCMark(syncSetName, id) {
+			continue
+		}
+		exported[id] = true
+		// These are supplied by appendYAML
+		delete(item, "apiVersion")
+		delete(item, "kind")
+		if err := appendYAML(buffer, apiVersion, kind, item); err != nil {
+			return fmt.Errorf("marshalling %s to YAML: %s", id, err)
+		}
+	}
+	return nil
+}
+
+func hasVerbs(res meta_v1.APIResource, verbs ...string) bool {
+	for _, verb := range verbs {
+		found := false
+		for _, v := range res.Verbs {
+			if v == verb {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,578 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// ConfigFilename is the name of the file which, if present in a
+// directory of the repo, says how the manifests for that directory
+// (and those under it) are generated, and how updates are made to
+// them; e.g., by running `kustomize build`, or `helm template`.
+const ConfigFilename = ".flux.yaml"
+
+// commandTimeout is how long a generator or updater command is given
+// to run, before it's killed.
+const commandTimeout = time.Minute
+
+// commandWaitDelay is how long a command that's been killed is then
+// waited for, e.g., for processes it started to let go of its output,
+// before giving up on it.
+const commandWaitDelay = 5 * time.Second
+
+// configFile is the format of the file named by ConfigFilename:
+//
+//	version: 1
+//	commandUpdated:
+//	  generators:
+//	    - command: kustomize build .
+//	  updaters:
+//	    - containerImage:
+//	        command: ./update-image.sh
+//	      policy:
+//	        command: ./update-policy.sh
+//
+// The output of the generators is concatenated, and parsed as a
+// multidoc YAML stream. Updater commands are given the particulars
+// of an update in environment variables:
+//
+//   - FLUX_WORKLOAD: the ID of the workload to update,
+//     e.g., `default:deployment/helloworld`;
+//   - for image updates, FLUX_CONTAINER, FLUX_IMG and FLUX_TAG: the
+//     container to update, and the image name and tag to now use;
+//     for an image pinned by digest, FLUX_TAG is `<tag>@<digest>`
+//     (or `@<digest>` if there's no tag), so `$FLUX_IMG:$FLUX_TAG`
+//     is the image;
+//   - for policy updates, FLUX_POLICY and FLUX_POLICY_VALUE: the
+//     policy to set, and its value; or, in the case of policies to
+//     remove, FLUX_POLICY only.
+type configFile struct {
+	Version        int             `yaml:"version"`
+	CommandUpdated *commandUpdated `yaml:"commandUpdated"`
+}
+
+type commandUpdated struct {
+	Generators []command `yaml:"generators"`
+	Updaters   []updater `yaml:"updaters"`
+}
+
+type updater struct {
+	ContainerImage command `yaml:"containerImage"`
+	Policy         command `yaml:"policy"`
+}
+
+type command struct {
+	Command string `yaml:"command"`
+}
+
+func readConfigFile(path string) (*configFile, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config configFile
+	if err := yaml.Unmarshal(bytes, &config); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	if config.Version != 1 {
+		return nil, fmt.Errorf("%s: unsupported version %d; expected version: 1", path, config.Version)
+	}
+	if config.CommandUpdated == nil || len(config.CommandUpdated.Generators) == 0 {
+		return nil, fmt.Errorf("%s: expected at least one generator under commandUpdated", path)
+	}
+	for _, g := range config.CommandUpdated.Generators {
+		if g.Command == "" {
+			return nil, fmt.Errorf("%s: generator with no command", path)
+		}
+	}
+	return &config, nil
+}
+
+// A generator accounts for the manifests of a directory of the repo
+// (and those under it) by producing them, rather than them being read
+// from files; and makes updates to whatever they are produced from.
+type generator interface {
+	// configFile returns the path of the file in the directory given
+	// that says how its manifests are generated, if there is one
+	configFile(dir string) (string, bool)
+	// references returns the directories whose manifests the
+	// generation configured in the file given draws on, which
+	// therefore aren't generated in their own right
+	references(configPath string) ([]string, error)
+	// generate returns the manifests, as a multidoc YAML stream,
+	// running any commands in `dir`; which is the directory of the
+	// config file, in a copy of the repo
+	generate(configPath, dir string) ([]byte, error)
+	updateImage(configPath string, id flux.ResourceID, container string, ref image.Ref) error
+	updatePolicies(configPath string, res resource.Resource, update policy.Update) error
+}
+
+// generatedDir is a directory whose manifests are generated.
+type generatedDir struct {
+	dir, configPath string
+	gen             generator
+}
+
+// configIn returns the generated directory for dir, if any of the
+// generators (taken in order) is configured there.
+func configIn(gens []generator, dir string) (generatedDir, bool) {
+	for _, g := range gens {
+		if path, ok := g.configFile(dir); ok {
+			return generatedDir{dir: dir, configPath: path, gen: g}, true
+		}
+	}
+	return generatedDir{}, false
+}
+
+// findConfigDirs returns the directories at or under root that
+// contain a config file. Directories under those are not searched,
+// since the config file is taken to account for them.
+func findConfigDirs(gens []generator, root string) ([]generatedDir, error) {
+	var dirs []generatedDir
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrapf(err, "walking %q for config files", path)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if gd, ok := configIn(gens, path); ok {
+			dirs = append(dirs, gd)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// configDirAbove returns the closest directory at or above path, and
+// not above base, that contains a config file, if there is one.
+func configDirAbove(gens []generator, base, path string) (generatedDir, bool) {
+	base = filepath.Clean(base)
+	dir := filepath.Clean(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		if gd, ok := configIn(gens, dir); ok {
+			return gd, true
+		}
+		if dir == base || !strings.HasPrefix(dir, base+string(filepath.Separator)) {
+			return generatedDir{}, false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func hasConfigFile(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, ConfigFilename))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// loadGenerated looks for config files at, above or under the paths
+// given, and returns the resources both loaded from files and
+// generated as configured, along with the files skipped. Files, and
+// the output of generators, are parsed using the cache given.
+// Directories that other generated directories draw on (e.g.,
+// kustomize bases) are not generated themselves, nor read as files.
+func loadGenerated(base string, roots []string, strict bool, cache *kresource.Cache, gens []generator) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+	var plain []string
+	var gendirs []generatedDir
+	seen := map[string]bool{}
+	addConfigDir := func(gd generatedDir) {
+		if !seen[gd.dir] {
+			seen[gd.dir] = true
+			gendirs = append(gendirs, gd)
+		}
+	}
+	for _, root := range roots {
+		if gd, ok := configDirAbove(gens, base, root); ok {
+			addConfigDir(gd)
+			continue
+		}
+		dirs, err := findConfigDirs(gens, root)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, gd := range dirs {
+			addConfigDir(gd)
+		}
+		plain = append(plain, root)
+	}
+
+	var configDirs []string
+	referenced := map[string]bool{}
+	for _, gd := range gendirs {
+		configDirs = append(configDirs, gd.dir)
+		refs, err := gd.gen.references(gd.configPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ref := range refs {
+			referenced[filepath.Clean(ref)] = true
+		}
+	}
+
+	objs := map[string]resource.Resource{}
+	var skipped []cluster.SkippedFile
+	if len(plain) > 0 {
+		var err error
+		if objs, skipped, err = cache.LoadReporting(base, configDirs, plain, strict); err != nil {
+			return objs, skipped, err
+		}
+	}
+
+	// Generators are run in a copy of the repo, so that whatever they
+	// do to the files there (or to the git repository) goes no
+	// further.
+	var copied string
+	defer func() {
+		if copied != "" {
+			os.RemoveAll(copied)
+		}
+	}()
+	for _, gd := range gendirs {
+		if referenced[gd.dir] {
+			continue
+		}
+		path := gd.configPath
+		source, err := filepath.Rel(base, path)
+		if err != nil {
+			return objs, skipped, errors.Wrapf(err, "config file %q is not under base %q", path, base)
+		}
+		if copied == "" {
+			if copied, err = copyRepo(base); err != nil {
+				return objs, skipped, errors.Wrap(err, "copying repo to run generators in")
+			}
+		}
+		out, err := gd.gen.generate(path, filepath.Join(copied, filepath.Dir(source)))
+		if err != nil {
+			return objs, skipped, errors.Wrapf(err, "generating manifests as configured in %s", path)
+		}
+		generated, skippedGenerated, err := cache.ParseMultidocReporting(out, source, strict)
+		if err != nil {
+			return objs, skipped, errors.Wrapf(err, "parsing output of generators in %s", path)
+		}
+		skipped = append(skipped, skippedGenerated...)
+		for id, obj := range generated {
+			if alreadyDefined, ok := objs[id]; ok {
+				return objs, skipped, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
+			}
+			objs[id] = obj
+		}
+	}
+	return objs, skipped, nil
+}
+
+// commandGenerator generates manifests by running the commands given in
+// config files named by ConfigFilename.
+type commandGenerator struct{}
+
+func (commandGenerator) configFile(dir string) (string, bool) {
+	if hasConfigFile(dir) {
+		return filepath.Join(dir, ConfigFilename), true
+	}
+	return "", false
+}
+
+func (commandGenerator) references(configPath string) ([]string, error) {
+	return nil, nil
+}
+
+func (commandGenerator) generate(configPath, dir string) ([]byte, error) {
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return config.generate(dir)
+}
+
+// generate runs each generator in the directory given, and returns
+// the output of them all, as a multidoc YAML stream.
+func (c *configFile) generate(dir string) ([]byte, error) {
+	var out bytes.Buffer
+	for _, g := range c.CommandUpdated.Generators {
+		var stdout bytes.Buffer
+		if err := runCommand(dir, g.Command, nil, &stdout); err != nil {
+			return nil, err
+		}
+		out.WriteString("\n---\n")
+		out.Write(stdout.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// copyRepo copies the files of the repo at `base` (but not its
+// `.git` directory) to a new temporary directory, and returns the
+// path to that.
+func copyRepo(base string) (string, error) {
+	dst, err := ioutil.TempDir("", "flux-generate")
+	if err != nil {
+		return "", err
+	}
+	err = filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir() && info.Name() == ".git":
+			return filepath.SkipDir
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		os.RemoveAll(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// runCommand runs the command line given with `sh -c`, in the
+// directory given. The command gets only the environment entries
+// supplied, the daemon's PATH so it can find its tools, and an empty
+// HOME of its own, rather than the daemon's with the credentials
+// therein. It's run in its own process group so that, if it runs for
+// longer than commandTimeout, it can be killed along with anything it
+// started; after which it's waited for at most commandWaitDelay.
+func runCommand(dir, cmdline string, env []string, stdout *bytes.Buffer) error {
+	home, err := ioutil.TempDir("", "flux-command-home")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(home)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", cmdline)
+	cmd.Dir = dir
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + home}, env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "running command %q", cmdline)
+	}
+
+	// Go waits for the output to be copied before Wait returns; so
+	// it won't return while anything the command started and left
+	// behind still has hold of stdout or stderr. Hence the wait
+	// after killing it is limited, even if the goroutine is left
+	// waiting.
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+	case <-time.After(commandTimeout):
+		killProcessGroup(cmd)
+		select {
+		case <-done:
+		case <-time.After(commandWaitDelay):
+		}
+		return fmt.Errorf("command %q timed out after %s", cmdline, commandTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.Wrapf(err, "running command %q: %s", cmdline, msg)
+		}
+		return errors.Wrapf(err, "running command %q", cmdline)
+	}
+	return nil
+}
+
+// generators returns the ways of generating manifests that are
+// switched on, in the order in which they are looked for.
+func (m *Manifests) generators() []generator {
+	var gens []generator
+	if m.ManifestGeneration {
+		gens = append(gens, commandGenerator{})
+	}
+	if m.Kustomize {
+		gens = append(gens, kustomizeGenerator{})
+	}
+	return gens
+}
+
+// RunsCommands reports whether commands given in config files are
+// run, to generate manifests and update them.
+func (m *Manifests) RunsCommands() bool {
+	return m.ManifestGeneration
+}
+
+// generatorFor returns the generator configured by the file at the
+// path given, if it is such a file.
+func (m *Manifests) generatorFor(path string) (generator, bool) {
+	if gd, ok := configIn(m.generators(), filepath.Dir(path)); ok && gd.configPath == filepath.Clean(path) {
+		return gd.gen, true
+	}
+	return nil, false
+}
+
+// IsGenerated reports whether the path given, from which resources
+// were loaded, is a config file (or a kustomization); in which case
+// the resources were generated, and must be updated with
+// UpdateGeneratedImage and UpdateGeneratedPolicies.
+func (m *Manifests) IsGenerated(path string) bool {
+	_, ok := m.generatorFor(path)
+	return ok
+}
+
+// UpdateGeneratedImage sets the image for a container of a workload
+// generated as configured in the file given.
+func (m *Manifests) UpdateGeneratedImage(configPath string, id flux.ResourceID, container string, ref image.Ref) error {
+	gen, ok := m.generatorFor(configPath)
+	if !ok {
+		return fmt.Errorf("%s does not configure manifest generation", configPath)
+	}
+	return gen.updateImage(configPath, id, container, ref)
+}
+
+// UpdateGeneratedPolicies applies the policy update to a workload
+// generated as configured in the file given.
+func (m *Manifests) UpdateGeneratedPolicies(configPath string, res resource.Resource, update policy.Update) error {
+	gen, ok := m.generatorFor(configPath)
+	if !ok {
+		return fmt.Errorf("%s does not configure manifest generation", configPath)
+	}
+	return gen.updatePolicies(configPath, res, update)
+}
+
+// updateImage runs the image updaters in the config file given.
+func (commandGenerator) updateImage(configPath string, id flux.ResourceID, container string, ref image.Ref) error {
+	tag := ref.Tag
+	if ref.Digest != "" {
+		tag = tag + "@" + ref.Digest
+	}
+	env := []string{
+		"FLUX_WORKLOAD=" + id.String(),
+		"FLUX_CONTAINER=" + container,
+		"FLUX_IMG=" + ref.Name.String(),
+		"FLUX_TAG=" + tag,
+	}
+	return runUpdaters(configPath, func(u updater) command { return u.ContainerImage }, "containerImage", env)
+}
+
+// updatePolicies runs the policy updaters in the config file given,
+// once for each policy to be set or removed.
+func (commandGenerator) updatePolicies(configPath string, res resource.Resource, update policy.Update) error {
+	id := res.ResourceID()
+	add, del, err := expandTagAll(update, func() ([]resource.Container, error) {
+		return workloadContainers(res)
+	})
+	if err != nil {
+		return err
+	}
+
+	policyUpdater := func(u updater) command { return u.Policy }
+	for _, pol := range sortedPolicies(add) {
+		env := []string{
+			"FLUX_WORKLOAD=" + id.String(),
+			"FLUX_POLICY=" + string(pol),
+			"FLUX_POLICY_VALUE=" + add[pol],
+		}
+		if err := runUpdaters(configPath, policyUpdater, "policy", env); err != nil {
+			return err
+		}
+	}
+	for _, pol := range sortedPolicies(del) {
+		env := []string{
+			"FLUX_WORKLOAD=" + id.String(),
+			"FLUX_POLICY=" + string(pol),
+		}
+		if err := runUpdaters(configPath, policyUpdater, "policy", env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func workloadContainers(res resource.Resource) ([]resource.Container, error) {
+	workload, ok := res.(resource.Workload)
+	if !ok {
+		return nil, errors.New("resource " + res.ResourceID().String() + " does not have containers")
+	}
+	return workload.Containers(), nil
+}
+
+// runUpdaters runs the commands selected from each updater in the
+// config file, in the config file's directory. It's an error if no
+// updater has such a command.
+func runUpdaters(configPath string, which func(updater) command, name string, env []string) error {
+	config, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	var ran bool
+	for _, u := range config.CommandUpdated.Updaters {
+		c := which(u)
+		if c.Command == "" {
+			continue
+		}
+		var stdout bytes.Buffer
+		if err := runCommand(filepath.Dir(configPath), c.Command, env, &stdout); err != nil {
+			return errors.Wrapf(err, "running %s updater configured in %s", name, configPath)
+		}
+		ran = true
+	}
+	if !ran {
+		return fmt.Errorf("no %s updater is configured in %s", name, configPath)
+	}
+	return nil
+}
+
+func sortedPolicies(set policy.Set) []policy.Policy {
+	var pols []policy.Policy
+	for pol := range set {
+		pols = append(pols, pol)
+	}
+	sort.Slice(pols, func(i, j int) bool { return pols[i] < pols[j] })
+	return pols
+}
@@ -0,0 +1,238 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+const generatedConfig = `version: 1
+commandUpdated:
+  generators:
+    - command: sed "s/NAME/$(cat name)/" deploy.tmpl && touch generated.log
+  updaters:
+    - containerImage:
+        command: 'sed -i "s|image: .*|image: $FLUX_IMG:$FLUX_TAG|" deploy.tmpl'
+      policy:
+        command: echo "$FLUX_WORKLOAD $FLUX_POLICY ${FLUX_POLICY_VALUE-removed} ${HOME-nohome}" >> policies.log
+`
+
+const generatedTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: NAME
+  namespace: gen
+spec:
+  template:
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+const plainManifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: plain
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+func setupGenerated(t *testing.T) (string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	files := map[string]string{
+		"plain.yaml":              plainManifest,
+		"gen/" + ConfigFilename:   generatedConfig,
+		"gen/deploy.tmpl":         generatedTemplate,
+		"gen/name":                "generated\n",
+		"gen/patch.yaml":          "{{ not a manifest }}",
+		"gen/sub/also-patch.yaml": "{{ not a manifest }}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return dir, cleanup
+}
+
+func TestLoadGenerated(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{ManifestGeneration: true}
+	objs, err := m.LoadManifests(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected two resources, got %#v", objs)
+	}
+	if res, ok := objs["default:deployment/plain"]; !ok || res.Source() != "plain.yaml" {
+		t.Errorf("expected plain deployment from plain.yaml, got %#v", res)
+	}
+	res, ok := objs["gen:deployment/generated"]
+	if !ok {
+		t.Fatalf("expected generated deployment, got %#v", objs)
+	}
+	if res.Source() != filepath.Join("gen", ConfigFilename) {
+		t.Errorf("expected source of generated deployment to be the config file, got %q", res.Source())
+	}
+
+	// Loading a file in a directory with a config file gets the
+	// generated resources for the directory; e.g., when reporting
+	// on changed files
+	objs, err = m.LoadManifests(dir, filepath.Join(dir, "gen", "deploy.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs["gen:deployment/generated"]; !ok || len(objs) != 1 {
+		t.Errorf("expected only the generated deployment, got %#v", objs)
+	}
+}
+
+func TestLoadGeneratedDisabled(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+	if err := os.RemoveAll(filepath.Join(dir, "gen", "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "gen", "patch.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifests{}
+	objs, err := m.LoadManifests(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs["default:deployment/plain"]; !ok || len(objs) != 1 {
+		t.Errorf("expected only the plain deployment, got %#v", objs)
+	}
+	if m.IsGenerated(filepath.Join(dir, "gen", ConfigFilename)) {
+		t.Error("expected config file not to be treated as such when manifest generation is off")
+	}
+}
+
+func TestUpdateGenerated(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{ManifestGeneration: true}
+	configPath := filepath.Join(dir, "gen", ConfigFilename)
+	if !m.IsGenerated(configPath) {
+		t.Fatal("expected config file to be recognised as such")
+	}
+
+	id := flux.MustParseResourceID("gen:deployment/generated")
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-b000002")
+	if err := m.UpdateGeneratedImage(configPath, id, "hello", ref); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := m.LoadManifests(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := objs[id.String()].(resource.Workload).Containers()
+	if len(containers) != 1 || containers[0].Image.String() != ref.String() {
+		t.Errorf("expected image to be updated to %s, got %#v", ref, containers)
+	}
+
+	changed, err := cluster.UpdatePolicies(m, dir, id, policy.Update{
+		Add:    policy.Set{policy.TagAll: "glob:master-*"},
+		Remove: policy.Set{policy.Locked: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The policy updater in the test config doesn't actually change
+	// any annotations
+	if changed {
+		t.Error("expected policies to be reported unchanged")
+	}
+	log, err := ioutil.ReadFile(filepath.Join(dir, "gen", "policies.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"gen:deployment/generated tag.hello glob:master-*",
+		"gen:deployment/generated locked removed",
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(log)), "\n") {
+		// The command gets a HOME of its own, not the daemon's
+		i := strings.LastIndex(line, " ")
+		if home := line[i+1:]; home == "nohome" || home == os.Getenv("HOME") {
+			t.Errorf("expected the updater to be given a HOME of its own, got %q", home)
+		}
+		got = append(got, line[:i])
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected policy updater to be run with\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	// The generator is run in a copy of the repo
+	if _, err := os.Stat(filepath.Join(dir, "gen", "generated.log")); !os.IsNotExist(err) {
+		t.Errorf("expected the generator not to write to the repo, got %v", err)
+	}
+}
+
+func TestUpdateGeneratedDigest(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	m := &Manifests{ManifestGeneration: true}
+	configPath := filepath.Join(dir, "gen", ConfigFilename)
+	id := flux.MustParseResourceID("gen:deployment/generated")
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-b000002@sha256:" + strings.Repeat("a", 64))
+	if err := m.UpdateGeneratedImage(configPath, id, "hello", ref); err != nil {
+		t.Fatal(err)
+	}
+	objs, err := m.LoadManifests(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers := objs[id.String()].(resource.Workload).Containers()
+	if len(containers) != 1 || containers[0].Image.String() != ref.String() {
+		t.Errorf("expected image to be updated to %s, got %#v", ref, containers)
+	}
+}
+
+func TestUpdateGeneratedNoUpdater(t *testing.T) {
+	dir, cleanup := setupGenerated(t)
+	defer cleanup()
+
+	configPath := filepath.Join(dir, "gen", ConfigFilename)
+	config := `version: 1
+commandUpdated:
+  generators:
+    - command: sed "s/NAME/$(cat name)/" deploy.tmpl
+`
+	if err := ioutil.WriteFile(configPath, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifests{ManifestGeneration: true}
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-b000002")
+	if err := m.UpdateGeneratedImage(configPath, flux.MustParseResourceID("gen:deployment/generated"), "hello", ref); err == nil {
+		t.Error("expected an error when there is no image updater")
+	}
+}
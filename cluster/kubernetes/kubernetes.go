@@ -54,6 +54,16 @@ type apiObject struct {
 	resource.Resource
 	Kind     string   `yaml:"kind"`
 	Metadata metadata `yaml:"metadata"`
+	// The definition to apply, if it is not that of the resource
+	// (e.g., because the resource has been marked for GC)
+	payload []byte
+}
+
+func (o *apiObject) Bytes() []byte {
+	if o.payload != nil {
+		return o.payload
+	}
+	return o.Resource.Bytes()
 }
 
 // A convenience for getting an minimal object from some bytes.
@@ -155,9 +165,12 @@ func (c *Cluster) SomeControllers(ids []flux.ResourceID) (res []cluster.Controll
 	for _, id := range ids {
 		ns, kind, name := id.Components()
 
-		resourceKind, ok := resourceKinds[kind]
+		// Manifests may have containers in kinds we don't know how to
+		// look up in the cluster (e.g., a Job); we can't say those
+		// exist, so leave them out.
+		resourceKind, ok := kinds()[kind]
 		if !ok {
-			return nil, fmt.Errorf("Unsupported kind %v", kind)
+			continue
 		}
 
 		podController, err := resourceKind.getPodController(c, ns, name)
@@ -186,7 +199,7 @@ func (c *Cluster) AllControllers(namespace string) (res []cluster.Controller, er
 			continue
 		}
 
-		for kind, resourceKind := range resourceKinds {
+		for kind, resourceKind := range kinds() {
 			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
@@ -229,6 +242,9 @@ func (c *Cluster) Sync(spec cluster.SyncDef) error {
 				continue
 			}
 			obj, err := parseObj(stage.res.Bytes())
+			if err == nil && stage.cmd == "apply" && spec.SyncSet != "" {
+				obj.payload, err = markForGC(stage.res.Bytes(), makeGCMark(spec.SyncSet, stage.res.ResourceID().String()))
+			}
 			if err == nil {
 				obj.Resource = stage.res
 				cs.stage(stage.cmd, obj)
@@ -272,7 +288,7 @@ func (c *Cluster) Export() ([]byte, error) {
 			return nil, errors.Wrap(err, "marshalling namespace to YAML")
 		}
 
-		for _, resourceKind := range resourceKinds {
+		for _, resourceKind := range kinds() {
 			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
@@ -382,7 +398,7 @@ func (c *Cluster) ImagesToFetch() registry.ImageCreds {
 	}
 
 	for _, ns := range namespaces {
-		for kind, resourceKind := range resourceKinds {
+		for kind, resourceKind := range kinds() {
 			podControllers, err := resourceKind.getPodControllers(c, ns.Name)
 			if err != nil {
 				if se, ok := err.(*apierrors.StatusError); ok && se.ErrStatus.Reason == meta_v1.StatusReasonNotFound {
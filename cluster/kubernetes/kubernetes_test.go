@@ -2,10 +2,14 @@ package kubernetes
 
 import (
 	apiv1 "k8s.io/api/core/v1"
+	apiext "k8s.io/api/extensions/v1beta1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	fakekubernetes "k8s.io/client-go/kubernetes/fake"
 	"testing"
 	"reflect"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 )
 
 func newNamespace(name string) *apiv1.Namespace {
@@ -60,3 +64,50 @@ func TestGetAllowedNamespacesNamespacesSetDoesNotExist(t *testing.T) {
 func TestGetAllowedNamespacesNamespacesMultiple(t *testing.T) {
 	testGetAllowedNamespaces(t, []string{"default","hello","kube-system"}, []string{"default","kube-system"})
 }
+
+func TestSomeControllersSkipsUnsupportedKinds(t *testing.T) {
+	replicas := int32(1)
+	deployment := &apiext.Deployment{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "helloworld",
+			Namespace: "default",
+		},
+		Spec: apiext.DeploymentSpec{
+			Replicas: &replicas,
+		},
+	}
+	clientset := fakekubernetes.NewSimpleClientset(newNamespace("default"), deployment)
+	c := NewCluster(clientset, nil, nil, nil, nil, nil)
+
+	// A Job may be a workload in the repo, but isn't a kind the
+	// cluster is asked about; it shouldn't stop the others from
+	// being returned.
+	controllers, err := c.SomeControllers([]flux.ResourceID{
+		flux.MustParseResourceID("default:job/migrate"),
+		flux.MustParseResourceID("default:deployment/helloworld"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 || controllers[0].ID != flux.MustParseResourceID("default:deployment/helloworld") {
+		t.Errorf("expected only the deployment, got %+v", controllers)
+	}
+}
+
+func TestKindsIncludeAnnotated(t *testing.T) {
+	if _, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  annotations:
+    containers.flux.weave.works/main: spec.image
+spec:
+  image: example/widget:1.0
+`), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kinds()["widget"]; !ok {
+		t.Error("expected a kind with container path annotations to be looked for in the cluster")
+	}
+}
@@ -0,0 +1,189 @@
+package kubernetes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
+)
+
+// KustomizePatchFilename is the name of the strategic merge patch
+// that flux adds to a kustomization, to give the annotations for
+// policies of the resources it generates.
+const KustomizePatchFilename = "flux-patch.yaml"
+
+// kustomizationFilenames are the names of the files kustomize looks
+// for in a directory, in the order it looks for them.
+var kustomizationFilenames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// kustomizeCommand is run in the directory of a kustomization to
+// build it. It's a variable so that tests can do without kustomize.
+var kustomizeCommand = "kustomize build ."
+
+// kustomization is the part of a kustomization file that flux needs
+// to read.
+type kustomization struct {
+	Namespace  string   `yaml:"namespace"`
+	Resources  []string `yaml:"resources"`
+	Bases      []string `yaml:"bases"`
+	Components []string `yaml:"components"`
+}
+
+func readKustomization(path string) (*kustomization, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k kustomization
+	if err := yaml.Unmarshal(bytes, &k); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", path)
+	}
+	return &k, nil
+}
+
+// kustomizeGenerator generates the manifests for a directory with a
+// kustomization by running `kustomize build`. Images are updated by
+// editing the `images` transformer in the kustomization; and
+// policies, by editing a patch kept for the purpose next to it.
+//
+// A kustomization that's used as a base by another (that is, is
+// given among its `resources` or `bases`) is not built by itself,
+// since its resources will appear in those of the overlay; and it's
+// the overlay that's edited to update them.
+type kustomizeGenerator struct{}
+
+func (kustomizeGenerator) configFile(dir string) (string, bool) {
+	for _, name := range kustomizationFilenames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func (kustomizeGenerator) references(configPath string) ([]string, error) {
+	k, err := readKustomization(configPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(configPath)
+	var refs []string
+	for _, lists := range [][]string{k.Resources, k.Bases, k.Components} {
+		for _, entry := range lists {
+			// Entries may be files, or remote URLs, as well as
+			// directories; only the latter are of interest
+			path := filepath.Join(dir, entry)
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				refs = append(refs, path)
+			}
+		}
+	}
+	return refs, nil
+}
+
+func (kustomizeGenerator) generate(configPath, dir string) ([]byte, error) {
+	var out bytes.Buffer
+	if err := runCommand(dir, kustomizeCommand, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// updateImage sets the tag of the image in the kustomization's
+// `images`. This applies to every container using the image, in all
+// the resources of the kustomization; which is what kustomize allows.
+func (kustomizeGenerator) updateImage(configPath string, id flux.ResourceID, container string, ref image.Ref) error {
+	return updateFile(configPath, func(def []byte) ([]byte, error) {
+		return kresource.UpdateKustomizationImage(def, ref)
+	})
+}
+
+// updatePolicies sets or removes the annotations for the policies in
+// the patch named by KustomizePatchFilename, which is added to the
+// kustomization's `patchesStrategicMerge` if it's not already there.
+// Annotations given by the bases can be changed this way, but not
+// removed.
+func (kustomizeGenerator) updatePolicies(configPath string, res resource.Resource, update policy.Update) error {
+	add, del, err := expandTagAll(update, func() ([]resource.Container, error) {
+		return workloadContainers(res)
+	})
+	if err != nil {
+		return err
+	}
+	set := map[string]string{}
+	for pol, val := range add {
+		set[kresource.PolicyPrefix+string(pol)] = val
+	}
+	var remove []string
+	for pol := range del {
+		remove = append(remove, kresource.PolicyPrefix+string(pol))
+	}
+
+	var header struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}
+	if err := yaml.Unmarshal(res.Bytes(), &header); err != nil {
+		return errors.Wrapf(err, "decoding generated manifest for %s", res.ResourceID())
+	}
+
+	k, err := readKustomization(configPath)
+	if err != nil {
+		return err
+	}
+	// If the kustomization gives the namespace, the one generated
+	// may not be that of the resource the patch applies to; so leave
+	// it out, for the patch to apply whatever the namespace is
+	id := res.ResourceID()
+	if k.Namespace != "" {
+		_, kind, name := id.Components()
+		id = flux.MakeResourceID("default", kind, name)
+	}
+
+	patchPath := filepath.Join(filepath.Dir(configPath), KustomizePatchFilename)
+	patch, err := ioutil.ReadFile(patchPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	newPatch, err := kresource.UpdateKustomizePatch(patch, id, header.APIVersion, header.Kind, set, remove)
+	if err != nil {
+		return err
+	}
+	if string(newPatch) == string(patch) {
+		return nil
+	}
+	if err := ioutil.WriteFile(patchPath, newPatch, 0666); err != nil {
+		return err
+	}
+	return updateFile(configPath, func(def []byte) ([]byte, error) {
+		return kresource.AddKustomizationPatch(def, KustomizePatchFilename)
+	})
+}
+
+// updateFile applies f to the contents of the file at path, and
+// writes the result back, keeping the file's mode.
+func updateFile(path string, f func([]byte) ([]byte, error)) error {
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	newDef, err := f(def)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, newDef, info.Mode())
+}
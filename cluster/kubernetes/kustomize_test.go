@@ -0,0 +1,156 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
+)
+
+const kustomizeBase = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  namespace: NAMESPACE
+spec:
+  template:
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+// setupKustomize makes a repo with a base, an overlay using it, and a
+// plain manifest; and stands in for `kustomize build` with a command
+// that gives the base with the overlay's namespace.
+func setupKustomize(t *testing.T) (string, func()) {
+	dir, cleanup := testfiles.TempDir(t)
+	files := map[string]string{
+		"plain.yaml":                              plainManifest,
+		"base/kustomization.yaml":                 "resources:\n- deploy.yaml\n",
+		"base/deploy.yaml":                        kustomizeBase,
+		"overlays/prod/kustomization.yaml":        "namespace: prod\nresources:\n- ../../base\n",
+		"overlays/prod/replicas.yaml":             "{{ not a manifest }}",
+		"overlays/prod/sub/not-a-manifest.yaml":   "{{ not a manifest }}",
+		"overlays/staging/kustomization.yml":      "namespace: staging\nbases:\n- ../../base\n",
+		"overlays/staging/.flux.yaml":             "this is ignored, since manifest generation is off",
+		"overlays/staging/even/more/patches.yaml": "{{ not a manifest }}",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	oldCommand := kustomizeCommand
+	kustomizeCommand = `sed "s/NAMESPACE/$(basename $(pwd))/" ../../base/deploy.yaml`
+	return dir, func() {
+		kustomizeCommand = oldCommand
+		cleanup()
+	}
+}
+
+func TestLoadKustomize(t *testing.T) {
+	dir, cleanup := setupKustomize(t)
+	defer cleanup()
+
+	m := &Manifests{Kustomize: true}
+	objs, err := m.LoadManifests(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 3 {
+		t.Fatalf("expected three resources, got %#v", objs)
+	}
+	if res, ok := objs["default:deployment/plain"]; !ok || res.Source() != "plain.yaml" {
+		t.Errorf("expected plain deployment from plain.yaml, got %#v", res)
+	}
+	for ns, source := range map[string]string{
+		"prod":    "overlays/prod/kustomization.yaml",
+		"staging": "overlays/staging/kustomization.yml",
+	} {
+		res, ok := objs[ns+":deployment/helloworld"]
+		if !ok {
+			t.Fatalf("expected deployment from %s overlay, got %#v", ns, objs)
+		}
+		if res.Source() != source {
+			t.Errorf("expected source of %s deployment to be %s, got %q", ns, source, res.Source())
+		}
+		if !m.IsGenerated(filepath.Join(dir, source)) {
+			t.Errorf("expected %s to be recognised as a kustomization", source)
+		}
+	}
+
+	// Loading a file in an overlay gets the resources generated for it
+	objs, err = m.LoadManifests(dir, filepath.Join(dir, "overlays", "prod", "replicas.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs["prod:deployment/helloworld"]; !ok || len(objs) != 1 {
+		t.Errorf("expected only the prod deployment, got %#v", objs)
+	}
+}
+
+func TestUpdateKustomize(t *testing.T) {
+	dir, cleanup := setupKustomize(t)
+	defer cleanup()
+
+	m := &Manifests{Kustomize: true}
+	configPath := filepath.Join(dir, "overlays", "prod", "kustomization.yaml")
+	id := flux.MustParseResourceID("prod:deployment/helloworld")
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-b000002")
+	if err := m.UpdateGeneratedImage(configPath, id, "hello", ref); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, configPath, `namespace: prod
+resources:
+- ../../base
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-b000002
+`)
+
+	if _, err := cluster.UpdatePolicies(m, dir, id, policy.Update{
+		Add: policy.Set{policy.TagAll: "glob:master-*"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, filepath.Join(dir, "overlays", "prod", KustomizePatchFilename), `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/tag.hello: glob:master-*
+`)
+	expectFile(t, configPath, `namespace: prod
+resources:
+- ../../base
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-b000002
+patchesStrategicMerge:
+- flux-patch.yaml
+`)
+}
+
+func expectFile(t *testing.T, path, expected string) {
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(got)) != strings.TrimSpace(expected) {
+		t.Errorf("expected %s to be\n%s\ngot\n%s", filepath.Base(path), expected, got)
+	}
+}
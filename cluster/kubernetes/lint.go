@@ -0,0 +1,40 @@
+package kubernetes
+
+import (
+	"sort"
+
+	"github.com/weaveworks/flux/cluster"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+var _ cluster.Linter = &Manifests{}
+
+// Lint checks each of the resources given with `kresource.Lint`.
+func (m *Manifests) Lint(resources map[string]resource.Resource) []cluster.LintFinding {
+	var ids []string
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var findings []cluster.LintFinding
+	for _, id := range ids {
+		res := resources[id]
+		problems, err := kresource.Lint(res.Bytes())
+		if err != nil {
+			// This would have failed when the resource was loaded,
+			// so it's not expected
+			problems = []kresource.LintProblem{{Rule: "unparseable", Message: err.Error()}}
+		}
+		for _, p := range problems {
+			findings = append(findings, cluster.LintFinding{
+				ID:      res.ResourceID(),
+				Source:  res.Source(),
+				Rule:    p.Rule,
+				Message: p.Message,
+			})
+		}
+	}
+	return findings
+}
@@ -1,17 +1,83 @@
 package kubernetes
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
 )
 
 type Manifests struct {
+	// ManifestGeneration says whether to look for config files
+	// (named by ConfigFilename), and generate the manifests for
+	// their directories by running the commands therein. Otherwise,
+	// manifests are only ever read from files.
+	ManifestGeneration bool
+	// Kustomize says whether to build the directories that have a
+	// kustomization file (other than those used as bases by others)
+	// with `kustomize build`, and make updates to them by editing
+	// the kustomization. Otherwise, the files in those directories
+	// are read like any others.
+	Kustomize bool
+	// Strict says whether it's an error for a manifest file (that
+	// is, a file with a .yaml, .yml or .json extension) to have a
+	// document that isn't a resource. Otherwise, such documents are
+	// skipped, and reported as such by LoadManifestsReporting.
+	Strict bool
+	// Cache, if not nil, is used to avoid parsing again files that
+	// haven't changed since they were last loaded.
+	Cache *kresource.Cache
 }
 
+var _ cluster.SkipReporter = &Manifests{}
+
 func (c *Manifests) LoadManifests(base, first string, rest ...string) (map[string]resource.Resource, error) {
-	return kresource.Load(base, first, rest...)
+	objs, _, err := c.LoadManifestsReporting(base, first, rest...)
+	return objs, err
+}
+
+func (c *Manifests) LoadManifestsReporting(base, first string, rest ...string) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+	roots := append([]string{first}, rest...)
+	if gens := c.generators(); len(gens) > 0 {
+		return loadGenerated(base, roots, c.Strict, c.Cache, gens)
+	}
+	return c.Cache.LoadReporting(base, nil, roots, c.Strict)
+}
+
+var _ cluster.ManifestWalker = &Manifests{}
+
+// WalksManifests reports whether the manifests can be walked. They
+// can't if any are generated, since the commands would be run again
+// at each walk.
+func (c *Manifests) WalksManifests() bool {
+	return len(c.generators()) == 0
+}
+
+// WalkManifests calls `fn` with each resource in the manifests under
+// the paths given, reading them a document at a time. The cache isn't
+// used, since it would hold every resource.
+func (c *Manifests) WalkManifests(base string, paths []string, fn func(resource.Resource) error) ([]cluster.SkippedFile, error) {
+	if gens := c.generators(); len(gens) > 0 {
+		objs, skipped, err := loadGenerated(base, paths, c.Strict, c.Cache, gens)
+		if err != nil {
+			return skipped, err
+		}
+		for _, obj := range objs {
+			if err := fn(obj); err != nil {
+				return skipped, err
+			}
+		}
+		return skipped, nil
+	}
+	return kresource.WalkReporting(base, nil, paths, c.Strict, fn)
 }
 
 func (c *Manifests) ParseManifests(allDefs []byte) (map[string]resource.Resource, error) {
@@ -22,4 +88,47 @@ func (c *Manifests) UpdateImage(def []byte, id flux.ResourceID, container string
 	return updatePodController(def, id, container, image)
 }
 
+var _ cluster.ValuesUpdater = &Manifests{}
+var _ cluster.CommandRunner = &Manifests{}
+
+// UpdateValuesImage updates the image of a container of a
+// HelmRelease whose chart has values files in the repo. The fields of
+// the image are changed in the manifest, where they're given in its
+// values, or else added there to override the values files.
+func (c *Manifests) UpdateValuesImage(root, path string, id flux.ResourceID, container string, image image.Ref) (bool, error) {
+	def, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	paths, err := kresource.HelmValuesFiles(def, id)
+	if err != nil {
+		return false, err
+	}
+	var files [][]byte
+	for _, p := range paths {
+		content, err := ioutil.ReadFile(filepath.Join(root, p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		files = append(files, content)
+	}
+	if len(files) == 0 {
+		return false, nil
+	}
+
+	newDef, err := kresource.UpdateHelmValuesImage(def, files, id, container, image)
+	if err != nil {
+		return false, errors.Wrapf(err, "updating image of container %q in %s", container, id)
+	}
+	if !bytes.Equal(newDef, def) {
+		if err := ioutil.WriteFile(path, newDef, os.FileMode(0600)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
 // UpdatePolicies and ServicesWithPolicies in policies.go
@@ -1,8 +1,6 @@
 package kubernetes
 
 import (
-	"fmt"
-
 	"github.com/pkg/errors"
 	yaml "gopkg.in/yaml.v2"
 
@@ -13,20 +11,39 @@ import (
 )
 
 func (m *Manifests) UpdatePolicies(def []byte, id flux.ResourceID, update policy.Update) ([]byte, error) {
-	ns, kind, name := id.Components()
-	add, del := update.Add, update.Remove
+	add, del, err := expandTagAll(update, func() ([]resource.Container, error) {
+		return extractContainers(def, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	set := map[string]string{}
+	for pol, val := range add {
+		set[kresource.PolicyPrefix+string(pol)] = val
+	}
+	var remove []string
+	for pol, _ := range del {
+		remove = append(remove, kresource.PolicyPrefix+string(pol))
+	}
 
-	// We may be sent the pseudo-policy `policy.TagAll`, which means
-	// apply this filter to all containers. To do so, we need to know
-	// what all the containers are.
+	return kresource.UpdateAnnotations(def, id, set, remove)
+}
+
+// expandTagAll returns the policies to add and remove for the update
+// given. We may be sent the pseudo-policy `policy.TagAll`, which
+// means apply this filter to all containers. To do so, we need to
+// know what all the containers are, hence the func argument.
+func expandTagAll(update policy.Update, containers func() ([]resource.Container, error)) (policy.Set, policy.Set, error) {
+	add, del := update.Add, update.Remove
 	if tagAll, ok := update.Add.Get(policy.TagAll); ok {
 		add = add.Without(policy.TagAll)
-		containers, err := extractContainers(def, id)
+		cs, err := containers()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		for _, container := range containers {
+		for _, container := range cs {
 			if tagAll == "glob:*" {
 				del = del.Add(policy.TagPrefix(container.Name))
 			} else {
@@ -34,16 +51,7 @@ func (m *Manifests) UpdatePolicies(def []byte, id flux.ResourceID, update policy
 			}
 		}
 	}
-
-	args := []string{}
-	for pol, val := range add {
-		args = append(args, fmt.Sprintf("%s%s=%s", kresource.PolicyPrefix, pol, val))
-	}
-	for pol, _ := range del {
-		args = append(args, fmt.Sprintf("%s%s=", kresource.PolicyPrefix, pol))
-	}
-
-	return (KubeYAML{}).Annotate(def, ns, kind, name, args...)
+	return add, del, nil
 }
 
 type manifest struct {
@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"text/template"
 
@@ -159,3 +160,61 @@ func templToString(t *testing.T, templ *template.Template, data []string) string
 	}
 	return out.String()
 }
+
+// Policy updates should change the annotations of the resource in
+// question, and nothing else in the file; not even whitespace or
+// formatting that a YAML encoder would normalise.
+func TestUpdatePoliciesOnlyTouchesAnnotations(t *testing.T) {
+	in := `# Two deployments, in one file
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata: {name: first, annotations: {flux.weave.works/locked: "true"}}
+spec:
+  template:
+    spec:
+      containers: [{name: first, image: "nginx:1.15"}]
+---
+apiVersion:   extensions/v1beta1    # extra spacing
+kind: Deployment
+metadata:
+    name: second
+    labels: &labels
+        app: second
+    annotations:
+      prometheus.io/scrape: 'false'
+spec:
+    selector: {matchLabels: *labels}
+    template:
+        metadata: {labels: *labels}
+        spec:
+            containers:
+            -   name: second
+                image: >-
+                    nginx:1.15
+`
+	out, err := (&Manifests{}).UpdatePolicies([]byte(in), flux.MustParseResourceID("default:deployment/second"), policy.Update{
+		Add: policy.Set{policy.Automated: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The new annotation is quoted like those already there
+	expected := strings.Replace(in, `      prometheus.io/scrape: 'false'
+`, `      prometheus.io/scrape: 'false'
+      flux.weave.works/automated: 'true'
+`, 1)
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	out, err = (&Manifests{}).UpdatePolicies([]byte(in), flux.MustParseResourceID("default:deployment/first"), policy.Update{
+		Remove: policy.Set{policy.Locked: "true"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Replace(in, `metadata: {name: first, annotations: {flux.weave.works/locked: "true"}}`, `metadata: {name: first}`, 1)
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
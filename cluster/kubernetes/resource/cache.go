@@ -0,0 +1,185 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
+)
+
+// Cache keeps the outcome of parsing each manifest file, keyed by
+// its path and the hash of its content, so that a file that hasn't
+// changed since it was last loaded needn't be parsed again. There's
+// at most one entry per path; a file that has changed replaces the
+// entry for its earlier content, and one that's gone is evicted when
+// next the directory it was in is loaded.
+//
+// Each caller gets its own copy of the cached resources, since they
+// may be changed (e.g., by `SetContainerImage`).
+//
+// A nil *Cache is valid, and does no caching.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	hash    [sha256.Size]byte
+	strict  bool
+	objs    map[string]resource.Resource
+	skipped []cluster.SkippedFile
+}
+
+func NewCache() *Cache {
+	return &Cache{entries: map[string]cacheEntry{}}
+}
+
+// LoadReporting is like the package-level LoadReporting, but parses
+// each file with ParseMultidocReporting below. Entries for files
+// under the roots that weren't parsed (because they've been removed,
+// or are no longer manifests) are evicted.
+func (c *Cache) LoadReporting(base string, except, roots []string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+	if c == nil {
+		return LoadReporting(base, except, roots, strict)
+	}
+
+	parsed := map[string]bool{}
+	parse := func(multidoc []byte, source string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+		parsed[source] = true
+		return c.ParseMultidocReporting(multidoc, source, strict)
+	}
+	objs, skipped, err := loadReporting(base, except, roots, strict, parse)
+	if err != nil {
+		return objs, skipped, err
+	}
+
+	relative := func(paths []string) []string {
+		var rel []string
+		for _, path := range paths {
+			if r, err := filepath.Rel(base, path); err == nil {
+				rel = append(rel, r)
+			}
+		}
+		return rel
+	}
+	relRoots, relExcept := relative(roots), relative(except)
+	c.mu.Lock()
+	for source := range c.entries {
+		if !parsed[source] && underAny(source, relRoots) && !underAny(source, relExcept) {
+			delete(c.entries, source)
+		}
+	}
+	c.mu.Unlock()
+	return objs, skipped, nil
+}
+
+// underAny reports whether the path given is one of, or under one of,
+// the directories given.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMultidocReporting is like the package-level
+// ParseMultidocReporting, but returns the outcome of parsing the
+// same content from the same source before, if there's one in the
+// cache. Errors aren't cached, since the content won't be synced
+// until it's fixed.
+func (c *Cache) ParseMultidocReporting(multidoc []byte, source string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+	if c == nil {
+		return ParseMultidocReporting(multidoc, source, strict)
+	}
+
+	hash := sha256.Sum256(multidoc)
+	c.mu.Lock()
+	entry, ok := c.entries[source]
+	c.mu.Unlock()
+	if !ok || entry.hash != hash || entry.strict != strict {
+		objs, skipped, err := ParseMultidocReporting(multidoc, source, strict)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry = cacheEntry{hash: hash, strict: strict, objs: objs, skipped: skipped}
+		c.mu.Lock()
+		c.entries[source] = entry
+		c.mu.Unlock()
+	}
+
+	// The caller gets its own resources, so it can't disturb the entry
+	objs := make(map[string]resource.Resource, len(entry.objs))
+	for id, obj := range entry.objs {
+		objs[id] = copyResource(obj)
+	}
+	return objs, append([]cluster.SkippedFile(nil), entry.skipped...), nil
+}
+
+// copyResource returns a deep copy of the resource given; that is,
+// one which shares no maps, slices or pointers with it. Unexported
+// fields are copied as they are, other than by `copyUnexported`.
+func copyResource(res resource.Resource) resource.Resource {
+	return deepCopy(reflect.ValueOf(res)).Interface().(resource.Resource)
+}
+
+// unexportedCopier is implemented by resources with unexported fields
+// that may be changed in place, so they can be copied too.
+type unexportedCopier interface {
+	copyUnexported()
+}
+
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		if u, ok := c.Interface().(unexportedCopier); ok {
+			u.copyUnexported()
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k)))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,170 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const cachedDoc = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+`
+
+func TestCacheParse(t *testing.T) {
+	cache := NewCache()
+	id := "default:service/svc"
+
+	first, _, err := cache.ParseMultidocReporting([]byte(cachedDoc), "svc.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _, err := cache.ParseMultidocReporting([]byte(cachedDoc), "svc.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first[id] == nil || !reflect.DeepEqual(first[id], again[id]) {
+		t.Errorf("expected the same resource from unchanged content, got %#v and %#v", first[id], again[id])
+	}
+
+	// Removing from the result doesn't affect what's cached
+	delete(again, id)
+	again, _, err = cache.ParseMultidocReporting([]byte(cachedDoc), "svc.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again[id], first[id]) {
+		t.Errorf("expected cached resource to survive the result being changed")
+	}
+
+	changed, _, err := cache.ParseMultidocReporting([]byte(cachedDoc+"  namespace: other\n"), "svc.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := changed["other:service/svc"]; !ok {
+		t.Errorf("expected changed content to be parsed again, got %#v", changed)
+	}
+
+	// The same content from elsewhere has a different source, so is
+	// parsed separately
+	elsewhere, _, err := cache.ParseMultidocReporting([]byte(cachedDoc), "other.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elsewhere[id].Source() != "other.yaml" {
+		t.Errorf("expected source other.yaml, got %q", elsewhere[id].Source())
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var cache *Cache
+	objs, _, err := cache.ParseMultidocReporting([]byte(cachedDoc), "svc.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 {
+		t.Errorf("expected one resource, got %#v", objs)
+	}
+}
+
+const cachedWorkloads = `---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/automated: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: greeter
+        image: quay.io/weaveworks/helloworld:master-a000001
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: rollout
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: quay.io/weaveworks/helloworld:master-a000001
+`
+
+func TestCacheCopies(t *testing.T) {
+	cache := NewCache()
+	first, _, err := cache.ParseMultidocReporting([]byte(cachedWorkloads), "workloads.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the resources returned, as e.g., a release does,
+	// changes only those resources
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	for _, id := range []string{"default:deployment/helloworld", "default:rollout/rollout"} {
+		workload := first[id].(resource.Workload)
+		if err := workload.SetContainerImage(workload.Containers()[0].Name, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first["default:deployment/helloworld"].(*Deployment).Meta.Annotations["flux.weave.works/automated"] = "false"
+
+	again, _, err := cache.ParseMultidocReporting([]byte(cachedWorkloads), "workloads.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, res := range again {
+		if img := res.(resource.Workload).Containers()[0].Image.String(); img != "quay.io/weaveworks/helloworld:master-a000001" {
+			t.Errorf("expected image of %s to be as parsed, got %s", id, img)
+		}
+	}
+	if annotations := again["default:deployment/helloworld"].(*Deployment).Meta.Annotations; annotations["flux.weave.works/automated"] != "true" {
+		t.Errorf("expected annotations to be as parsed, got %v", annotations)
+	}
+}
+
+func TestCacheEvicts(t *testing.T) {
+	base, err := ioutil.TempDir("", "flux-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	for f, doc := range map[string]string{
+		"svc.yaml":   cachedDoc,
+		"other.yaml": cachedDoc + "  namespace: other\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(base, f), []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := NewCache()
+	if _, _, err := cache.LoadReporting(base, nil, []string{filepath.Join(base, "svc.yaml")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cache.LoadReporting(base, nil, []string{base}, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("expected an entry for each file, got %v", cache.entries)
+	}
+
+	if err := os.Remove(filepath.Join(base, "other.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cache.LoadReporting(base, nil, []string{base}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries["other.yaml"]; ok || len(cache.entries) != 1 {
+		t.Errorf("expected only the entry for the file removed to be evicted, got %v", cache.entries)
+	}
+}
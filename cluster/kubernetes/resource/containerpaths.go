@@ -0,0 +1,244 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+// ContainerPathAnnotationPrefix, followed by a container name, is the
+// annotation of a resource saying where in it the image for that
+// container is given, for kinds that don't have their images in a pod
+// spec (e.g., an operator's custom resource with `spec.image`, or
+// `spec.baseImage` and `spec.version`). The path is from the top of
+// the resource, and is given as for ImagePathAnnotationPrefix; it can
+// include list indices:
+//
+//	metadata:
+//	  annotations:
+//	    containers.flux.weave.works/prometheus: repository=spec.baseImage,tag=spec.version
+//	    containers.flux.weave.works/reloader: spec.sidecars[0].image
+//
+// If there are any such annotations, only the images they describe
+// are interpreted as containers; and they take precedence over any
+// container paths given for the kind.
+const ContainerPathAnnotationPrefix = "containers.flux.weave.works/"
+
+// KindContainerPaths says where the images are in resources of a
+// kind, for kinds unknown to flux. Each container is given a path (or
+// paths to the parts of the image) in the syntax of a container path
+// annotation.
+type KindContainerPaths struct {
+	// APIVersion is that of the kind, e.g., `monitoring.coreos.com/v1`.
+	// Resources in any version of the same API group are matched;
+	// this version is the one used to get them from the cluster.
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Containers map[string]string `yaml:"containers"`
+}
+
+// Group returns the API group of the kind, which is empty for the
+// core API.
+func (k KindContainerPaths) Group() string {
+	if i := strings.Index(k.APIVersion, "/"); i >= 0 {
+		return k.APIVersion[:i]
+	}
+	return ""
+}
+
+func (k KindContainerPaths) matches(apiVersion, kind string) bool {
+	return strings.EqualFold(k.Kind, kind) && k.Group() == (KindContainerPaths{APIVersion: apiVersion}).Group()
+}
+
+// fields returns the image fields given for each container, in order
+// of container name.
+func (k KindContainerPaths) fields() []imageFields {
+	var names []string
+	for name := range k.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result []imageFields
+	for _, name := range names {
+		if f, ok := parseImageFields(name, k.Containers[name]); ok {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+type containerPathsFile struct {
+	Kinds []KindContainerPaths `yaml:"kinds"`
+}
+
+// ParseContainerPaths parses the container paths for kinds, given in
+// YAML like
+//
+//	kinds:
+//	- apiVersion: monitoring.coreos.com/v1
+//	  kind: Prometheus
+//	  containers:
+//	    prometheus: repository=spec.baseImage,tag=spec.version
+//
+// It's an error to give paths for a kind flux already knows how to
+// find the images of.
+func ParseContainerPaths(data []byte) ([]KindContainerPaths, error) {
+	var file containerPathsFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing container paths: %s", err)
+	}
+	for i, k := range file.Kinds {
+		switch {
+		case k.APIVersion == "" || k.Kind == "":
+			return nil, fmt.Errorf("entry %d: both apiVersion and kind must be given", i+1)
+		case podSpecPaths[strings.ToLower(k.Kind)] != nil || isHelmReleaseKind(k.Kind):
+			return nil, fmt.Errorf("entry %d: the images of %s resources are found already, and cannot be given paths", i+1, k.Kind)
+		case len(k.Containers) == 0:
+			return nil, fmt.Errorf("entry %d (%s): no containers given", i+1, k.Kind)
+		}
+		for name, spec := range k.Containers {
+			if _, ok := parseImageFields(name, spec); !ok {
+				return nil, fmt.Errorf("entry %d (%s): container %q: expected a path, or paths given as repository=<path>,tag=<path>; got %q", i+1, k.Kind, name, spec)
+			}
+		}
+	}
+	return file.Kinds, nil
+}
+
+var (
+	containerPathsMu sync.RWMutex
+	containerPaths   []KindContainerPaths
+	annotatedKinds   []KindContainerPaths
+)
+
+// SetContainerPaths sets the container paths used for the kinds
+// given, when interpreting resources from then on. It's expected to
+// be called once, before loading any manifests; those already loaded
+// (and cached) are not interpreted again.
+func SetContainerPaths(kinds []KindContainerPaths) {
+	containerPathsMu.Lock()
+	defer containerPathsMu.Unlock()
+	containerPaths = kinds
+}
+
+// ContainerPaths returns the container paths set for kinds.
+func ContainerPaths() []KindContainerPaths {
+	containerPathsMu.RLock()
+	defer containerPathsMu.RUnlock()
+	return containerPaths
+}
+
+// AnnotatedKinds returns the kinds (without any container paths)
+// that have been seen in manifests with container path annotations,
+// which don't have container paths set. They come with the API
+// version given in the manifest, so they can be found in the cluster
+// like the kinds with container paths.
+func AnnotatedKinds() []KindContainerPaths {
+	containerPathsMu.RLock()
+	defer containerPathsMu.RUnlock()
+	return annotatedKinds
+}
+
+// noteAnnotatedKind records the kind of a resource with container
+// path annotations, if it's not already known of.
+func noteAnnotatedKind(apiVersion, kind string) {
+	containerPathsMu.Lock()
+	defer containerPathsMu.Unlock()
+	for _, k := range append(containerPaths, annotatedKinds...) {
+		if k.matches(apiVersion, kind) {
+			return
+		}
+	}
+	annotatedKinds = append(annotatedKinds, KindContainerPaths{APIVersion: apiVersion, Kind: kind})
+}
+
+// containerPathFields returns the fields of each of the images in a
+// resource, according to its container path annotations, or if it
+// has none, the container paths for its kind. If there are neither,
+// the result is empty.
+func containerPathFields(obj map[string]interface{}) []imageFields {
+	var result []imageFields
+	annotations, _ := asMap(lookupValue(obj, []string{"metadata", "annotations"}))
+	for _, k := range sorted_keys(annotations) {
+		if !strings.HasPrefix(k, ContainerPathAnnotationPrefix) {
+			continue
+		}
+		spec, _ := annotations[k].(string)
+		if f, ok := parseImageFields(strings.TrimPrefix(k, ContainerPathAnnotationPrefix), spec); ok {
+			result = append(result, f)
+		}
+	}
+	if len(result) == 0 {
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		for _, k := range ContainerPaths() {
+			if k.matches(apiVersion, kind) {
+				result = k.fields()
+				break
+			}
+		}
+	}
+	for i := range result {
+		result[i] = partsIfMap(obj, result[i])
+	}
+	return result
+}
+
+// FindPathContainers returns the containers of the resource given
+// (as decoded from a manifest, or from the API), if it has container
+// paths, either in its annotations or for its kind. The second result
+// is false if it has none. Those images that aren't present, or can't
+// be parsed, are left out.
+func FindPathContainers(obj map[string]interface{}) ([]resource.Container, bool) {
+	fields := containerPathFields(obj)
+	if len(fields) == 0 {
+		return nil, false
+	}
+	var containers []resource.Container
+	for _, f := range fields {
+		if ref, ok := f.ref(obj); ok {
+			containers = append(containers, resource.Container{Name: f.container, Image: ref})
+		}
+	}
+	return containers, true
+}
+
+// unmarshalPathsWorkload returns the resource given as a
+// GenericWorkload, if it has container paths.
+func unmarshalPathsWorkload(base baseObject, def []byte) (*GenericWorkload, bool) {
+	if podSpecPaths[strings.ToLower(base.Kind)] != nil {
+		return nil, false
+	}
+	// As with looking for pod specs, most resources can be passed
+	// over without parsing them again.
+	if !bytes.Contains(def, []byte(ContainerPathAnnotationPrefix)) && !hasContainerPathsForKind(base.Kind) {
+		return nil, false
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(def, &obj); err != nil {
+		return nil, false
+	}
+	containers, ok := FindPathContainers(obj)
+	if !ok {
+		return nil, false
+	}
+	if apiVersion, _ := obj["apiVersion"].(string); apiVersion != "" {
+		noteAnnotatedKind(apiVersion, base.Kind)
+	}
+	return &GenericWorkload{baseObject: base, containers: containers}, true
+}
+
+func hasContainerPathsForKind(kind string) bool {
+	for _, k := range ContainerPaths() {
+		if strings.EqualFold(k.Kind, kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const pathsResources = `---
+apiVersion: monitoring.coreos.com/v1
+kind: Prometheus
+metadata:
+  name: main
+  namespace: monitoring
+spec:
+  baseImage: quay.io/prometheus/prometheus
+  version: v2.7.1
+  replicas: 2
+---
+apiVersion: example.com/v1alpha1
+kind: Database
+metadata:
+  name: orders
+  annotations:
+    containers.flux.weave.works/db: spec.image
+    containers.flux.weave.works/backup: .spec.sidecars[0].image
+spec:
+  image: postgres:10.6 # keep this comment
+  sidecars:
+  - image: example/backup:1.0
+`
+
+func setTestContainerPaths(t *testing.T) {
+	paths, err := ParseContainerPaths([]byte(`
+kinds:
+- apiVersion: monitoring.coreos.com/v1beta1
+  kind: Prometheus
+  containers:
+    prometheus: repository=spec.baseImage,tag=spec.version
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetContainerPaths(paths)
+}
+
+func TestParseContainerPathsErrors(t *testing.T) {
+	for _, config := range []string{
+		`kinds: [{kind: Prometheus, containers: {prometheus: spec.image}}]`,
+		`kinds: [{apiVersion: apps/v1, kind: Deployment, containers: {app: spec.image}}]`,
+		`kinds: [{apiVersion: monitoring.coreos.com/v1, kind: Prometheus}]`,
+		`kinds: [{apiVersion: monitoring.coreos.com/v1, kind: Prometheus, containers: {prometheus: "tag=spec.version"}}]`,
+		`kinds: [{apiVersion: monitoring.coreos.com/v1, kind: Prometheus, paths: {}}]`,
+	} {
+		if _, err := ParseContainerPaths([]byte(config)); err == nil {
+			t.Errorf("expected error parsing %q", config)
+		}
+	}
+}
+
+func TestParsePathsWorkloads(t *testing.T) {
+	setTestContainerPaths(t)
+	defer SetContainerPaths(nil)
+
+	objs, err := ParseMultidoc([]byte(pathsResources), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[string][]string{
+		"monitoring:prometheus/main": {"prometheus=quay.io/prometheus/prometheus:v2.7.1"},
+		"default:database/orders":    {"backup=example/backup:1.0", "db=postgres:10.6"},
+	} {
+		workload, ok := objs[id].(resource.Workload)
+		if !ok {
+			t.Errorf("expected %s to be a workload, got %#v", id, objs[id])
+			continue
+		}
+		var containers []string
+		for _, c := range workload.Containers() {
+			containers = append(containers, c.Name+"="+c.Image.String())
+		}
+		if strings.Join(containers, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected containers %v for %s, got %v", expected, id, containers)
+		}
+	}
+
+	// A kind with annotations, but no paths, is remembered with its
+	// API version so it can be found in the cluster
+	var annotated []string
+	for _, k := range AnnotatedKinds() {
+		annotated = append(annotated, k.APIVersion+" "+k.Kind)
+	}
+	if strings.Join(annotated, ",") != "example.com/v1alpha1 Database" {
+		t.Errorf("expected only the database kind to be noted, got %v", annotated)
+	}
+
+	// Without paths for the kind, there's nothing to go on
+	SetContainerPaths(nil)
+	objs, err = ParseMultidoc([]byte(pathsResources), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs["monitoring:prometheus/main"].(resource.Workload); ok {
+		t.Error("expected prometheus not to be taken as a workload without container paths")
+	}
+}
+
+func TestUpdateImagePaths(t *testing.T) {
+	setTestContainerPaths(t)
+	defer SetContainerPaths(nil)
+
+	for _, c := range []struct {
+		id, container, image string
+		replacements         []string
+	}{
+		{"monitoring:prometheus/main", "prometheus", "quay.io/prometheus/prometheus:v2.8.0",
+			[]string{"version: v2.7.1", "version: v2.8.0"}},
+		{"default:database/orders", "db", "postgres:10.7",
+			[]string{"image: postgres:10.6", "image: postgres:10.7"}},
+		{"default:database/orders", "backup", "example/backup:1.1",
+			[]string{"image: example/backup:1.0", "image: example/backup:1.1"}},
+	} {
+		ref, err := image.ParseRef(c.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := UpdateImage([]byte(pathsResources), flux.MustParseResourceID(c.id), c.container, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.NewReplacer(c.replacements...).Replace(pathsResources)
+		if string(out) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+		}
+	}
+
+	ref, _ := image.ParseRef("postgres:10.7")
+	if _, err := UpdateImage([]byte(pathsResources), flux.MustParseResourceID("default:database/orders"), "cache", ref); err == nil {
+		t.Error("expected error updating a container without a path")
+	}
+}
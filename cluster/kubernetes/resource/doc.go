@@ -4,5 +4,12 @@
 // exported bytes into resource definitions to send to
 // `cluster.Sync`, and ignore much of the detail in "real" Kubernetes
 // objects.
+//
+// Loading manifests holds each resource, with the bytes of its
+// document, in memory until the load is done. Walking them (see
+// WalkReporting) reads each file a document at a time, and holds a
+// resource only while it's being looked at; this is how the daemon
+// syncs, when it can, so that the memory it needs doesn't grow with
+// the manifests but for their IDs.
 
 package resource
@@ -0,0 +1,1122 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	yaml3 "gopkg.in/yaml.v3"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+// The procedures in this file update manifests by editing the bytes
+// of the file in place, at the positions of the YAML nodes that need
+// to change, rather than by decoding the file, changing the decoded
+// value, and encoding it again. This means everything else --
+// comments, the order of keys, quoting and indentation, and any other
+// documents in the file -- is left exactly as it was, and the diffs
+// in commits are as small as they can be.
+
+// UpdateImage returns the manifest given, with the image of the
+// container named in the workload identified replaced with `ref`. If
+// the image is given by an alias, or through a merge key, it's the
+// node referred to that's changed (and so the change applies wherever
+// that node is used).
+func UpdateImage(def []byte, id flux.ResourceID, container string, ref image.Ref) ([]byte, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, err
+	}
+	res, err := src.findResource(id)
+	if err != nil {
+		return nil, err
+	}
+	var edits []edit
+	if isHelmReleaseKind(scalarValue(mappingValue(res, "kind"))) {
+		edits, err = src.helmImageEdits(res, container, ref)
+	} else if fields := nodeContainerPathFields(res); len(fields) > 0 {
+		edits, err = src.fieldEdits(res, fields, container, ref)
+		if err == nil && edits == nil {
+			err = fmt.Errorf("container %q has no path in %s", container, id)
+		}
+	} else {
+		edits, err = src.podImageEdits(res, container, ref)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "updating image of container %q in %s", container, id)
+	}
+	return src.apply(edits...), nil
+}
+
+// UpdateAnnotations returns the manifest given, with the annotations
+// in `set` given those values, and those in `remove` removed, in the
+// resource identified. Removing takes precedence over setting. New
+// annotations are added after existing ones; if there are no
+// annotations left, the `annotations` field is removed.
+func UpdateAnnotations(def []byte, id flux.ResourceID, set map[string]string, remove []string) ([]byte, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, err
+	}
+	res, err := src.findResource(id)
+	if err != nil {
+		return nil, err
+	}
+	edits, err := src.annotationEdits(res, set, remove)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updating annotations in %s", id)
+	}
+	return src.apply(edits...), nil
+}
+
+// HelmValuesFiles returns the paths of the values files of the
+// HelmRelease identified, relative to the root of the repo and lowest
+// precedence first; or nothing, for other kinds of resource. See
+// `HelmRelease` for which files these are.
+func HelmValuesFiles(def []byte, id flux.ResourceID) ([]string, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, err
+	}
+	res, err := src.findResource(id)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(scalarValue(mappingValue(res, "kind")), "HelmRelease") {
+		return nil, nil
+	}
+	var spec helmReleaseSpec
+	if node := mappingValue(res, "spec"); node != nil {
+		if err := node.Decode(&spec); err != nil {
+			return nil, errors.Wrapf(err, "reading spec of %s", id)
+		}
+	}
+	return spec.valuesFiles(), nil
+}
+
+// UpdateHelmValuesImage is like UpdateImage, for a HelmRelease with
+// values files; `files` has the content of those, in the order given
+// by HelmValuesFiles. Each field of the image is changed in the values
+// of the HelmRelease if it's given there, and otherwise, if it's given
+// in one of the files, is added to the values to override it. The
+// files themselves are left alone, since the chart they belong to may
+// be used by other HelmReleases. It returns the updated manifest.
+func UpdateHelmValuesImage(def []byte, files [][]byte, id flux.ResourceID, container string, ref image.Ref) ([]byte, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, err
+	}
+	res, err := src.findResource(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nodes of the values in the HelmRelease and in each file,
+	// highest precedence first
+	roots := []*yaml3.Node{mappingValue(mappingValue(res, "spec"), "values")}
+	for i := len(files) - 1; i >= 0; i-- {
+		fileSrc, err := parseSource(files[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing values file")
+		}
+		var root *yaml3.Node
+		if len(fileSrc.docs) > 0 {
+			root = fileSrc.docs[0]
+		}
+		roots = append(roots, root)
+	}
+	var values map[string]interface{}
+	for i := len(roots) - 1; i >= 0; i-- {
+		var v map[string]interface{}
+		if roots[i] != nil {
+			if err := roots[i].Decode(&v); err != nil {
+				return nil, errors.Wrap(err, "reading values")
+			}
+		}
+		values = mergeValues(values, v)
+	}
+	var annotations map[string]string
+	if node := mappingValue(mappingValue(res, "metadata"), "annotations"); node != nil {
+		_ = node.Decode(&annotations) // if they can't be decoded, assume none
+	}
+
+	var edits []edit
+	var overrides []assignment
+	found := false
+	for _, f := range findImageFields(annotations, values) {
+		if f.container != container {
+			continue
+		}
+		found = true
+		for _, a := range f.assignments(ref) {
+			var node *yaml3.Node
+			i := 0
+			for ; i < len(roots) && node == nil; i++ {
+				node = fieldNode(roots[i], a.path)
+			}
+			if node == nil {
+				return nil, fmt.Errorf("did not find field %s", strings.Join(a.path, "."))
+			}
+			if node.Value == a.value {
+				continue
+			}
+			if i > 1 {
+				overrides = append(overrides, a)
+				continue
+			}
+			e, err := src.replaceScalar(node, a.value)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, e)
+		}
+		break
+	}
+	if !found {
+		return nil, fmt.Errorf("did not find container %s in HelmRelease", container)
+	}
+	if len(overrides) > 0 {
+		e, err := src.overrideEdits(res, overrides)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e...)
+	}
+	return src.apply(edits...), nil
+}
+
+// overrideEdits returns the edits adding the assignments given to the
+// values of a HelmRelease. Mappings along the paths are added to where
+// they're given in the values, and created where they're not.
+func (s *source) overrideEdits(res *yaml3.Node, as []assignment) ([]edit, error) {
+	specKey, spec := explicitEntry(res, "spec")
+	if spec == nil || spec.Kind != yaml3.MappingNode {
+		return nil, errors.New("HelmRelease has no spec")
+	}
+	var values []pair
+	for _, a := range as {
+		values = withPair(values, a.path, a.value)
+	}
+	return s.addEntries(specKey, spec, []pair{{key: "values", nested: values}})
+}
+
+// addEntries returns the edits adding the pairs given to a mapping,
+// and to the mappings nested in it for nested pairs. Only entries
+// given in the mapping itself are added to, since changing a mapping
+// merged or aliased from elsewhere would change more than the values.
+func (s *source) addEntries(key, m *yaml3.Node, pairs []pair) ([]edit, error) {
+	var edits []edit
+	var add []pair
+	for _, p := range pairs {
+		k, v := explicitEntry(m, p.key)
+		switch {
+		case k == nil && mappingValue(m, p.key) == nil:
+			add = append(add, p)
+		case k != nil && p.nested != nil && v.Kind == yaml3.MappingNode:
+			es, err := s.addEntries(k, v, p.nested)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, es...)
+		default:
+			return nil, fmt.Errorf("unable to override %q in the values of the HelmRelease", p.key)
+		}
+	}
+	// These go after the edits to nested mappings, in case both are
+	// inserted at the same place
+	if len(add) > 0 {
+		if m.Style&yaml3.FlowStyle == 0 && len(m.Content) == 0 {
+			return nil, fmt.Errorf("unable to add to %q in the manifest", key.Value)
+		}
+		e, err := s.appendEntries(key, m, false, add...)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, nil
+}
+
+// explicitEntry is like mappingEntry, but finds only entries given in
+// the mapping itself, rather than merged into it.
+func explicitEntry(m *yaml3.Node, key string) (*yaml3.Node, *yaml3.Node) {
+	if m == nil || m.Kind != yaml3.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k := m.Content[i]; !isMergeKey(k) && k.Value == key {
+			return k, m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// withPair returns the pairs given with a value added at the path,
+// in nested pairs for all but the last key.
+func withPair(pairs []pair, path []string, value string) []pair {
+	if len(path) == 1 {
+		return append(pairs, pair{key: path[0], value: value})
+	}
+	for i := range pairs {
+		if pairs[i].key == path[0] && pairs[i].nested != nil {
+			pairs[i].nested = withPair(pairs[i].nested, path[1:], value)
+			return pairs
+		}
+	}
+	return append(pairs, pair{key: path[0], nested: withPair(nil, path[1:], value)})
+}
+
+// ---
+
+// source is a manifest file along with its parsed documents, and an
+// index of the lines in it so that node positions (which are given
+// as line and column) can be turned into byte offsets.
+type source struct {
+	bytes []byte
+	docs  []*yaml3.Node
+	// whether the file is JSON, in which case anything written into
+	// it must be JSON too
+	json bool
+	// the byte offset of the start of each line; line N (counting
+	// from 1, as in node positions) starts at lines[N-1]
+	lines []int
+}
+
+func parseSource(def []byte) (*source, error) {
+	src := &source{bytes: def, lines: []int{0}}
+	if trimmed := bytes.TrimSpace(def); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		src.json = true
+	}
+	for i, b := range def {
+		if b == '\n' {
+			src.lines = append(src.lines, i+1)
+		}
+	}
+	dec := yaml3.NewDecoder(bytes.NewReader(def))
+	for {
+		var doc yaml3.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing manifest for update")
+		}
+		if len(doc.Content) > 0 {
+			src.docs = append(src.docs, doc.Content[0])
+		}
+	}
+	return src, nil
+}
+
+// findResource finds the mapping node of the resource identified, in
+// any of the documents in the file.
+func (s *source) findResource(id flux.ResourceID) (*yaml3.Node, error) {
+	if res := findResource(s.docs, id); res != nil {
+		return res, nil
+	}
+	return nil, fmt.Errorf("resource %s not found in manifest", id)
+}
+
+func findResource(nodes []*yaml3.Node, id flux.ResourceID) *yaml3.Node {
+	ns, kind, name := id.Components()
+	for _, n := range nodes {
+		n = resolve(n)
+		if n == nil || n.Kind != yaml3.MappingNode {
+			continue
+		}
+		k := scalarValue(mappingValue(n, "kind"))
+		items := resolve(mappingValue(n, "items"))
+		if isList(scalarValue(mappingValue(n, "apiVersion")), k, items != nil && items.Kind == yaml3.SequenceNode) {
+			if res := findResource(items.Content, id); res != nil {
+				return res
+			}
+			continue
+		}
+		meta := mappingValue(n, "metadata")
+		resNS := scalarValue(mappingValue(meta, "namespace"))
+		if resNS == "" {
+			resNS = "default"
+		}
+		if strings.EqualFold(k, kind) && scalarValue(mappingValue(meta, "name")) == name && resNS == ns {
+			return n
+		}
+	}
+	return nil
+}
+
+// podImageEdits returns the edit to change the image of the
+// container named, in the pod spec(s) of a workload.
+func (s *source) podImageEdits(res *yaml3.Node, container string, ref image.Ref) ([]edit, error) {
+	podSpecs := findPodSpecs(res)
+	if len(podSpecs) == 0 {
+		return nil, ErrNoPodSpec
+	}
+	for _, podSpec := range podSpecs {
+		for _, c := range podSpecContainers(podSpec) {
+			if scalarValue(mappingValue(c, "name")) == container {
+				e, err := s.replaceScalar(mappingValue(c, "image"), ref.String())
+				return []edit{e}, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("container %q not found in workload", container)
+}
+
+// helmImageEdits returns the edits to change the image of the
+// container named in a FluxHelmRelease or HelmRelease, which is in
+// its values, as interpreted by `FindFluxHelmReleaseContainers`. That
+// may mean changing more than one field, if the image is given in
+// parts.
+func (s *source) helmImageEdits(res *yaml3.Node, container string, ref image.Ref) ([]edit, error) {
+	valuesNode := mappingValue(mappingValue(res, "spec"), "values")
+	var values map[string]interface{}
+	if valuesNode != nil {
+		if err := valuesNode.Decode(&values); err != nil {
+			return nil, err
+		}
+	}
+	var annotations map[string]string
+	if node := mappingValue(mappingValue(res, "metadata"), "annotations"); node != nil {
+		_ = node.Decode(&annotations) // if they can't be decoded, assume none
+	}
+
+	edits, err := s.fieldEdits(valuesNode, findImageFields(annotations, values), container, ref)
+	if err != nil {
+		return nil, err
+	}
+	if edits == nil {
+		return nil, fmt.Errorf("did not find container %s in %s", container, scalarValue(mappingValue(res, "kind")))
+	}
+	return edits, nil
+}
+
+// fieldEdits returns the edits to change the image of the container
+// named to `ref`, with the fields for each container given by paths
+// from the node `root`. For a container that's found, the result is
+// not nil, though it may be empty if the fields have those values
+// already.
+func (s *source) fieldEdits(root *yaml3.Node, fields []imageFields, container string, ref image.Ref) ([]edit, error) {
+	for _, f := range fields {
+		if f.container != container {
+			continue
+		}
+		edits := []edit{}
+		for _, a := range f.assignments(ref) {
+			node := fieldNode(root, a.path)
+			if node == nil {
+				return nil, fmt.Errorf("did not find field %s", strings.Join(a.path, "."))
+			}
+			if node.Value == a.value {
+				continue
+			}
+			e, err := s.replaceScalar(node, a.value)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, e)
+		}
+		return edits, nil
+	}
+	return nil, nil
+}
+
+// fieldNode returns the scalar node at the path given from `root`,
+// or nil if there isn't one.
+func fieldNode(root *yaml3.Node, path []string) *yaml3.Node {
+	node := root
+	for _, k := range path {
+		node = pathValue(node, k)
+	}
+	if node == nil || node.Kind != yaml3.ScalarNode {
+		return nil
+	}
+	return node
+}
+
+// nodeContainerPathFields returns the image fields of a resource
+// given by container paths (see `containerPathFields`), if it has
+// any. As when loading resources, kinds with a known pod spec are
+// never interpreted by container paths.
+func nodeContainerPathFields(res *yaml3.Node) []imageFields {
+	kind := scalarValue(mappingValue(res, "kind"))
+	if podSpecPaths[strings.ToLower(kind)] != nil {
+		return nil
+	}
+	if !hasContainerPathsForKind(kind) {
+		var annotations map[string]string
+		if node := mappingValue(mappingValue(res, "metadata"), "annotations"); node != nil {
+			_ = node.Decode(&annotations)
+		}
+		found := false
+		for k := range annotations {
+			found = found || strings.HasPrefix(k, ContainerPathAnnotationPrefix)
+		}
+		if !found {
+			return nil
+		}
+	}
+	var obj map[string]interface{}
+	if err := res.Decode(&obj); err != nil {
+		return nil
+	}
+	return containerPathFields(obj)
+}
+
+// mappingEntry returns the key and value nodes for the key given in
+// a mapping node, or nils if the node is not a mapping or doesn't
+// have the key. Aliases are followed, so the value returned is the
+// node actually in the file; and keys may come from merged mappings
+// (`<<: *anchor`), though keys given explicitly take precedence, as
+// do earlier merged mappings over later ones.
+func mappingEntry(m *yaml3.Node, key string) (*yaml3.Node, *yaml3.Node) {
+	m = resolve(m)
+	if m == nil || m.Kind != yaml3.MappingNode {
+		return nil, nil
+	}
+	var merges []*yaml3.Node
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		k := m.Content[i]
+		if isMergeKey(k) {
+			merges = append(merges, resolve(m.Content[i+1]))
+			continue
+		}
+		if k.Value == key {
+			return k, resolve(m.Content[i+1])
+		}
+	}
+	for _, merge := range merges {
+		sources := []*yaml3.Node{merge}
+		if merge.Kind == yaml3.SequenceNode {
+			sources = merge.Content
+		}
+		for _, source := range sources {
+			if k, v := mappingEntry(source, key); k != nil {
+				return k, v
+			}
+		}
+	}
+	return nil, nil
+}
+
+// resolve returns the node an alias refers to, or the node itself if
+// it's not an alias.
+func resolve(n *yaml3.Node) *yaml3.Node {
+	for n != nil && n.Kind == yaml3.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func isMergeKey(n *yaml3.Node) bool {
+	return n.Kind == yaml3.ScalarNode && n.Value == "<<" && (n.Tag == "!!merge" || n.Tag == "")
+}
+
+// pathValue returns the value for the key given in a mapping node,
+// or the item at the index given in a sequence node; or nil if there
+// isn't one.
+func pathValue(n *yaml3.Node, key string) *yaml3.Node {
+	if n = resolve(n); n != nil && n.Kind == yaml3.SequenceNode {
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(n.Content) {
+			return resolve(n.Content[i])
+		}
+		return nil
+	}
+	return mappingValue(n, key)
+}
+
+func mappingValue(m *yaml3.Node, key string) *yaml3.Node {
+	_, v := mappingEntry(m, key)
+	return v
+}
+
+func scalarValue(n *yaml3.Node) string {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml3.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
+
+// ---
+
+// edit is a replacement of the bytes [start, end) with text; if
+// start == end, it's an insertion.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// apply makes the edits given, which must not overlap, to the source
+// bytes, and returns the result.
+func (s *source) apply(edits ...edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var out bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		out.Write(s.bytes[last:e.start])
+		out.WriteString(e.text)
+		last = e.end
+	}
+	out.Write(s.bytes[last:])
+	return out.Bytes()
+}
+
+// offset returns the byte offset of the position given as a line and
+// column, each counted from 1. Columns count characters rather than
+// bytes.
+func (s *source) offset(line, column int) int {
+	off := s.lineStart(line)
+	for col := 1; col < column && off < len(s.bytes); col++ {
+		_, size := utf8.DecodeRune(s.bytes[off:])
+		off += size
+	}
+	return off
+}
+
+// lineStart returns the byte offset of the start of the line given,
+// or the end of the file if there's no such line.
+func (s *source) lineStart(line int) int {
+	if line-1 < len(s.lines) {
+		return s.lines[line-1]
+	}
+	return len(s.bytes)
+}
+
+// lineText returns the line given, without its line ending.
+func (s *source) lineText(line int) string {
+	start, end := s.lineStart(line), s.lineStart(line+1)
+	return strings.TrimRight(string(s.bytes[start:end]), "\r\n")
+}
+
+func (s *source) lineCount() int {
+	n := len(s.lines)
+	if s.lines[n-1] == len(s.bytes) {
+		n-- // the last "line" is empty, after a final newline
+	}
+	return n
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// entryEndLine returns the last line of a block mapping entry given
+// its key and value nodes. The entry extends over the lines following
+// the key that are indented further than it, or, if the value is a
+// block sequence, equally indented items; blank lines and comments
+// between those are included, but not trailing ones.
+func (s *source) entryEndLine(key, value *yaml3.Node) int {
+	keyIndent := key.Column - 1
+	seq := value.Kind == yaml3.SequenceNode && value.Style&yaml3.FlowStyle == 0
+	end := key.Line
+	for line := key.Line + 1; line <= s.lineCount(); line++ {
+		text := s.lineText(line)
+		trimmed := strings.TrimSpace(text)
+		indent := indentOf(text)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(text, "---") || strings.HasPrefix(text, "..."):
+			return end
+		case strings.HasPrefix(trimmed, "#"):
+			if indent <= keyIndent {
+				return end
+			}
+			continue
+		case indent > keyIndent:
+			end = line
+		case seq && indent == keyIndent && (trimmed == "-" || strings.HasPrefix(trimmed, "- ")):
+			end = line
+		default:
+			return end
+		}
+	}
+	return end
+}
+
+// entryLines returns the byte range of the whole lines given, which
+// may be removed or inserted before.
+func (s *source) entryLines(first, last int) (int, int) {
+	return s.lineStart(first), s.lineStart(last + 1)
+}
+
+// removable reports whether a mapping entry can be removed by
+// removing its lines, i.e., the key begins its line.
+func (s *source) removable(key *yaml3.Node) bool {
+	return indentOf(s.lineText(key.Line)) == key.Column-1
+}
+
+// insertLines returns an edit inserting the lines given before the
+// line given (or at the end of the file).
+func (s *source) insertLines(before int, lines ...string) edit {
+	at := s.lineStart(before)
+	text := strings.Join(lines, "\n") + "\n"
+	if at == len(s.bytes) && at > 0 && s.bytes[at-1] != '\n' {
+		text = "\n" + text
+	}
+	return edit{start: at, end: at, text: text}
+}
+
+// scalarEnd returns the offset of the end of a scalar node that
+// starts at the offset given.
+func (s *source) scalarEnd(n *yaml3.Node, start int) (int, error) {
+	b := s.bytes
+	switch quoting(n) {
+	case yaml3.SingleQuotedStyle:
+		for i := start + 1; i < len(b); i++ {
+			if b[i] == '\'' {
+				if i+1 < len(b) && b[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case yaml3.DoubleQuotedStyle:
+		for i := start + 1; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+	case 0:
+		// A plain scalar on a single line is exactly its value
+		if end := start + len(n.Value); end <= len(b) && string(b[start:end]) == n.Value {
+			return end, nil
+		}
+	}
+	return 0, errors.New("unable to locate the value in the manifest")
+}
+
+// replaceScalar returns an edit replacing the scalar node given with
+// the value given, keeping the quoting style of the original if
+// possible.
+func (s *source) replaceScalar(n *yaml3.Node, value string) (edit, error) {
+	if n.Kind != yaml3.ScalarNode {
+		return edit{}, errors.New("value to replace is not a scalar")
+	}
+	start := s.start(n)
+	end, err := s.scalarEnd(n, start)
+	if err != nil {
+		return edit{}, err
+	}
+	return edit{start: start, end: end, text: s.format(value, quoting(n), false)}, nil
+}
+
+// start returns the offset at which the content of a node starts;
+// i.e., after any anchor (`&name`) or tag (`!!str`), which are left in
+// place when the node is replaced.
+func (s *source) start(n *yaml3.Node) int {
+	off := s.offset(n.Line, n.Column)
+	for off < len(s.bytes) && (s.bytes[off] == '&' || s.bytes[off] == '!') {
+		for off < len(s.bytes) && !isSpace(s.bytes[off]) {
+			off++
+		}
+		for off < len(s.bytes) && isSpace(s.bytes[off]) {
+			off++
+		}
+	}
+	return off
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t'
+}
+
+// quoting returns the style of a scalar, disregarding whether it
+// has a tag.
+func quoting(n *yaml3.Node) yaml3.Style {
+	return n.Style &^ yaml3.TaggedStyle
+}
+
+// format returns the value formatted to go in the file, given the
+// style of the value it replaces (if any), and whether it will be in
+// a flow collection (where plain scalars can't include indicators
+// like `,`).
+func (s *source) format(value string, style yaml3.Style, flow bool) string {
+	if s.json {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(value) // strings always encode
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+	if flow && style == 0 && strings.ContainsAny(value, ",[]{}") {
+		style = yaml3.SingleQuotedStyle
+	}
+	return formatScalar(value, style)
+}
+
+// formatScalar returns the value as YAML in the style given, unless
+// that wouldn't read back as the same string, in which case in a
+// quoted style.
+func formatScalar(value string, style yaml3.Style) string {
+	switch {
+	case strings.ContainsAny(value, "\n\t") || style == yaml3.DoubleQuotedStyle:
+		return strconv.Quote(value)
+	case style == yaml3.SingleQuotedStyle || !plainSafe(value):
+		return "'" + strings.Replace(value, "'", "''", -1) + "'"
+	}
+	return value
+}
+
+// plainSafe reports whether a string can be written as a plain
+// scalar, and be read back as the same string.
+func plainSafe(value string) bool {
+	if value == "" || strings.TrimSpace(value) != value ||
+		strings.ContainsAny(value[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(value, ": ") || strings.Contains(value, " #") ||
+		strings.HasSuffix(value, ":") {
+		return false
+	}
+	var v interface{}
+	if err := yaml3.Unmarshal([]byte(value), &v); err != nil {
+		return false
+	}
+	str, ok := v.(string)
+	return ok && str == value
+}
+
+// ---
+
+// annotationEdits returns the edits needed to update the annotations
+// of the resource given.
+func (s *source) annotationEdits(res *yaml3.Node, set map[string]string, remove []string) ([]edit, error) {
+	metaKey, meta := mappingEntry(res, "metadata")
+	if meta == nil || meta.Kind != yaml3.MappingNode || len(meta.Content) == 0 {
+		return nil, errors.New("resource has no metadata")
+	}
+
+	removed := map[string]bool{}
+	for _, k := range remove {
+		removed[k] = true
+	}
+	add := map[string]string{}
+	for k, v := range set {
+		if !removed[k] {
+			add[k] = v
+		}
+	}
+
+	annotationsKey, annotationsValue := mappingEntry(meta, "annotations")
+	annotations := annotationsValue
+	if annotations != nil && annotations.Tag == "!!null" {
+		annotations = nil // e.g., `annotations:` with nothing after
+	}
+	if annotations != nil && annotations.Kind != yaml3.MappingNode {
+		return nil, errors.New("annotations are not a mapping")
+	}
+
+	// Work out what will be left, to see whether there's anything
+	// to do, and whether there will be any annotations at all
+	explicit := map[string]bool{}
+	remaining := 0
+	if annotations != nil {
+		for i := 0; i+1 < len(annotations.Content); i += 2 {
+			key := annotations.Content[i]
+			if !isMergeKey(key) {
+				explicit[key.Value] = true
+			}
+			if !removed[key.Value] {
+				remaining++
+			}
+		}
+	}
+	// Annotations merged in from elsewhere are updated where they
+	// are given, but can't be removed.
+	for k := range removed {
+		if key, _ := mappingEntry(annotations, k); key != nil && !explicit[k] {
+			return nil, fmt.Errorf("unable to remove annotation %q, since it is merged from elsewhere", k)
+		}
+	}
+	var newKeys []string
+	for k := range add {
+		if key, _ := mappingEntry(annotations, k); key == nil {
+			newKeys = append(newKeys, k)
+		}
+	}
+	sort.Strings(newKeys)
+	var newPairs []pair
+	for _, k := range newKeys {
+		newPairs = append(newPairs, pair{key: k, value: add[k]})
+	}
+
+	if remaining == 0 && len(newPairs) == 0 {
+		if annotationsKey == nil {
+			return nil, nil
+		}
+		return s.removeEntries(meta, map[string]bool{"annotations": true})
+	}
+
+	if annotations == nil {
+		p := pair{key: "annotations", nested: newPairs}
+		if annotationsKey == nil {
+			e, err := s.appendEntries(metaKey, meta, false, p)
+			return []edit{e}, err
+		}
+		// There's an empty value for annotations (e.g., `null`);
+		// replace it, or if it's nothing at all, the whole line
+		if annotationsValue.Value != "" {
+			start := s.start(annotationsValue)
+			end, err := s.scalarEnd(annotationsValue, start)
+			if err != nil {
+				return nil, err
+			}
+			text := strings.TrimPrefix(s.flowText(p, 0, 0, false), s.format(p.key, 0, true)+": ")
+			return []edit{{start: start, end: end, text: text}}, nil
+		}
+		if meta.Style&yaml3.FlowStyle != 0 {
+			return nil, errors.New("unable to add annotations to the manifest")
+		}
+		first := meta.Content[0]
+		start, end := s.entryLines(annotationsKey.Line, annotationsKey.Line)
+		e := s.insertLines(annotationsKey.Line, s.blockLines(first.Column-1, s.step(metaKey, meta), p)...)
+		return []edit{{start: start, end: end, text: e.text}}, nil
+	}
+
+	edits, err := s.removeEntries(annotations, removed)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range add {
+		if key, value := mappingEntry(annotations, k); key != nil {
+			e, changed, err := s.replaceValue(key, value, v)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				edits = append(edits, e)
+			}
+		}
+	}
+	if len(newPairs) > 0 {
+		e, err := s.appendEntries(annotationsKey, annotations, remaining == 0, newPairs...)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, nil
+}
+
+// replaceValue returns an edit replacing the value of a mapping entry
+// with a scalar, and whether that is a change. A single-line scalar
+// is replaced in place, keeping its quoting style and any comment
+// after it; if the value is an alias, it's the node referred to
+// that's replaced. Anything else in a block mapping is replaced up to
+// the end of the entry.
+func (s *source) replaceValue(key, value *yaml3.Node, v string) (edit, bool, error) {
+	target := resolve(value)
+	if target.Kind == yaml3.ScalarNode && target.Value == v {
+		return edit{}, false, nil
+	}
+	if style := quoting(target); target.Kind == yaml3.ScalarNode && (style == 0 || style == yaml3.SingleQuotedStyle || style == yaml3.DoubleQuotedStyle) {
+		if e, err := s.replaceScalar(target, v); err == nil {
+			return e, true, nil
+		}
+	}
+	start := s.start(value)
+	end := s.lineStart(s.entryEndLine(key, value)+1) - 1
+	if target != value || s.json || end < start {
+		return edit{}, false, fmt.Errorf("unable to replace value of %q in the manifest", key.Value)
+	}
+	if s.bytes[end] != '\n' {
+		end++ // there was no final newline
+	}
+	return edit{start: start, end: end, text: s.format(v, 0, false)}, true, nil
+}
+
+// pair is an entry to add to a mapping; either a scalar value, or a
+// nested mapping.
+type pair struct {
+	key, value string
+	nested     []pair
+}
+
+// step returns the indentation used for entries of the mapping given,
+// relative to its key.
+func (s *source) step(key, m *yaml3.Node) int {
+	if len(m.Content) > 0 {
+		if step := m.Content[0].Column - key.Column; step > 0 {
+			return step
+		}
+	}
+	return 2
+}
+
+// appendEntries returns an edit adding the pairs given after the
+// last entry of a mapping, following its layout. If `empty` is true,
+// the existing entries are all being removed.
+func (s *source) appendEntries(key, m *yaml3.Node, empty bool, pairs ...pair) (edit, error) {
+	if m.Style&yaml3.FlowStyle == 0 {
+		first, last := m.Content[0], len(m.Content)-2
+		return s.insertLines(s.entryEndLine(m.Content[last], m.Content[last+1])+1, s.blockLines(first.Column-1, s.step(key, m), pairs...)...), nil
+	}
+
+	at, sep, indent, multiline := s.start(m)+1, ", ", 0, false
+	if n := len(m.Content); n > 0 {
+		lastKey, lastValue := m.Content[n-2], m.Content[n-1]
+		end, err := s.valueEnd(lastValue)
+		if err != nil {
+			return edit{}, err
+		}
+		at = end
+		if lastKey.Line > key.Line {
+			multiline, indent = true, lastKey.Column-1
+			sep = ",\n" + strings.Repeat(" ", indent)
+		}
+	}
+	var texts []string
+	for _, p := range pairs {
+		texts = append(texts, s.flowText(p, indent, s.step(key, m), multiline))
+	}
+	text := strings.Join(texts, sep)
+	if len(m.Content) > 0 && !empty {
+		text = sep + text
+	}
+	return edit{start: at, end: at, text: text}, nil
+}
+
+// blockLines returns the lines for pairs to be added to a block
+// mapping, with the indentation given.
+func (s *source) blockLines(indent, step int, pairs ...pair) []string {
+	var lines []string
+	for _, p := range pairs {
+		prefix := strings.Repeat(" ", indent) + s.format(p.key, 0, false) + ":"
+		if p.nested != nil {
+			lines = append(lines, prefix)
+			lines = append(lines, s.blockLines(indent+step, step, p.nested...)...)
+			continue
+		}
+		lines = append(lines, prefix+" "+s.format(p.value, 0, false))
+	}
+	return lines
+}
+
+// flowText returns the text for a pair to be added to a flow
+// mapping; nested mappings are laid out over several lines, with the
+// indentation given, if `multiline` is true.
+func (s *source) flowText(p pair, indent, step int, multiline bool) string {
+	key := s.format(p.key, 0, true)
+	if p.nested == nil {
+		return key + ": " + s.format(p.value, 0, true)
+	}
+	var texts []string
+	for _, q := range p.nested {
+		texts = append(texts, s.flowText(q, indent+step, step, multiline))
+	}
+	if !multiline {
+		return key + ": {" + strings.Join(texts, ", ") + "}"
+	}
+	inner := strings.Repeat(" ", indent+step)
+	return key + ": {\n" + inner + strings.Join(texts, ",\n"+inner) + "\n" + strings.Repeat(" ", indent) + "}"
+}
+
+// removeEntries returns the edits removing the entries with the keys
+// given from a mapping. Entries in a block mapping are removed line
+// by line; in a flow mapping, along with the separator before or
+// after them.
+func (s *source) removeEntries(m *yaml3.Node, keys map[string]bool) ([]edit, error) {
+	var edits []edit
+	n := len(m.Content) / 2
+	remove := func(i int) bool {
+		key := m.Content[2*i]
+		return !isMergeKey(key) && keys[key.Value]
+	}
+	for i := 0; i < n; i++ {
+		if !remove(i) {
+			continue
+		}
+		key, value := m.Content[2*i], m.Content[2*i+1]
+		if m.Style&yaml3.FlowStyle == 0 {
+			if !s.removable(key) {
+				return nil, fmt.Errorf("unable to remove %q from the manifest", key.Value)
+			}
+			start, end := s.entryLines(key.Line, s.entryEndLine(key, value))
+			edits = append(edits, edit{start: start, end: end})
+			continue
+		}
+		// Find the run of entries to remove, and take out the
+		// separator following it, or if it's at the end, the one
+		// preceding it
+		j := i
+		for j+1 < n && remove(j+1) {
+			j++
+		}
+		start, end := s.start(key), 0
+		lastEnd, err := s.valueEnd(m.Content[2*j+1])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case j+1 < n:
+			end = s.start(m.Content[2*j+2])
+		case i > 0:
+			if start, err = s.valueEnd(m.Content[2*i-1]); err != nil {
+				return nil, err
+			}
+			end = lastEnd
+		default:
+			end = lastEnd
+		}
+		edits = append(edits, edit{start: start, end: end})
+		i = j
+	}
+	return edits, nil
+}
+
+// valueEnd returns the offset just after the node given, which must
+// be a scalar, an alias, or a flow collection.
+func (s *source) valueEnd(n *yaml3.Node) (int, error) {
+	start := s.start(n)
+	switch {
+	case n.Kind == yaml3.ScalarNode:
+		return s.scalarEnd(n, start)
+	case n.Kind == yaml3.AliasNode:
+		return start + 1 + len(n.Value), nil
+	case n.Style&yaml3.FlowStyle != 0:
+		return s.flowEnd(start)
+	}
+	return 0, errors.New("unable to locate the end of a value in the manifest")
+}
+
+// flowEnd returns the offset just after the flow collection starting
+// at the offset given.
+func (s *source) flowEnd(start int) (int, error) {
+	b := s.bytes
+	depth := 0
+	for i := start; i < len(b); i++ {
+		switch b[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1, nil
+			}
+		case '\'':
+			for i++; i < len(b) && b[i] != '\''; i++ {
+			}
+		case '"':
+			for i++; i < len(b) && b[i] != '"'; i++ {
+				if b[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return 0, errors.New("unable to locate the end of a value in the manifest")
+}
@@ -0,0 +1,565 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const editDeployment = `# The helloworld app; see README.md
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: helloworld   # indented by four
+    annotations:
+        prometheus.io/scrape: "false" # double-quoted
+spec:
+    template:
+        spec:
+            containers:
+            - name: helloworld
+              image: "quay.io/weaveworks/helloworld:master-07a1b6b" # keep this comment
+              args: [ "-msg", 'Ahoy' ]
+            - image: quay.io/weaveworks/sidecar:master-a000001    # and this
+              name: sidecar
+`
+
+func TestUpdateImagePreservesFormatting(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	for _, c := range []struct {
+		container, image, out string
+	}{
+		{"helloworld", "quay.io/weaveworks/helloworld:master-a000002", `# The helloworld app; see README.md
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: helloworld   # indented by four
+    annotations:
+        prometheus.io/scrape: "false" # double-quoted
+spec:
+    template:
+        spec:
+            containers:
+            - name: helloworld
+              image: "quay.io/weaveworks/helloworld:master-a000002" # keep this comment
+              args: [ "-msg", 'Ahoy' ]
+            - image: quay.io/weaveworks/sidecar:master-a000001    # and this
+              name: sidecar
+`},
+		{"sidecar", "quay.io/weaveworks/sidecar:v1", `# The helloworld app; see README.md
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: helloworld   # indented by four
+    annotations:
+        prometheus.io/scrape: "false" # double-quoted
+spec:
+    template:
+        spec:
+            containers:
+            - name: helloworld
+              image: "quay.io/weaveworks/helloworld:master-07a1b6b" # keep this comment
+              args: [ "-msg", 'Ahoy' ]
+            - image: quay.io/weaveworks/sidecar:v1    # and this
+              name: sidecar
+`},
+	} {
+		ref, err := image.ParseRef(c.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := UpdateImage([]byte(editDeployment), id, c.container, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != c.out {
+			t.Errorf("expected:\n%s\ngot:\n%s", c.out, string(out))
+		}
+	}
+}
+
+func TestUpdateImageNotFound(t *testing.T) {
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:v1")
+	if _, err := UpdateImage([]byte(editDeployment), flux.MustParseResourceID("default:deployment/goodbyeworld"), "helloworld", ref); err == nil {
+		t.Error("expected error updating a resource not in the manifest")
+	}
+	if _, err := UpdateImage([]byte(editDeployment), flux.MustParseResourceID("default:deployment/helloworld"), "nonesuch", ref); err == nil {
+		t.Error("expected error updating a container not in the resource")
+	}
+}
+
+func TestUpdateAnnotationsPreservesFormatting(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	out, err := UpdateAnnotations([]byte(editDeployment), id, map[string]string{
+		"prometheus.io/scrape":       "true",
+		"flux.weave.works/automated": "true",
+		"flux.weave.works/tag.app":   "glob:master-*",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# The helloworld app; see README.md
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: helloworld   # indented by four
+    annotations:
+        prometheus.io/scrape: "true" # double-quoted
+        flux.weave.works/automated: 'true'
+        flux.weave.works/tag.app: glob:master-*
+spec:
+    template:
+        spec:
+            containers:
+            - name: helloworld
+              image: "quay.io/weaveworks/helloworld:master-07a1b6b" # keep this comment
+              args: [ "-msg", 'Ahoy' ]
+            - image: quay.io/weaveworks/sidecar:master-a000001    # and this
+              name: sidecar
+`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestUpdateAnnotationsFlowStyle(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	for _, c := range []struct {
+		name    string
+		in, out string
+		set     map[string]string
+		remove  []string
+	}{
+		{
+			name: "add to flow-style annotations",
+			in: `kind: Deployment
+metadata:
+  name: helloworld
+  annotations: {prometheus.io/scrape: 'false'} # comment
+spec: {}
+`,
+			out: `kind: Deployment
+metadata:
+  name: helloworld
+  annotations: {prometheus.io/scrape: 'false', flux.weave.works/locked: 'true'} # comment
+spec: {}
+`,
+			set: map[string]string{"flux.weave.works/locked": "true"},
+		},
+		{
+			name: "remove the last of flow-style annotations",
+			in: `kind: Deployment
+metadata:
+  name: helloworld
+  annotations: {flux.weave.works/locked: 'true'}
+spec: {}
+`,
+			out: `kind: Deployment
+metadata:
+  name: helloworld
+spec: {}
+`,
+			remove: []string{"flux.weave.works/locked"},
+		},
+		{
+			name: "add to a file without a final newline",
+			in: `kind: Deployment
+metadata:
+  name: helloworld`,
+			out: `kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/locked: 'true'
+`,
+			set: map[string]string{"flux.weave.works/locked": "true"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := UpdateAnnotations([]byte(c.in), id, c.set, c.remove)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != c.out {
+				t.Errorf("expected:\n%s\ngot:\n%s", c.out, string(out))
+			}
+		})
+	}
+}
+
+const editAnchors = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations: &annotations
+    flux.weave.works/automated: 'true'
+spec:
+  template:
+    metadata:
+      annotations:
+        <<: *annotations
+        prometheus.io/scrape: 'false'
+    spec:
+      containers:
+      - &base
+        name: helloworld
+        image: &image !!str quay.io/weaveworks/helloworld:master-07a1b6b
+        args: [-msg, Ahoy]
+      - <<: *base
+        name: echo
+        args: [-echo]
+      - name: sidecar
+        image: *image
+`
+
+func TestUpdateImageAnchors(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations: &annotations
+    flux.weave.works/automated: 'true'
+spec:
+  template:
+    metadata:
+      annotations:
+        <<: *annotations
+        prometheus.io/scrape: 'false'
+    spec:
+      containers:
+      - &base
+        name: helloworld
+        image: &image !!str quay.io/weaveworks/helloworld:master-a000002
+        args: [-msg, Ahoy]
+      - <<: *base
+        name: echo
+        args: [-echo]
+      - name: sidecar
+        image: *image
+`
+	// All the containers get their image from the same node, so
+	// whichever is updated, it's that node that changes.
+	for _, container := range []string{"helloworld", "echo", "sidecar"} {
+		out, err := UpdateImage([]byte(editAnchors), id, container, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != expected {
+			t.Errorf("updating %s, expected:\n%s\ngot:\n%s", container, expected, string(out))
+		}
+	}
+}
+
+func TestUpdateAnnotationsMerged(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	src, err := parseSource([]byte(editAnchors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := src.findResource(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Look at the pod template, which merges in the annotations of
+	// the deployment
+	template := mappingValue(mappingValue(res, "spec"), "template")
+
+	edits, err := src.annotationEdits(template, map[string]string{
+		"flux.weave.works/automated": "false",
+		"prometheus.io/scrape":       "true",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations: &annotations
+    flux.weave.works/automated: 'false'
+spec:
+  template:
+    metadata:
+      annotations:
+        <<: *annotations
+        prometheus.io/scrape: 'true'
+    spec:
+      containers:
+      - &base
+        name: helloworld
+        image: &image !!str quay.io/weaveworks/helloworld:master-07a1b6b
+        args: [-msg, Ahoy]
+      - <<: *base
+        name: echo
+        args: [-echo]
+      - name: sidecar
+        image: *image
+`
+	if out := src.apply(edits...); string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	if _, err = src.annotationEdits(template, nil, []string{"flux.weave.works/automated"}); err == nil {
+		t.Error("expected error removing a merged annotation")
+	}
+}
+
+func TestUpdateImageInMultidocAndLists(t *testing.T) {
+	in := `# A file with lots of things in it
+---
+apiVersion: v1
+kind:    Service   # odd spacing, left alone
+metadata: {name: helloworld, namespace: hello}
+spec:
+  ports: [{port: 80}]
+---
+apiVersion: v1
+kind: DeploymentList
+items:
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: helloworld
+    namespace: other
+  spec:
+    template:
+      spec:
+        containers:
+        - name: helloworld
+          image: "quay.io/weaveworks/helloworld:master-07a1b6b"
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: helloworld
+    namespace: hello
+  spec:
+    template:
+      spec:
+        containers:
+        - name: helloworld
+          image: "quay.io/weaveworks/helloworld:master-07a1b6b"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld   # same name, different namespace
+spec:
+  template:
+    spec:
+      containers:
+      - name: helloworld
+        image: "quay.io/weaveworks/helloworld:master-07a1b6b"
+...
+`
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	for _, c := range []struct {
+		id   string
+		line int // the line on which the image should be changed
+	}{
+		{"other:deployment/helloworld", 22},
+		{"hello:deployment/helloworld", 33},
+		{"default:deployment/helloworld", 44},
+	} {
+		out, err := UpdateImage([]byte(in), flux.MustParseResourceID(c.id), "helloworld", ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inLines, outLines := strings.Split(in, "\n"), strings.Split(string(out), "\n")
+		if len(inLines) != len(outLines) {
+			t.Fatalf("updating %s, expected %d lines, got %d:\n%s", c.id, len(inLines), len(outLines), out)
+		}
+		for i := range inLines {
+			expected := inLines[i]
+			if i+1 == c.line {
+				expected = strings.Replace(expected, "master-07a1b6b", "master-a000002", 1)
+			}
+			if outLines[i] != expected {
+				t.Errorf("updating %s, at line %d expected %q, got %q", c.id, i+1, expected, outLines[i])
+			}
+		}
+	}
+}
+
+const editJSON = `{
+    "apiVersion": "apps/v1",
+    "kind": "Deployment",
+    "metadata": {
+        "name": "helloworld"
+    },
+    "spec": {
+        "template": {
+            "spec": {
+                "containers": [
+                    {"name": "helloworld", "image": "quay.io/weaveworks/helloworld:master-07a1b6b"}
+                ]
+            }
+        }
+    }
+}
+`
+
+func TestUpdateJSON(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	ref, _ := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	out, err := UpdateImage([]byte(editJSON), id, "helloworld", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(editJSON, "master-07a1b6b", "master-a000002", 1)
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	// Add the first annotations
+	out, err = UpdateAnnotations(out, id, map[string]string{
+		"flux.weave.works/automated": "true",
+		"flux.weave.works/tag.app":   `regexp:^master-.*"?$`,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAnnotations := strings.Replace(expected, `        "name": "helloworld"
+`, `        "name": "helloworld",
+        "annotations": {
+            "flux.weave.works/automated": "true",
+            "flux.weave.works/tag.app": "regexp:^master-.*\"?$"
+        }
+`, 1)
+	if string(out) != withAnnotations {
+		t.Errorf("expected:\n%s\ngot:\n%s", withAnnotations, string(out))
+	}
+
+	// Remove one, change one, add one
+	out, err = UpdateAnnotations(out, id, map[string]string{
+		"flux.weave.works/tag.app": "glob:master-*",
+		"flux.weave.works/locked":  "true",
+	}, []string{"flux.weave.works/automated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(expected, `        "name": "helloworld"
+`, `        "name": "helloworld",
+        "annotations": {
+            "flux.weave.works/tag.app": "glob:master-*",
+            "flux.weave.works/locked": "true"
+        }
+`, 1)
+	if string(out) != changed {
+		t.Errorf("expected:\n%s\ngot:\n%s", changed, string(out))
+	}
+
+	// Remove them all, leaving just what we started with
+	out, err = UpdateAnnotations(out, id, nil, []string{"flux.weave.works/tag.app", "flux.weave.works/locked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+}
+
+func TestUpdateHelmImageParts(t *testing.T) {
+	in := `apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: mariadb
+  namespace: maria
+  annotations:
+    helm.flux.weave.works/images.db: repository=mariadb.image,tag=mariadb.imageTag
+spec:
+  chartGitPath: mariadb
+  values:
+    mariadb:
+      image: bitnami/mariadb # the repository
+      imageTag: 10 # the tag
+`
+	id := flux.MustParseResourceID("maria:fluxhelmrelease/mariadb")
+	for _, c := range []struct {
+		image, repo, tag string
+	}{
+		{"bitnami/mariadb:10.1.33", "bitnami/mariadb", "10.1.33"},
+		{"bitnami/mariadb:10.2", "bitnami/mariadb", "'10.2'"},
+		{"quay.io/bitnami/mariadb:11", "quay.io/bitnami/mariadb", "'11'"},
+	} {
+		ref, _ := image.ParseRef(c.image)
+		out, err := UpdateImage([]byte(in), id, "db", ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.Replace(in, "image: bitnami/mariadb #", "image: "+c.repo+" #", 1)
+		expected = strings.Replace(expected, "imageTag: 10 #", "imageTag: "+c.tag+" #", 1)
+		if string(out) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+		}
+	}
+}
+
+func TestUpdateHelmImageDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	ref, _ := image.ParseRef("bitnami/mariadb:10.1.33@" + digest)
+	id := flux.MustParseResourceID("maria:fluxhelmrelease/mariadb")
+	for _, c := range []struct {
+		name, values, expected string
+	}{
+		{
+			name: "digest after the tag",
+			values: `    mariadb:
+      image:
+        repository: bitnami/mariadb
+        tag: 10.1.30-r1
+`,
+			expected: `    mariadb:
+      image:
+        repository: bitnami/mariadb
+        tag: 10.1.33@` + digest + `
+`,
+		},
+		{
+			name: "digest field, keeping its quotes",
+			values: `    mariadb:
+      image:
+        repository: bitnami/mariadb
+        tag: 10.1.30-r1
+        digest: ""
+`,
+			expected: `    mariadb:
+      image:
+        repository: bitnami/mariadb
+        tag: 10.1.33
+        digest: "` + digest + `"
+`,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			in := `apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: mariadb
+  namespace: maria
+spec:
+  chartGitPath: mariadb
+  values:
+`
+			out, err := UpdateImage([]byte(in+c.values), id, "mariadb", ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != in+c.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", in+c.expected, string(out))
+			}
+			resources, err := ParseMultidoc(out, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			containers := resources[id.String()].(resource.Workload).Containers()
+			if len(containers) != 1 || containers[0].Image.String() != ref.String() {
+				t.Errorf("expected the image to be read back as %s, got %+v", ref, containers)
+			}
+		})
+	}
+}
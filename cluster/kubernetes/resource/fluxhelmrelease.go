@@ -3,6 +3,8 @@ package resource
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/resource"
@@ -33,41 +35,138 @@ type FluxHelmRelease struct {
 
 type ImageSetter func(image.Ref)
 
-// The type we have to interpret as containers is a
-// `map[string]interface{}`; and, we want a stable order to the
-// containers we output, since things will jump around in API calls,
-// or fail to verify, otherwise. Since we can't get them in the order
-// they appear in the document, sort them.
-func sorted_keys(values map[string]interface{}) []string {
-	var keys []string
-	for k := range values {
-		keys = append(keys, k)
+// ImagePathAnnotationPrefix, followed by a container name, is the
+// annotation of a FluxHelmRelease saying where in its values the
+// image for that container is given, for charts that don't follow
+// the conventions recognised otherwise. The path is a sequence of
+// keys separated by dots; it can point at a whole image ref, or at a
+// map with `repository` and `tag` (and optionally `registry` and
+// `digest`) entries. Or, the parts can be given separately:
+//
+// ```
+// metadata:
+//   annotations:
+//     helm.flux.weave.works/images.app: app.image
+//     helm.flux.weave.works/images.db: repository=db.image,tag=db.imageTag
+// ```
+//
+// An image pinned by digest has the digest written to the `digest`
+// field if there is one, and otherwise after the tag, as
+// `tag@digest`.
+//
+// If there are any such annotations, only the images they describe
+// are interpreted as containers.
+const ImagePathAnnotationPrefix = "helm.flux.weave.works/images."
+
+// imageFields says where in the values of a FluxHelmRelease an image
+// is given: either as a whole (at `image`), or in parts. Each path is
+// a list of keys; an empty path means the part isn't given.
+type imageFields struct {
+	container                                string
+	image, registry, repository, tag, digest []string
+}
+
+// assignment is a value to be given to the field at a path.
+type assignment struct {
+	path  []string
+	value string
+}
+
+// ref returns the image as given by the fields, if it can be found
+// in and parsed from the values.
+func (f imageFields) ref(values map[string]interface{}) (image.Ref, bool) {
+	var s string
+	if f.image != nil {
+		str, ok := lookupValue(values, f.image).(string)
+		if !ok {
+			return image.Ref{}, false
+		}
+		s = str
+	} else {
+		// Without a tag there's nothing to update, so the parts
+		// aren't interpreted as an image
+		repo, ok := lookupValue(values, f.repository).(string)
+		if !ok || repo == "" || f.tag == nil {
+			return image.Ref{}, false
+		}
+		s = repo
+		if f.registry != nil {
+			if reg, ok := lookupValue(values, f.registry).(string); ok && reg != "" {
+				s = reg + "/" + repo
+			}
+		}
+		if tag := lookupValue(values, f.tag); tag != nil {
+			// The tag field may have a digest after the tag, or
+			// just the digest
+			if t := fmt.Sprint(tag); strings.HasPrefix(t, "@") {
+				s = s + t
+			} else {
+				s = s + ":" + t
+			}
+		}
+		if digest, ok := lookupValue(values, f.digest).(string); ok && digest != "" {
+			s = s + "@" + digest
+		}
 	}
-	sort.Strings(keys)
-	return keys
+	ref, err := image.ParseRef(s)
+	return ref, err == nil
 }
 
-// FindFluxHelmReleaseContainers examines the Values from a
-// FluxHelmRelease (manifest, or cluster resource, or otherwise) and
-// calls visit with each container name and image it finds, as well as
-// procedure for changing the image value. It will return an error if
-// it cannot interpret the values as specifying images, or if the
-// `visit` function itself returns an error.
-func FindFluxHelmReleaseContainers(values map[string]interface{}, visit func(string, image.Ref, ImageSetter) error) error {
+// assignments returns the values to give the fields, for them to
+// describe the image given.
+func (f imageFields) assignments(ref image.Ref) []assignment {
+	if f.image != nil {
+		return []assignment{{f.image, ref.String()}}
+	}
+	var as []assignment
+	if f.registry != nil {
+		as = append(as, assignment{f.registry, ref.Domain}, assignment{f.repository, ref.Image})
+	} else {
+		as = append(as, assignment{f.repository, ref.Name.String()})
+	}
+	if f.tag != nil {
+		tag := ref.Tag
+		if f.digest != nil {
+			as = append(as, assignment{f.digest, ref.Digest})
+		} else if ref.Digest != "" {
+			tag = tag + "@" + ref.Digest
+		}
+		as = append(as, assignment{f.tag, tag})
+	}
+	return as
+}
+
+// findImageFields returns the fields of each of the images in the
+// values of a FluxHelmRelease, according to its annotations, or if
+// there are no annotations for images, by convention.
+func findImageFields(annotations map[string]string, values map[string]interface{}) []imageFields {
+	var result []imageFields
+	for _, k := range sortedAnnotations(annotations) {
+		if !strings.HasPrefix(k, ImagePathAnnotationPrefix) {
+			continue
+		}
+		if f, ok := parseImageFields(strings.TrimPrefix(k, ImagePathAnnotationPrefix), annotations[k]); ok {
+			result = append(result, partsIfMap(values, f))
+		}
+	}
+	if len(result) > 0 {
+		return result
+	}
+
 	// Try the simplest format first:
 	// ```
 	// values:
 	//   image: 'repo/image:tag'
 	// ```
-	if imgInfo, ok := values["image"]; ok {
-		if imgInfoStr, ok := imgInfo.(string); ok {
-			imageRef, err := image.ParseRef(imgInfoStr)
-			if err == nil {
-				return visit(ReleaseContainerName, imageRef, func(ref image.Ref) {
-					values["image"] = ref.String()
-				})
-			}
-		}
+	// or with the parts given separately:
+	// ```
+	// values:
+	//   image:
+	//     repository: repo/image
+	//     tag: tag
+	// ```
+	if f := partsIfMap(values, imageFields{container: ReleaseContainerName, image: []string{"image"}}); f.validIn(values) {
+		return []imageFields{f}
 	}
 	// Second most simple format:
 	// ```
@@ -77,35 +176,195 @@ func FindFluxHelmReleaseContainers(values map[string]interface{}, visit func(str
 	//   bar:
 	//     image: repo/bar:tag
 	// ```
+	// (and likewise, with the parts given separately)
 	for _, k := range sorted_keys(values) {
-		var imgInfo interface{}
-		var ok bool
-		var setter ImageSetter
-		// From a YAML (i.e., a file), it's a
-		// `map[interface{}]interface{}`, and from JSON (i.e.,
-		// Kubernetes API) it's a `map[string]interface{}`.
-		switch m := values[k].(type) {
-		case map[string]interface{}:
-			imgInfo, ok = m["image"]
-			setter = func(ref image.Ref) {
-				m["image"] = ref.String()
+		if f := partsIfMap(values, imageFields{container: k, image: []string{k, "image"}}); f.validIn(values) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// parseImageFields interprets a description of where an image is
+// given: either the path to the whole image, or the paths to its
+// parts, as `repository=<path>,tag=<path>` (and optionally
+// `registry=<path>` and `digest=<path>`). It returns false if there isn't a path to
+// either the image or its repository.
+func parseImageFields(container, spec string) (imageFields, bool) {
+	f := imageFields{container: container}
+	if !strings.Contains(spec, "=") {
+		f.image = splitPath(spec)
+	} else {
+		for _, part := range strings.Split(spec, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
 			}
-		case map[interface{}]interface{}:
-			imgInfo, ok = m["image"]
-			setter = func(ref image.Ref) {
-				m["image"] = ref.String()
+			switch kv[0] {
+			case "registry":
+				f.registry = splitPath(kv[1])
+			case "repository":
+				f.repository = splitPath(kv[1])
+			case "tag":
+				f.tag = splitPath(kv[1])
+			case "digest":
+				f.digest = splitPath(kv[1])
 			}
 		}
-		if ok {
-			if imgInfoStr, ok := imgInfo.(string); ok {
-				imageRef, err := image.ParseRef(imgInfoStr)
-				if err == nil {
-					err = visit(k, imageRef, setter)
-				}
-				if err != nil {
-					return err
-				}
+	}
+	return f, f.image != nil || f.repository != nil
+}
+
+func (f imageFields) validIn(values map[string]interface{}) bool {
+	_, ok := f.ref(values)
+	return ok
+}
+
+// partsIfMap returns the fields given, or if the image path points
+// at a map, the fields for the parts given in that map.
+func partsIfMap(values map[string]interface{}, f imageFields) imageFields {
+	if f.image == nil {
+		return f
+	}
+	m, ok := asMap(lookupValue(values, f.image))
+	if !ok {
+		return f
+	}
+	parts := imageFields{container: f.container}
+	for _, part := range []struct {
+		key   string
+		field *[]string
+	}{
+		{"registry", &parts.registry},
+		{"repository", &parts.repository},
+		{"tag", &parts.tag},
+		{"digest", &parts.digest},
+	} {
+		if _, ok := m[part.key]; ok {
+			*part.field = append(append([]string{}, f.image...), part.key)
+		}
+	}
+	return parts
+}
+
+// lookupValue returns the value at the path given, or nil if there
+// isn't one.
+func lookupValue(values map[string]interface{}, path []string) interface{} {
+	var v interface{} = values
+	for _, k := range path {
+		v = stepValue(v, k)
+	}
+	return v
+}
+
+// stepValue returns the entry for the key given in a map, or the
+// item at the index given in a list; or nil, if there isn't one.
+func stepValue(v interface{}, k string) interface{} {
+	if l, ok := v.([]interface{}); ok {
+		if i, err := strconv.Atoi(k); err == nil && i >= 0 && i < len(l) {
+			return l[i]
+		}
+		return nil
+	}
+	m, ok := asMap(v)
+	if !ok {
+		return nil
+	}
+	return m[k]
+}
+
+// setValue sets the value at the path given, if there's a map (or a
+// list, with the index given) for it to go in.
+func setValue(values map[string]interface{}, path []string, value string) {
+	var v interface{} = values
+	for _, k := range path[:len(path)-1] {
+		v = stepValue(v, k)
+	}
+	// From a YAML (i.e., a file), it's a
+	// `map[interface{}]interface{}`, and from JSON (i.e.,
+	// Kubernetes API) it's a `map[string]interface{}`.
+	last := path[len(path)-1]
+	switch m := v.(type) {
+	case map[string]interface{}:
+		m[last] = value
+	case map[interface{}]interface{}:
+		m[last] = value
+	case []interface{}:
+		if i, err := strconv.Atoi(last); err == nil && i >= 0 && i < len(m) {
+			m[i] = value
+		}
+	}
+}
+
+// asMap returns the value as a map with string keys, if it is a map.
+// Changes to the result are not reflected in the value.
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		res := map[string]interface{}{}
+		for k, v := range m {
+			if ks, ok := k.(string); ok {
+				res[ks] = v
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+// The type we have to interpret as containers is a
+// `map[string]interface{}`; and, we want a stable order to the
+// containers we output, since things will jump around in API calls,
+// or fail to verify, otherwise. Since we can't get them in the order
+// they appear in the document, sort them.
+func sorted_keys(values map[string]interface{}) []string {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitPath splits a path into the keys it goes through, and the
+// indices of any lists, so that e.g., `spec.sidecars[0].image` is
+// `spec`, `sidecars`, `0`, `image`. A leading dot is allowed, as in
+// JSONPath.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimSpace(path), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(path, ".")
+}
+
+func sortedAnnotations(annotations map[string]string) []string {
+	var keys []string
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FindFluxHelmReleaseContainers examines the annotations and Values
+// from a FluxHelmRelease (manifest, or cluster resource, or
+// otherwise) and calls visit with each container name and image it
+// finds, as well as procedure for changing the image value. It will
+// return an error if the `visit` function itself returns an error.
+func FindFluxHelmReleaseContainers(annotations map[string]string, values map[string]interface{}, visit func(string, image.Ref, ImageSetter) error) error {
+	for _, f := range findImageFields(annotations, values) {
+		ref, ok := f.ref(values)
+		if !ok {
+			continue
+		}
+		f := f
+		if err := visit(f.container, ref, func(ref image.Ref) {
+			for _, a := range f.assignments(ref) {
+				setValue(values, a.path, a.value)
 			}
+		}); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -116,7 +375,7 @@ func FindFluxHelmReleaseContainers(values map[string]interface{}, visit func(str
 func (fhr FluxHelmRelease) Containers() []resource.Container {
 	var containers []resource.Container
 	// If there's an error in interpreting, return what we have.
-	_ = FindFluxHelmReleaseContainers(fhr.Spec.Values, func(container string, image image.Ref, _ ImageSetter) error {
+	_ = FindFluxHelmReleaseContainers(fhr.Meta.Annotations, fhr.Spec.Values, func(container string, image image.Ref, _ ImageSetter) error {
 		containers = append(containers, resource.Container{
 			Name:  container,
 			Image: image,
@@ -127,12 +386,13 @@ func (fhr FluxHelmRelease) Containers() []resource.Container {
 }
 
 // SetContainerImage mutates this resource by setting the `image`
-// field of `values`, or a subvalue therein, per one of the
-// interpretations in `FindFluxHelmReleaseContainers` above. NB we can
-// get away with a value-typed receiver because we set a map entry.
+// field of `values`, or a subvalue therein (or the fields for its
+// parts), per one of the interpretations in
+// `FindFluxHelmReleaseContainers` above. NB we can get away with a
+// value-typed receiver because we set a map entry.
 func (fhr FluxHelmRelease) SetContainerImage(container string, ref image.Ref) error {
 	found := false
-	if err := FindFluxHelmReleaseContainers(fhr.Spec.Values, func(name string, image image.Ref, setter ImageSetter) error {
+	if err := FindFluxHelmReleaseContainers(fhr.Meta.Annotations, fhr.Spec.Values, func(name string, image image.Ref, setter ImageSetter) error {
 		if container == name {
 			setter(ref)
 			found = true
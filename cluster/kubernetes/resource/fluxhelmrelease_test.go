@@ -109,3 +109,109 @@ spec:
 		t.Errorf("expected container name %q, got %q", expectedContainer, containers[0].Name)
 	}
 }
+
+func TestParseImageParts(t *testing.T) {
+	for _, c := range []struct {
+		name, doc string
+		expected  map[string]string
+	}{
+		{
+			name: "repository and tag, by convention",
+			doc: `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: mariadb
+  namespace: maria
+spec:
+  chartGitPath: mariadb
+  values:
+    image:
+      registry: docker.io
+      repository: bitnami/mariadb
+      tag: 10.1.30-r1
+`,
+			expected: map[string]string{ReleaseContainerName: "docker.io/bitnami/mariadb:10.1.30-r1"},
+		},
+		{
+			name: "repository and tag per container, by convention",
+			doc: `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: mariadb
+  namespace: maria
+spec:
+  chartGitPath: mariadb
+  values:
+    db:
+      image:
+        repository: bitnami/mariadb
+        tag: 10.1.30-r1
+    metrics:
+      image:
+        repository: prom/mysqld-exporter # no tag, so not interpreted
+`,
+			expected: map[string]string{"db": "bitnami/mariadb:10.1.30-r1"},
+		},
+		{
+			name: "paths given in annotations",
+			doc: `---
+apiVersion: helm.integrations.flux.weave.works/v1alpha2
+kind: FluxHelmRelease
+metadata:
+  name: mariadb
+  namespace: maria
+  annotations:
+    helm.flux.weave.works/images.db: repository=mariadb.image,tag=mariadb.imageTag
+    helm.flux.weave.works/images.metrics: exporter.deeply.nested.image
+spec:
+  chartGitPath: mariadb
+  values:
+    mariadb:
+      image: bitnami/mariadb
+      imageTag: 10
+    exporter:
+      deeply:
+        nested:
+          image: prom/mysqld-exporter:v0.10.0
+    other:
+      image: not/interpreted:because-there-are-annotations
+`,
+			expected: map[string]string{"db": "bitnami/mariadb:10", "metrics": "prom/mysqld-exporter:v0.10.0"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			resources, err := ParseMultidoc([]byte(c.doc), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fhr, ok := resources["maria:fluxhelmrelease/mariadb"].(resource.Workload)
+			if !ok {
+				t.Fatalf("expected a workload; got %#v", resources)
+			}
+			containers := fhr.Containers()
+			if len(containers) != len(c.expected) {
+				t.Fatalf("expected %d containers, got %#v", len(c.expected), containers)
+			}
+			for _, container := range containers {
+				if container.Image.String() != c.expected[container.Name] {
+					t.Errorf("expected image %q for container %q, got %q", c.expected[container.Name], container.Name, container.Image.String())
+				}
+			}
+
+			// Setting every image should be reflected in the
+			// containers afterwards
+			for _, container := range containers {
+				if err := fhr.SetContainerImage(container.Name, container.Image.WithNewTag("new-tag")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, container := range fhr.Containers() {
+				if container.Image.Tag != "new-tag" || container.Image.Name.String() != c.expected[container.Name][:len(container.Image.Name.String())] {
+					t.Errorf("unexpected image after update for container %q: %q", container.Name, container.Image.String())
+				}
+			}
+		})
+	}
+}
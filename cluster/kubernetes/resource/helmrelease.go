@@ -0,0 +1,193 @@
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// HelmRelease is the custom resource (of flux.weave.works/v1beta1)
+// that supersedes FluxHelmRelease. The images are given in its
+// values in just the same way, and updated likewise; including, with
+// annotations prefixed with ImagePathAnnotationPrefix to say where
+// they are.
+//
+// When the chart is in git, the values can also come from the
+// chart's `values.yaml` and from files in the chart given in
+// `valuesFrom`, if those are in the repo too; these are read when
+// loading the manifests, and merged under `values` as Helm would.
+type HelmRelease struct {
+	baseObject
+	Spec helmReleaseSpec
+	// the values with those from the values files merged in, or nil
+	// if there are no values files
+	values map[string]interface{}
+}
+
+type helmReleaseSpec struct {
+	Chart struct {
+		Path string
+	}
+	ValuesFrom []struct {
+		ChartFileRef *struct {
+			Path string
+		} `yaml:"chartFileRef"`
+	} `yaml:"valuesFrom"`
+	Values map[string]interface{}
+}
+
+// valuesFiles returns the paths of the values files of a chart in
+// git, relative to the root of the repo and lowest precedence first:
+// the chart's `values.yaml`, then those given in `valuesFrom`. The
+// chart is taken to be in the same repo as the HelmRelease; files
+// that aren't there are just not read. Values from ConfigMaps and
+// Secrets are in the cluster, so aren't included.
+func (s helmReleaseSpec) valuesFiles() []string {
+	if s.Chart.Path == "" {
+		return nil
+	}
+	files := []string{filepath.Join(s.Chart.Path, "values.yaml")}
+	for _, from := range s.ValuesFrom {
+		if from.ChartFileRef != nil && from.ChartFileRef.Path != "" {
+			files = append(files, filepath.Join(s.Chart.Path, from.ChartFileRef.Path))
+		}
+	}
+	var inRepo []string
+	for _, f := range files {
+		if f = filepath.Clean(f); !filepath.IsAbs(f) && f != ".." && !strings.HasPrefix(f, ".."+string(filepath.Separator)) {
+			inRepo = append(inRepo, f)
+		}
+	}
+	return inRepo
+}
+
+// readValuesFiles reads the values files of the HelmRelease that are
+// in the repo at `root`, and merges them with the values given in
+// the HelmRelease. A values file that can't be read or parsed is left
+// out (Helm will report it, if it's used), rather than failing the
+// load of every manifest.
+func (hr *HelmRelease) readValuesFiles(root string) {
+	hr.values = nil
+	var merged map[string]interface{}
+	for _, path := range hr.Spec.valuesFiles() {
+		bytes, err := ioutil.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			continue
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(bytes, &values); err != nil {
+			continue
+		}
+		merged = mergeValues(merged, values)
+	}
+	if merged != nil {
+		hr.values = mergeValues(merged, hr.Spec.Values)
+	}
+}
+
+func (hr *HelmRelease) copyUnexported() {
+	hr.baseObject.copyUnexported()
+	if hr.values != nil {
+		hr.values = deepCopy(reflect.ValueOf(hr.values)).Interface().(map[string]interface{})
+	}
+}
+
+// allValues returns the values from which the images of the
+// HelmRelease are interpreted.
+func (hr HelmRelease) allValues() map[string]interface{} {
+	if hr.values != nil {
+		return hr.values
+	}
+	return hr.Spec.Values
+}
+
+// mergeValues returns the values in `base`, overridden by those in
+// `override`; maps are merged, and other values replaced, as Helm
+// does for values files.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range override {
+		if bm, ok := asMap(res[k]); ok {
+			if om, ok := asMap(v); ok {
+				res[k] = mergeValues(bm, om)
+				continue
+			}
+		}
+		res[k] = v
+	}
+	return res
+}
+
+// Containers returns the containers that are defined in the
+// HelmRelease.
+func (hr HelmRelease) Containers() []resource.Container {
+	return helmContainers(hr.Meta.Annotations, hr.allValues())
+}
+
+// FileContainers returns the containers whose images are given (at
+// least in part) in the values files of the chart, rather than in the
+// HelmRelease itself. These can't be seen in the cluster.
+func (hr HelmRelease) FileContainers() []resource.Container {
+	if hr.values == nil {
+		return nil
+	}
+	inRelease := map[string]bool{}
+	for _, c := range helmContainers(hr.Meta.Annotations, hr.Spec.Values) {
+		inRelease[c.Name] = true
+	}
+	var containers []resource.Container
+	for _, c := range hr.Containers() {
+		if !inRelease[c.Name] {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+func helmContainers(annotations map[string]string, values map[string]interface{}) []resource.Container {
+	var containers []resource.Container
+	// If there's an error in interpreting, return what we have.
+	_ = FindFluxHelmReleaseContainers(annotations, values, func(container string, image image.Ref, _ ImageSetter) error {
+		containers = append(containers, resource.Container{
+			Name:  container,
+			Image: image,
+		})
+		return nil
+	})
+	return containers
+}
+
+// SetContainerImage mutates this resource by setting the image in
+// its values, as for a FluxHelmRelease.
+func (hr HelmRelease) SetContainerImage(container string, ref image.Ref) error {
+	found := false
+	if err := FindFluxHelmReleaseContainers(hr.Meta.Annotations, hr.allValues(), func(name string, image image.Ref, setter ImageSetter) error {
+		if container == name {
+			setter(ref)
+			found = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("did not find container %s in HelmRelease", container)
+	}
+	return nil
+}
+
+// isHelmReleaseKind reports whether the kind given is one of those
+// whose images are given in chart values.
+func isHelmReleaseKind(kind string) bool {
+	return strings.EqualFold(kind, "FluxHelmRelease") || strings.EqualFold(kind, "HelmRelease")
+}
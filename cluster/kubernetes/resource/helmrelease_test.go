@@ -0,0 +1,248 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const helmReleaseDoc = `---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: demo
+  annotations:
+    helm.flux.weave.works/images.app: repository=app.image.repo,tag=app.image.tag
+spec:
+  releaseName: podinfo
+  chart:
+    git: git@github.com:weaveworks/flux-get-started
+    path: charts/podinfo
+  values:
+    app:
+      image:
+        repo: stefanprodan/podinfo # from Docker Hub
+        tag: 1.4.2
+    cache:
+      image: redis:4.0.11 # not a container, per the annotations
+`
+
+func TestParseHelmRelease(t *testing.T) {
+	resources, err := ParseMultidoc([]byte(helmReleaseDoc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := resources["demo:helmrelease/podinfo"]
+	if !ok {
+		t.Fatalf("expected resource not found; instead got %#v", resources)
+	}
+	hr, ok := res.(resource.Workload)
+	if !ok {
+		t.Fatalf("expected resource to be a Workload, instead got %#v", res)
+	}
+
+	containers := hr.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container; got %#v", containers)
+	}
+	if containers[0].Name != "app" || containers[0].Image.String() != "stefanprodan/podinfo:1.4.2" {
+		t.Errorf("expected container app with image stefanprodan/podinfo:1.4.2, got %#v", containers[0])
+	}
+
+	ref, _ := image.ParseRef("stefanprodan/podinfo:1.5.0")
+	if err := hr.SetContainerImage("app", ref); err != nil {
+		t.Fatal(err)
+	}
+	if image := hr.Containers()[0].Image; image != ref {
+		t.Errorf("expected image to be set to %s, got %s", ref, image)
+	}
+	if err := hr.SetContainerImage("cache", ref); err == nil {
+		t.Error("expected error setting image of container not given by annotations")
+	}
+}
+
+func TestUpdateHelmReleaseImage(t *testing.T) {
+	id := flux.MustParseResourceID("demo:helmrelease/podinfo")
+	ref, _ := image.ParseRef("stefanprodan/podinfo:1.5.0")
+	out, err := UpdateImage([]byte(helmReleaseDoc), id, "app", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(helmReleaseDoc, "tag: 1.4.2", "tag: 1.5.0", 1)
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	if _, err := UpdateImage([]byte(helmReleaseDoc), id, "cache", ref); err == nil {
+		t.Error("expected error updating container not given by annotations")
+	}
+}
+
+const helmReleaseValuesFilesDoc = `---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: demo
+spec:
+  releaseName: podinfo
+  chart:
+    git: git@github.com:weaveworks/flux-get-started
+    path: charts/podinfo
+  valuesFrom:
+  - chartFileRef:
+      path: overrides/prod.yaml
+  - configMapKeyRef:
+      name: in-the-cluster
+  values:
+    cache:
+      image:
+        tag: 4.0.12 # overrides the tag in the chart
+`
+
+const helmChartValues = `# values of the chart
+cache:
+  image:
+    repository: redis
+    tag: 4.0.11
+app:
+  image:
+    repository: stefanprodan/podinfo
+    tag: 1.4.1
+`
+
+const helmChartOverrides = `app:
+  image:
+    tag: 1.4.2
+`
+
+func TestLoadHelmReleaseValuesFiles(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	for name, content := range map[string]string{
+		"releases/podinfo.yaml":              helmReleaseValuesFilesDoc,
+		"charts/podinfo/Chart.yaml":          "name: podinfo\n",
+		"charts/podinfo/values.yaml":         helmChartValues,
+		"charts/podinfo/overrides/prod.yaml": helmChartOverrides,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, err := Load(dir, filepath.Join(dir, "releases"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hr, ok := objs["demo:helmrelease/podinfo"].(*HelmRelease)
+	if !ok {
+		t.Fatalf("expected a HelmRelease, got %#v", objs)
+	}
+	expected := []resource.Container{
+		{Name: "app", Image: mustParseRef(t, "stefanprodan/podinfo:1.4.2")},
+		{Name: "cache", Image: mustParseRef(t, "redis:4.0.12")},
+	}
+	if containers := hr.Containers(); !reflect.DeepEqual(containers, expected) {
+		t.Errorf("expected containers %+v, got %+v", expected, containers)
+	}
+	if containers := hr.FileContainers(); !reflect.DeepEqual(containers, expected) {
+		t.Errorf("expected containers in files %+v, got %+v", expected, containers)
+	}
+}
+
+func TestUpdateHelmValuesImage(t *testing.T) {
+	id := flux.MustParseResourceID("demo:helmrelease/podinfo")
+	files, err := HelmValuesFiles([]byte(helmReleaseValuesFilesDoc), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"charts/podinfo/values.yaml", "charts/podinfo/overrides/prod.yaml"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected values files %v, got %v", expected, files)
+	}
+
+	noValues := helmReleaseValuesFilesDoc[:strings.Index(helmReleaseValuesFilesDoc, "  values:\n")]
+	for _, c := range []struct {
+		container, image   string
+		manifest, expected string
+	}{
+		{
+			container: "app",
+			image:     "quay.io/stefanprodan/podinfo:1.5.0",
+			manifest:  helmReleaseValuesFilesDoc,
+			expected: helmReleaseValuesFilesDoc + `    app:
+      image:
+        repository: quay.io/stefanprodan/podinfo
+        tag: 1.5.0
+`,
+		},
+		{
+			container: "cache",
+			image:     "redis:5.0.0",
+			manifest:  helmReleaseValuesFilesDoc,
+			expected:  strings.Replace(helmReleaseValuesFilesDoc, "tag: 4.0.12", "tag: 5.0.0", 1),
+		},
+		{
+			container: "cache",
+			image:     "quay.io/redis:5.0.0",
+			manifest:  helmReleaseValuesFilesDoc,
+			expected: strings.Replace(helmReleaseValuesFilesDoc, "tag: 4.0.12", "tag: 5.0.0", 1) + `        repository: quay.io/redis
+`,
+		},
+		{
+			container: "app",
+			image:     "stefanprodan/podinfo:1.5.0",
+			manifest:  noValues,
+			expected: noValues + `  values:
+    app:
+      image:
+        tag: 1.5.0
+`,
+		},
+	} {
+		def, err := UpdateHelmValuesImage([]byte(c.manifest), [][]byte{[]byte(helmChartValues), []byte(helmChartOverrides)}, id, c.container, mustParseRef(t, c.image))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(def) != c.expected {
+			t.Errorf("updating %s to %s, expected:\n%s\ngot:\n%s", c.container, c.image, c.expected, string(def))
+		}
+	}
+
+	// Values merged from elsewhere aren't changed to override the files
+	merged := `---
+apiVersion: flux.weave.works/v1beta1
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: demo
+spec:
+  chart:
+    path: charts/podinfo
+  values:
+    <<: {app: {replicas: 2}}
+`
+	if _, err := UpdateHelmValuesImage([]byte(merged), [][]byte{[]byte(helmChartValues)}, id, "app", mustParseRef(t, "stefanprodan/podinfo:1.5.0")); err == nil {
+		t.Error("expected error overriding values merged from elsewhere")
+	}
+}
+
+func mustParseRef(t *testing.T, s string) image.Ref {
+	ref, err := image.ParseRef(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
@@ -0,0 +1,242 @@
+package resource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml3 "gopkg.in/yaml.v3"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+// The procedures in this file edit kustomization files, and the patch
+// flux keeps alongside them, in the same way as manifests are edited
+// in edit.go: in place, so that the rest of the file is untouched.
+
+// UpdateKustomizationImage returns the kustomization given, with the
+// entry in its `images` transformer for the image repository in `ref`
+// set to use the tag (and digest, if any) of `ref`. An entry is taken
+// to be for the repository if it has it as its `newName`, or failing
+// that as its `name`; if there's no such entry, one is added.
+func UpdateKustomizationImage(def []byte, ref image.Ref) ([]byte, error) {
+	src, k, err := parseKustomization(def)
+	if err != nil {
+		return nil, err
+	}
+
+	imagesKey, images := mappingEntry(k, "images")
+	if images != nil && images.Kind == yaml3.SequenceNode {
+		for _, item := range images.Content {
+			item = resolve(item)
+			if item.Kind != yaml3.MappingNode || len(item.Content) == 0 {
+				continue
+			}
+			name := scalarValue(mappingValue(item, "newName"))
+			if name == "" {
+				name = scalarValue(mappingValue(item, "name"))
+			}
+			if entryRef, err := image.ParseRef(name); err == nil && entryRef.CanonicalName() == ref.CanonicalName() {
+				edits, err := src.imageEntryEdits(item, ref)
+				if err != nil {
+					return nil, errors.Wrap(err, "updating images in kustomization")
+				}
+				return src.apply(edits...), nil
+			}
+		}
+	}
+
+	e, err := src.appendListItem(k, imagesKey, images, "images", func(indent int) []string {
+		entry := []pair{{key: "name", value: ref.Name.String()}}
+		if ref.Tag != "" {
+			entry = append(entry, pair{key: "newTag", value: ref.Tag})
+		}
+		if ref.Digest != "" {
+			entry = append(entry, pair{key: "digest", value: ref.Digest})
+		}
+		return src.itemLines(indent, entry)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "adding to images in kustomization")
+	}
+	return src.apply(e), nil
+}
+
+// AddKustomizationPatch returns the kustomization given, with the
+// file named listed under `patchesStrategicMerge`, if it isn't
+// already.
+func AddKustomizationPatch(def []byte, file string) ([]byte, error) {
+	src, k, err := parseKustomization(def)
+	if err != nil {
+		return nil, err
+	}
+	patchesKey, patches := mappingEntry(k, "patchesStrategicMerge")
+	if patches != nil && patches.Kind == yaml3.SequenceNode {
+		for _, item := range patches.Content {
+			if scalarValue(item) == file {
+				return def, nil
+			}
+		}
+	}
+	e, err := src.appendListItem(k, patchesKey, patches, "patchesStrategicMerge", func(indent int) []string {
+		return []string{strings.Repeat(" ", indent) + "- " + src.format(file, 0, false)}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "adding to patchesStrategicMerge in kustomization")
+	}
+	return src.apply(e), nil
+}
+
+// UpdateKustomizePatch returns the strategic merge patch given (which
+// may be empty), with the annotations of the resource identified
+// updated as by UpdateAnnotations. If the patch doesn't already have
+// a document for the resource, one is added at the end, with the
+// apiVersion and kind given; the namespace is left out if it's
+// `default`.
+func UpdateKustomizePatch(def []byte, id flux.ResourceID, apiVersion, kind string, set map[string]string, remove []string) ([]byte, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, err
+	}
+	if res := findResource(src.docs, id); res != nil {
+		edits, err := src.annotationEdits(res, set, remove)
+		if err != nil {
+			return nil, errors.Wrapf(err, "updating annotations in %s", id)
+		}
+		return src.apply(edits...), nil
+	}
+
+	removed := map[string]bool{}
+	for _, k := range remove {
+		removed[k] = true
+	}
+	var annotations []pair
+	for k, v := range set {
+		if !removed[k] {
+			annotations = append(annotations, pair{key: k, value: v})
+		}
+	}
+	if len(annotations) == 0 {
+		return def, nil
+	}
+	sort.Slice(annotations, func(i, j int) bool { return annotations[i].key < annotations[j].key })
+
+	ns, _, name := id.Components()
+	meta := []pair{{key: "name", value: name}}
+	if ns != "default" {
+		meta = append(meta, pair{key: "namespace", value: ns})
+	}
+	meta = append(meta, pair{key: "annotations", nested: annotations})
+	lines := src.blockLines(0, 2,
+		pair{key: "apiVersion", value: apiVersion},
+		pair{key: "kind", value: kind},
+		pair{key: "metadata", nested: meta})
+	if len(src.docs) > 0 {
+		lines = append([]string{"---"}, lines...)
+	}
+	return src.apply(src.insertLines(src.lineCount()+1, lines...)), nil
+}
+
+// ---
+
+func parseKustomization(def []byte) (*source, *yaml3.Node, error) {
+	src, err := parseSource(def)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(src.docs) == 0 {
+		return nil, nil, errors.New("kustomization is empty")
+	}
+	k := resolve(src.docs[0])
+	if k.Kind != yaml3.MappingNode || len(k.Content) == 0 {
+		return nil, nil, errors.New("kustomization is not a mapping")
+	}
+	return src, k, nil
+}
+
+// imageEntryEdits returns the edits to make an entry in the images
+// transformer give the tag and digest of `ref`.
+func (s *source) imageEntryEdits(item *yaml3.Node, ref image.Ref) ([]edit, error) {
+	var edits []edit
+	var add []pair
+	remove := map[string]bool{}
+	for _, field := range []struct{ key, value string }{{"newTag", ref.Tag}, {"digest", ref.Digest}} {
+		key, value := mappingEntry(item, field.key)
+		switch {
+		case field.value == "":
+			if key != nil {
+				remove[field.key] = true
+			}
+		case key == nil:
+			add = append(add, pair{key: field.key, value: field.value})
+		default:
+			e, changed, err := s.replaceValue(key, value, field.value)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				edits = append(edits, e)
+			}
+		}
+	}
+	if len(remove) > 0 {
+		removals, err := s.removeEntries(item, remove)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, removals...)
+	}
+	if len(add) > 0 {
+		e, err := s.appendEntries(item.Content[0], item, false, add...)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, nil
+}
+
+// appendListItem returns an edit adding the lines for an item (as
+// made by `item`, given the indentation of the sequence's dashes) to
+// the end of the block sequence under `key` in the mapping given. If
+// there is no such entry, or it has an empty value, it's written
+// afresh.
+func (s *source) appendListItem(m, key, list *yaml3.Node, name string, item func(indent int) []string) (edit, error) {
+	if list != nil && list.Tag != "!!null" {
+		if list.Kind != yaml3.SequenceNode {
+			return edit{}, fmt.Errorf("%s is not a list", name)
+		}
+		if list.Style&yaml3.FlowStyle != 0 || len(list.Content) == 0 {
+			return edit{}, fmt.Errorf("unable to add to %s given in flow style", name)
+		}
+		indent := indentOf(s.lineText(list.Content[0].Line))
+		return s.insertLines(s.entryEndLine(key, list)+1, item(indent)...), nil
+	}
+	if m.Style&yaml3.FlowStyle != 0 {
+		return edit{}, errors.New("unable to edit a kustomization given in flow style")
+	}
+	if key != nil {
+		// e.g., `images:` with nothing after; replace the line
+		if !s.removable(key) {
+			return edit{}, fmt.Errorf("unable to replace empty %s", name)
+		}
+		indent := key.Column - 1
+		lines := append([]string{strings.Repeat(" ", indent) + s.format(name, 0, false) + ":"}, item(indent)...)
+		start, end := s.entryLines(key.Line, key.Line)
+		return edit{start: start, end: end, text: strings.Join(lines, "\n") + "\n"}, nil
+	}
+	last := len(m.Content) - 2
+	indent := m.Content[0].Column - 1
+	lines := append([]string{strings.Repeat(" ", indent) + s.format(name, 0, false) + ":"}, item(indent)...)
+	return s.insertLines(s.entryEndLine(m.Content[last], m.Content[last+1])+1, lines...), nil
+}
+
+// itemLines returns the lines for a mapping to be added as an item
+// of a block sequence, with its dash at the indentation given.
+func (s *source) itemLines(indent int, pairs []pair) []string {
+	lines := s.blockLines(indent+2, 2, pairs...)
+	lines[0] = strings.Repeat(" ", indent) + "- " + strings.TrimLeft(lines[0], " ")
+	return lines
+}
@@ -0,0 +1,192 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+const editKustomization = `# The production overlay
+namespace: prod
+resources:
+- ../../base
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-a000001 # keep this comment
+- name: sidecar
+  newName: quay.io/weaveworks/sidecar
+  digest: sha256:7df6db5aa61ae9480f52f0b3a06a140ab98d427f86d8d5de0bedab9b8df6b1c0
+`
+
+func TestUpdateKustomizationImage(t *testing.T) {
+	for _, c := range []struct {
+		name, def, image, out string
+	}{
+		{"by name", editKustomization, "quay.io/weaveworks/helloworld:master-a000002", `# The production overlay
+namespace: prod
+resources:
+- ../../base
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-a000002 # keep this comment
+- name: sidecar
+  newName: quay.io/weaveworks/sidecar
+  digest: sha256:7df6db5aa61ae9480f52f0b3a06a140ab98d427f86d8d5de0bedab9b8df6b1c0
+`},
+		{"by new name, dropping the digest", editKustomization, "quay.io/weaveworks/sidecar:v2", `# The production overlay
+namespace: prod
+resources:
+- ../../base
+images:
+- name: quay.io/weaveworks/helloworld
+  newTag: master-a000001 # keep this comment
+- name: sidecar
+  newName: quay.io/weaveworks/sidecar
+  newTag: v2
+`},
+		{"new entry", editKustomization, "alpine:3.8", editKustomization + `- name: alpine
+  newTag: '3.8'
+`},
+		{"no images", `resources:
+  - deploy.yaml
+`, "alpine:3.8", `resources:
+  - deploy.yaml
+images:
+- name: alpine
+  newTag: '3.8'
+`},
+		{"empty images", `images:
+resources: [deploy.yaml]
+`, "alpine:3.8", `images:
+- name: alpine
+  newTag: '3.8'
+resources: [deploy.yaml]
+`},
+	} {
+		ref, err := image.ParseRef(c.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := UpdateKustomizationImage([]byte(c.def), ref)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if string(out) != c.out {
+			t.Errorf("%s: expected\n%s\ngot\n%s", c.name, c.out, out)
+		}
+	}
+}
+
+func TestAddKustomizationPatch(t *testing.T) {
+	out, err := AddKustomizationPatch([]byte(editKustomization), "flux-patch.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := editKustomization + `patchesStrategicMerge:
+- flux-patch.yaml
+`
+	if string(out) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	again, err := AddKustomizationPatch(out, "flux-patch.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(out) {
+		t.Errorf("expected patch already listed to be left alone, got\n%s", again)
+	}
+
+	out, err = AddKustomizationPatch([]byte(`patchesStrategicMerge:
+  - replicas.yaml
+resources: [deploy.yaml]
+`), "flux-patch.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `patchesStrategicMerge:
+  - replicas.yaml
+  - flux-patch.yaml
+resources: [deploy.yaml]
+`
+	if string(out) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+}
+
+func TestUpdateKustomizePatch(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	out, err := UpdateKustomizePatch(nil, id, "apps/v1", "Deployment", map[string]string{
+		PolicyPrefix + "locked":    "true",
+		PolicyPrefix + "automated": "true",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/automated: 'true'
+    flux.weave.works/locked: 'true'
+`
+	if string(out) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	other := flux.MustParseResourceID("other:daemonset/sidecar")
+	out, err = UpdateKustomizePatch(out, other, "apps/v1", "DaemonSet", map[string]string{
+		PolicyPrefix + "tag.sidecar": "semver:~1",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected += `---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: sidecar
+  namespace: other
+  annotations:
+    flux.weave.works/tag.sidecar: semver:~1
+`
+	if string(out) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	out, err = UpdateKustomizePatch(out, id, "apps/v1", "Deployment", nil, []string{PolicyPrefix + "locked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  annotations:
+    flux.weave.works/automated: 'true'
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: sidecar
+  namespace: other
+  annotations:
+    flux.weave.works/tag.sidecar: semver:~1
+`
+	if string(out) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out)
+	}
+
+	// Removing annotations from a resource not in the patch leaves it
+	// as it was
+	unchanged, err := UpdateKustomizePatch(out, flux.MustParseResourceID("default:deployment/absent"), "apps/v1", "Deployment", nil, []string{PolicyPrefix + "locked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(unchanged) != string(out) {
+		t.Errorf("expected patch to be unchanged, got\n%s", unchanged)
+	}
+}
@@ -0,0 +1,405 @@
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// The rules checked by Lint
+const (
+	LintDeprecatedAPIVersion  = "deprecated-api-version"
+	LintMissingResourceLimits = "missing-resource-limits"
+	LintInvalidSelector       = "invalid-selector"
+)
+
+// LintProblem is a problem found in a manifest by Lint.
+type LintProblem struct {
+	Rule    string
+	Message string
+}
+
+// deprecatedAPIVersions gives, for each API version that is
+// deprecated for some kinds, the API version to use instead for each
+// of those kinds.
+var deprecatedAPIVersions = map[string]map[string]string{
+	"extensions/v1beta1": {
+		"daemonset":         "apps/v1",
+		"deployment":        "apps/v1",
+		"replicaset":        "apps/v1",
+		"ingress":           "networking.k8s.io/v1beta1",
+		"networkpolicy":     "networking.k8s.io/v1",
+		"podsecuritypolicy": "policy/v1beta1",
+	},
+	"apps/v1beta1": {
+		"deployment":  "apps/v1",
+		"statefulset": "apps/v1",
+	},
+	"apps/v1beta2": {
+		"daemonset":   "apps/v1",
+		"deployment":  "apps/v1",
+		"replicaset":  "apps/v1",
+		"statefulset": "apps/v1",
+	},
+}
+
+// selectorKinds are the kinds which select the pods they manage
+// with a label selector at `spec.selector`, and supply the labels for
+// those pods at `spec.template.metadata.labels`. A
+// ReplicationController uses a plain map of labels, rather than a
+// label selector.
+var selectorKinds = map[string]bool{
+	"daemonset":             true,
+	"deployment":            true,
+	"replicaset":            true,
+	"replicationcontroller": true,
+	"statefulset":           true,
+}
+
+// Lint checks the manifest given, which is of a single resource, for
+// problems that may not stop it being applied but are likely to be
+// mistakes, or to cause trouble later: deprecated API versions,
+// containers without resource limits, and pod selectors that are
+// invalid or don't match the pod template.
+func Lint(def []byte) ([]LintProblem, error) {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(def, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	res := doc.Content[0]
+	var problems []LintProblem
+	problems = append(problems, lintAPIVersion(res)...)
+	problems = append(problems, lintResourceLimits(res)...)
+	problems = append(problems, lintSelector(res)...)
+	return problems, nil
+}
+
+func lintAPIVersion(res *yaml3.Node) []LintProblem {
+	apiVersion := scalarValue(mappingValue(res, "apiVersion"))
+	kind := scalarValue(mappingValue(res, "kind"))
+	if replacement, ok := deprecatedAPIVersions[apiVersion][strings.ToLower(kind)]; ok {
+		return []LintProblem{{
+			Rule:    LintDeprecatedAPIVersion,
+			Message: fmt.Sprintf("%s %s is deprecated; use %s", apiVersion, kind, replacement),
+		}}
+	}
+	return nil
+}
+
+func lintResourceLimits(res *yaml3.Node) []LintProblem {
+	var problems []LintProblem
+	for _, podSpec := range findPodSpecs(res) {
+		containers := podSpecContainers(podSpec)
+		if inits := mappingValue(podSpec, "initContainers"); inits != nil && inits.Kind == yaml3.SequenceNode {
+			for _, c := range inits.Content {
+				if c = resolve(c); c.Kind == yaml3.MappingNode {
+					containers = append(containers, c)
+				}
+			}
+		}
+		for _, c := range containers {
+			name := scalarValue(mappingValue(c, "name"))
+			limits := mappingValue(mappingValue(c, "resources"), "limits")
+			var missing []string
+			for _, r := range []string{"cpu", "memory"} {
+				if mappingValue(limits, r) == nil {
+					missing = append(missing, r)
+				}
+			}
+			switch len(missing) {
+			case 0:
+			case 1:
+				problems = append(problems, LintProblem{
+					Rule:    LintMissingResourceLimits,
+					Message: fmt.Sprintf("container %q has no %s limit", name, missing[0]),
+				})
+			default:
+				problems = append(problems, LintProblem{
+					Rule:    LintMissingResourceLimits,
+					Message: fmt.Sprintf("container %q has no resource limits", name),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+func lintSelector(res *yaml3.Node) []LintProblem {
+	kind := strings.ToLower(scalarValue(mappingValue(res, "kind")))
+	if !selectorKinds[kind] {
+		return nil
+	}
+	invalid := func(format string, args ...interface{}) []LintProblem {
+		return []LintProblem{{Rule: LintInvalidSelector, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	spec := mappingValue(res, "spec")
+	podLabels, err := labelMap(mappingValue(mappingValue(mappingValue(spec, "template"), "metadata"), "labels"))
+	if err != nil {
+		return invalid("pod template labels: %s", err)
+	}
+	selector := mappingValue(spec, "selector")
+	if selector == nil {
+		// The selector is defaulted to the pod template labels, in
+		// API versions before apps/v1
+		if scalarValue(mappingValue(res, "apiVersion")) == "apps/v1" {
+			return invalid("spec.selector is required in apps/v1")
+		}
+		return nil
+	}
+
+	var sel labelSelector
+	if kind == "replicationcontroller" {
+		if sel.matchLabels, err = labelMap(selector); err != nil {
+			return invalid("spec.selector: %s", err)
+		}
+	} else {
+		if sel, err = parseLabelSelector(selector); err != nil {
+			return invalid("spec.selector: %s", err)
+		}
+	}
+	if sel.empty() {
+		return invalid("spec.selector is empty, and would select all pods")
+	}
+	if !sel.matches(podLabels) {
+		return invalid("spec.selector does not match the labels of the pod template")
+	}
+	return nil
+}
+
+// ---
+
+var (
+	labelNameRegexp   = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]$`)
+	labelPrefixRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// validLabelKey checks for a label key as Kubernetes would: an
+// optional DNS subdomain prefix and a slash, then a name of at most
+// 63 characters.
+func validLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) > 253 || !labelPrefixRegexp.MatchString(prefix) {
+			return fmt.Errorf("invalid label key %q: prefix must be a DNS subdomain", key)
+		}
+	}
+	if len(name) > 63 || !labelNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid label key %q: name must be at most 63 alphanumeric characters, '-', '_' or '.', starting and ending with an alphanumeric character", key)
+	}
+	return nil
+}
+
+func validLabelValue(key, value string) error {
+	if value != "" && (len(value) > 63 || !labelNameRegexp.MatchString(value)) {
+		return fmt.Errorf("invalid value %q for label %q: must be empty, or at most 63 alphanumeric characters, '-', '_' or '.', starting and ending with an alphanumeric character", value, key)
+	}
+	return nil
+}
+
+// labelString returns the string value of a node used as a label key
+// or value. The values in a map of labels must be strings; a number
+// or boolean, e.g., `version: 1`, won't be accepted by the API.
+func labelString(n *yaml3.Node) (string, error) {
+	n = resolve(n)
+	if n == nil {
+		return "", errors.New("missing value")
+	}
+	if n.Kind != yaml3.ScalarNode {
+		return "", errors.New("expected a string")
+	}
+	if n.ShortTag() != "!!str" {
+		return "", fmt.Errorf("%s is not a string; quote it", n.Value)
+	}
+	return n.Value, nil
+}
+
+// labelMap returns the labels in the mapping node given, checking
+// that each key and value is valid. A nil node is an empty set of
+// labels.
+func labelMap(n *yaml3.Node) (map[string]string, error) {
+	n = resolve(n)
+	labels := map[string]string{}
+	if n == nil {
+		return labels, nil
+	}
+	if n.Kind != yaml3.MappingNode {
+		return nil, errors.New("expected a map of labels")
+	}
+	// Entries given explicitly take precedence over merged entries,
+	// so do the merges first. As in mappingEntry, earlier merged
+	// mappings take precedence over later ones.
+	var merges []*yaml3.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if isMergeKey(n.Content[i]) {
+			v := resolve(n.Content[i+1])
+			if v.Kind == yaml3.SequenceNode {
+				merges = append(merges, v.Content...)
+			} else {
+				merges = append(merges, v)
+			}
+		}
+	}
+	for i := len(merges) - 1; i >= 0; i-- {
+		merged, err := labelMap(merges[i])
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range merged {
+			labels[k] = v
+		}
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if isMergeKey(k) {
+			continue
+		}
+		key, err := labelString(k)
+		if err != nil {
+			return nil, err
+		}
+		if err := validLabelKey(key); err != nil {
+			return nil, err
+		}
+		value, err := labelString(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "label %q", key)
+		}
+		if err := validLabelValue(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// labelSelector is a (parsed and checked) label selector, as in
+// `metav1.LabelSelector`.
+type labelSelector struct {
+	matchLabels      map[string]string
+	matchExpressions []selectorRequirement
+}
+
+type selectorRequirement struct {
+	key      string
+	operator string
+	values   []string
+}
+
+func parseLabelSelector(n *yaml3.Node) (labelSelector, error) {
+	var sel labelSelector
+	n = resolve(n)
+	if n.Kind != yaml3.MappingNode {
+		return sel, errors.New("expected a label selector")
+	}
+	var err error
+	if sel.matchLabels, err = labelMap(mappingValue(n, "matchLabels")); err != nil {
+		return sel, err
+	}
+	exprs := mappingValue(n, "matchExpressions")
+	if exprs == nil {
+		return sel, nil
+	}
+	if exprs.Kind != yaml3.SequenceNode {
+		return sel, errors.New("expected a list of match expressions")
+	}
+	for _, expr := range exprs.Content {
+		req, err := parseRequirement(resolve(expr))
+		if err != nil {
+			return sel, err
+		}
+		sel.matchExpressions = append(sel.matchExpressions, req)
+	}
+	return sel, nil
+}
+
+func parseRequirement(n *yaml3.Node) (selectorRequirement, error) {
+	var req selectorRequirement
+	var err error
+	if req.key, err = labelString(mappingValue(n, "key")); err != nil {
+		return req, errors.Wrap(err, "key of match expression")
+	}
+	if err := validLabelKey(req.key); err != nil {
+		return req, err
+	}
+	req.operator = scalarValue(mappingValue(n, "operator"))
+	if values := mappingValue(n, "values"); values != nil {
+		if values.Kind != yaml3.SequenceNode {
+			return req, fmt.Errorf("expected a list of values for %q", req.key)
+		}
+		for _, v := range values.Content {
+			value, err := labelString(v)
+			if err != nil {
+				return req, err
+			}
+			if err := validLabelValue(req.key, value); err != nil {
+				return req, err
+			}
+			req.values = append(req.values, value)
+		}
+	}
+	switch req.operator {
+	case "In", "NotIn":
+		if len(req.values) == 0 {
+			return req, fmt.Errorf("operator %s for %q needs at least one value", req.operator, req.key)
+		}
+	case "Exists", "DoesNotExist":
+		if len(req.values) > 0 {
+			return req, fmt.Errorf("operator %s for %q must not have values", req.operator, req.key)
+		}
+	default:
+		return req, fmt.Errorf("unknown operator %q for %q; expected one of In, NotIn, Exists, DoesNotExist", req.operator, req.key)
+	}
+	return req, nil
+}
+
+func (sel labelSelector) empty() bool {
+	return len(sel.matchLabels) == 0 && len(sel.matchExpressions) == 0
+}
+
+func (sel labelSelector) matches(labels map[string]string) bool {
+	for k, v := range sel.matchLabels {
+		if have, ok := labels[k]; !ok || have != v {
+			return false
+		}
+	}
+	for _, req := range sel.matchExpressions {
+		have, ok := labels[req.key]
+		switch req.operator {
+		case "In":
+			if !ok || !contains(req.values, have) {
+				return false
+			}
+		case "NotIn":
+			if ok && contains(req.values, have) {
+				return false
+			}
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package resource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const lintedPodSpec = `
+  template:
+    metadata:
+      labels:
+        app: hello
+        tier: web
+    spec:
+      containers:
+      - name: hello
+        image: quay.io/weaveworks/helloworld:master-a000001
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+`
+
+func TestLint(t *testing.T) {
+	for name, c := range map[string]struct {
+		manifest string
+		expected []LintProblem
+	}{
+		"no problems": {
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  selector:
+    matchLabels:
+      app: hello
+    matchExpressions:
+    - {key: tier, operator: In, values: [web, api]}
+    - {key: canary, operator: DoesNotExist}` + lintedPodSpec,
+		},
+		"deprecated API version": {
+			manifest: `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: hello
+spec:` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintDeprecatedAPIVersion, "extensions/v1beta1 Deployment is deprecated; use apps/v1"},
+			},
+		},
+		"deprecated API version, for some kinds only": {
+			manifest: `apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: hello
+---
+apiVersion: apps/v1beta1
+kind: ControllerRevision
+metadata:
+  name: hello
+`,
+			expected: []LintProblem{
+				{LintDeprecatedAPIVersion, "extensions/v1beta1 Ingress is deprecated; use networking.k8s.io/v1beta1"},
+			},
+		},
+		"missing resource limits": {
+			manifest: `apiVersion: v1
+kind: Pod
+metadata:
+  name: hello
+spec:
+  initContainers:
+  - name: init
+    image: busybox
+  containers:
+  - name: main
+    image: quay.io/weaveworks/helloworld:master-a000001
+    resources:
+      limits:
+        cpu: 100m
+      requests:
+        memory: 64Mi
+`,
+			expected: []LintProblem{
+				{LintMissingResourceLimits, `container "main" has no memory limit`},
+				{LintMissingResourceLimits, `container "init" has no resource limits`},
+			},
+		},
+		"missing selector in apps/v1": {
+			manifest: `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: hello
+spec:` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, "spec.selector is required in apps/v1"},
+			},
+		},
+		"missing selector before apps/v1": {
+			manifest: `apiVersion: v1
+kind: ReplicationController
+metadata:
+  name: hello
+spec:` + lintedPodSpec,
+		},
+		"selector not matching the pod template": {
+			manifest: `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: hello
+spec:
+  selector:
+    matchLabels:
+      app: goodbye` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, "spec.selector does not match the labels of the pod template"},
+			},
+		},
+		"selector with an unknown operator": {
+			manifest: `apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: hello
+spec:
+  selector:
+    matchExpressions:
+    - key: app
+      operator: Equals
+      values: [hello]` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, `spec.selector: unknown operator "Equals" for "app"; expected one of In, NotIn, Exists, DoesNotExist`},
+			},
+		},
+		"selector with a number for a value": {
+			manifest: `apiVersion: v1
+kind: ReplicationController
+metadata:
+  name: hello
+spec:
+  selector:
+    app: hello
+    version: 1` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, `spec.selector: label "version": 1 is not a string; quote it`},
+			},
+		},
+		"selector with an invalid key": {
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  selector:
+    matchLabels:
+      -app: hello` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, `spec.selector: invalid label key "-app": name must be at most 63 alphanumeric characters, '-', '_' or '.', starting and ending with an alphanumeric character`},
+			},
+		},
+		"empty selector": {
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  selector: {}` + lintedPodSpec,
+			expected: []LintProblem{
+				{LintInvalidSelector, "spec.selector is empty, and would select all pods"},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var problems []LintProblem
+			for _, doc := range strings.Split(c.manifest, "---\n") {
+				ps, err := Lint([]byte(doc))
+				if err != nil {
+					t.Fatal(err)
+				}
+				problems = append(problems, ps...)
+			}
+			if !reflect.DeepEqual(c.expected, problems) {
+				t.Errorf("expected %#v, got %#v", c.expected, problems)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package resource
 
 import (
+	"strings"
+
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -8,3 +10,16 @@ type List struct {
 	baseObject
 	Items []resource.Resource
 }
+
+// isList reports whether a document is a list of resources; either
+// the generic `List`, or a list of a particular kind, like
+// `DeploymentList`. Lists are in the core API group (`apiVersion:
+// v1`) and have a sequence of items; other kinds that just happen to
+// end in "List" are left alone. A `List` without an apiVersion is
+// accepted, as it always has been.
+func isList(apiVersion, kind string, hasItems bool) bool {
+	if !hasItems || !strings.HasSuffix(kind, "List") {
+		return false
+	}
+	return apiVersion == "v1" || (apiVersion == "" && kind == "List")
+}
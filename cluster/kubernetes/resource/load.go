@@ -3,12 +3,21 @@ package resource
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/cluster"
+	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/resource"
 )
 
@@ -16,8 +25,107 @@ import (
 // based on the file(s) therein. Resources are named according to the
 // file content, rather than the file name of directory structure.
 func Load(base, atLeastOne string, more ...string) (map[string]resource.Resource, error) {
-	roots := append([]string{atLeastOne}, more...)
+	return LoadExcept(base, nil, append([]string{atLeastOne}, more...))
+}
+
+// LoadExcept is like Load, but does not look in the directories
+// given in `except` (nor those under them), which are absolute
+// paths, as the roots are.
+func LoadExcept(base string, except, roots []string) (map[string]resource.Resource, error) {
+	objs, _, err := LoadReporting(base, except, roots, false)
+	return objs, err
+}
+
+// LoadReporting is like LoadExcept, but also returns the files it
+// skipped, and why. If `strict` is true, a manifest file with a
+// document that isn't a resource is an error, rather than being
+// skipped.
+func LoadReporting(base string, except, roots []string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error) {
+	return loadReporting(base, except, roots, strict, ParseMultidocReporting)
+}
+
+// WalkReporting is like LoadReporting, but rather than returning the
+// resources, it calls `fn` with each in turn, as it's parsed. Files
+// are read a document at a time, and a resource isn't kept once `fn`
+// returns; so, besides what `fn` keeps, only the ID of each resource
+// (to catch duplicates) is held for the whole walk. If `fn` returns
+// an error, the walk stops with it.
+func WalkReporting(base string, except, roots []string, strict bool, fn func(resource.Resource) error) ([]cluster.SkippedFile, error) {
+	sources := map[string]string{}
+	return walkFiles(base, except, roots, func(path, source string) ([]cluster.SkippedFile, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read file at %q", path)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if filepath.Ext(path) == ".json" {
+			// A JSON file is a single document, so it's read whole
+			content, err := ioutil.ReadAll(f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to read file at %q", path)
+			}
+			if reason := notJSONManifest(content); reason != "" {
+				return skipNotJSONManifest(source, reason, strict)
+			}
+			r = bytes.NewReader(content)
+		}
+		return parseMultidocStream(r, source, strict, func(obj resource.Resource) error {
+			id := obj.ResourceID().String()
+			if other, ok := sources[id]; ok && other != source {
+				return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, other, source)
+			}
+			sources[id] = source
+			if hr, ok := obj.(*HelmRelease); ok {
+				hr.readValuesFiles(base)
+			}
+			return fn(obj)
+		})
+	})
+}
+
+type parseFunc func(multidoc []byte, source string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error)
+
+func loadReporting(base string, except, roots []string, strict bool, parse parseFunc) (map[string]resource.Resource, []cluster.SkippedFile, error) {
 	objs := map[string]resource.Resource{}
+	skipped, err := walkFiles(base, except, roots, func(path, source string) ([]cluster.SkippedFile, error) {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read file at %q", path)
+		}
+		if filepath.Ext(path) == ".json" {
+			if reason := notJSONManifest(bytes); reason != "" {
+				return skipNotJSONManifest(source, reason, strict)
+			}
+		}
+		docsInFile, skippedInFile, err := parse(bytes, source, strict)
+		if err != nil {
+			return nil, err
+		}
+		for id, obj := range docsInFile {
+			if hr, ok := obj.(*HelmRelease); ok {
+				hr.readValuesFiles(base)
+			}
+			if alreadyDefined, ok := objs[id]; ok {
+				return nil, fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
+			}
+			objs[id] = obj
+		}
+		return skippedInFile, nil
+	})
+	return objs, skipped, err
+}
+
+// walkFiles calls `load` with each manifest file under the roots
+// (other than those in charts, or under the directories in
+// `except`), along with its path relative to `base`. It returns the
+// files skipped, including those `load` reports.
+func walkFiles(base string, except, roots []string, load func(path, source string) ([]cluster.SkippedFile, error)) ([]cluster.SkippedFile, error) {
+	excluded := map[string]bool{}
+	for _, dir := range except {
+		excluded[filepath.Clean(dir)] = true
+	}
+	var skipped []cluster.SkippedFile
 	charts, err := newChartTracker(base)
 	if err != nil {
 		return nil, errors.Wrapf(err, "walking %q for chartdirs", base)
@@ -27,43 +135,95 @@ func Load(base, atLeastOne string, more ...string) (map[string]resource.Resource
 			if err != nil {
 				return errors.Wrapf(err, "walking %q for yamels", path)
 			}
+			source, err := filepath.Rel(base, path)
+			if err != nil {
+				return errors.Wrapf(err, "path to scan %q is not under base %q", path, base)
+			}
 
 			if charts.isDirChart(path) {
+				skipped = append(skipped, cluster.SkippedFile{Path: source, Reason: "directory is a Helm chart"})
+				return filepath.SkipDir
+			}
+			if info.IsDir() && excluded[filepath.Clean(path)] {
 				return filepath.SkipDir
 			}
 
-			if charts.isPathInChart(path) {
+			if charts.isPathInChart(path) || info.IsDir() {
 				return nil
 			}
 
-			if !info.IsDir() && filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
-				bytes, err := ioutil.ReadFile(path)
-				if err != nil {
-					return errors.Wrapf(err, "unable to read file at %q", path)
-				}
-				source, err := filepath.Rel(base, path)
-				if err != nil {
-					return errors.Wrapf(err, "path to scan %q is not under base %q", path, base)
-				}
-				docsInFile, err := ParseMultidoc(bytes, source)
-				if err != nil {
-					return err
-				}
-				for id, obj := range docsInFile {
-					if alreadyDefined, ok := objs[id]; ok {
-						return fmt.Errorf(`duplicate definition of '%s' (in %s and %s)`, id, alreadyDefined.Source(), source)
-					}
-					objs[id] = obj
+			if !isManifestFile(path) {
+				if !isHidden(source) {
+					skipped = append(skipped, cluster.SkippedFile{Path: source, Reason: "not a .yaml, .yml or .json file"})
 				}
+				return nil
 			}
-			return nil
+
+			skippedInFile, err := load(path, source)
+			skipped = append(skipped, skippedInFile...)
+			return err
 		})
 		if err != nil {
-			return objs, err
+			return skipped, err
 		}
 	}
 
-	return objs, nil
+	return skipped, nil
+}
+
+// isManifestFile reports whether the file at the path given should be
+// read for resources. YAML is expected, but JSON is accepted too (it
+// being a subset of YAML, it's parsed the same way).
+func isManifestFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// notJSONManifest gives the reason a JSON file is not a manifest, or
+// "" if it looks like one. Plenty of JSON files aren't manifests
+// (`package.json`, `tsconfig.json`, ...); these are skipped, rather
+// than failing to parse as resources.
+func notJSONManifest(bytes []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(bytes, &v); err != nil {
+		return "not valid JSON"
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return "JSON file is not an object, so is not a resource"
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if apiVersion == "" || kind == "" {
+		return "JSON file has no apiVersion and kind, so is not a resource"
+	}
+	return ""
+}
+
+// skipNotJSONManifest reports a JSON file that isn't a manifest as
+// skipped; or, if `strict`, fails, as for a YAML document that isn't
+// a resource.
+func skipNotJSONManifest(source, reason string, strict bool) ([]cluster.SkippedFile, error) {
+	if strict {
+		return nil, makeUnmarshalObjectErr(source, &cluster.FileError{Path: source, Message: reason})
+	}
+	return []cluster.SkippedFile{{Path: source, Reason: reason}}, nil
+}
+
+// isHidden reports whether the path given, or any directory it's
+// in, is hidden (has a name starting with '.'); e.g., it's under
+// `.git/`. Hidden files that aren't manifests aren't worth a mention
+// in the files skipped.
+func isHidden(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if strings.HasPrefix(elem, ".") && elem != "." && elem != ".." {
+			return true
+		}
+	}
+	return false
 }
 
 type chartTracker map[string]bool
@@ -126,42 +286,131 @@ func looksLikeChart(dir string) bool {
 // ParseMultidoc takes a dump of config (a multidoc YAML) and
 // constructs an object set from the resources represented therein.
 func ParseMultidoc(multidoc []byte, source string) (map[string]resource.Resource, error) {
+	objs, _, err := ParseMultidocReporting(multidoc, source, false)
+	return objs, err
+}
+
+// ParseMultidocReporting is like ParseMultidoc, but also returns the
+// documents that were skipped because they aren't resources; or, if
+// `strict` is true, fails on the first such document. Errors in
+// parsing give the line, in the multidoc, at which they occur.
+func ParseMultidocReporting(multidoc []byte, source string, strict bool) (map[string]resource.Resource, []cluster.SkippedFile, error) {
 	objs := map[string]resource.Resource{}
-	chunks := bufio.NewScanner(bytes.NewReader(multidoc))
+	skipped, err := parseMultidocStream(bytes.NewReader(multidoc), source, strict, func(obj resource.Resource) error {
+		objs[obj.ResourceID().String()] = obj
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return objs, skipped, nil
+}
+
+// parseMultidocStream reads a multidoc YAML a document at a time,
+// and calls `fn` with each resource in it, as ParseMultidocReporting
+// would return them. It returns the documents skipped; or an error,
+// if a document can't be parsed (or, if `strict`, isn't a resource),
+// or `fn` returns one.
+func parseMultidocStream(r io.Reader, source string, strict bool, fn func(resource.Resource) error) ([]cluster.SkippedFile, error) {
+	var skipped []cluster.SkippedFile
+	chunks := bufio.NewScanner(r)
 	initialBuffer := make([]byte, 4096)     // Matches startBufSize in bufio/scan.go
 	chunks.Buffer(initialBuffer, 1024*1024) // Allow growth to 1MB
-	chunks.Split(splitYAMLDocument)
+	// Keep track of the line each document starts at, for reporting
+	line, docLine := 1, 1
+	chunks.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := splitYAMLDocument(data, atEOF)
+		if token != nil {
+			docLine = line
+			line += bytes.Count(data[:advance], []byte("\n"))
+		}
+		return advance, token, err
+	})
 
 	var obj resource.Resource
 	var err error
 	for chunks.Scan() {
 		// It's not guaranteed that the return value of Bytes() will not be mutated later:
 		// https://golang.org/pkg/bufio/#Scanner.Bytes
-		// But we will be snaffling it away, so make a copy.
+		// But we will be snaffling it away, so make a copy. Only
+		// the length of the document is copied: the capacity is
+		// whatever's left of the scanner's buffer, and keeping that
+		// for every resource would hold far more memory than needed.
 		bytes := chunks.Bytes()
-		bytes2 := make([]byte, len(bytes), cap(bytes))
+		bytes2 := make([]byte, len(bytes))
 		copy(bytes2, bytes)
 		if obj, err = unmarshalObject(source, bytes2); err != nil {
-			return nil, errors.Wrapf(err, "parsing YAML doc from %q", source)
+			return nil, makeUnmarshalObjectErr(source, makeParseError(source, docLine, err))
 		}
 		if obj == nil {
+			if isEmptyDocument(bytes2) {
+				continue
+			}
+			if strict {
+				return nil, makeUnmarshalObjectErr(source, &cluster.FileError{
+					Path:    source,
+					Line:    docLine,
+					Message: "document has no kind, so is not a resource",
+				})
+			}
+			skipped = append(skipped, cluster.SkippedFile{Path: source, Line: docLine, Reason: "document has no kind, so is not a resource"})
 			continue
 		}
 		// Lists must be treated specially, since it's the
 		// contained resources we are after.
 		if list, ok := obj.(*List); ok {
 			for _, item := range list.Items {
-				objs[item.ResourceID().String()] = item
+				if err := fn(item); err != nil {
+					return skipped, err
+				}
 			}
-		} else {
-			objs[obj.ResourceID().String()] = obj
+		} else if err := fn(obj); err != nil {
+			return skipped, err
 		}
 	}
 
 	if err := chunks.Err(); err != nil {
-		return objs, errors.Wrapf(err, "scanning multidoc from %q", source)
+		return skipped, errors.Wrapf(err, "scanning multidoc from %q", source)
+	}
+	return skipped, nil
+}
+
+// isEmptyDocument reports whether a YAML document has nothing in it
+// but (perhaps) comments and whitespace.
+func isEmptyDocument(doc []byte) bool {
+	var v interface{}
+	return yaml.Unmarshal(doc, &v) == nil && v == nil
+}
+
+// yamlErrorLine matches the line numbers in the errors from the YAML
+// parser; either in a syntax error, `yaml: line 3: ...`, or in each
+// of the errors of a type error, `  line 3: ...`.
+var yamlErrorLine = regexp.MustCompile(`(?m)^(yaml: |  )line (\d+): `)
+
+// makeParseError gives an error from parsing the document starting
+// at line `docLine` of a file, with line numbers counted from the
+// beginning of the file rather than the document.
+func makeParseError(source string, docLine int, err error) *cluster.FileError {
+	if fe, ok := err.(*fluxerr.Error); ok {
+		err = fe.Err
 	}
-	return objs, nil
+	fileErr := &cluster.FileError{Path: source, Line: docLine}
+	first := true
+	fileErr.Message = yamlErrorLine.ReplaceAllStringFunc(err.Error(), func(match string) string {
+		sub := yamlErrorLine.FindStringSubmatch(match)
+		n, _ := strconv.Atoi(sub[2])
+		n += docLine - 1
+		if first {
+			fileErr.Line = n
+			first = false
+		}
+		if sub[1] == "yaml: " {
+			// the line is given by the FileError itself
+			return sub[1]
+		}
+		return fmt.Sprintf("%sline %d: ", sub[1], n)
+	})
+	return fileErr
 }
 
 // ---
@@ -0,0 +1,133 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/weaveworks/flux/resource"
+)
+
+// benchManifest gives a deployment and a service, as would typically
+// be found together in a file.
+func benchManifest(i int) string {
+	return fmt.Sprintf(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-%[1]d
+  namespace: bench
+  annotations:
+    flux.weave.works/automated: "true"
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: app-%[1]d
+  template:
+    metadata:
+      labels:
+        app: app-%[1]d
+    spec:
+      containers:
+      - name: main
+        image: quay.io/weaveworks/helloworld:master-a000001
+        ports:
+        - containerPort: 80
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app-%[1]d
+  namespace: bench
+spec:
+  selector:
+    app: app-%[1]d
+  ports:
+  - port: 80
+`, i)
+}
+
+func benchRepo(b *testing.B, files int) (string, func()) {
+	dir, err := ioutil.TempDir("", "flux-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < files; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("dir-%d", i%100), fmt.Sprintf("app-%d.yaml", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			b.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(benchManifest(i)), 0666); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func BenchmarkLoad(b *testing.B) {
+	for _, files := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			dir, cleanup := benchRepo(b, files)
+			defer cleanup()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Load(dir, dir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWalk walks the manifests without keeping them, as a sync
+// does; compare the memory allocated with BenchmarkLoad.
+func BenchmarkWalk(b *testing.B) {
+	for _, files := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("files=%d", files), func(b *testing.B) {
+			dir, cleanup := benchRepo(b, files)
+			defer cleanup()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := WalkReporting(dir, nil, []string{dir}, false, func(resource.Resource) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoadCached(b *testing.B) {
+	dir, cleanup := benchRepo(b, 10000)
+	defer cleanup()
+	cache := NewCache()
+	if _, _, err := cache.LoadReporting(dir, nil, []string{dir}, false); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := cache.LoadReporting(dir, nil, []string{dir}, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseMultidoc(b *testing.B) {
+	var multidoc bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		multidoc.WriteString(benchManifest(i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseMultidoc(multidoc.Bytes(), "bench"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,13 +2,18 @@ package resource
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
 	"github.com/weaveworks/flux/resource"
 )
@@ -185,6 +190,55 @@ items:
 	}
 }
 
+func TestUnmarshalKindedList(t *testing.T) {
+	doc := `---
+apiVersion: v1
+kind: DeploymentList
+items:
+- kind: Deployment
+  metadata:
+    name: foo
+- {}
+- kind: Deployment
+  metadata:
+    name: bar
+    namespace: baz
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expected two resources, got %+v", objs)
+	}
+	for _, id := range []string{"default:deployment/foo", "baz:deployment/bar"} {
+		if _, ok := objs[id]; !ok {
+			t.Errorf("expected %s in %+v", id, objs)
+		}
+	}
+}
+
+func TestUnmarshalNotList(t *testing.T) {
+	// A custom resource that only looks like a list
+	doc := `---
+apiVersion: example.com/v1
+kind: AllowList
+metadata:
+  name: allowed
+items:
+- kind: Deployment
+  metadata:
+    name: foo
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs["default:allowlist/allowed"]; !ok || len(objs) != 1 {
+		t.Errorf("expected only the AllowList, got %+v", objs)
+	}
+}
+
 func debyte(r resource.Resource) resource.Resource {
 	if res, ok := r.(interface {
 		debyte()
@@ -209,6 +263,242 @@ func TestLoadSome(t *testing.T) {
 	}
 }
 
+func TestLoadJSON(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	files := map[string]string{
+		"helloworld-deploy.json": `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {"name": "helloworld", "namespace": "hello"}
+}
+`,
+		"notes.txt": `kind: Deployment
+metadata:
+  name: not-a-manifest
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objs, err := Load(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 {
+		t.Fatalf("expected one resource, got %#v", objs)
+	}
+	res, ok := objs["hello:deployment/helloworld"]
+	if !ok {
+		t.Fatalf("expected deployment from JSON file, got %#v", objs)
+	}
+	if res.Source() != "helloworld-deploy.json" {
+		t.Errorf("expected source of helloworld-deploy.json, got %q", res.Source())
+	}
+}
+
+func TestParseMultidocReporting(t *testing.T) {
+	doc := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+# just a comment
+---
+settings:
+  debug: true
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+`
+	objs, skipped, err := ParseMultidocReporting([]byte(doc), "test.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("expected two resources, got %#v", objs)
+	}
+	expected := []cluster.SkippedFile{
+		{Path: "test.yaml", Line: 9, Reason: "document has no kind, so is not a resource"},
+	}
+	if !reflect.DeepEqual(expected, skipped) {
+		t.Errorf("expected skipped %#v, got %#v", expected, skipped)
+	}
+
+	_, _, err = ParseMultidocReporting([]byte(doc), "test.yaml", true)
+	fileErr, ok := cluster.AsFileError(err)
+	if !ok {
+		t.Fatalf("expected a FileError in strict mode, got %v", err)
+	}
+	if fileErr.Path != "test.yaml" || fileErr.Line != 9 {
+		t.Errorf("expected error at test.yaml:9, got %v", fileErr)
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	doc := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: svc
+  labels: app: svc
+`
+	_, err := ParseMultidoc([]byte(doc), "test.yaml")
+	fileErr, ok := cluster.AsFileError(err)
+	if !ok {
+		t.Fatalf("expected a FileError, got %v", err)
+	}
+	expected := &cluster.FileError{
+		Path:    "test.yaml",
+		Line:    11,
+		Message: "yaml: mapping values are not allowed in this context",
+	}
+	if !reflect.DeepEqual(expected, fileErr) {
+		t.Errorf("expected %#v, got %#v", expected, fileErr)
+	}
+}
+
+func TestLoadReporting(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"README.md":         "# Manifests\n",
+		".hidden/notes.txt": "not reported\n",
+		"settings.yaml":     "debug: true\n",
+		"package.json":      `{"name": "website", "version": "1.0.0"}`,
+		"servers.json":      `["a.example.com", "b.example.com"]`,
+		"tsconfig.json":     "{\n  // comments aren't JSON\n}\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, skipped, err := LoadReporting(dir, nil, []string{dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != len(testfiles.ResourceMap) {
+		t.Errorf("expected %d objects, got %#v", len(testfiles.ResourceMap), objs)
+	}
+	reasons := map[string]string{}
+	for _, s := range skipped {
+		reasons[s.Path] = s.Reason
+	}
+	for path, reason := range map[string]string{
+		"README.md":     "not a .yaml, .yml or .json file",
+		"garbage":       "not a .yaml, .yml or .json file",
+		"charts/nginx":  "directory is a Helm chart",
+		"settings.yaml": "document has no kind, so is not a resource",
+		"package.json":  "JSON file has no apiVersion and kind, so is not a resource",
+		"servers.json":  "JSON file is not an object, so is not a resource",
+		"tsconfig.json": "not valid JSON",
+	} {
+		if reasons[path] != reason {
+			t.Errorf("expected %s to be skipped with reason %q, got %q", path, reason, reasons[path])
+		}
+	}
+	if _, ok := reasons[".hidden/notes.txt"]; ok {
+		t.Error("expected hidden file not to be reported as skipped")
+	}
+
+	if _, _, err := LoadReporting(dir, nil, []string{dir}, true); err == nil {
+		t.Error("expected an error in strict mode, for a document without a kind")
+	}
+}
+
+func TestLoadReportingStrictJSON(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "website", "version": "1.0.0"}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "package.json: JSON file has no apiVersion and kind, so is not a resource"
+	_, _, err := LoadReporting(dir, nil, []string{dir}, true)
+	if fileErr, ok := cluster.AsFileError(err); !ok || fileErr.Error() != expected {
+		t.Errorf("expected error %q in strict mode, got %v", expected, err)
+	}
+	_, err = WalkReporting(dir, nil, []string{dir}, true, func(resource.Resource) error { return nil })
+	if fileErr, ok := cluster.AsFileError(err); !ok || fileErr.Error() != expected {
+		t.Errorf("expected error %q walking in strict mode, got %v", expected, err)
+	}
+}
+
+func TestWalkReporting(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := testfiles.WriteTestFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "settings.yaml"), []byte("debug: true\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, skipped, err := LoadReporting(dir, nil, []string{dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	walked := map[string]string{}
+	walkSkipped, err := WalkReporting(dir, nil, []string{dir}, false, func(res resource.Resource) error {
+		walked[res.ResourceID().String()] = string(res.Bytes())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := map[string]string{}
+	for id, res := range objs {
+		loaded[id] = string(res.Bytes())
+	}
+	if !reflect.DeepEqual(loaded, walked) {
+		t.Errorf("expected the resources walked to be those loaded:\n%#v\ngot:\n%#v", loaded, walked)
+	}
+	if !reflect.DeepEqual(skipped, walkSkipped) {
+		t.Errorf("expected the files skipped in the walk to be those skipped loading:\n%#v\ngot:\n%#v", skipped, walkSkipped)
+	}
+
+	if _, err := WalkReporting(dir, nil, []string{dir}, true, func(resource.Resource) error { return nil }); err == nil {
+		t.Error("expected an error in strict mode, for a document without a kind")
+	}
+	stop := errors.New("stop")
+	n := 0
+	if _, err := WalkReporting(dir, nil, []string{dir}, false, func(resource.Resource) error {
+		n++
+		return stop
+	}); err != stop || n != 1 {
+		t.Errorf("expected the walk to stop at the first error; got %v after %d resources", err, n)
+	}
+
+	// A resource defined in two files is an error, as it is loading
+	if err := ioutil.WriteFile(filepath.Join(dir, "again.yaml"), []byte(testfiles.Files["helloworld-deploy.yaml"]), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WalkReporting(dir, nil, []string{dir}, false, func(resource.Resource) error { return nil }); err == nil || !strings.Contains(err.Error(), "duplicate definition") {
+		t.Errorf("expected an error about a duplicate definition, got %v", err)
+	}
+}
+
 func TestChartTracker(t *testing.T) {
 	dir, cleanup := testfiles.TempDir(t)
 	defer cleanup()
@@ -256,3 +546,40 @@ func TestChartTracker(t *testing.T) {
 	}
 
 }
+
+func TestParseAnchorsAndMerges(t *testing.T) {
+	doc := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      containers:
+      - &base
+        name: helloworld
+        image: &image quay.io/weaveworks/helloworld:master-07a1b6b
+      - <<: *base
+        name: echo
+      - name: sidecar
+        image: *image
+`
+	objs, err := ParseMultidoc([]byte(doc), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, ok := objs["default:deployment/helloworld"]
+	if !ok {
+		t.Fatalf("expected deployment; got %#v", objs)
+	}
+	containers := res.(resource.Workload).Containers()
+	if len(containers) != 3 {
+		t.Fatalf("expected three containers; got %#v", containers)
+	}
+	for i, name := range []string{"helloworld", "echo", "sidecar"} {
+		if containers[i].Name != name || containers[i].Image.String() != "quay.io/weaveworks/helloworld:master-07a1b6b" {
+			t.Errorf("unexpected container %d: %#v", i, containers[i])
+		}
+	}
+}
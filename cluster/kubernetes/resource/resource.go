@@ -43,6 +43,19 @@ func (o *baseObject) debyte() {
 	o.bytes = nil
 }
 
+// copyUnexported copies what would otherwise be shared between
+// copies of the object; see `copyResource`. (The bytes aren't changed
+// in place, so can be shared.)
+func (o *baseObject) copyUnexported() {
+	if o.Meta.Annotations != nil {
+		annotations := make(map[string]string, len(o.Meta.Annotations))
+		for k, v := range o.Meta.Annotations {
+			annotations[k] = v
+		}
+		o.Meta.Annotations = annotations
+	}
+}
+
 func (o baseObject) Policy() policy.Set {
 	set := policy.Set{}
 	for k, v := range o.Meta.Annotations {
@@ -79,6 +92,17 @@ func unmarshalObject(source string, bytes []byte) (resource.Resource, error) {
 }
 
 func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
+	// Lists of any kind (`List`, `DeploymentList`, ...) are unpacked
+	// into their items
+	var raw rawList
+	if strings.HasSuffix(base.Kind, "List") && yaml.Unmarshal(bytes, &raw) == nil && isList(raw.APIVersion, base.Kind, raw.Items != nil) {
+		var list List
+		if err := unmarshalList(base, &raw, &list); err != nil {
+			return nil, err
+		}
+		return &list, nil
+	}
+
 	switch base.Kind {
 	case "CronJob":
 		var cj = CronJob{baseObject: base}
@@ -110,20 +134,18 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 			return nil, err
 		}
 		return &ss, nil
-	case "List":
-		var raw rawList
-		if err := yaml.Unmarshal(bytes, &raw); err != nil {
-			return nil, err
-		}
-		var list List
-		unmarshalList(base, &raw, &list)
-		return &list, nil
 	case "FluxHelmRelease":
 		var fhr = FluxHelmRelease{baseObject: base}
 		if err := yaml.Unmarshal(bytes, &fhr); err != nil {
 			return nil, err
 		}
 		return &fhr, nil
+	case "HelmRelease":
+		var hr = HelmRelease{baseObject: base}
+		if err := yaml.Unmarshal(bytes, &hr); err != nil {
+			return nil, err
+		}
+		return &hr, nil
 	case "":
 		// If there is an empty resource (due to eg an introduced comment),
 		// we are returning nil for the resource and nil for an error
@@ -132,20 +154,27 @@ func unmarshalKind(base baseObject, bytes []byte) (resource.Resource, error) {
 		// assumption it is unlikely to happen.
 		return nil, nil
 	// The remainder are things we have to care about, but not
-	// treat specially
+	// treat specially; though they may run containers
 	default:
+		if w, ok := unmarshalPathsWorkload(base, bytes); ok {
+			return w, nil
+		}
+		if w, ok := unmarshalGenericWorkload(base, bytes); ok {
+			return w, nil
+		}
 		return &base, nil
 	}
 }
 
 type rawList struct {
-	Items []map[string]interface{}
+	APIVersion string `yaml:"apiVersion"`
+	Items      []map[string]interface{}
 }
 
 func unmarshalList(base baseObject, raw *rawList, list *List) error {
 	list.baseObject = base
-	list.Items = make([]resource.Resource, len(raw.Items), len(raw.Items))
-	for i, item := range raw.Items {
+	list.Items = make([]resource.Resource, 0, len(raw.Items))
+	for _, item := range raw.Items {
 		bytes, err := yaml.Marshal(item)
 		if err != nil {
 			return err
@@ -154,7 +183,9 @@ func unmarshalList(base baseObject, raw *rawList, list *List) error {
 		if err != nil {
 			return err
 		}
-		list.Items[i] = res
+		if res != nil {
+			list.Items = append(list.Items, res)
+		}
 	}
 	return nil
 }
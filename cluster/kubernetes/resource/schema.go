@@ -0,0 +1,184 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml3 "gopkg.in/yaml.v3"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+// ErrNoPodSpec is returned when asked to update the image of a
+// container in a resource that has no pod spec, i.e., which nothing
+// is known to run containers for.
+var ErrNoPodSpec = errors.New("resource has no pod spec")
+
+// podSpecPaths gives, for the kinds of resource Kubernetes comes
+// with, the path through the manifest to the pod spec (as in the API
+// types, a PodSpec within a PodTemplateSpec, usually). Other kinds
+// are interpreted by looking for fields which have the shape of a
+// pod spec; see `findPodSpecs`.
+var podSpecPaths = map[string][]string{
+	"cronjob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+	"daemonset":             {"spec", "template", "spec"},
+	"deployment":            {"spec", "template", "spec"},
+	"job":                   {"spec", "template", "spec"},
+	"pod":                   {"spec"},
+	"podtemplate":           {"template", "spec"},
+	"replicaset":            {"spec", "template", "spec"},
+	"replicationcontroller": {"spec", "template", "spec"},
+	"statefulset":           {"spec", "template", "spec"},
+}
+
+// maxPodSpecDepth is how deep in a manifest to look for pod specs,
+// for kinds not in podSpecPaths. It's enough for e.g., an Argo
+// Rollout or an OpenShift DeploymentConfig (at `spec.template.spec`)
+// and for pod templates within lists of roles or replica specs
+// (e.g., a TFJob's `spec.tfReplicaSpecs.Worker.template.spec`).
+const maxPodSpecDepth = 8
+
+// findPodSpecs returns the pod specs in the resource given. For
+// kinds we know the schema of, that's at most the one at the known
+// path; for others, it's any field outside of `metadata` and `status`
+// that looks like a pod spec.
+func findPodSpecs(res *yaml3.Node) []*yaml3.Node {
+	kind := strings.ToLower(scalarValue(mappingValue(res, "kind")))
+	if path, ok := podSpecPaths[kind]; ok {
+		podSpec := res
+		for _, k := range path {
+			podSpec = mappingValue(podSpec, k)
+		}
+		if isPodSpec(podSpec) {
+			return []*yaml3.Node{podSpec}
+		}
+		return nil
+	}
+
+	var found []*yaml3.Node
+	var search func(n *yaml3.Node, depth int)
+	search = func(n *yaml3.Node, depth int) {
+		n = resolve(n)
+		if n == nil || depth > maxPodSpecDepth {
+			return
+		}
+		switch n.Kind {
+		case yaml3.MappingNode:
+			if isPodSpec(n) {
+				found = append(found, n)
+				return
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if depth == 0 && (n.Content[i].Value == "metadata" || n.Content[i].Value == "status") {
+					continue
+				}
+				search(n.Content[i+1], depth+1)
+			}
+		case yaml3.SequenceNode:
+			for _, item := range n.Content {
+				search(item, depth+1)
+			}
+		}
+	}
+	search(res, 0)
+	return found
+}
+
+// isPodSpec reports whether the node given has the shape of a pod
+// spec; that is, it's a mapping with a non-empty list of
+// `containers`, each of which has a name and an image. (Those being
+// the only fields of a container, and containers the only field of a
+// pod spec, that are required.)
+func isPodSpec(n *yaml3.Node) bool {
+	containers := podSpecContainers(n)
+	if len(containers) == 0 {
+		return false
+	}
+	for _, c := range containers {
+		name, img := mappingValue(c, "name"), mappingValue(c, "image")
+		if name == nil || name.Kind != yaml3.ScalarNode || img == nil || img.Kind != yaml3.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// podSpecContainers returns the container nodes of a pod spec, with
+// any aliases resolved.
+func podSpecContainers(podSpec *yaml3.Node) []*yaml3.Node {
+	containers := mappingValue(podSpec, "containers")
+	if containers == nil || containers.Kind != yaml3.SequenceNode {
+		return nil
+	}
+	var result []*yaml3.Node
+	for _, c := range containers.Content {
+		if c = resolve(c); c.Kind == yaml3.MappingNode {
+			result = append(result, c)
+		} else {
+			return nil
+		}
+	}
+	return result
+}
+
+// GenericWorkload is a resource of a kind not otherwise accounted
+// for, that has one or more pod specs (as found by `findPodSpecs`),
+// or has its images at container paths (see `FindPathContainers`);
+// e.g., a ReplicaSet, or a custom resource which runs containers.
+type GenericWorkload struct {
+	baseObject
+	containers []resource.Container
+}
+
+func (w GenericWorkload) Containers() []resource.Container {
+	return w.containers
+}
+
+func (w GenericWorkload) SetContainerImage(container string, ref image.Ref) error {
+	for i, c := range w.containers {
+		if c.Name == container {
+			w.containers[i].Image = ref
+			return nil
+		}
+	}
+	return fmt.Errorf("container %q not found in workload", container)
+}
+
+func (w *GenericWorkload) copyUnexported() {
+	w.baseObject.copyUnexported()
+	w.containers = append([]resource.Container(nil), w.containers...)
+}
+
+var _ resource.Workload = GenericWorkload{}
+
+// unmarshalGenericWorkload returns the resource given as a
+// GenericWorkload, if it has any pod specs.
+func unmarshalGenericWorkload(base baseObject, def []byte) (*GenericWorkload, bool) {
+	// Most resources (Services, ConfigMaps, and so on) can't have a
+	// pod spec; those without so much as the word are passed over
+	// without the expense of parsing them again.
+	if !bytes.Contains(def, []byte("containers")) {
+		return nil, false
+	}
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(def, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, false
+	}
+	podSpecs := findPodSpecs(doc.Content[0])
+	if len(podSpecs) == 0 {
+		return nil, false
+	}
+	w := GenericWorkload{baseObject: base}
+	for _, podSpec := range podSpecs {
+		for _, c := range podSpecContainers(podSpec) {
+			// As for other workloads, an image that can't be parsed
+			// is taken as an empty ref.
+			im, _ := image.ParseRef(scalarValue(mappingValue(c, "image")))
+			w.containers = append(w.containers, resource.Container{Name: scalarValue(mappingValue(c, "name")), Image: im})
+		}
+	}
+	return &w, true
+}
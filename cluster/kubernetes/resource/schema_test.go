@@ -0,0 +1,125 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/resource"
+)
+
+const genericWorkloads = `---
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: rs
+spec:
+  template:
+    spec:
+      containers:
+      - name: main
+        image: quay.io/weaveworks/helloworld:master-a000001
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+spec:
+  containers:
+  - name: main
+    image: quay.io/weaveworks/helloworld:master-a000001
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: rollout
+  namespace: demo
+spec:
+  strategy:
+    canary: {}
+  template:
+    spec:
+      containers:
+      - name: main
+        image: quay.io/weaveworks/helloworld:master-a000001
+---
+apiVersion: kubeflow.org/v1
+kind: TFJob
+metadata:
+  name: training
+spec:
+  tfReplicaSpecs:
+    PS:
+      template:
+        spec:
+          containers:
+          - name: tensorflow
+            image: tensorflow/tensorflow:1.10.0
+    Worker:
+      template:
+        spec:
+          containers:
+          - name: worker
+            image: tensorflow/tensorflow:1.10.0-gpu
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  containers: "none here"
+`
+
+func TestParseGenericWorkloads(t *testing.T) {
+	objs, err := ParseMultidoc([]byte(genericWorkloads), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[string][]string{
+		"default:replicaset/rs":  {"main"},
+		"default:pod/pod":        {"main"},
+		"demo:rollout/rollout":   {"main"},
+		"default:tfjob/training": {"tensorflow", "worker"},
+	} {
+		res, ok := objs[id]
+		if !ok {
+			t.Errorf("expected %s in %+v", id, objs)
+			continue
+		}
+		workload, ok := res.(resource.Workload)
+		if !ok {
+			t.Errorf("expected %s to be a workload, got %#v", id, res)
+			continue
+		}
+		var names []string
+		for _, c := range workload.Containers() {
+			names = append(names, c.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected containers %v for %s, got %v", expected, id, names)
+		}
+	}
+	if _, ok := objs["default:configmap/config"].(resource.Workload); ok {
+		t.Error("expected configmap not to be taken as a workload")
+	}
+}
+
+func TestUpdateImageGenericWorkloads(t *testing.T) {
+	ref, _ := image.ParseRef("tensorflow/tensorflow:1.11.0-gpu")
+	out, err := UpdateImage([]byte(genericWorkloads), flux.MustParseResourceID("default:tfjob/training"), "worker", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(genericWorkloads, "tensorflow/tensorflow:1.10.0-gpu", ref.String(), 1)
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(out))
+	}
+
+	_, err = UpdateImage([]byte(genericWorkloads), flux.MustParseResourceID("default:configmap/config"), "main", ref)
+	if errors.Cause(err) != ErrNoPodSpec {
+		t.Errorf("expected error %q for resource without pod spec, got %v", ErrNoPodSpec, err)
+	}
+}
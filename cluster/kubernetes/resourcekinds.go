@@ -1,13 +1,17 @@
 package kubernetes
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	apiapps "k8s.io/api/apps/v1beta1"
 	apibatch "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
 	apiext "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"github.com/weaveworks/flux"
 	fhr_v1alpha2 "github.com/weaveworks/flux/apis/helm.integrations.flux.weave.works/v1alpha2"
@@ -43,6 +47,7 @@ func init() {
 	resourceKinds["deployment"] = &deploymentKind{}
 	resourceKinds["statefulset"] = &statefulSetKind{}
 	resourceKinds["fluxhelmrelease"] = &fluxHelmReleaseKind{}
+	resourceKinds["helmrelease"] = &helmReleaseKind{}
 }
 
 type podController struct {
@@ -80,10 +85,33 @@ func (pc podController) toClusterController(resourceID flux.ResourceID) cluster.
 		Status:     pc.status,
 		Antecedent: antecedent,
 		Labels:     pc.GetLabels(),
+		Platform:   platformFromNodeSelector(pc.podTemplate.Spec.NodeSelector),
 		Containers: cluster.ContainersOrExcuse{Containers: clusterContainers, Excuse: excuse},
 	}
 }
 
+// Node labels giving the operating system and architecture of a
+// node; the beta labels are those used before Kubernetes 1.14.
+const (
+	nodeOSLabel       = "kubernetes.io/os"
+	nodeArchLabel     = "kubernetes.io/arch"
+	betaNodeOSLabel   = "beta.kubernetes.io/os"
+	betaNodeArchLabel = "beta.kubernetes.io/arch"
+)
+
+// platformFromNodeSelector returns the platform pods with the node
+// selector given will run on, as far as it says.
+func platformFromNodeSelector(selector map[string]string) image.Platform {
+	var p image.Platform
+	if p.OS = selector[nodeOSLabel]; p.OS == "" {
+		p.OS = selector[betaNodeOSLabel]
+	}
+	if p.Arch = selector[nodeArchLabel]; p.Arch == "" {
+		p.Arch = selector[betaNodeArchLabel]
+	}
+	return p
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // extensions/v1beta1 Deployment
 
@@ -309,7 +337,7 @@ func (fhr *fluxHelmReleaseKind) getPodControllers(c *Cluster, namespace string)
 }
 
 func makeFluxHelmReleasePodController(fluxHelmRelease *fhr_v1alpha2.FluxHelmRelease) podController {
-	containers := createK8sFHRContainers(fluxHelmRelease.Spec)
+	containers := createK8sFHRContainers(fluxHelmRelease.ObjectMeta.Annotations, fluxHelmRelease.Spec)
 
 	podTemplate := apiv1.PodTemplateSpec{
 		ObjectMeta: fluxHelmRelease.ObjectMeta,
@@ -332,9 +360,15 @@ func makeFluxHelmReleasePodController(fluxHelmRelease *fhr_v1alpha2.FluxHelmRele
 // createK8sContainers creates a list of k8s containers by
 // interpreting the FluxHelmRelease resource. The interpretation is
 // analogous to that in cluster/kubernetes/resource/fluxhelmrelease.go
-func createK8sFHRContainers(spec fhr_v1alpha2.FluxHelmReleaseSpec) []apiv1.Container {
+func createK8sFHRContainers(annotations map[string]string, spec fhr_v1alpha2.FluxHelmReleaseSpec) []apiv1.Container {
+	return createK8sValuesContainers(annotations, spec.Values)
+}
+
+// createK8sValuesContainers creates a list of k8s containers from
+// the images given in chart values.
+func createK8sValuesContainers(annotations map[string]string, values map[string]interface{}) []apiv1.Container {
 	var containers []apiv1.Container
-	_ = kresource.FindFluxHelmReleaseContainers(spec.Values, func(name string, image image.Ref, _ kresource.ImageSetter) error {
+	_ = kresource.FindFluxHelmReleaseContainers(annotations, values, func(name string, image image.Ref, _ kresource.ImageSetter) error {
 		containers = append(containers, apiv1.Container{
 			Name:  name,
 			Image: image.String(),
@@ -343,3 +377,249 @@ func createK8sFHRContainers(spec fhr_v1alpha2.FluxHelmReleaseSpec) []apiv1.Conta
 	})
 	return containers
 }
+
+/////////////////////////////////////////////////////////////////////////////
+// flux.weave.works/v1beta1 HelmRelease
+
+const helmReleaseAPIVersion = "flux.weave.works/v1beta1"
+
+// helmRelease is the part of a HelmRelease needed to interpret it as
+// a controller. There's no generated client for this version of the
+// custom resource, so it's fetched and decoded as JSON.
+type helmRelease struct {
+	meta_v1.TypeMeta   `json:",inline"`
+	meta_v1.ObjectMeta `json:"metadata"`
+	Spec               struct {
+		Values map[string]interface{} `json:"values,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		ReleaseStatus string `json:"releaseStatus"`
+	} `json:"status"`
+}
+
+type helmReleaseList struct {
+	Items []helmRelease `json:"items"`
+}
+
+type helmReleaseKind struct{}
+
+func (hr *helmReleaseKind) getPodController(c *Cluster, namespace, name string) (podController, error) {
+	var helmRelease helmRelease
+	if err := c.getHelmReleases(namespace, name, &helmRelease); err != nil {
+		return podController{}, err
+	}
+	return makeHelmReleasePodController(&helmRelease), nil
+}
+
+func (hr *helmReleaseKind) getPodControllers(c *Cluster, namespace string) ([]podController, error) {
+	var helmReleases helmReleaseList
+	if err := c.getHelmReleases(namespace, "", &helmReleases); err != nil {
+		return nil, err
+	}
+
+	var podControllers []podController
+	for i := range helmReleases.Items {
+		podControllers = append(podControllers, makeHelmReleasePodController(&helmReleases.Items[i]))
+	}
+	return podControllers, nil
+}
+
+// getHelmReleases gets the HelmRelease named, or if the name is
+// empty, all those in the namespace, and decodes the result into
+// `into`. If the custom resource isn't defined, the error is a
+// NotFound status error, as for other kinds.
+func (c *Cluster) getHelmReleases(namespace, name string, into interface{}) error {
+	req := c.client.HelmV1alpha2().RESTClient().Get().
+		AbsPath("/apis", helmReleaseAPIVersion).
+		Namespace(namespace).
+		Resource("helmreleases")
+	if name != "" {
+		req = req.Name(name)
+	}
+	bytes, err := req.DoRaw()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, into)
+}
+
+func makeHelmReleasePodController(helmRelease *helmRelease) podController {
+	podTemplate := apiv1.PodTemplateSpec{
+		ObjectMeta: helmRelease.ObjectMeta,
+		Spec: apiv1.PodSpec{
+			Containers:       createK8sValuesContainers(helmRelease.ObjectMeta.Annotations, helmRelease.Spec.Values),
+			ImagePullSecrets: []apiv1.LocalObjectReference{},
+		},
+	}
+
+	return podController{
+		apiVersion:  helmReleaseAPIVersion,
+		kind:        "HelmRelease",
+		name:        helmRelease.ObjectMeta.Name,
+		status:      helmRelease.Status.ReleaseStatus,
+		podTemplate: podTemplate,
+		k8sObject:   helmRelease,
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Kinds with container paths
+
+// pathsKind is a kind otherwise unknown to flux, for which the
+// container paths have been given (with kresource.SetContainerPaths).
+// As with HelmReleases, there's no client for it, so its resources
+// are fetched and decoded as JSON.
+type pathsKind struct {
+	paths kresource.KindContainerPaths
+}
+
+// pathsResource is a resource of a pathsKind: the metadata, for its
+// labels and annotations, and the whole of it, to find images in.
+type pathsResource struct {
+	meta_v1.ObjectMeta
+	object map[string]interface{}
+}
+
+// MarshalJSON gives the resource as it came, but without the API
+// version and kind, which are written separately when exporting.
+func (r pathsResource) MarshalJSON() ([]byte, error) {
+	obj := map[string]interface{}{}
+	for k, v := range r.object {
+		if k != "apiVersion" && k != "kind" {
+			obj[k] = v
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// kinds returns all the kinds flux can find the containers of in the
+// cluster, keyed by lower case kind, as in resource IDs: those it
+// knows, those with container paths, and those seen in manifests with
+// container path annotations.
+func kinds() map[string]resourceKind {
+	all := map[string]resourceKind{}
+	for kind, rk := range resourceKinds {
+		all[kind] = rk
+	}
+	for _, paths := range append(kresource.ContainerPaths(), kresource.AnnotatedKinds()...) {
+		kind := strings.ToLower(paths.Kind)
+		if _, ok := all[kind]; !ok {
+			all[kind] = &pathsKind{paths: paths}
+		}
+	}
+	return all
+}
+
+func (pk *pathsKind) getPodController(c *Cluster, namespace, name string) (podController, error) {
+	resources, err := c.getPathsResources(pk.paths, namespace, name)
+	if err != nil {
+		return podController{}, err
+	}
+	if len(resources) == 0 {
+		return podController{}, fmt.Errorf("%s %s/%s not found", pk.paths.Kind, namespace, name)
+	}
+	return pk.makePodController(resources[0]), nil
+}
+
+func (pk *pathsKind) getPodControllers(c *Cluster, namespace string) ([]podController, error) {
+	resources, err := c.getPathsResources(pk.paths, namespace, "")
+	if err != nil {
+		return nil, err
+	}
+	var podControllers []podController
+	for _, r := range resources {
+		podControllers = append(podControllers, pk.makePodController(r))
+	}
+	return podControllers, nil
+}
+
+func (pk *pathsKind) makePodController(r pathsResource) podController {
+	var containers []apiv1.Container
+	found, _ := kresource.FindPathContainers(r.object)
+	for _, c := range found {
+		containers = append(containers, apiv1.Container{Name: c.Name, Image: c.Image.String()})
+	}
+	return podController{
+		apiVersion: pk.paths.APIVersion,
+		kind:       pk.paths.Kind,
+		name:       r.Name,
+		status:     StatusUnknown,
+		podTemplate: apiv1.PodTemplateSpec{
+			ObjectMeta: r.ObjectMeta,
+			Spec:       apiv1.PodSpec{Containers: containers},
+		},
+		k8sObject: &r,
+	}
+}
+
+// getPathsResources gets the resource of the kind given with the
+// name given, or if the name is empty, all those in the namespace.
+// The name of the API resource for the kind is looked up first; if
+// the kind isn't defined, the error is a NotFound status error, as
+// for other kinds. Kinds that aren't namespaced have no resources
+// here.
+func (c *Cluster) getPathsResources(paths kresource.KindContainerPaths, namespace, name string) ([]pathsResource, error) {
+	apiResources, err := c.client.ServerResourcesForGroupVersion(paths.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	var plural string
+	for _, r := range apiResources.APIResources {
+		// subresources (e.g., `rollouts/status`) have the kind too
+		if r.Kind == paths.Kind && !strings.Contains(r.Name, "/") {
+			if !r.Namespaced {
+				return nil, nil
+			}
+			plural = r.Name
+			break
+		}
+	}
+	if plural == "" {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: paths.Group(), Resource: strings.ToLower(paths.Kind)}, name)
+	}
+
+	prefix := "/apis"
+	if paths.Group() == "" {
+		prefix = "/api"
+	}
+	req := c.client.HelmV1alpha2().RESTClient().Get().
+		AbsPath(prefix, paths.APIVersion).
+		Namespace(namespace).
+		Resource(plural)
+	if name != "" {
+		req = req.Name(name)
+	}
+	bytes, err := req.DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var raws []json.RawMessage
+	if name != "" {
+		raws = append(raws, bytes)
+	} else {
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(bytes, &list); err != nil {
+			return nil, err
+		}
+		raws = list.Items
+	}
+	var resources []pathsResource
+	for _, raw := range raws {
+		var r pathsResource
+		var withMeta struct {
+			Meta meta_v1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(raw, &withMeta); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &r.object); err != nil {
+			return nil, err
+		}
+		r.ObjectMeta = withMeta.Meta
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/resource"
 )
 
 type changeSet struct {
@@ -73,20 +74,21 @@ func (c *Kubectl) connectArgs() []string {
 
 // rankOfKind returns an int denoting the position of the given kind
 // in the partial ordering of Kubernetes resources, according to which
-// kinds depend on which (derived by hand).
+// kinds depend on which (derived by hand). The kind may be given in
+// lower case, as it is in resource IDs.
 func rankOfKind(kind string) int {
-	switch kind {
+	switch strings.ToLower(kind) {
 	// Namespaces answer to NOONE
-	case "Namespace":
+	case "namespace":
 		return 0
 	// These don't go in namespaces; or do, but don't depend on anything else
-	case "ServiceAccount", "ClusterRole", "Role", "PersistentVolume", "Service":
+	case "serviceaccount", "clusterrole", "role", "persistentvolume", "service":
 		return 1
 	// These depend on something above, but not each other
-	case "ResourceQuota", "LimitRange", "Secret", "ConfigMap", "RoleBinding", "ClusterRoleBinding", "PersistentVolumeClaim", "Ingress":
+	case "resourcequota", "limitrange", "secret", "configmap", "rolebinding", "clusterrolebinding", "persistentvolumeclaim", "ingress":
 		return 2
 	// Same deal, next layer
-	case "DaemonSet", "Deployment", "ReplicationController", "ReplicaSet", "Job", "CronJob", "StatefulSet":
+	case "daemonset", "deployment", "replicationcontroller", "replicaset", "job", "cronjob", "statefulset":
 		return 3
 	// Assumption: anything not mentioned isn't depended _upon_, so
 	// can come last.
@@ -95,6 +97,15 @@ func rankOfKind(kind string) int {
 	}
 }
 
+var _ cluster.ApplyOrderer = &Cluster{}
+
+// ApplyRank gives the rank of the resource's kind, as given by
+// rankOfKind.
+func (c *Cluster) ApplyRank(res resource.Resource) int {
+	_, kind, _ := res.ResourceID().Components()
+	return rankOfKind(kind)
+}
+
 type applyOrder []*apiObject
 
 func (objs applyOrder) Len() int {
@@ -1,10 +1,13 @@
 package kubernetes
 
 import (
+	"bytes"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/kit/log"
+	"gopkg.in/yaml.v2"
 
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/cluster"
@@ -13,12 +16,14 @@ import (
 
 type mockApplier struct {
 	commandRun bool
+	applied    changeSet
 }
 
 func (m *mockApplier) apply(_ log.Logger, c changeSet) cluster.SyncError {
 	if len(c.objs) != 0 {
 		m.commandRun = true
 	}
+	m.applied = c
 	return nil
 }
 
@@ -81,6 +86,84 @@ func TestSyncMalformed(t *testing.T) {
 	}
 }
 
+func TestSyncMarksForGC(t *testing.T) {
+	kube, mock := setup(t)
+	def := []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: helloworld
+  labels:
+    app: helloworld
+`)
+	res := rsc{"default:deployment/helloworld", def}
+	if err := kube.Sync(cluster.SyncDef{
+		Actions: []cluster.SyncAction{
+			{Apply: res},
+			{Delete: rsc{"default:deployment/goodbyeworld", []byte("kind: Deployment\nmetadata:\n  name: goodbyeworld\n")}},
+		},
+		SyncSet: "test",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	applied := mock.applied.objs["apply"]
+	if len(applied) != 1 {
+		t.Fatalf("expected one resource to be applied, got %#v", applied)
+	}
+	var obj struct {
+		Metadata struct {
+			Labels map[string]string
+		}
+	}
+	if err := yaml.Unmarshal(applied[0].Bytes(), &obj); err != nil {
+		t.Fatal(err)
+	}
+	mark := makeGCMark("test", "default:deployment/helloworld")
+	if obj.Metadata.Labels[gcMarkLabel] != mark || obj.Metadata.Labels["app"] != "helloworld" {
+		t.Errorf("expected resource to be labelled with the mark %s, got labels %v", mark, obj.Metadata.Labels)
+	}
+	if makeGCMark("other", "default:deployment/helloworld") == mark ||
+		makeGCMark("test", "default:deployment/goodbyeworld") == mark {
+		t.Error("expected marks to differ for different sync sets and resources")
+	}
+
+	// Only what's applied is marked
+	deleted := mock.applied.objs["delete"]
+	if len(deleted) != 1 || string(deleted[0].Bytes()) != "kind: Deployment\nmetadata:\n  name: goodbyeworld\n" {
+		t.Errorf("expected deleted resource to be as given, got %#v", deleted)
+	}
+}
+
+func TestAppendMarked(t *testing.T) {
+	mark := makeGCMark("test", "default:deployment/helloworld")
+	list := []byte(`{"items": [
+  {"metadata": {"name": "helloworld", "labels": {"` + gcMarkLabel + `": "` + mark + `"}}, "spec": {"replicas": 2}},
+  {"metadata": {"name": "copied", "namespace": "default", "labels": {"` + gcMarkLabel + `": "` + mark + `"}}},
+  {"metadata": {"name": "unmarked"}}
+]}`)
+	var buf bytes.Buffer
+	exported := map[string]bool{}
+	if err := appendMarked(&buf, exported, "test", "apps/v1", "Deployment", list); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 || !exported["default:deployment/helloworld"] {
+		t.Errorf("expected only the helloworld deployment to be exported, got %v", exported)
+	}
+	if !strings.HasPrefix(buf.String(), "---\napiVersion: apps/v1\nkind: Deployment\n") || !strings.Contains(buf.String(), "replicas: 2") {
+		t.Errorf("unexpected YAML exported:\n%s", buf.String())
+	}
+
+	// The same resource, listed under another API group, is
+	// exported only once
+	before := buf.Len()
+	if err := appendMarked(&buf, exported, "test", "extensions/v1beta1", "Deployment", list); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != before {
+		t.Errorf("expected nothing more to be exported, got:\n%s", buf.String())
+	}
+}
+
 // TestApplyOrder checks that applyOrder works as expected.
 func TestApplyOrder(t *testing.T) {
 	objs := []*apiObject{
@@ -110,3 +193,14 @@ func TestApplyOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyRank(t *testing.T) {
+	kube, _ := setup(t)
+	ranks := []int{}
+	for _, id := range []string{"default:namespace/ns", "default:secret/secret", "default:deployment/deploy"} {
+		ranks = append(ranks, kube.ApplyRank(rsc{id: id}))
+	}
+	if !sort.IntsAreSorted(ranks) || ranks[0] == ranks[1] || ranks[1] == ranks[2] {
+		t.Errorf("expected a namespace, a secret and a deployment to be ranked in that order, got %v", ranks)
+	}
+}
@@ -1,9 +1,10 @@
 package kubernetes
 
 import (
-	"strings"
+	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/image"
 )
 
@@ -11,11 +12,16 @@ import (
 // docs, as bytes), a resource ID referring to a controller, a
 // container name, and the name of the new image that should be used
 // for the container. It returns a new YAML stream where the image for
-// the container has been replaced with the imageRef supplied.
+// the container has been replaced with the imageRef supplied, and
+// everything else (including comments and formatting) left as it was.
+//
+// The controller can be of any kind that has a pod spec, including
+// those not otherwise known to flux.
 func updatePodController(in []byte, resource flux.ResourceID, container string, newImageID image.Ref) ([]byte, error) {
-	namespace, kind, name := resource.Components()
-	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok {
+	out, err := kresource.UpdateImage(in, resource, container, newImageID)
+	if errors.Cause(err) == kresource.ErrNoPodSpec {
+		_, kind, _ := resource.Components()
 		return nil, UpdateNotSupportedError(kind)
 	}
-	return (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
+	return out, err
 }
@@ -266,8 +266,8 @@ const case3out = `---
 apiVersion: extensions/v1beta1
 kind: Deployment
 metadata:
-  namespace: monitoring
-  name: grafana # comment, and only one space indent
+ namespace: monitoring
+ name: grafana # comment, and only one space indent
 spec:
   replicas: 1
   template:
@@ -443,7 +443,7 @@ spec:
         - containerPort: 80
         image: nginx:1.10-alpine
         name: nginx
-      - image: nginx:1.10-alpine    # testing comments, and this image is on the first line.
+      - image: nginx:1.10-alpine # testing comments, and this image is on the first line.
         name: nginx2
 `
 
@@ -0,0 +1,24 @@
+package cluster
+
+import (
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+// LintFinding is a problem found in the manifest for a resource,
+// which won't necessarily stop it from being applied; e.g., the use
+// of a deprecated API version.
+type LintFinding struct {
+	ID      flux.ResourceID
+	Source  string // the file the resource was loaded from
+	Rule    string // an identifier for the rule broken, e.g., `deprecated-api-version`
+	Message string
+}
+
+// Linter is implemented by Manifests that can check resources for
+// problems beyond their simply being parseable.
+type Linter interface {
+	// Lint returns the problems found in the resources given, in
+	// order of resource ID.
+	Lint(resources map[string]resource.Resource) []LintFinding
+}
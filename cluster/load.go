@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/resource"
+)
+
+// SkippedFile is a file under the manifests path, or a document in
+// a file, that was not loaded as resources; e.g., because it's not a
+// YAML file.
+type SkippedFile struct {
+	Path   string // relative to the repo
+	Line   int    // the line a skipped document starts at; zero if the whole file was skipped
+	Reason string
+}
+
+// FileError is an error loading manifests, found in a particular
+// file; or, if Path is empty, not attributable to any one file.
+type FileError struct {
+	Path    string // relative to the repo
+	Line    int    // zero if not known
+	Message string
+}
+
+func (e *FileError) Error() string {
+	switch {
+	case e.Path == "":
+		return e.Message
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+	default:
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+}
+
+// AsFileError returns the FileError at the bottom of err, if there
+// is one.
+func AsFileError(err error) (*FileError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *FileError:
+			return e, true
+		case *fluxerr.Error:
+			err = e.Err
+		default:
+			cause := errors.Cause(err)
+			if cause == err {
+				return nil, false
+			}
+			err = cause
+		}
+	}
+	return nil, false
+}
+
+// SkipReporter is implemented by Manifests that can say which files
+// they pass over when loading resources.
+type SkipReporter interface {
+	// LoadManifestsReporting is like LoadManifests, but also returns
+	// the files (or documents in files) that were skipped, and why.
+	LoadManifestsReporting(baseDir, first string, rest ...string) (map[string]resource.Resource, []SkippedFile, error)
+}
+
+// ManifestWalker is implemented by Manifests that can give the
+// resources under some paths one at a time, so that they needn't all
+// be held in memory at once (e.g., to sync them).
+type ManifestWalker interface {
+	// WalksManifests reports whether the resources can be walked;
+	// if not, they are to be loaded with LoadManifests.
+	WalksManifests() bool
+	// WalkManifests calls `fn` with each resource LoadManifests
+	// would load from the paths given, in turn, and returns the
+	// files skipped (as LoadManifestsReporting does). A resource is
+	// not kept once `fn` returns. If `fn` returns an error, the walk
+	// stops with it.
+	WalkManifests(baseDir string, paths []string, fn func(resource.Resource) error) ([]SkippedFile, error)
+}
@@ -39,6 +39,93 @@ type Manifests interface {
 	ServicesWithPolicies(path string) (policy.ResourceMap, error)
 }
 
+// CommandUpdater is implemented by Manifests that may generate some
+// resources by running commands, rather than reading them from
+// files. A generated resource can't be updated by rewriting the file
+// it came from; the update has to be made by a command as well.
+type CommandUpdater interface {
+	// IsGenerated reports whether resources loaded from the path
+	// given were generated, and should be updated with the methods
+	// below.
+	IsGenerated(path string) bool
+	// UpdateGeneratedImage updates the image for a container of a
+	// resource generated as configured in the file at `path`
+	UpdateGeneratedImage(path string, resourceID flux.ResourceID, container string, newImageID image.Ref) error
+	// UpdateGeneratedPolicies applies the policy update to a
+	// resource generated as configured in the file at `path`
+	UpdateGeneratedPolicies(path string, res resource.Resource, update policy.Update) error
+}
+
+// CommandRunner is implemented by Manifests that may run commands
+// given in the repo, e.g., to generate manifests, when loading or
+// updating them.
+type CommandRunner interface {
+	// RunsCommands reports whether commands from the repo are run.
+	RunsCommands() bool
+}
+
+// ValuesUpdater is implemented by Manifests whose resources may have
+// images given in files other than their manifest; e.g., in the
+// values files of a Helm chart.
+type ValuesUpdater interface {
+	// UpdateValuesImage updates the image for a container of the
+	// resource defined in the file at `path`, if the resource has
+	// values files under `root`, and reports whether it did. If
+	// not, the manifest is to be updated as usual.
+	UpdateValuesImage(root, path string, resourceID flux.ResourceID, container string, newImageID image.Ref) (bool, error)
+}
+
+// UpdatePolicies applies the policy update to the manifest for the
+// identified resource, whether by rewriting the file it is defined in
+// or, if it's generated, by running the configured command. It
+// reports whether the resource's policies were changed.
+func UpdatePolicies(m Manifests, root string, id flux.ResourceID, update policy.Update) (bool, error) {
+	resources, err := m.LoadManifests(root, root)
+	if err != nil {
+		return false, err
+	}
+	res, ok := resources[id.String()]
+	if !ok {
+		return false, ErrResourceNotFound(id.String())
+	}
+
+	path := filepath.Join(root, res.Source())
+	if cu, ok := m.(CommandUpdater); ok && cu.IsGenerated(path) {
+		if err := cu.UpdateGeneratedPolicies(path, res, update); err != nil {
+			return false, err
+		}
+		resources, err := m.LoadManifests(root, root)
+		if err != nil {
+			return false, err
+		}
+		updated, ok := resources[id.String()]
+		if !ok {
+			return false, ErrResourceNotFound(id.String())
+		}
+		return !samePolicies(updated.Policy(), res.Policy()), nil
+	}
+
+	var changed bool
+	err = updateFile(path, func(def []byte) ([]byte, error) {
+		newDef, err := m.UpdatePolicies(def, id, update)
+		changed = err == nil && string(newDef) != string(def)
+		return newDef, err
+	})
+	return changed, err
+}
+
+func samePolicies(a, b policy.Set) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, v := range a {
+		if w, ok := b[p]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
 // UpdateManifest looks for the manifest for the identified resource,
 // reads its contents, applies f(contents), and writes the results
 // back to the file.
@@ -53,7 +140,10 @@ func UpdateManifest(m Manifests, root string, id flux.ResourceID, f func(manifes
 		return ErrResourceNotFound(id.String())
 	}
 
-	path := filepath.Join(root, resource.Source())
+	return updateFile(filepath.Join(root, resource.Source()), f)
+}
+
+func updateFile(path string, f func(manifest []byte) ([]byte, error)) error {
 	def, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
@@ -14,6 +14,7 @@ type Mock struct {
 	SomeServicesFunc         func([]flux.ResourceID) ([]Controller, error)
 	PingFunc                 func() error
 	ExportFunc               func() ([]byte, error)
+	ExportSyncSetFunc        func(name string) ([]byte, error)
 	SyncFunc                 func(SyncDef) error
 	PublicSSHKeyFunc         func(regenerate bool) (ssh.PublicKey, error)
 	UpdateImageFunc          func(def []byte, id flux.ResourceID, container string, newImageID image.Ref) ([]byte, error)
@@ -22,6 +23,7 @@ type Mock struct {
 	UpdateManifestFunc       func(path, resourceID string, f func(def []byte) ([]byte, error)) error
 	UpdatePoliciesFunc       func([]byte, flux.ResourceID, policy.Update) ([]byte, error)
 	ServicesWithPoliciesFunc func(path string) (policy.ResourceMap, error)
+	DriftFunc                func(resources map[string]resource.Resource, syncSetName string, withDiff bool) ([]ResourceDrift, error)
 }
 
 func (m *Mock) AllControllers(maybeNamespace string) ([]Controller, error) {
@@ -40,6 +42,10 @@ func (m *Mock) Export() ([]byte, error) {
 	return m.ExportFunc()
 }
 
+func (m *Mock) ExportSyncSet(name string) ([]byte, error) {
+	return m.ExportSyncSetFunc(name)
+}
+
 func (m *Mock) Sync(c SyncDef) error {
 	return m.SyncFunc(c)
 }
@@ -71,3 +77,7 @@ func (m *Mock) UpdatePolicies(def []byte, id flux.ResourceID, p policy.Update) (
 func (m *Mock) ServicesWithPolicies(path string) (policy.ResourceMap, error) {
 	return m.ServicesWithPoliciesFunc(path)
 }
+
+func (m *Mock) Drift(resources map[string]resource.Resource, syncSetName string, withDiff bool) ([]ResourceDrift, error) {
+	return m.DriftFunc(resources, syncSetName, withDiff)
+}
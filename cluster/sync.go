@@ -18,6 +18,10 @@ type SyncAction struct {
 type SyncDef struct {
 	// The actions to undertake
 	Actions []SyncAction
+	// If not empty, the resources applied are marked as belonging to
+	// this sync set, so that they can be exported with ExportSyncSet
+	// later (and garbage collected, if no longer in the sync set)
+	SyncSet string
 }
 
 type ResourceError struct {
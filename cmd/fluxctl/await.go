@@ -15,8 +15,8 @@ import (
 var ErrTimeout = errors.New("timeout")
 
 // await polls for a job to complete, then for the resulting commit to
-// be applied
-func await(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, verbosity int) error {
+// be applied. The result of the job is output with the printer given.
+func await(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, print update.ResultPrinter, verbosity int) error {
 	result, err := awaitJob(ctx, client, jobID)
 	if err != nil {
 		if err == ErrTimeout {
@@ -30,11 +30,28 @@ is safe to retry operations.`)
 		return err
 	}
 	if result.Result != nil {
-		update.PrintResults(stdout, result.Result, verbosity)
+		if err := print(stdout, result.Result, verbosity); err != nil {
+			return err
+		}
 	}
 	if result.Revision != "" {
 		fmt.Fprintf(stderr, "Commit pushed:\t%s\n", result.Revision[:7])
 	}
+	for _, p := range result.Proposals {
+		if p.Pending {
+			fmt.Fprintf(stderr, "Already proposed on branch:\t%s\n", p.Branch)
+		} else {
+			fmt.Fprintf(stderr, "Proposed on branch:\t%s\n", p.Branch)
+		}
+		if p.URL != "" {
+			fmt.Fprintf(stderr, "Merge request:\t%s\n", p.URL)
+		}
+	}
+	if len(result.Proposals) == 0 && result.Result != nil && isProposal(result.Spec) {
+		fmt.Fprintln(stderr, `
+The changes were not proposed on a branch, nor committed; the daemon
+may be a version that does not know how to propose changes.`)
+	}
 	if result.Result == nil {
 		fmt.Fprintf(stderr, "Nothing to do\n")
 		return nil
@@ -60,6 +77,16 @@ to run a sync interactively.`)
 	return nil
 }
 
+// isProposal says whether the update asked for the changes to be
+// proposed, rather than committed.
+func isProposal(spec *update.Spec) bool {
+	if spec == nil {
+		return false
+	}
+	s, ok := spec.Spec.(update.ReleaseSpec)
+	return ok && s.Kind == update.ReleaseKindPropose
+}
+
 // await polls for a job to have been completed, with exponential backoff.
 func awaitJob(ctx context.Context, client api.Server, jobID job.ID) (job.Result, error) {
 	var result job.Result
@@ -2,20 +2,72 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"text/tabwriter"
 
+	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/update"
 )
 
 type outputOpts struct {
 	verbosity int
+	format    string
 }
 
 func AddOutputFlags(cmd *cobra.Command, opts *outputOpts) {
 	cmd.Flags().CountVarP(&opts.verbosity, "verbose", "v", "include skipped (and ignored, with -vv) controllers in output")
+	AddFormatFlag(cmd, &opts.format)
+}
+
+// AddFormatFlag adds the flag for choosing how output is printed;
+// as a table, or as JSON or YAML for other programs to read.
+func AddFormatFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", update.FormatTable, "output format: table, json or yaml")
+}
+
+// resultPrinter returns the printer for the output format chosen, or
+// an error if it's not a known format.
+func (opts outputOpts) resultPrinter() (update.ResultPrinter, error) {
+	if err := checkFormat(opts.format); err != nil {
+		return nil, err
+	}
+	return update.NewResultPrinter(opts.format)
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case update.FormatTable, update.FormatJSON, update.FormatYAML:
+		return nil
+	}
+	return newUsageError(fmt.Sprintf("unknown output format %q; expected one of table, json or yaml", format))
+}
+
+// printStructured writes the value given to out as JSON or YAML,
+// according to the format given.
+func printStructured(out io.Writer, format string, v interface{}) error {
+	var bytes []byte
+	var err error
+	switch format {
+	case update.FormatJSON:
+		if bytes, err = json.MarshalIndent(v, "", "  "); err == nil {
+			bytes = append(bytes, '\n')
+		}
+	case update.FormatYAML:
+		bytes, err = yaml.Marshal(v)
+	default:
+		return fmt.Errorf("format %q is neither JSON nor YAML", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(bytes)
+	return err
 }
 
 func newTabwriter() *tabwriter.Writer {
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/install"
+)
+
+type installOpts struct {
+	install.TemplateParameters
+	registryDisableScanning bool
+	apply                   bool
+}
+
+func newInstall() *installOpts {
+	return &installOpts{}
+}
+
+func (opts *installOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Print the manifests for running flux in a cluster, or apply them.",
+		Long: `
+Print the manifests for running flux in a cluster: the daemon's deployment,
+service account and RBAC rules, the secret for its SSH key, and memcached
+(unless image registry scanning is disabled). With --apply, they're given to
+kubectl to apply to the cluster in your current kubectl context, instead.
+        `,
+		Example: makeExample(
+			"fluxctl install --git-url=git@github.com:weaveworks/flux-example --namespace=flux > flux.yaml",
+			"fluxctl install --git-url=git@github.com:weaveworks/flux-example --git-path=workloads --apply",
+		),
+		// Nothing to connect to; it may not even be running yet.
+		PersistentPreRunE: func(*cobra.Command, []string) error { return nil },
+		RunE:              opts.RunE,
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.GitURL, "git-url", "", "URL of the git repo with the manifests to sync, e.g., git@github.com:weaveworks/flux-example")
+	flags.StringVar(&opts.GitBranch, "git-branch", "master", "branch of the git repo to sync")
+	flags.StringVar(&opts.GitPath, "git-path", "", "relative path within the git repo to find the manifests in; the whole repo, if not given")
+	flags.StringVar(&opts.Namespace, "namespace", "default", "namespace to run flux in; it's created if it's not default")
+	flags.StringVar(&opts.Image, "flux-image", install.DefaultImage(version), "fluxd image to run")
+	flags.BoolVar(&opts.registryDisableScanning, "registry-disable-scanning", false, "don't scan image registries for new images (so automation won't work), and don't run memcached")
+	flags.StringArrayVar(&opts.AdditionalFluxArgs, "flux-arg", nil, "another argument for fluxd, e.g., --flux-arg=--sync-interval=1m; may be repeated")
+	flags.BoolVar(&opts.apply, "apply", false, "apply the manifests with kubectl, rather than printing them")
+	return cmd
+}
+
+func (opts *installOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+	if opts.GitURL == "" {
+		return newUsageError("--git-url is required")
+	}
+	opts.RegistryScanning = !opts.registryDisableScanning
+
+	manifests, err := install.FillInTemplates(opts.TemplateParameters)
+	if err != nil {
+		return err
+	}
+	var all bytes.Buffer
+	for _, name := range install.ManifestNames(manifests) {
+		all.Write(manifests[name])
+	}
+
+	if !opts.apply {
+		_, err := cmd.OutOrStdout().Write(all.Bytes())
+		return err
+	}
+	kubectl := exec.Command("kubectl", "apply", "-f", "-")
+	kubectl.Stdin = &all
+	kubectl.Stdout = cmd.OutOrStdout()
+	stderr := &bytes.Buffer{}
+	kubectl.Stderr = stderr
+	if err := kubectl.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return errors.Wrap(err, "running kubectl apply")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "\nFlux is starting in the namespace %s. To see its SSH key, to give it access to the git repo:\n\n  fluxctl identity --k8s-fwd-ns=%s\n", opts.Namespace, opts.Namespace)
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInstallCommand_FluxArgs(t *testing.T) {
+	cmd := newInstall().Command()
+	var out bytes.Buffer
+	cmd.SetOutput(&out)
+	cmd.SetArgs([]string{
+		"--git-url=git@github.com:weaveworks/flux-example",
+		"--flux-arg=--git-path=a,b",
+		"--flux-arg=--sync-interval=1m",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	// Each argument is given whole, commas and all
+	for _, arg := range []string{`- "--git-path=a,b"`, `- "--sync-interval=1m"`} {
+		if !strings.Contains(out.String(), arg) {
+			t.Errorf("expected the deployment to have %s, got\n%s", arg, out.String())
+		}
+	}
+}
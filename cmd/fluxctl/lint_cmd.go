@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+type lintOpts struct {
+	*rootOpts
+}
+
+func newLint(parent *rootOpts) *lintOpts {
+	return &lintOpts{rootOpts: parent}
+}
+
+func (opts *lintOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "lint",
+		Short:   "Show the problems found in the manifests when they were last synced.",
+		Example: makeExample("fluxctl lint"),
+		RunE:    opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *lintOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	ctx := context.Background()
+
+	report, err := opts.API.LintReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case report.Revision == "":
+		fmt.Fprintln(cmd.OutOrStdout(), "The manifests have not been linted yet; they will be at the next sync.")
+		return nil
+	case len(report.Findings) == 0:
+		fmt.Fprintf(cmd.OutOrStdout(), "No problems found in the manifests at revision %s.\n", report.Revision)
+		return nil
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Problems found in the manifests at revision %s:\n\n", report.Revision)
+	w := newTabwriter()
+	fmt.Fprintf(w, "RESOURCE\tSOURCE\tRULE\tMESSAGE\n")
+	for _, f := range report.Findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.ID, f.Source, f.Rule, f.Message)
+	}
+	w.Flush()
+	return nil
+}
@@ -5,17 +5,20 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
 )
 
 type controllerListOpts struct {
 	*rootOpts
 	namespace     string
 	allNamespaces bool
+	format        string
 }
 
 func newControllerList(parent *rootOpts) *controllerListOpts {
@@ -31,6 +34,7 @@ func (opts *controllerListOpts) Command() *cobra.Command {
 	}
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Confine query to namespace")
 	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces")
+	AddFormatFlag(cmd, &opts.format)
 	return cmd
 }
 
@@ -38,6 +42,9 @@ func (opts *controllerListOpts) RunE(cmd *cobra.Command, args []string) error {
 	if len(args) != 0 {
 		return errorWantedNoArgs
 	}
+	if err := checkFormat(opts.format); err != nil {
+		return err
+	}
 
 	if opts.allNamespaces {
 		opts.namespace = ""
@@ -52,6 +59,10 @@ func (opts *controllerListOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	sort.Sort(controllerStatusByName(controllers))
 
+	if opts.format != update.FormatTable {
+		return printStructured(cmd.OutOrStdout(), opts.format, controllers)
+	}
+
 	w := newTabwriter()
 	fmt.Fprintf(w, "CONTROLLER\tCONTAINER\tIMAGE\tRELEASE\tPOLICY\n")
 	for _, controller := range controllers {
@@ -94,6 +105,32 @@ func policies(s v6.ControllerStatus) string {
 	if s.Ignore {
 		ps = append(ps, string(policy.Ignore))
 	}
+	if _, ok := s.Policies[string(policy.ReleaseWindow)]; ok {
+		ps = append(ps, string(policy.ReleaseWindow))
+	}
 	sort.Strings(ps)
-	return strings.Join(ps, ",")
+	p := strings.Join(ps, ",")
+	if s.Locked {
+		p += lockDetails(s.Policies)
+	}
+	if s.Held != nil {
+		p += fmt.Sprintf(" (update held until %s)", s.Held.Until.Format("Mon 15:04 MST"))
+	}
+	return p
+}
+
+// lockDetails describes why a controller is locked, and until when,
+// if either was given.
+func lockDetails(policies map[string]string) string {
+	var details []string
+	if msg := policies[string(policy.LockedMsg)]; msg != "" {
+		details = append(details, strings.Join(strings.Fields(msg), " "))
+	}
+	if until, err := time.Parse(time.RFC3339, policies[string(policy.LockedUntil)]); err == nil {
+		details = append(details, "until "+until.Local().Format("2 Jan 15:04 MST"))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " (locked: " + strings.Join(details, ", ") + ")"
 }
@@ -9,7 +9,9 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v10"
 	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/update"
 )
@@ -19,6 +21,10 @@ type controllerShowOpts struct {
 	namespace  string
 	controller string
 	limit      int
+	tagFilter  string
+	sort       string
+	revision   bool
+	format     string
 
 	// Deprecated
 	service string
@@ -30,14 +36,22 @@ func newControllerShow(parent *rootOpts) *controllerShowOpts {
 
 func (opts *controllerShowOpts) Command() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "list-images",
-		Short:   "Show the deployed and available images for a controller.",
-		Example: makeExample("fluxctl list-images --namespace default --controller=deployment/foo"),
-		RunE:    opts.RunE,
+		Use:   "list-images",
+		Short: "Show the deployed and available images for a controller.",
+		Example: makeExample(
+			"fluxctl list-images --namespace default --controller=deployment/foo",
+			"fluxctl list-images --controller=deployment/foo --tag-filter='semver:~1.2' --sort=semver",
+			"fluxctl list-images --controller=deployment/foo --tag-filter='regexp:^build-\\d+$'",
+		),
+		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
 	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Show images for this controller")
 	cmd.Flags().IntVarP(&opts.limit, "limit", "l", 10, "Number of images to show (0 for all)")
+	cmd.Flags().StringVar(&opts.tagFilter, "tag-filter", "", "Show only images with tags matching this pattern, given as for tag policies (e.g., 'semver:~1.2', 'regexp:^build-', or a glob)")
+	cmd.Flags().StringVar(&opts.sort, "sort", "", "Sort images by 'created' (newest first) or 'semver' (highest first); by default, as the tag filter orders them, or newest first")
+	cmd.Flags().BoolVar(&opts.revision, "show-revision", false, "Show the source revision (e.g., git commit) each image was built from, if recorded in its labels")
+	AddFormatFlag(cmd, &opts.format)
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Show images for this service")
@@ -53,6 +67,9 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 	if len(args) != 0 {
 		return errorWantedNoArgs
 	}
+	if err := checkFormat(opts.format); err != nil {
+		return err
+	}
 
 	var resourceSpec update.ResourceSpec
 	if len(opts.controller) == 0 {
@@ -65,18 +82,42 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 		resourceSpec = update.MakeResourceSpec(id)
 	}
 
+	listOpts := v10.ListImagesOptions{
+		Spec:      resourceSpec,
+		TagFilter: opts.tagFilter,
+		Sort:      opts.sort,
+	}
+	// The table shows the running image even when it's past the
+	// limit, so needs all the images; otherwise, the limit applies
+	// to the images available for each container, as it does for
+	// the table.
+	if opts.format != update.FormatTable {
+		listOpts.Limit = opts.limit
+	}
+	if err := listOpts.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+
 	ctx := context.Background()
 
-	controllers, err := opts.API.ListImages(ctx, resourceSpec)
+	controllers, err := opts.API.ListImagesWithOptions(ctx, listOpts)
 	if err != nil {
 		return err
 	}
 
 	sort.Sort(imageStatusByName(controllers))
 
+	if opts.format != update.FormatTable {
+		return printStructured(cmd.OutOrStdout(), opts.format, controllers)
+	}
+
 	out := newTabwriter()
 
-	fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED")
+	if opts.revision {
+		fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED\tREVISION")
+	} else {
+		fmt.Fprintln(out, "CONTROLLER\tCONTAINER\tIMAGE\tCREATED")
+	}
 	for _, controller := range controllers {
 		if len(controller.Containers) == 0 {
 			fmt.Fprintf(out, "%s\t\t\t\n", controller.ID)
@@ -93,7 +134,11 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 			}
 			if len(container.Available) == 0 {
 				availableErr := container.AvailableError
-				if availableErr == "" {
+				switch {
+				case availableErr != "":
+				case container.AvailableImagesCount > 0 && opts.tagFilter != "":
+					availableErr = "no images match tag filter"
+				default:
 					availableErr = registry.ErrNoImageData.Error()
 				}
 				fmt.Fprintf(out, "%s\t%s\t%s%s\t%s\n", controllerName, containerName, reg, repo, availableErr)
@@ -104,7 +149,7 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 			for _, available := range container.Available {
 				running := "|  "
 				_, _, tag := available.ID.Components()
-				if currentTag == tag {
+				if isRunning(container.Current.ID, currentTag, available) {
 					running = "'->"
 					foundRunning = true
 				} else if foundRunning {
@@ -115,7 +160,7 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 				var printEllipsis, printLine bool
 				if opts.limit <= 0 || lineCount <= opts.limit {
 					printEllipsis, printLine = false, true
-				} else if container.Current.ID == available.ID {
+				} else if isRunning(container.Current.ID, currentTag, available) {
 					printEllipsis, printLine = lineCount > (opts.limit+1), true
 				}
 				if printEllipsis {
@@ -126,7 +171,11 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 					if !available.CreatedAt.IsZero() {
 						createdAt = available.CreatedAt.Format(time.RFC822)
 					}
-					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
+					if opts.revision {
+						fmt.Fprintf(out, "\t\t%s %s\t%s\t%s\n", running, tag, createdAt, available.Revision())
+					} else {
+						fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
+					}
 				}
 			}
 			controllerName = ""
@@ -136,6 +185,16 @@ func (opts *controllerShowOpts) RunE(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// isRunning reports whether the available image is the one currently
+// running; by digest, if the current image is pinned to one.
+func isRunning(current image.Ref, currentTag string, available image.Info) bool {
+	if current.Digest != "" {
+		return available.HasDigest(current.Digest)
+	}
+	_, _, tag := available.ID.Components()
+	return currentTag == tag
+}
+
 type imageStatusByName []v6.ImageStatus
 
 func (s imageStatusByName) Len() int {
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+type listSkippedOpts struct {
+	*rootOpts
+}
+
+func newListSkipped(parent *rootOpts) *listSkippedOpts {
+	return &listSkippedOpts{rootOpts: parent}
+}
+
+func (opts *listSkippedOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list-skipped",
+		Short:   "Show the files skipped, or the error, when the manifests were last loaded.",
+		Example: makeExample("fluxctl list-skipped"),
+		RunE:    opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *listSkippedOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+
+	ctx := context.Background()
+
+	report, err := opts.API.ManifestsReport(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if report.Revision == "" {
+		fmt.Fprintln(out, "The manifests have not been loaded yet; they will be at the next sync.")
+		return nil
+	}
+	if report.Error != nil {
+		fmt.Fprintf(out, "The manifests at revision %s could not be loaded:\n\n    %s\n\n", report.Revision, report.Error)
+	}
+	if len(report.Skipped) == 0 {
+		fmt.Fprintf(out, "No files skipped when loading the manifests at revision %s.\n", report.Revision)
+		return nil
+	}
+
+	fmt.Fprintf(out, "Files skipped when loading the manifests at revision %s:\n\n", report.Revision)
+	w := newTabwriter()
+	fmt.Fprintf(w, "PATH\tLINE\tREASON\n")
+	for _, s := range report.Skipped {
+		line := ""
+		if s.Line > 0 {
+			line = fmt.Sprint(s.Line)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Path, line, s.Reason)
+	}
+	w.Flush()
+	return nil
+}
@@ -11,7 +11,9 @@ type controllerLockOpts struct {
 	namespace  string
 	controller string
 	outputOpts
-	cause update.Cause
+	cause  update.Cause
+	reason string
+	until  string
 
 	// Deprecated
 	service string
@@ -27,6 +29,7 @@ func (opts *controllerLockOpts) Command() *cobra.Command {
 		Short: "Lock a controller, so it cannot be deployed.",
 		Example: makeExample(
 			"fluxctl lock --controller=default:deployment/helloworld",
+			"fluxctl lock --controller=default:deployment/helloworld --reason='waiting for QA' --until=2018-10-01T17:00:00Z",
 		),
 		RunE: opts.RunE,
 	}
@@ -34,6 +37,8 @@ func (opts *controllerLockOpts) Command() *cobra.Command {
 	AddCauseFlags(cmd, &opts.cause)
 	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
 	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Controller to lock")
+	cmd.Flags().StringVar(&opts.reason, "reason", "", "Why the controller is locked")
+	cmd.Flags().StringVar(&opts.until, "until", "", "When the lock expires, as a duration (e.g., 2h) or RFC3339 time; if not given, the lock lasts until the controller is unlocked")
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to lock")
@@ -54,6 +59,8 @@ func (opts *controllerLockOpts) RunE(cmd *cobra.Command, args []string) error {
 		controller: opts.controller,
 		cause:      opts.cause,
 		lock:       true,
+		lockReason: opts.reason,
+		lockUntil:  opts.until,
 	}
 	return policyOpts.RunE(cmd, args)
 }
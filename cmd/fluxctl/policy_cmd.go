@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/weaveworks/flux"
@@ -23,6 +24,12 @@ type controllerPolicyOpts struct {
 	automate, deautomate bool
 	lock, unlock         bool
 
+	lockReason string
+	lockUntil  string
+
+	releaseWindow   string
+	noReleaseWindow bool
+
 	cause update.Cause
 
 	// Deprecated
@@ -44,14 +51,33 @@ Tag filter patterns must be specified as 'container=pattern', such as 'foo=1.*'
 where an asterisk means 'match anything'.
 Surrounding these with single-quotes are recommended to avoid shell expansion.
 
+Patterns are globs unless prefixed otherwise; 'regexp:' gives a regular
+expression, whose capture groups (if any) are compared in order to find the
+newest tag; 'calver:' selects tags that are calendar versions,
+optionally followed by a glob; and 'semver:' selects tags that are
+semantic versions, optionally within a range such as '~1.2'.
+
 If both --tag-all and --tag are specified, --tag-all will apply to all
 containers which aren't explicitly named.
+
+A release window restricts automated releases to the times given, as days,
+times of day and (optionally) a time zone, such as 'Mon-Fri 09:00-17:00
+Europe/London'; periods may be separated by ';'. Updates found outside the
+window are held, and released when it opens.
+
+A lock may be given a reason, which is shown when listing controllers, and an
+expiry, as a duration (e.g., '2h') or a time (e.g., '2018-10-01T17:00:00Z'),
+after which the daemon unlocks the controller.
         `,
 		Example: makeExample(
 			"fluxctl policy --controller=default:deployment/foo --automate",
 			"fluxctl policy --controller=default:deployment/foo --lock",
+			"fluxctl policy --controller=default:deployment/foo --lock --reason='database migration' --until=2h",
 			"fluxctl policy --controller=default:deployment/foo --tag='bar=1.*' --tag='baz=2.*'",
 			"fluxctl policy --controller=default:deployment/foo --tag-all='master-*' --tag='bar=1.*'",
+			"fluxctl policy --controller=default:deployment/foo --tag='bar=regexp:^build-(\\d+)$' --tag='baz=calver:'",
+			"fluxctl policy --controller=default:deployment/foo --tag='bar=semver:~1.2'",
+			"fluxctl policy --controller=default:deployment/foo --release-window='Mon-Fri 09:00-17:00 Europe/London'",
 		),
 		RunE: opts.RunE,
 	}
@@ -67,6 +93,10 @@ containers which aren't explicitly named.
 	flags.BoolVar(&opts.deautomate, "deautomate", false, "Deautomate controller")
 	flags.BoolVar(&opts.lock, "lock", false, "Lock controller")
 	flags.BoolVar(&opts.unlock, "unlock", false, "Unlock controller")
+	flags.StringVar(&opts.lockReason, "reason", "", "Why the controller is locked (with --lock)")
+	flags.StringVar(&opts.lockUntil, "until", "", "When the lock expires, as a duration or RFC3339 time (with --lock)")
+	flags.StringVar(&opts.releaseWindow, "release-window", "", "Only make automated releases of the controller at these times")
+	flags.BoolVar(&opts.noReleaseWindow, "no-release-window", false, "Remove the controller's release window")
 
 	// Deprecated
 	flags.StringVarP(&opts.service, "service", "s", "", "Service to modify")
@@ -91,13 +121,24 @@ func (opts *controllerPolicyOpts) RunE(cmd *cobra.Command, args []string) error
 	if opts.lock && opts.unlock {
 		return newUsageError("lock and unlock both specified")
 	}
+	if (opts.lockReason != "" || opts.lockUntil != "") && !opts.lock {
+		return newUsageError("reason and until can only be given with lock")
+	}
+	if opts.releaseWindow != "" && opts.noReleaseWindow {
+		return newUsageError("release-window and no-release-window both specified")
+	}
+
+	printer, err := opts.resultPrinter()
+	if err != nil {
+		return err
+	}
 
 	resourceID, err := flux.ParseResourceIDOptionalNamespace(opts.namespace, opts.controller)
 	if err != nil {
 		return err
 	}
 
-	changes, err := calculatePolicyChanges(opts)
+	changes, err := calculatePolicyChanges(opts, time.Now())
 	if err != nil {
 		return err
 	}
@@ -114,11 +155,12 @@ func (opts *controllerPolicyOpts) RunE(cmd *cobra.Command, args []string) error
 	if err != nil {
 		return err
 	}
-	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbosity)
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, printer, opts.verbosity)
 }
 
-func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
+func calculatePolicyChanges(opts *controllerPolicyOpts, now time.Time) (policy.Update, error) {
 	add := policy.Set{}
+	remove := policy.Set{}
 	if opts.automate {
 		add = add.Add(policy.Automated)
 	}
@@ -129,9 +171,21 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 				Set(policy.LockedUser, opts.cause.User).
 				Set(policy.LockedMsg, opts.cause.Message)
 		}
+		if opts.lockReason != "" {
+			add = add.Set(policy.LockedMsg, opts.lockReason)
+		}
+		// Locking again without an expiry makes the lock permanent
+		if opts.lockUntil != "" {
+			until, err := policy.ParseLockExpiry(opts.lockUntil, now)
+			if err != nil {
+				return policy.Update{}, err
+			}
+			add = add.Set(policy.LockedUntil, until.UTC().Format(time.RFC3339))
+		} else {
+			remove = remove.Add(policy.LockedUntil)
+		}
 	}
 
-	remove := policy.Set{}
 	if opts.deautomate {
 		remove = remove.Add(policy.Automated)
 	}
@@ -139,10 +193,20 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 		remove = remove.
 			Add(policy.Locked).
 			Add(policy.LockedMsg).
-			Add(policy.LockedUser)
+			Add(policy.LockedUser).
+			Add(policy.LockedUntil)
 	}
 	if opts.tagAll != "" {
-		add = add.Set(policy.TagAll, "glob:"+opts.tagAll)
+		add = add.Set(policy.TagAll, patternValue(opts.tagAll))
+	}
+	if opts.releaseWindow != "" {
+		if _, err := policy.ParseWindow(opts.releaseWindow); err != nil {
+			return policy.Update{}, err
+		}
+		add = add.Set(policy.ReleaseWindow, opts.releaseWindow)
+	}
+	if opts.noReleaseWindow {
+		remove = remove.Add(policy.ReleaseWindow)
 	}
 
 	for _, tagPair := range opts.tags {
@@ -153,14 +217,29 @@ func calculatePolicyChanges(opts *controllerPolicyOpts) (policy.Update, error) {
 
 		container, tag := parts[0], parts[1]
 		if tag != "*" {
-			add = add.Set(policy.TagPrefix(container), "glob:"+tag)
+			add = add.Set(policy.TagPrefix(container), patternValue(tag))
 		} else {
 			remove = remove.Add(policy.TagPrefix(container))
 		}
 	}
 
+	// A pattern that doesn't parse would match no tags, and so quietly
+	// stop automation for the container
+	if err := add.ValidatePatterns(); err != nil {
+		return policy.Update{}, err
+	}
+
 	return policy.Update{
 		Add:    add,
 		Remove: remove,
 	}, nil
 }
+
+// patternValue gives the policy value for a tag pattern, which is
+// taken to be a glob unless it says otherwise.
+func patternValue(pattern string) string {
+	if policy.HasPatternPrefix(pattern) {
+		return pattern
+	}
+	return "glob:" + pattern
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/policy"
+)
+
+func TestCalculatePolicyChanges_TagPatterns(t *testing.T) {
+	now := time.Now()
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{tags: []string{"app=semver:~1.2"}, tagAll: "master-*"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.Add[policy.TagPrefix("app")] != "semver:~1.2" || update.Add[policy.TagAll] != "glob:master-*" {
+		t.Errorf("unexpected policies added: %v", update.Add)
+	}
+
+	for _, opts := range []*controllerPolicyOpts{
+		{tags: []string{"app=semver:~>>1"}},
+		{tags: []string{"app=regexp:("}},
+		{tagAll: "regexp:build-(\\d+"},
+	} {
+		if _, err := calculatePolicyChanges(opts, now); err == nil {
+			t.Errorf("expected error for invalid pattern in %+v", opts)
+		}
+	}
+}
+
+func TestCalculatePolicyChanges_ReleaseWindow(t *testing.T) {
+	now := time.Now()
+	update, err := calculatePolicyChanges(&controllerPolicyOpts{releaseWindow: "Mon-Fri 09:00-17:00 Europe/London"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Policy names are snake_case, as they appear in annotations
+	if update.Add["release_window"] != "Mon-Fri 09:00-17:00 Europe/London" {
+		t.Errorf("unexpected policies added: %v", update.Add)
+	}
+
+	update, err = calculatePolicyChanges(&controllerPolicyOpts{noReleaseWindow: true}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.Remove.Contains("release_window") {
+		t.Errorf("unexpected policies removed: %v", update.Remove)
+	}
+
+	if _, err := calculatePolicyChanges(&controllerPolicyOpts{releaseWindow: "Mon 25:00-26:00"}, now); err == nil {
+		t.Error("expected error for invalid release window")
+	}
+}
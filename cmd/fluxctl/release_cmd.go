@@ -19,6 +19,7 @@ type controllerReleaseOpts struct {
 	allImages      bool
 	exclude        []string
 	dryRun         bool
+	propose        bool
 	outputOpts
 	cause update.Cause
 
@@ -38,6 +39,7 @@ func (opts *controllerReleaseOpts) Command() *cobra.Command {
 			"fluxctl release -n default --controller=deployment/foo --update-image=library/hello:v2",
 			"fluxctl release --all --update-image=library/hello:v2",
 			"fluxctl release --controller=default:deployment/foo --update-all-images",
+			"fluxctl release --controller=default:deployment/foo --update-all-images --propose",
 		),
 		RunE: opts.RunE,
 	}
@@ -51,6 +53,7 @@ func (opts *controllerReleaseOpts) Command() *cobra.Command {
 	cmd.Flags().BoolVar(&opts.allImages, "update-all-images", false, "Update all images to latest versions")
 	cmd.Flags().StringSliceVar(&opts.exclude, "exclude", []string{}, "List of controllers to exclude")
 	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Do not release anything; just report back what would have been done")
+	cmd.Flags().BoolVar(&opts.propose, "propose", false, "Push the release to a branch of its own, to be reviewed and merged, rather than committing it to the branch synced")
 
 	// Deprecated
 	cmd.Flags().StringSliceVarP(&opts.services, "service", "s", []string{}, "Service to release")
@@ -76,6 +79,15 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 		return newUsageError("please supply either --all, or at least one --controller=<controller>")
 	}
 
+	if opts.dryRun && opts.propose {
+		return newUsageError("--dry-run and --propose cannot be used together")
+	}
+
+	printer, err := opts.resultPrinter()
+	if err != nil {
+		return err
+	}
+
 	var controllers []update.ResourceSpec
 	if opts.allControllers {
 		controllers = []update.ResourceSpec{update.ResourceSpecAll}
@@ -89,10 +101,7 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 		}
 	}
 
-	var (
-		image update.ImageSpec
-		err   error
-	)
+	var image update.ImageSpec
 	switch {
 	case opts.image != "":
 		image, err = update.ParseImageSpec(opts.image)
@@ -104,8 +113,11 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 	}
 
 	var kind update.ReleaseKind = update.ReleaseKindExecute
-	if opts.dryRun {
+	switch {
+	case opts.dryRun:
 		kind = update.ReleaseKindPlan
+	case opts.propose:
+		kind = update.ReleaseKindPropose
 	}
 
 	var excludes []flux.ResourceID
@@ -117,9 +129,12 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 		excludes = append(excludes, s)
 	}
 
-	if opts.dryRun {
+	switch {
+	case opts.dryRun:
 		fmt.Fprintf(cmd.OutOrStderr(), "Submitting dry-run release...\n")
-	} else {
+	case opts.propose:
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting release to be proposed ...\n")
+	default:
 		fmt.Fprintf(cmd.OutOrStderr(), "Submitting release ...\n")
 	}
 
@@ -139,5 +154,5 @@ func (opts *controllerReleaseOpts) RunE(cmd *cobra.Command, args []string) error
 		return err
 	}
 
-	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbosity)
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, printer, opts.verbosity)
 }
@@ -24,6 +24,11 @@ func TestReleaseCommand_CLIConversion(t *testing.T) {
 			ImageSpec:    update.ImageSpecLatest,
 			Kind:         update.ReleaseKindPlan,
 		}},
+		{[]string{"--update-all-images", "--all", "--propose"}, update.ReleaseSpec{
+			ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
+			ImageSpec:    update.ImageSpecLatest,
+			Kind:         update.ReleaseKindPropose,
+		}},
 		{[]string{"--update-image=alpine:latest", "--all"}, update.ReleaseSpec{
 			ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll},
 			ImageSpec:    "alpine:latest",
@@ -79,6 +84,7 @@ func TestReleaseCommand_InputFailures(t *testing.T) {
 		{[]string{"--update-all-images"}, "Should error when not specifying controller spec"},
 		{[]string{"--controller=invalid&controller", "--update-all-images"}, "Should error with invalid controller"},
 		{[]string{"subcommand"}, "Should error when given subcommand"},
+		{[]string{"--all", "--update-all-images", "--dry-run", "--propose"}, "Should error when both dry-run and propose"},
 	} {
 		testArgs(t, v.args, true, v.msg)
 	}
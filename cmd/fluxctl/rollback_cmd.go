@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+type controllerRollbackOpts struct {
+	*rootOpts
+	namespace string
+	revision  string
+	dryRun    bool
+	outputOpts
+	cause update.Cause
+}
+
+func newControllerRollback(parent *rootOpts) *controllerRollbackOpts {
+	return &controllerRollbackOpts{rootOpts: parent}
+}
+
+func (opts *controllerRollbackOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback <controller>",
+		Short: "Put back the images a controller used before its last release.",
+		Long: `
+Put back the images a controller used before its most recent release,
+whether that was made with fluxctl or by automation. With --revision,
+put back the images the controller used at that git revision instead.
+
+Rolling back is itself a release, so rolling back twice reinstates
+the images that were rolled back. It doesn't change the controller's
+policies; if it is automated, you may want to lock it too.
+`,
+		Example: makeExample(
+			"fluxctl rollback deployment/foo",
+			"fluxctl rollback -n prod deployment/foo --dry-run",
+			"fluxctl rollback default:deployment/foo --revision=1a2b3c4",
+		),
+		RunE: opts.RunE,
+	}
+
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "default", "Controller namespace")
+	cmd.Flags().StringVar(&opts.revision, "revision", "", "Git revision whose images to roll back to, instead of those before the last release")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Do not roll back anything; just report back what would have been done")
+
+	return cmd
+}
+
+func (opts *controllerRollbackOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please supply the controller to roll back, as <namespace>:<kind>/<name> or <kind>/<name>")
+	}
+
+	id, err := flux.ParseResourceIDOptionalNamespace(opts.namespace, args[0])
+	if err != nil {
+		return err
+	}
+
+	printer, err := opts.resultPrinter()
+	if err != nil {
+		return err
+	}
+
+	var kind update.ReleaseKind = update.ReleaseKindExecute
+	if opts.dryRun {
+		kind = update.ReleaseKindPlan
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting dry-run rollback...\n")
+	} else {
+		fmt.Fprintf(cmd.OutOrStderr(), "Submitting rollback ...\n")
+	}
+
+	ctx := context.Background()
+	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
+		Type:  update.Rollback,
+		Cause: opts.cause,
+		Spec: update.RollbackSpec{
+			ResourceID: id,
+			Revision:   opts.revision,
+			Kind:       kind,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, printer, opts.verbosity)
+}
@@ -0,0 +1,68 @@
+package main //+integration
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+func testRollbackArgs(t *testing.T, args []string, shouldErr bool) *genericMockRoundTripper {
+	svc := newMockService()
+	cmd := newControllerRollback(mockServiceOpts(svc)).Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		t.Fatalf("args %v: unexpected outcome, error %v", args, err)
+	}
+	return svc
+}
+
+func TestRollbackCommand_CLIConversion(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/flux")
+	for _, v := range []struct {
+		args         []string
+		expectedSpec update.RollbackSpec
+	}{
+		{[]string{"deployment/flux"}, update.RollbackSpec{
+			ResourceID: id,
+			Kind:       update.ReleaseKindExecute,
+		}},
+		{[]string{"default:deployment/flux", "--dry-run"}, update.RollbackSpec{
+			ResourceID: id,
+			Kind:       update.ReleaseKindPlan,
+		}},
+		{[]string{"-n", "prod", "deployment/flux", "--revision=1a2b3c4"}, update.RollbackSpec{
+			ResourceID: flux.MustParseResourceID("prod:deployment/flux"),
+			Revision:   "1a2b3c4",
+			Kind:       update.ReleaseKindExecute,
+		}},
+	} {
+		svc := testRollbackArgs(t, v.args, false)
+
+		method := "UpdateManifests"
+		if svc.calledURL(method) == nil {
+			t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+		}
+		var actualSpec update.Spec
+		if err := json.NewDecoder(svc.calledRequest(method).Body).Decode(&actualSpec); err != nil {
+			t.Fatal("Failed to decode spec")
+		}
+		if actualSpec.Type != update.Rollback || !reflect.DeepEqual(v.expectedSpec, actualSpec.Spec) {
+			t.Fatalf("Expected %#v but got %#v", v.expectedSpec, actualSpec)
+		}
+	}
+}
+
+func TestRollbackCommand_InputFailures(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"deployment/one", "deployment/two"},
+		{"invalid&controller"},
+	} {
+		testRollbackArgs(t, args, true)
+	}
+}
@@ -80,6 +80,7 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newControllerShow(opts).Command(),
 		newControllerList(opts).Command(),
 		newControllerRelease(opts).Command(),
+		newControllerRollback(opts).Command(),
 		newServiceAutomate(opts).Command(),
 		newControllerDeautomate(opts).Command(),
 		newControllerLock(opts).Command(),
@@ -88,6 +89,10 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newSave(opts).Command(),
 		newIdentity(opts).Command(),
 		newSync(opts).Command(),
+		newLint(opts).Command(),
+		newListSkipped(opts).Command(),
+		newSyncStatus(opts).Command(),
+		newInstall().Command(),
 	)
 
 	return cmd
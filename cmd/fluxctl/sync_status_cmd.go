@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/update"
+)
+
+type syncStatusOpts struct {
+	*rootOpts
+	diff   bool
+	all    bool
+	format string
+}
+
+func newSyncStatus(parent *rootOpts) *syncStatusOpts {
+	return &syncStatusOpts{rootOpts: parent}
+}
+
+func (opts *syncStatusOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync-status",
+		Short: "Show how the resources in the cluster differ from the manifests last synced.",
+		Long: `Compare the manifests in git, at the revision last synced, with the
+resources in the cluster. Each resource is in sync, modified (some of
+the fields given in its manifest have other values in the cluster),
+missing from the cluster, or extraneous (it was synced, but no longer
+has a manifest; this is only known if fluxd marks the resources it
+syncs, with --sync-garbage-collection).`,
+		Example: makeExample(
+			"fluxctl sync-status",
+			"fluxctl sync-status --diff",
+			"fluxctl sync-status --all -o json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().BoolVar(&opts.diff, "diff", false, "show the fields that differ, for modified resources")
+	cmd.Flags().BoolVar(&opts.all, "all", false, "list the resources that are in sync, as well as those that aren't")
+	AddFormatFlag(cmd, &opts.format)
+	return cmd
+}
+
+func (opts *syncStatusOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if err := checkFormat(opts.format); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	report, err := opts.API.DriftReport(ctx, v11.DriftOptions{Diff: opts.diff})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if opts.format != update.FormatTable {
+		return printStructured(out, opts.format, report)
+	}
+
+	if len(report.Revisions) == 0 {
+		fmt.Fprintln(out, "Nothing has been synced yet, so there is nothing to compare.")
+		return nil
+	}
+	var urls []string
+	for url := range report.Revisions {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		fmt.Fprintf(out, "Compared with revision %s of %s\n", report.Revisions[url], url)
+	}
+	fmt.Fprintln(out)
+
+	inSync := 0
+	var listed []cluster.ResourceDrift
+	for _, r := range report.Resources {
+		if r.Status == cluster.DriftInSync {
+			inSync++
+			if !opts.all {
+				continue
+			}
+		}
+		listed = append(listed, r)
+	}
+
+	if len(listed) > 0 {
+		w := newTabwriter()
+		fmt.Fprintf(w, "RESOURCE\tSOURCE\tSTATUS\n")
+		for _, r := range listed {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.ID, r.Source, r.Status)
+			for _, f := range r.Diff {
+				clusterValue := f.Cluster
+				if clusterValue == "" {
+					clusterValue = "(absent)"
+				}
+				fmt.Fprintf(w, "\t\t%s: %s in git, %s in cluster\n", f.Path, f.Git, clusterValue)
+			}
+		}
+		w.Flush()
+		fmt.Fprintln(out)
+	}
+
+	drifted := len(report.Resources) - inSync
+	fmt.Fprintf(out, "%d resource(s) in sync, %d drifted.\n", inSync, drifted)
+	if !report.Extraneous {
+		fmt.Fprintln(out, "Extraneous resources were not looked for, since fluxd is not marking the resources it syncs (see --sync-garbage-collection).")
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	k8sifclient "github.com/weaveworks/flux/integrations/client/clientset/versioned"
@@ -23,15 +25,22 @@ import (
 
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/cluster/kubernetes"
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
 	"github.com/weaveworks/flux/daemon"
+	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/mergerequest"
+	"github.com/weaveworks/flux/gpg"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/http/client"
 	daemonhttp "github.com/weaveworks/flux/http/daemon"
+	"github.com/weaveworks/flux/http/webhook"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/notifications"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/registry/cache"
+	registryDisk "github.com/weaveworks/flux/registry/cache/disk"
 	registryMemcache "github.com/weaveworks/flux/registry/cache/memcached"
 	registryMiddleware "github.com/weaveworks/flux/registry/middleware"
 	"github.com/weaveworks/flux/remote"
@@ -58,6 +67,20 @@ func optionalVar(fs *pflag.FlagSet, value ssh.OptionalValue, name, usage string)
 	return value
 }
 
+// mergeRequestOpener makes the opener for merge requests in the repo
+// at the remote given, on the host given, with the API token read
+// from the file given; or nil, if no host is given.
+func mergeRequestOpener(host, tokenFile string, remote git.Remote) (mergerequest.Opener, error) {
+	if host == "" {
+		return nil, nil
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading merge request token file")
+	}
+	return mergerequest.New(host, remote, strings.TrimSpace(string(token)))
+}
+
 func main() {
 	// Flag domain.
 	fs := pflag.NewFlagSet("default", pflag.ContinueOnError)
@@ -71,6 +94,7 @@ func main() {
 	// This mirrors how kubectl extracts information from the environment.
 	var (
 		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
+		listenMetricsAddr = fs.String("listen-metrics", "", "Listen address for /metrics, if it is to be served separately from the API")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "Optional, explicit path to kubectl tool")
 		versionFlag       = fs.Bool("version", false, "Get version number")
 		// Git repo & key etc.
@@ -87,19 +111,52 @@ func main() {
 		gitSkip        = fs.Bool("git-ci-skip", false, `append "[ci skip]" to commit messages so that CI will skip builds`)
 		gitSkipMessage = fs.String("git-ci-skip-message", "", "additional text for commit messages, useful for skipping builds in CI. Use this to supply specific text, or set --git-ci-skip")
 
+		gitSigningKey       = fs.String("git-signing-key", "", "GPG key (given by ID, fingerprint or email) with which to sign the commits, and the sync tag, made in the git repo; it must be in the keyring, e.g., imported with --git-gpg-key-import")
+		gitVerifySignatures = fs.Bool("git-verify-signatures", false, "only sync a revision if it, and each commit since the last revision trusted (one verified already, or pointed at by a signed sync tag), has a good signature made by a key in the keyring; otherwise, refuse to sync it, and report that with an event")
+		gitGPGKeyImport     = fs.String("git-gpg-key-import", "", "file, or directory of files, with GPG keys to import into the keyring at startup; these are the keys trusted by --git-verify-signatures, and can include the secret key for --git-signing-key")
+
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "period at which to poll git repo for new commits")
+		gitReposFile    = fs.String("git-repos-file", "", "path to a YAML file listing more git repos to sync from, besides --git-url; each is given as a url, and optionally a branch, path and pollInterval (which default to --git-branch, the top directory, and --git-poll-interval), and credentials or host keys")
+
+		gitHTTPSUsername          = fs.String("git-https-username", "", "username to give with the password, for an https:// --git-url")
+		gitHTTPSPasswordFile      = fs.String("git-https-password-file", "", "file (e.g., mounted from a secret) with the password or token to give for an https:// --git-url")
+		gitHTTPSPasswordEnv       = fs.String("git-https-password-env", "", "environment variable with the password or token to give for an https:// --git-url, if it's not in a file")
+		gitSSHKnownHosts          = fs.String("git-ssh-known-hosts", "", "known_hosts file with the only SSH host keys to trust for --git-url, instead of those in the SSH config")
+		gitSSHHostKeyFingerprints = fs.StringSlice("git-ssh-host-key-fingerprint", []string{}, "fingerprint (as printed by ssh-keygen -l, e.g., SHA256:...) of an SSH host key to trust for --git-url, instead of those in the SSH config; the host's keys are fetched, and those that match written to --ssh-keygen-dir. May be repeated")
+
+		gitProposeAutomated      = fs.Bool("git-propose-automated", false, "push automated image updates to a branch of their own, to be reviewed and merged, rather than committing them to --git-branch")
+		gitMergeRequests         = fs.String("git-merge-requests", "", "open a merge request for each branch of changes proposed in --git-url, on the host given: github or gitlab (including GitHub Enterprise, and self-hosted GitLab)")
+		gitMergeRequestTokenFile = fs.String("git-merge-request-token-file", "", "file (e.g., mounted from a secret) with the API token with which to open merge requests, for --git-merge-requests")
 		// syncing
-		syncInterval = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		syncInterval       = fs.Duration("sync-interval", 5*time.Minute, "apply config in git to cluster at least this often, even if there are no new commits")
+		manifestGeneration = fs.Bool("manifest-generation", false, "look for "+kubernetes.ConfigFilename+" files in the git repo, and generate and update manifests by running the commands they give")
+		kustomize          = fs.Bool("kustomize", false, "build directories of the git repo that have a kustomization file by running kustomize, and update images and policies by editing the kustomization")
+		lintManifests      = fs.Bool("lint-manifests", false, "check manifests when syncing, for deprecated API versions, containers without resource limits, and invalid pod selectors; the findings are reported by `fluxctl lint`")
+		lintBlockSync      = fs.Bool("lint-block-sync", false, "with --lint-manifests, don't sync if linting finds any problems")
+		containerPathsFile = fs.String("container-paths-file", "", "path to a YAML file giving, for kinds of resource flux doesn't otherwise know how to find images in (e.g., custom resources of operators), the paths of the fields that have the image of each container")
+		strictManifests    = fs.Bool("strict-manifests", false, "fail to sync if a .yaml, .yml or .json file in the git repo has a document that isn't a resource, rather than skipping it; skipped files are reported by `fluxctl list-skipped`")
+		syncGC             = fs.Bool("sync-garbage-collection", false, "delete resources that were synced from git, and have since been removed from it; resources synced are labelled flux.weave.works/sync-gc-mark to keep track")
+		syncGCDryRun       = fs.Bool("sync-garbage-collection-dry", false, "label resources when syncing, as for --sync-garbage-collection, but only log what would be deleted")
 		// registry
 		memcachedHostname    = fs.String("memcached-hostname", "memcached", "Hostname for memcached service.")
 		memcachedTimeout     = fs.Duration("memcached-timeout", time.Second, "Maximum time to wait before giving up on memcached requests.")
 		memcachedService     = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
 		registryCacheExpiry  = fs.Duration("registry-cache-expiry", 1*time.Hour, "Duration to keep cached image info. Must be < 1 month.")
+		registryCacheDir     = fs.String("registry-cache-dir", "", "keep image info in files under this directory (e.g., a persistent volume), so it survives restarts, instead of in memcached")
 		registryPollInterval = fs.Duration("registry-poll-interval", 5*time.Minute, "period at which to check for updated images")
 		registryRPS          = fs.Int("registry-rps", 200, "maximum registry requests per second per host")
 		registryBurst        = fs.Int("registry-burst", defaultRemoteConnections, "maximum number of warmer connections to remote and memcache")
+		registryWorkers      = fs.Int("registry-warmer-workers", 4, "number of images the warmer refreshes at once")
+		registryDisable      = fs.Bool("registry-disable-scanning", false, "do not scan image registries for image metadata, so images can't be listed, released or automated; memcached isn't needed")
 		registryTrace        = fs.Bool("registry-trace", false, "output trace of image registry requests to log")
 		registryInsecure     = fs.StringSlice("registry-insecure-host", []string{}, "use HTTP for this image registry domain (e.g., registry.cluster.local), instead of HTTPS")
+		registryTagDates     = fs.StringArray("registry-tag-date-pattern", []string{}, "for images without a creation time, find a date in the tag using <regexp>=<time layout>; e.g., '(\\d{8})=20060102'. May be repeated; the first match is used")
+		registryFirstSeen    = fs.Bool("registry-use-first-seen", false, "for images without a creation time (or a date in the tag), use the time the image was first seen")
+		registryECR          = fs.Bool("registry-ecr-auth", true, "get credentials for AWS ECR registries using the AWS SDK (from the environment, shared config, or the instance role), refreshing them before they expire; configured credentials are used if this fails")
+		registryPlatforms    = fs.StringSlice("registry-platform", []string{image.DefaultPlatform.String()}, "platform(s) of interest for multi-platform images, as <os>[/<arch>[/<variant>]], in order of preference; the first found supplies the image metadata unless a workload's node selector asks for another. May be repeated")
+		// automation and listing images
+		imageExcludeOlderThan = fs.Duration("image-exclude-older-than", 0, "never consider images older than this for automated updates, or list them as available; 0 means no limit")
+		imageExcludeTags      = fs.StringSlice("image-exclude-tag", []string{}, "never consider images with tags matching this glob (e.g., '*-rc*') for automated updates, or list them as available. May be repeated")
 
 		// k8s-secret backed ssh keyring configuration
 		k8sSecretName            = fs.String("k8s-secret-name", "flux-git-deploy", "Name of the k8s secret used to store the private SSH key")
@@ -114,7 +171,13 @@ func main() {
 		upstreamURL = fs.String("connect", "", "Connect to an upstream service e.g., Weave Cloud, at this base address")
 		token       = fs.String("token", "", "Authentication token for upstream service")
 
+		eventLinks        = fs.StringArray("event-link", []string{}, "add a link to each event sent upstream, or to notification sinks, given as <name>=<URL template>; e.g., 'grafana=https://grafana/d/abc?var-namespace={{.Namespace}}&from={{.FromMillis}}&to={{.ToMillis}}'. May be repeated")
+		notificationsFile = fs.String("notifications-file", "", "path to a YAML file listing places besides the upstream service to send events to, e.g., Slack incoming webhooks or other HTTP endpoints, and the types of event to send to each")
+		eventDigestPeriod = fs.Duration("event-digest-period", 0, "if non-zero, send a single summary of release and automation events to the upstream service, and to each notification sink, at this period (e.g., 24h), rather than one notification per event")
+
 		dockerConfig = fs.String("docker-config", "", "path to a docker config to use for image registry credentials")
+
+		webhookSecret = fs.String("webhook-secret", "", "if set, receive push webhooks from GitHub, GitLab, Bitbucket, Docker Hub, Quay and GCR at /api/flux/v1/notify/<source>, authenticated with this secret, and sync or look for new images straight away")
 	)
 
 	err := fs.Parse(os.Args[1:])
@@ -163,11 +226,100 @@ func main() {
 		os.Exit(1)
 	}
 
+	var gitRepoConfigs []git.RepoConfig
+	if *gitReposFile != "" {
+		bytes, err := ioutil.ReadFile(*gitReposFile)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("reading git repos file (--git-repos-file): %s", err))
+			os.Exit(1)
+		}
+		gitRepoConfigs, err = git.ParseRepoConfigs(bytes)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("in git repos file %s: %s", *gitReposFile, err))
+			os.Exit(1)
+		}
+		for _, c := range gitRepoConfigs {
+			if c.URL == *gitURL {
+				logger.Log("err", fmt.Sprintf("git repos file (--git-repos-file) lists the main git repo %s; it can only be synced once", c.URL))
+				os.Exit(1)
+			}
+			if len(c.Path) > 0 && c.Path[0] == '/' {
+				logger.Log("err", fmt.Sprintf("path for git repo %s should not have leading forward slash", c.URL))
+				os.Exit(1)
+			}
+		}
+	}
+
+	var notificationSinks []notifications.Sink
+	if *notificationsFile != "" {
+		bytes, err := ioutil.ReadFile(*notificationsFile)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("reading notifications file (--notifications-file): %s", err))
+			os.Exit(1)
+		}
+		notificationSinks, err = notifications.ParseConfig(bytes)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("in notifications file %s: %s", *notificationsFile, err))
+			os.Exit(1)
+		}
+	}
+
+	if *containerPathsFile != "" {
+		bytes, err := ioutil.ReadFile(*containerPathsFile)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("reading container paths file (--container-paths-file): %s", err))
+			os.Exit(1)
+		}
+		containerPaths, err := kresource.ParseContainerPaths(bytes)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("in container paths file %s: %s", *containerPathsFile, err))
+			os.Exit(1)
+		}
+		kresource.SetContainerPaths(containerPaths)
+	}
+
+	if *gitGPGKeyImport != "" {
+		imported, err := gpg.ImportKeys(*gitGPGKeyImport)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("importing GPG keys (--git-gpg-key-import): %s", err))
+			os.Exit(1)
+		}
+		logger.Log("info", "imported GPG keys", "files", fmt.Sprintf("%v", imported))
+	} else if *gitVerifySignatures {
+		logger.Log("warning", "--git-verify-signatures is set, but no keys were imported with --git-gpg-key-import; only commits signed by keys already in the keyring will be synced")
+	}
+
 	if *sshKeygenDir == "" {
 		logger.Log("info", fmt.Sprintf("SSH keygen dir (--ssh-keygen-dir) not provided, so using the deploy key volume (--k8s-secret-volume-mount-path=%s); this may cause problems if the deploy key volume is mounted read-only", *k8sSecretVolumeMountPath))
 		*sshKeygenDir = *k8sSecretVolumeMountPath
 	}
 
+	// Host keys pinned by fingerprint are written to the keygen dir,
+	// since it's expected to be writable.
+	gitAuth, err := git.AuthConfig{
+		Username:            *gitHTTPSUsername,
+		PasswordFile:        *gitHTTPSPasswordFile,
+		PasswordEnv:         *gitHTTPSPasswordEnv,
+		KnownHostsFile:      *gitSSHKnownHosts,
+		HostKeyFingerprints: *gitSSHHostKeyFingerprints,
+	}.Auth(*gitURL, filepath.Join(*sshKeygenDir, "known_hosts"))
+	if err != nil {
+		logger.Log("err", fmt.Sprintf("authenticating with git repo (--git-url): %s", err))
+		os.Exit(1)
+	}
+	if (*gitMergeRequests == "") != (*gitMergeRequestTokenFile == "") {
+		logger.Log("err", "--git-merge-requests and --git-merge-request-token-file must be given together")
+		os.Exit(1)
+	}
+	gitRepoAuths := make([]git.Auth, len(gitRepoConfigs))
+	for i, c := range gitRepoConfigs {
+		gitRepoAuths[i], err = c.AuthConfig.Auth(c.URL, filepath.Join(*sshKeygenDir, fmt.Sprintf("known_hosts-%d", i+1)))
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("authenticating with git repo %s, in git repos file %s: %s", c.URL, *gitReposFile, err))
+			os.Exit(1)
+		}
+	}
+
 	// Cluster component.
 	var clusterVersion string
 	var sshKeyRing ssh.KeyRing
@@ -263,26 +415,48 @@ func main() {
 		k8s = k8sInst
 		// There is only one way we currently interpret a repo of
 		// files as manifests, and that's as Kubernetes yamels.
-		k8sManifests = &kubernetes.Manifests{}
+		k8sManifests = &kubernetes.Manifests{
+			ManifestGeneration: *manifestGeneration,
+			Kustomize:          *kustomize,
+			Strict:             *strictManifests,
+			Cache:              kresource.NewCache(),
+		}
 	}
 
 	// Registry components
 	var cacheRegistry registry.Registry
 	var cacheWarmer *cache.Warmer
-	{
+	if *registryDisable {
+		logger.Log("registry", "image registry scanning is disabled")
+		cacheRegistry = registry.ImageScanDisabledRegistry{}
+	} else {
 		// Cache client, for use by registry and cache warmer
 		var cacheClient cache.Client
-		memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
-			Host:           *memcachedHostname,
-			Service:        *memcachedService,
-			Expiry:         *registryCacheExpiry,
-			Timeout:        *memcachedTimeout,
-			UpdateInterval: 1 * time.Minute,
-			Logger:         log.With(logger, "component", "memcached"),
-			MaxIdleConns:   *registryBurst,
-		})
-		defer memcacheClient.Stop()
-		cacheClient = cache.InstrumentClient(memcacheClient)
+		if *registryCacheDir != "" {
+			diskClient, err := registryDisk.NewDiskClient(registryDisk.DiskConfig{
+				Path:   *registryCacheDir,
+				Expiry: *registryCacheExpiry,
+				Logger: log.With(logger, "component", "disk-cache"),
+			})
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			defer diskClient.Stop()
+			cacheClient = cache.InstrumentClient(diskClient)
+		} else {
+			memcacheClient := registryMemcache.NewMemcacheClient(registryMemcache.MemcacheConfig{
+				Host:           *memcachedHostname,
+				Service:        *memcachedService,
+				Expiry:         *registryCacheExpiry,
+				Timeout:        *memcachedTimeout,
+				UpdateInterval: 1 * time.Minute,
+				Logger:         log.With(logger, "component", "memcached"),
+				MaxIdleConns:   *registryBurst,
+			})
+			defer memcacheClient.Stop()
+			cacheClient = cache.InstrumentClient(memcacheClient)
+		}
 
 		cacheRegistry = &cache.Cache{
 			Reader: cacheClient,
@@ -295,11 +469,24 @@ func main() {
 			RPS:   *registryRPS,
 			Burst: *registryBurst,
 		}
+		var platforms []image.Platform
+		for _, p := range *registryPlatforms {
+			platform, err := image.ParsePlatform(p)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			platforms = append(platforms, platform)
+		}
 		remoteFactory := &registry.RemoteClientFactory{
 			Logger:        registryLogger,
 			Limiters:      registryLimits,
 			Trace:         *registryTrace,
 			InsecureHosts: *registryInsecure,
+			Platforms:     platforms,
+		}
+		if *registryECR {
+			remoteFactory.ECR = registry.NewECRCredentials()
 		}
 
 		// Warmer
@@ -309,6 +496,17 @@ func main() {
 			logger.Log("err", err)
 			os.Exit(1)
 		}
+		for _, p := range *registryTagDates {
+			pattern, err := image.ParseTagDatePattern(p)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			cacheWarmer.TimestampFallback.TagDates = append(cacheWarmer.TimestampFallback.TagDates, pattern)
+		}
+		cacheWarmer.TimestampFallback.FirstSeen = *registryFirstSeen
+		cacheWarmer.Workers = *registryWorkers
+		cacheWarmer.Backoff = registryLimits
 	}
 
 	// Mechanical components.
@@ -344,7 +542,7 @@ func main() {
 	updateCheckLogger := log.With(logger, "component", "checkpoint")
 	checkForUpdates(clusterVersion, strconv.FormatBool(*gitURL != ""), updateCheckLogger)
 
-	gitRemote := git.Remote{URL: *gitURL}
+	gitRemote := git.Remote{URL: *gitURL, Auth: gitAuth}
 	gitConfig := git.Config{
 		Path:        *gitPath,
 		Branch:      *gitBranch,
@@ -354,6 +552,15 @@ func main() {
 		UserEmail:   *gitEmail,
 		SetAuthor:   *gitSetAuthor,
 		SkipMessage: *gitSkipMessage,
+
+		SigningKey:       *gitSigningKey,
+		VerifySignatures: *gitVerifySignatures,
+	}
+
+	mergeRequests, err := mergeRequestOpener(*gitMergeRequests, *gitMergeRequestTokenFile, gitRemote)
+	if err != nil {
+		logger.Log("err", fmt.Sprintf("opening merge requests (--git-merge-requests): %s", err))
+		os.Exit(1)
 	}
 
 	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval))
@@ -367,6 +574,37 @@ func main() {
 		}()
 	}
 
+	var gitRepos []daemon.GitRepo
+	for i, c := range gitRepoConfigs {
+		config := gitConfig
+		config.Branch = c.Branch
+		if config.Branch == "" {
+			config.Branch = *gitBranch
+		}
+		config.Path = c.Path
+		pollInterval := c.PollInterval
+		if pollInterval == 0 {
+			pollInterval = *gitPollInterval
+		}
+
+		remote := git.Remote{URL: c.URL, Auth: gitRepoAuths[i]}
+		opener, err := mergeRequestOpener(c.MergeRequests, c.MergeRequestTokenFile, remote)
+		if err != nil {
+			logger.Log("err", fmt.Sprintf("opening merge requests for git repo %s, in git repos file %s: %s", c.URL, *gitReposFile, err))
+			os.Exit(1)
+		}
+		r := git.NewRepo(remote, git.PollInterval(pollInterval))
+		shutdownWg.Add(1)
+		go func() {
+			err := r.Start(shutdown, shutdownWg)
+			if err != nil {
+				errc <- err
+			}
+		}()
+		gitRepos = append(gitRepos, daemon.GitRepo{Repo: r, Config: config, MergeRequests: opener})
+		logger.Log("url", c.URL, "branch", config.Branch, "path", config.Path, "poll-interval", pollInterval)
+	}
+
 	logger.Log(
 		"url", *gitURL,
 		"user", *gitUser,
@@ -389,15 +627,43 @@ func main() {
 		ImageRefresh:   make(chan image.Name, 100), // size chosen by fair dice roll
 		Repo:           repo,
 		GitConfig:      gitConfig,
+		GitRepos:       gitRepos,
 		Jobs:           jobs,
 		JobStatusCache: &job.StatusCache{Size: 100},
 		Logger:         log.With(logger, "component", "daemon"),
+		ImageExclusions: image.Exclusions{
+			OlderThan: *imageExcludeOlderThan,
+			Tags:      *imageExcludeTags,
+		},
+		LintManifests:           *lintManifests,
+		LintBlocksSync:          *lintBlockSync,
+		GarbageCollection:       *syncGC,
+		GarbageCollectionDryRun: *syncGCDryRun,
+		ProposeAutomated:        *gitProposeAutomated,
+		MergeRequests:           mergeRequests,
 		LoopVars: &daemon.LoopVars{
 			SyncInterval:         *syncInterval,
 			RegistryPollInterval: *registryPollInterval,
 		},
 	}
 
+	var linkTemplates []event.LinkTemplate
+	for _, l := range *eventLinks {
+		t, err := event.ParseLinkTemplate(l)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		linkTemplates = append(linkTemplates, t)
+	}
+
+	// Release and automation events are summarised, if asked, once per
+	// period for each of the upstream and the notification sinks
+	var digest *event.Digest
+	if *eventDigestPeriod > 0 {
+		digest = event.NewDigest(*eventDigestPeriod)
+	}
+
 	{
 		// Connect to fluxsvc if given an upstream address
 		if *upstreamURL != "" {
@@ -417,6 +683,12 @@ func main() {
 				os.Exit(1)
 			}
 			daemon.EventWriter = upstream
+			if len(linkTemplates) > 0 {
+				daemon.EventWriter = event.NewLinkingWriter(daemon.EventWriter, linkTemplates, log.With(logger, "component", "links"))
+			}
+			if digest != nil {
+				daemon.EventWriter = digest.Channel("upstream", daemon.EventWriter)
+			}
 			go func() {
 				<-shutdown
 				upstream.Close()
@@ -426,22 +698,64 @@ func main() {
 		}
 	}
 
+	// Send events to any other sinks as well. This wraps the
+	// upstream, so each sink gets every event (or with a digest, its
+	// own summary of the releases).
+	if len(notificationSinks) > 0 {
+		notificationsLogger := log.With(logger, "component", "notifications")
+		for _, sink := range notificationSinks {
+			notificationsLogger.Log("sink", sink.Name)
+		}
+		notifier := notifications.NewWriter(daemon.EventWriter, notificationSinks, linkTemplates, notificationsLogger)
+		if digest != nil {
+			notifier.DigestTo(digest)
+		}
+		daemon.EventWriter = notifier
+		shutdownWg.Add(1)
+		go notifier.Loop(shutdown, shutdownWg)
+	}
+	if digest != nil {
+		shutdownWg.Add(1)
+		go digest.Loop(shutdown, shutdownWg, log.With(logger, "component", "digest"))
+	}
+
 	shutdownWg.Add(1)
 	go daemon.Loop(shutdown, shutdownWg, log.With(logger, "component", "sync-loop"))
 
-	cacheWarmer.Notify = daemon.AskForImagePoll
-	cacheWarmer.Priority = daemon.ImageRefresh
-	shutdownWg.Add(1)
-	go cacheWarmer.Loop(log.With(logger, "component", "warmer"), shutdown, shutdownWg, imageCreds)
+	if cacheWarmer != nil {
+		cacheWarmer.Notify = daemon.AskForImagePoll
+		cacheWarmer.Priority = daemon.ImageRefresh
+		cacheWarmer.Automated = daemon.AutomatedImages
+		shutdownWg.Add(1)
+		go cacheWarmer.Loop(log.With(logger, "component", "warmer"), shutdown, shutdownWg, imageCreds)
+	} else {
+		// Nothing's there to take notice of new images
+		daemon.ImageRefresh = nil
+	}
 
 	go func() {
 		mux := http.DefaultServeMux
-		mux.Handle("/metrics", promhttp.Handler())
+		if *listenMetricsAddr == "" {
+			mux.Handle("/metrics", promhttp.Handler())
+		}
 		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
 		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
+		if *webhookSecret != "" {
+			webhooks := webhook.NewHandler(daemon, *webhookSecret, log.With(logger, "component", "webhook"))
+			mux.Handle("/api/flux/v1/notify/", http.StripPrefix("/api/flux/v1/notify", webhooks))
+		}
 		logger.Log("addr", *listenAddr)
 		errc <- http.ListenAndServe(*listenAddr, mux)
 	}()
 
+	if *listenMetricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			logger.Log("metrics-addr", *listenMetricsAddr)
+			errc <- http.ListenAndServe(*listenMetricsAddr, mux)
+		}()
+	}
+
 	// Fall off the end, into the waiting procedure.
 }
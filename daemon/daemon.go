@@ -3,8 +3,11 @@ package daemon
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -13,11 +16,13 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/mergerequest"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
@@ -44,13 +49,31 @@ type Daemon struct {
 	Cluster        cluster.Cluster
 	Manifests      cluster.Manifests
 	Registry       registry.Registry
-	ImageRefresh   chan image.Name
+	ImageRefresh   chan image.Name // nil, if images aren't being scanned
 	Repo           *git.Repo
 	GitConfig      git.Config
+	GitRepos       []GitRepo // more repos to sync from, besides Repo
 	Jobs           *job.Queue
 	JobStatusCache *job.StatusCache
 	EventWriter    event.EventWriter
 	Logger         log.Logger
+	// Images never to be considered for automated updates, or listed
+	// as available
+	ImageExclusions image.Exclusions
+	// Whether to lint the manifests each time they're synced, and if
+	// so, whether to refuse to sync any that have findings
+	LintManifests  bool
+	LintBlocksSync bool
+	// Whether to delete resources that were synced, and have since
+	// been removed from the repo; and whether only to log what would
+	// be deleted
+	GarbageCollection       bool
+	GarbageCollectionDryRun bool
+	// Whether to push automated updates to a branch of their own, to
+	// be reviewed, rather than committing them to the branch synced;
+	// and how to open merge requests for the main repo, if at all
+	ProposeAutomated bool
+	MergeRequests    mergerequest.Opener
 	// bookkeeping
 	*LoopVars
 }
@@ -71,13 +94,8 @@ func (d *Daemon) Export(ctx context.Context) ([]byte, error) {
 }
 
 func (d *Daemon) getPolicyResourceMap(ctx context.Context) (policy.ResourceMap, v6.ReadOnlyReason, error) {
-	var services policy.ResourceMap
 	var globalReadOnly v6.ReadOnlyReason
-	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
-		var err error
-		services, err = d.Manifests.ServicesWithPolicies(checkout.ManifestDir())
-		return err
-	})
+	services, err := d.servicesWithPolicies(ctx)
 
 	// The reason something is missing from the map differs depending
 	// on the state of the git repo.
@@ -125,9 +143,10 @@ func (d *Daemon) ListServices(ctx context.Context, namespace string) ([]v6.Contr
 			Antecedent: service.Antecedent,
 			Labels:     service.Labels,
 			Automated:  policies.Contains(policy.Automated),
-			Locked:     policies.Contains(policy.Locked),
+			Locked:     policies.LockedAt(time.Now()),
 			Ignore:     policies.Contains(policy.Ignore),
 			Policies:   policies.ToStringMap(),
+			Held:       d.heldUpdate(service.ID),
 		})
 	}
 
@@ -151,6 +170,10 @@ func (d *Daemon) ListImages(ctx context.Context, spec update.ResourceSpec) ([]v6
 
 // ListImagesWithOptions lists the images available for set of services
 func (d *Daemon) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesOptions) ([]v6.ImageStatus, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, invalidImagesOptionsError(err)
+	}
+
 	var services []cluster.Controller
 	var err error
 	if opts.Spec == update.ResourceSpecAll {
@@ -175,7 +198,7 @@ func (d *Daemon) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesO
 
 	var res []v6.ImageStatus
 	for _, service := range services {
-		serviceContainers, err := getServiceContainers(service, imageRepos, policyResourceMap, opts.OverrideContainerFields)
+		serviceContainers, err := getServiceContainers(service, imageRepos, policyResourceMap, d.ImageExclusions, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -194,26 +217,6 @@ type jobFunc func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Res
 // updateFunc is a type for procedures that operate on a git checkout, to be run in a job
 type updateFunc func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error)
 
-// makeJobFromUpdate turns an updateFunc into a jobFunc that will run
-// the update with a fresh clone, and log the result as an event.
-func (d *Daemon) makeJobFromUpdate(update updateFunc) jobFunc {
-	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
-		var result job.Result
-		err := d.WithClone(ctx, func(working *git.Checkout) error {
-			var err error
-			result, err = update(ctx, jobID, working, logger)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
-			return result, err
-		}
-		return result, nil
-	}
-}
-
 // executeJob runs a job func and keeps track of its status, so the
 // daemon can report it when asked.
 func (d *Daemon) executeJob(id job.ID, do jobFunc, logger log.Logger) (job.Result, error) {
@@ -230,7 +233,7 @@ func (d *Daemon) executeJob(id job.ID, do jobFunc, logger log.Logger) (job.Resul
 }
 
 // makeLoggingFunc takes a jobFunc and returns a jobFunc that will log
-// a commit event with the result.
+// a commit event with the result, and an event for each new proposal.
 func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 	return func(ctx context.Context, id job.ID, logger log.Logger) (job.Result, error) {
 		started := time.Now().UTC()
@@ -239,14 +242,35 @@ func (d *Daemon) makeLoggingJobFunc(f jobFunc) jobFunc {
 			return result, err
 		}
 		logger.Log("revision", result.Revision)
-		if result.Revision != "" {
-			var serviceIDs []flux.ResourceID
-			for id, result := range result.Result {
-				if result.Status == update.ReleaseStatusSuccess {
-					serviceIDs = append(serviceIDs, id)
-				}
+		var serviceIDs []flux.ResourceID
+		for id, result := range result.Result {
+			if result.Status == update.ReleaseStatusSuccess {
+				serviceIDs = append(serviceIDs, id)
 			}
-
+		}
+		for _, p := range result.Proposals {
+			// A proposal already made was logged at the time
+			if p.Pending {
+				continue
+			}
+			if err := d.LogEvent(event.Event{
+				ServiceIDs: serviceIDs,
+				Type:       event.EventPropose,
+				StartedAt:  started,
+				EndedAt:    started,
+				LogLevel:   event.LogLevelInfo,
+				Metadata: &event.ProposeEventMetadata{
+					Revision: p.Revision,
+					Branch:   p.Branch,
+					URL:      p.URL,
+					Spec:     result.Spec,
+					Result:   result.Result,
+				},
+			}); err != nil {
+				return result, err
+			}
+		}
+		if result.Revision != "" {
 			metadata := &event.CommitEventMetadata{
 				Revision: result.Revision,
 				Spec:     result.Spec,
@@ -294,14 +318,36 @@ func (d *Daemon) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID,
 	}
 	switch s := spec.Spec.(type) {
 	case release.Changes:
+		do := d.makeJobFromUpdate(resourcesChanged(s), func(gr GitRepo, ids []flux.ResourceID) updateFunc {
+			return d.release(gr, spec, changesTo(s, ids))
+		})
 		if s.ReleaseKind() == update.ReleaseKindPlan {
 			id := job.ID(guid.New())
-			_, err := d.executeJob(id, d.makeJobFromUpdate(d.release(spec, s)), d.Logger)
+			_, err := d.executeJob(id, do, d.Logger)
 			return id, err
 		}
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, s)))), nil
+		return d.queueJob(d.makeLoggingJobFunc(do)), nil
+	case update.RollbackSpec:
+		do := d.makeJobFromUpdate([]flux.ResourceID{s.ResourceID}, func(gr GitRepo, _ []flux.ResourceID) updateFunc {
+			return d.rollback(gr, spec, s)
+		})
+		if s.Kind == update.ReleaseKindPlan {
+			id := job.ID(guid.New())
+			_, err := d.executeJob(id, do, d.Logger)
+			return id, err
+		}
+		return d.queueJob(d.makeLoggingJobFunc(do)), nil
 	case policy.Updates:
-		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicy(spec, s)))), nil
+		var ids []flux.ResourceID
+		for resourceID, u := range s {
+			if err := u.Add.ValidatePatterns(); err != nil {
+				return id, errors.Wrapf(err, "updating policies of %s", resourceID)
+			}
+			ids = append(ids, resourceID)
+		}
+		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(ids, func(_ GitRepo, ids []flux.ResourceID) updateFunc {
+			return d.updatePolicy(spec, policyUpdatesTo(s, ids))
+		}))), nil
 	case update.ManualSync:
 		return d.queueJob(d.sync()), nil
 	default:
@@ -345,39 +391,30 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 			if policy.Set(u.Add).Contains(policy.Automated) {
 				anythingAutomated = true
 			}
-			// find the service manifest
-			err := cluster.UpdateManifest(d.Manifests, working.ManifestDir(), serviceID, func(def []byte) ([]byte, error) {
-				newDef, err := d.Manifests.UpdatePolicies(def, serviceID, u)
-				if err != nil {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
-					return nil, err
-				}
-				if string(newDef) == string(def) {
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSkipped,
-					}
-				} else {
-					serviceIDs = append(serviceIDs, serviceID)
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusSuccess,
-					}
-				}
-				return newDef, nil
-			})
+			// find the service manifest, and apply the update to it
+			changed, err := cluster.UpdatePolicies(d.Manifests, working.ManifestDir(), serviceID, u)
 			if err != nil {
-				switch err := err.(type) {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusFailed,
+					Error:  err.Error(),
+				}
+				switch err.(type) {
 				case cluster.ManifestError:
-					result.Result[serviceID] = update.ControllerResult{
-						Status: update.ReleaseStatusFailed,
-						Error:  err.Error(),
-					}
+					continue
 				default:
 					return result, err
 				}
 			}
+			if changed {
+				serviceIDs = append(serviceIDs, serviceID)
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSuccess,
+				}
+			} else {
+				result.Result[serviceID] = update.ControllerResult{
+					Status: update.ReleaseStatusSkipped,
+				}
+			}
 		}
 		if len(serviceIDs) == 0 {
 			return result, nil
@@ -408,7 +445,7 @@ func (d *Daemon) updatePolicy(spec update.Spec, updates policy.Updates) updateFu
 	}
 }
 
-func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
+func (d *Daemon) release(gr GitRepo, spec update.Spec, c release.Changes) updateFunc {
 	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
 		rc := release.NewReleaseContext(d.Cluster, d.Manifests, d.Registry, working)
 		result, err := release.Release(rc, c, logger)
@@ -420,7 +457,9 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 
 		var revision string
 
-		if c.ReleaseKind() == update.ReleaseKindExecute {
+		_, automated := c.(*update.Automated)
+		propose := c.ReleaseKind() == update.ReleaseKindPropose || (automated && d.ProposeAutomated)
+		if c.ReleaseKind() == update.ReleaseKindExecute || propose {
 			commitMsg := spec.Cause.Message
 			if commitMsg == "" {
 				commitMsg = c.CommitMessage(result)
@@ -430,12 +469,24 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 				commitAuthor = spec.Cause.User
 			}
 			commitAction := git.CommitAction{Author: commitAuthor, Message: commitMsg}
-			if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}); err != nil {
+			commitNote := &note{JobID: jobID, Spec: spec, Result: result}
+			if propose {
+				proposal, err := d.propose(ctx, gr, working, commitAction, commitNote, automated, logger)
+				if err != nil {
+					return zero, err
+				}
+				return job.Result{
+					Spec:      &spec,
+					Result:    result,
+					Proposals: []job.Proposal{proposal},
+				}, nil
+			}
+			if err := working.CommitAndPush(ctx, commitAction, commitNote); err != nil {
 				// On the chance pushing failed because it was not
 				// possible to fast-forward, ask the repo to fetch
 				// from upstream ASAP, so the next attempt is more
 				// likely to succeed.
-				d.Repo.Notify()
+				gr.Repo.Notify()
 				return zero, err
 			}
 			revision, err = working.HeadRevision(ctx)
@@ -451,6 +502,163 @@ func (d *Daemon) release(spec update.Spec, c release.Changes) updateFunc {
 	}
 }
 
+// proposalBranchPrefix starts the name of each branch that changes
+// are proposed on.
+const proposalBranchPrefix = "flux-propose/"
+
+// The segment of a proposal branch name after the prefix, for changes
+// proposed when asked for, and by automation.
+const (
+	proposalManual = "manual"
+	proposalAuto   = "auto"
+)
+
+// propose commits the changes in the working clone to a branch of
+// their own, rather than the branch synced, and opens a merge request
+// for the branch if the repo is set up for that. The branch is named
+// for the workloads changed (see `proposalBranch`), so proposing the
+// same changes again (as automation will, until they are merged)
+// finds the branch already there; and proposing other changes to the
+// same workloads, e.g., a newer image, or the same changes once the
+// branch synced has moved on, replaces what's on the branch, and so
+// updates its merge request rather than opening another. Changes
+// proposed by automation are kept apart from those asked for, so
+// neither replaces the other.
+func (d *Daemon) propose(ctx context.Context, gr GitRepo, working *git.Checkout, commitAction git.CommitAction, n *note, automated bool, logger log.Logger) (job.Proposal, error) {
+	branch, err := working.CommitAndPushBranch(ctx, commitAction, n, proposalBranch(n.Result, automated))
+	// Either way, fetch, so the notes (and the branch) pushed are
+	// known to the repo
+	gr.Repo.Notify()
+	if err != nil {
+		return job.Proposal{}, err
+	}
+	proposal := job.Proposal{Branch: branch.Name, Revision: branch.Revision, Pending: branch.Existed}
+	if branch.Existed || branch.Updated || gr.MergeRequests == nil {
+		// A branch that was there already has had its merge request
+		// opened (if there is one to open)
+		return proposal, nil
+	}
+
+	var description bytes.Buffer
+	fmt.Fprintf(&description, "Merging this into %s will apply these changes to the cluster.\n\n```\n", gr.Config.Branch)
+	update.PrintResults(&description, n.Result, 0)
+	description.WriteString("```\n")
+	proposal.URL, err = gr.MergeRequests.Open(ctx, branch.Name, gr.Config.Branch, commitAction.Message, description.String())
+	if err != nil {
+		// The changes are on the branch regardless, so can still be
+		// merged by hand
+		logger.Log("branch", branch.Name, "err", err)
+	}
+	return proposal, nil
+}
+
+// proposalBranch names the branch on which to propose the changes in
+// the result given, after whether they're automated, and the
+// workloads changed: for a single workload, after its ID; for more
+// than one, after a hash of their IDs, to keep the name short.
+func proposalBranch(result update.Result, automated bool) string {
+	prefix := proposalBranchPrefix + proposalManual + "/"
+	if automated {
+		prefix = proposalBranchPrefix + proposalAuto + "/"
+	}
+	var ids []string
+	for _, id := range result.AffectedResources() {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+	if len(ids) == 1 {
+		name := strings.NewReplacer(":", "-", "/", "-").Replace(ids[0])
+		// Resource IDs make good branch names, but for those git
+		// doesn't allow
+		if !strings.HasSuffix(name, ".lock") && !strings.Contains(name, "..") {
+			return prefix + name
+		}
+	}
+	hash := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	return prefix + "workloads-" + hex.EncodeToString(hash[:])[:12]
+}
+
+// rollback works out which images to go back to, then releases them
+// like any other change of images.
+func (d *Daemon) rollback(gr GitRepo, spec update.Spec, s update.RollbackSpec) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		var rollback *update.RollbackRelease
+		var err error
+		if s.Revision != "" {
+			rollback, err = d.rollbackToRevision(ctx, gr, working, s)
+		} else {
+			rollback, err = d.rollbackLastRelease(ctx, gr, working, s)
+		}
+		if err != nil {
+			return job.Result{}, err
+		}
+		return d.release(gr, spec, rollback)(ctx, jobID, working, logger)
+	}
+}
+
+// rollbackToRevision gives the rollback to the images used by the
+// controller in the manifests at the revision named.
+func (d *Daemon) rollbackToRevision(ctx context.Context, gr GitRepo, working *git.Checkout, s update.RollbackSpec) (*update.RollbackRelease, error) {
+	export, err := working.Export(ctx, s.Revision)
+	if err != nil {
+		return nil, unknownRevisionError(s.Revision, err)
+	}
+	defer export.Clean()
+	// Commands may be run from the (perhaps old) revision
+	if d.verifyBeforeCommands(gr) {
+		if err := d.verifyRevision(ctx, gr, working, s.Revision); err != nil {
+			return nil, err
+		}
+	}
+
+	resources, err := d.Manifests.LoadManifests(export.Dir(), export.ManifestDir())
+	if err != nil {
+		return nil, manifestLoadError(err)
+	}
+	res, ok := resources[s.ResourceID.String()]
+	if !ok {
+		return nil, noRollbackError(s, fmt.Errorf("%s is not defined at revision %s", s.ResourceID, s.Revision))
+	}
+	workload, ok := res.(resource.Workload)
+	if !ok {
+		return nil, noRollbackError(s, fmt.Errorf("%s does not have containers", s.ResourceID))
+	}
+	return s.RollbackTo(s.Revision, workload.Containers()), nil
+}
+
+// rollbackLastRelease gives the rollback that undoes the most recent
+// release (automated or not) of the controller, as recorded in the
+// notes on commits.
+func (d *Daemon) rollbackLastRelease(ctx context.Context, gr GitRepo, working *git.Checkout, s update.RollbackSpec) (*update.RollbackRelease, error) {
+	head, err := working.HeadRevision(ctx)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := gr.Repo.CommitsBefore(ctx, head, gr.Config.Path)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := working.NoteRevList(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading notes from repo")
+	}
+	// Commits are newest first
+	for _, commit := range commits {
+		if _, ok := notes[commit.Revision]; !ok {
+			continue
+		}
+		var n note
+		ok, err := working.GetNote(ctx, commit.Revision, &n)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading notes from repo")
+		}
+		if ok && len(n.Result.Undo(s.ResourceID)) > 0 {
+			return s.Undo(commit.Revision, n.Result), nil
+		}
+	}
+	return nil, noRollbackError(s, fmt.Errorf("no release of %s was found", s.ResourceID))
+}
+
 // Tell the daemon to synchronise the cluster with the manifests in
 // the git repo. This has an error return value because upstream there
 // may be comms difficulties or other sources of problems; here, we
@@ -459,7 +667,13 @@ func (d *Daemon) NotifyChange(ctx context.Context, change v9.Change) error {
 	switch change.Kind {
 	case v9.GitChange:
 		gitUpdate := change.Source.(v9.GitUpdate)
-		if gitUpdate.URL != d.Repo.Origin().URL && gitUpdate.Branch != d.GitConfig.Branch {
+		for _, gr := range d.GitRepos {
+			if gr.Repo.Origin().Equivalent(gitUpdate.URL) && gitUpdate.Branch == gr.Config.Branch {
+				gr.Repo.Notify()
+				return nil
+			}
+		}
+		if !d.Repo.Origin().Equivalent(gitUpdate.URL) || gitUpdate.Branch != d.GitConfig.Branch {
 			// It isn't strictly an _error_ to be notified about a repo/branch pair
 			// that isn't ours, but it's worth logging anyway for debugging.
 			d.Logger.Log("msg", "notified about unrelated change",
@@ -470,7 +684,9 @@ func (d *Daemon) NotifyChange(ctx context.Context, change v9.Change) error {
 		d.Repo.Notify()
 	case v9.ImageChange:
 		imageUpdate := change.Source.(v9.ImageUpdate)
-		d.ImageRefresh <- imageUpdate.Name
+		if d.ImageRefresh != nil {
+			d.ImageRefresh <- imageUpdate.Name
+		}
 	}
 	return nil
 }
@@ -527,6 +743,16 @@ func (d *Daemon) JobStatus(ctx context.Context, jobID job.ID) (job.Status, error
 // and it's applied at or _past_ it, you'll get an empty list.
 func (d *Daemon) SyncStatus(ctx context.Context, commitRef string) ([]string, error) {
 	commits, err := d.Repo.CommitsBetween(ctx, d.GitConfig.SyncTag, commitRef, d.GitConfig.Path)
+	// The commit may be in another repo, e.g., if a release was
+	// committed to it
+	for _, gr := range d.GitRepos {
+		if err == nil {
+			break
+		}
+		if more, moreErr := gr.Repo.CommitsBetween(ctx, gr.Config.SyncTag, commitRef, gr.Config.Path); moreErr == nil {
+			commits, err = more, nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -558,15 +784,94 @@ func (d *Daemon) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 	}, nil
 }
 
+// LintReport returns the problems found in the manifests when they
+// were last synced.
+func (d *Daemon) LintReport(ctx context.Context) (v11.LintReport, error) {
+	if !d.LintManifests {
+		return v11.LintReport{}, lintingDisabledError
+	}
+	d.lintMu.RLock()
+	defer d.lintMu.RUnlock()
+	return d.lintReport, nil
+}
+
+// ManifestsReport returns the outcome of loading the manifests when
+// they were last synced: the files skipped, or the error that stopped
+// them from being loaded.
+func (d *Daemon) ManifestsReport(ctx context.Context) (v11.ManifestsReport, error) {
+	d.manifestsMu.RLock()
+	defer d.manifestsMu.RUnlock()
+	return d.manifestsReport, nil
+}
+
+// DriftReport compares the manifests in each repo, at the revision
+// last synced, with the resources in the cluster. As when syncing, a
+// resource defined in more than one repo is taken from the first
+// (with the main repo first); and, if any repo other than the main
+// repo can't be read, it's left out of the report rather than failing
+// it.
+func (d *Daemon) DriftReport(ctx context.Context, opts v11.DriftOptions) (v11.DriftReport, error) {
+	detector, ok := d.Cluster.(cluster.DriftDetector)
+	if !ok {
+		return v11.DriftReport{}, driftUnsupportedError
+	}
+	report := v11.DriftReport{
+		Revisions:  map[string]string{},
+		Extraneous: d.GarbageCollection || d.GarbageCollectionDryRun,
+	}
+	reported := map[flux.ResourceID]bool{}
+	for _, gr := range d.repos() {
+		err := d.withCloneOf(ctx, gr, func(working *git.Checkout) error {
+			revision, err := working.SyncRevision(ctx)
+			if isUnknownRevision(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			export, err := working.Export(ctx, revision)
+			if err != nil {
+				return unknownRevisionError(revision, err)
+			}
+			defer export.Clean()
+			resources, err := d.Manifests.LoadManifests(export.Dir(), export.ManifestDir())
+			if err != nil {
+				return manifestLoadError(err)
+			}
+			var syncSet string
+			if report.Extraneous {
+				syncSet = syncSetName(gr)
+			}
+			drifts, err := detector.Drift(resources, syncSet, opts.Diff)
+			if err != nil {
+				return err
+			}
+			for _, drift := range drifts {
+				if !reported[drift.ID] {
+					reported[drift.ID] = true
+					report.Resources = append(report.Resources, drift)
+				}
+			}
+			report.Revisions[gr.Repo.Origin().URL] = revision
+			return nil
+		})
+		if err != nil {
+			if gr.Repo == d.Repo {
+				return v11.DriftReport{}, err
+			}
+			d.Logger.Log("url", gr.Repo.Origin().URL, "err", err)
+		}
+	}
+	sort.Slice(report.Resources, func(i, j int) bool {
+		return report.Resources[i].ID.String() < report.Resources[j].ID.String()
+	})
+	return report, nil
+}
+
 // Non-api.Server methods
 
 func (d *Daemon) WithClone(ctx context.Context, fn func(*git.Checkout) error) error {
-	co, err := d.Repo.Clone(ctx, d.GitConfig)
-	if err != nil {
-		return err
-	}
-	defer co.Clean()
-	return fn(co)
+	return d.withCloneOf(ctx, d.repos()[0], fn)
 }
 
 func (d *Daemon) LogEvent(ev event.Event) error {
@@ -593,18 +898,21 @@ func containers2containers(cs []resource.Container) []v6.Container {
 	return res
 }
 
-func getServiceContainers(service cluster.Controller, imageRepos update.ImageRepos, policyResourceMap policy.ResourceMap, fields []string) (res []v6.Container, err error) {
+func getServiceContainers(service cluster.Controller, imageRepos update.ImageRepos, policyResourceMap policy.ResourceMap, exclusions image.Exclusions, opts v10.ListImagesOptions) (res []v6.Container, err error) {
 	for _, c := range service.ContainersOrNil() {
 		imageRepo := c.Image.Name
 		tagPattern := policy.GetTagPattern(policyResourceMap, service.ID, c.Name)
 
-		images := imageRepos.GetRepoImages(imageRepo)
+		images := imageRepos.GetRepoImages(imageRepo).ForPlatform(service.Platform)
+		// Look for the current image before excluding any, since it
+		// may well be one that's excluded
 		currentImage := images.FindWithRef(c.Image)
 
-		container, err := v6.NewContainer(c.Name, images, currentImage, tagPattern, fields)
+		container, err := v6.NewContainer(c.Name, images.Exclude(exclusions), currentImage, tagPattern, opts.OverrideContainerFields)
 		if err != nil {
 			return res, err
 		}
+		container.Available = opts.SelectImages(container.Available)
 		res = append(res, container)
 	}
 
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -15,6 +18,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/cluster"
@@ -176,7 +180,7 @@ func TestDaemon_ListImagesWithOptions(t *testing.T) {
 						{
 							Name:           container,
 							Current:        image.Info{ID: currentImageRef},
-							LatestFiltered: image.Info{ID: currentImageRef},
+							LatestFiltered: image.Info{ID: newImageRef},
 							Available: []image.Info{
 								{ID: currentImageRef},
 								{ID: newImageRef},
@@ -218,7 +222,7 @@ func TestDaemon_ListImagesWithOptions(t *testing.T) {
 						{
 							Name:           container,
 							Current:        image.Info{ID: currentImageRef},
-							LatestFiltered: image.Info{ID: currentImageRef},
+							LatestFiltered: image.Info{ID: newImageRef},
 							Available: []image.Info{
 								{ID: currentImageRef},
 								{ID: newImageRef},
@@ -403,6 +407,221 @@ func TestDaemon_Release(t *testing.T) {
 
 }
 
+// mockOpener records the merge requests it's asked to open.
+type mockOpener struct {
+	mu     sync.Mutex
+	opened []string // the branches
+}
+
+func (o *mockOpener) Open(ctx context.Context, branch, base, title, description string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.opened = append(o.opened, branch)
+	return fmt.Sprintf("https://git.example.com/merge_requests/%d", len(o.opened)), nil
+}
+
+func (o *mockOpener) timesOpened(branch string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for _, b := range o.opened {
+		if b == branch {
+			n++
+		}
+	}
+	return n
+}
+
+// When I propose a release, it should be pushed to a branch of its
+// own, with a merge request opened for it, leaving the branch synced
+// as it was; and proposing it again should find it already proposed
+func TestDaemon_Propose(t *testing.T) {
+	d, start, clean, _, _ := mockDaemon(t)
+	opener := &mockOpener{}
+	d.MergeRequests = opener
+	// So that automation doesn't commit to the branch synced either
+	d.ProposeAutomated = true
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propose := func() job.Proposal {
+		stat := w.ForJobSucceeded(d, updateManifest(ctx, t, d, update.Spec{
+			Type: update.Images,
+			Spec: update.ReleaseSpec{
+				Kind:         update.ReleaseKindPropose,
+				ServiceSpecs: []update.ResourceSpec{update.ResourceSpec(svc)},
+				ImageSpec:    newHelloImage,
+			},
+		}))
+		if stat.Result.Revision != "" {
+			t.Errorf("expected no revision to be synced, got %s", stat.Result.Revision)
+		}
+		if len(stat.Result.Proposals) != 1 {
+			t.Fatalf("expected one proposal, got %+v", stat.Result.Proposals)
+		}
+		return stat.Result.Proposals[0]
+	}
+
+	first := propose()
+	if first.Pending || first.URL == "" || first.Branch != proposalBranchPrefix+"manual/default-deployment-helloworld" {
+		t.Errorf("expected a new proposal, with a merge request, got %+v", first)
+	}
+	second := propose()
+	if !second.Pending || second.Branch != first.Branch || second.Revision != first.Revision {
+		t.Errorf("expected the proposal %+v to be found pending, got %+v", first, second)
+	}
+	if n := opener.timesOpened(first.Branch); n != 1 {
+		t.Errorf("expected a merge request to be opened once, was opened %d times", n)
+	}
+
+	w.Eventually(func() bool {
+		rev, err := d.Repo.Revision(ctx, first.Branch)
+		return err == nil && rev == first.Revision
+	}, "Waiting for proposed branch")
+	if rev, err := d.Repo.Revision(ctx, d.GitConfig.Branch); err != nil || rev != head {
+		t.Errorf("expected %s to be left at %s, got %s (%v)", d.GitConfig.Branch, head, rev, err)
+	}
+	config := d.GitConfig
+	config.Branch = first.Branch
+	co, err := d.Repo.Clone(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer co.Clean()
+	bytes, err := ioutil.ReadFile(filepath.Join(co.ManifestDir(), "helloworld-deploy.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bytes), newHelloImage) {
+		t.Errorf("expected the proposed branch to have %s", newHelloImage)
+	}
+}
+
+func TestProposalBranch(t *testing.T) {
+	success := update.ControllerResult{Status: update.ReleaseStatusSuccess}
+	one := update.Result{
+		flux.MustParseResourceID(svc):                         success,
+		flux.MustParseResourceID("default:deployment/locked"): {Status: update.ReleaseStatusSkipped},
+	}
+	if branch := proposalBranch(one, false); branch != proposalBranchPrefix+"manual/default-deployment-helloworld" {
+		t.Errorf("expected branch named for the workload changed, got %q", branch)
+	}
+	// Automated proposals don't replace those asked for, nor the
+	// other way around
+	if branch := proposalBranch(one, true); branch != proposalBranchPrefix+"auto/default-deployment-helloworld" {
+		t.Errorf("expected branch for automation named apart, got %q", branch)
+	}
+
+	two := update.Result{
+		flux.MustParseResourceID(svc):                          success,
+		flux.MustParseResourceID("default:deployment/another"): success,
+	}
+	branch := proposalBranch(two, false)
+	if !strings.HasPrefix(branch, proposalBranchPrefix+"manual/workloads-") {
+		t.Errorf("expected branch named for a hash of the workloads changed, got %q", branch)
+	}
+	if again := proposalBranch(two, false); again != branch {
+		t.Errorf("expected the same name for the same workloads, got %q and %q", branch, again)
+	}
+	if auto := proposalBranch(two, true); auto != strings.Replace(branch, "/manual/", "/auto/", 1) {
+		t.Errorf("expected the automated branch to differ only by its source, got %q and %q", branch, auto)
+	}
+}
+
+// When I roll back a controller, its images should be put back as
+// they were before the last release, or at the revision given
+func TestDaemon_Rollback(t *testing.T) {
+	d, start, clean, k8s, _ := mockDaemon(t)
+	// The mock cluster reports the controller whichever are asked
+	// for, so automation (of another controller) would undo the
+	// rollbacks
+	k8s.SomeServicesFunc = func(ids []flux.ResourceID) ([]cluster.Controller, error) {
+		all, err := k8s.AllServicesFunc("")
+		var some []cluster.Controller
+		for _, c := range all {
+			for _, id := range ids {
+				if c.ID == id {
+					some = append(some, c)
+				}
+			}
+		}
+		return some, err
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := flux.MustParseResourceID(svc)
+
+	// Each job must see the commits made by the one before
+	waitForRevision := func(rev string) {
+		w.Eventually(func() bool {
+			d.Repo.Refresh(ctx)
+			head, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+			return err == nil && head == rev
+		}, "Waiting for repo to have revision "+rev)
+	}
+
+	released := w.ForJobSucceeded(d, updateImage(ctx, d, t))
+	waitForRevision(released.Result.Revision)
+
+	rollback := func(revision string) job.Status {
+		jobID := updateManifest(ctx, t, d, update.Spec{
+			Type: update.Rollback,
+			Spec: update.RollbackSpec{
+				ResourceID: id,
+				Revision:   revision,
+				Kind:       update.ReleaseKindExecute,
+			},
+		})
+		stat := w.ForJobSucceeded(d, jobID)
+		waitForRevision(stat.Result.Revision)
+		return stat
+	}
+
+	checkImage := func(stat job.Status, from, to string) {
+		expected := []update.ContainerUpdate{{
+			Container: container,
+			Current:   mustParseImageRef(from),
+			Target:    mustParseImageRef(to),
+		}}
+		if got := stat.Result.Result[id].PerContainer; !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected updates %#v, got %#v", expected, got)
+		}
+
+		w.Eventually(func() bool {
+			co, err := d.Repo.Clone(ctx, d.GitConfig)
+			if err != nil {
+				return false
+			}
+			defer co.Clean()
+			m, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range m[svc].(resource.Workload).Containers() {
+				if c.Name == container {
+					return c.Image.String() == to
+				}
+			}
+			return false
+		}, "Waiting for manifest to have "+to)
+	}
+
+	// Undo the release
+	checkImage(rollback(""), newHelloImage, currentHelloImage)
+	// Go back to the images as they were after the release
+	checkImage(rollback(released.Result.Revision), currentHelloImage, newHelloImage)
+}
+
 // When I update a policy, I expect it to add to the queue
 // When I update a policy, it should add an annotation to the manifest
 func TestDaemon_PolicyUpdate(t *testing.T) {
@@ -434,6 +653,134 @@ func TestDaemon_PolicyUpdate(t *testing.T) {
 	}, "Waiting for new annotation")
 }
 
+// The workloads with images in values files are loaded once for each
+// revision, rather than at every image poll
+func TestDaemon_FileWorkloadsByRevision(t *testing.T) {
+	d, start, clean, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	if _, err := d.fileWorkloads(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := d.Repo.Revision(ctx, d.GitConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.fileWorkloadsRev != rev {
+		t.Fatalf("expected workloads to be loaded at %s, got %s", rev, d.fileWorkloadsRev)
+	}
+	// Stand in for having loaded something, to tell whether it's
+	// loaded again
+	loaded := map[string]resource.Workload{"loaded": nil}
+	d.fileWorkloadsByID = loaded
+	workloads, err := d.fileWorkloads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := workloads["loaded"]; !ok {
+		t.Errorf("expected workloads to be kept for revision %s, got %v", rev, workloads)
+	}
+
+	w.ForJobSucceeded(d, updatePolicy(ctx, t, d))
+	if err := d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	workloads, err = d.fileWorkloads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := workloads["loaded"]; ok || d.fileWorkloadsRev == rev {
+		t.Errorf("expected workloads to be loaded again after the branch moved on from %s", rev)
+	}
+}
+
+// When I give a tag pattern that can't match, the policy update
+// should be refused, rather than stopping automation
+func TestDaemon_PolicyUpdateInvalidPattern(t *testing.T) {
+	d, start, clean, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	_, err := d.UpdateManifests(context.Background(), update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {
+				Add: policy.Set{policy.TagPrefix(container): "semver:~>>1"},
+			},
+		},
+	})
+	if err == nil {
+		t.Error("expected policy update with an invalid pattern to be refused")
+	}
+}
+
+// When a lock expires, the daemon should unlock the controller
+func TestDaemon_ExpireLocks(t *testing.T) {
+	d, start, clean, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	id := updateManifest(ctx, t, d, update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {
+				Add: policy.Set{}.Add(policy.Locked).Set(policy.LockedUntil, until),
+			},
+		},
+	})
+	w.ForJobSucceeded(d, id)
+
+	policies := func() policy.Set {
+		// The daemon may be pushing automated releases at the
+		// same time, so a failure here is worth trying again
+		co, err := d.Repo.Clone(ctx, d.GitConfig)
+		if err != nil {
+			return nil
+		}
+		defer co.Clean()
+		m, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDir())
+		if err != nil {
+			t.Fatalf("Error: %s", err.Error())
+		}
+		return m[svc].Policy()
+	}
+
+	// Not expired yet, so it's left alone, and the daemon's told
+	// when it will expire
+	w.Eventually(func() bool {
+		p := policies()
+		if !p.Contains(policy.LockedUntil) {
+			return false
+		}
+		services := policy.ResourceMap{flux.MustParseResourceID(svc): p}
+		next := d.expireLocks(ctx, services, time.Now(), log.NewNopLogger())
+		return next.UTC().Format(time.RFC3339) == until
+	}, "Waiting for lock")
+
+	// Once it's expired, it's removed
+	id = updateManifest(ctx, t, d, update.Spec{
+		Type: update.Policy,
+		Spec: policy.Updates{
+			flux.MustParseResourceID(svc): {
+				Add: policy.Set{}.Set(policy.LockedUntil, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)),
+			},
+		},
+	})
+	w.ForJobSucceeded(d, id)
+	// Make sure the expiry is seen; the daemon may get there first
+	d.AskForImagePoll()
+	w.Eventually(func() bool {
+		p := policies()
+		return !p.Contains(policy.Locked) && !p.Contains(policy.LockedUntil)
+	}, "Waiting for lock to expire")
+}
+
 // When I call sync status, it should return a commit showing the sync
 // that is about to take place. Then it should return empty once it is
 // complete
@@ -457,6 +804,56 @@ func TestDaemon_SyncStatus(t *testing.T) {
 	w.ForSyncStatus(d, stat.Result.Revision, 0)
 }
 
+func TestDaemon_DriftReport(t *testing.T) {
+	d, start, clean, k8s, _ := mockDaemon(t)
+	var syncSets []string
+	k8s.DriftFunc = func(resources map[string]resource.Resource, syncSetName string, withDiff bool) ([]cluster.ResourceDrift, error) {
+		syncSets = append(syncSets, syncSetName)
+		var drifts []cluster.ResourceDrift
+		for _, res := range resources {
+			drift := cluster.ResourceDrift{ID: res.ResourceID(), Source: res.Source(), Status: cluster.DriftInSync}
+			if res.ResourceID().String() == svc {
+				drift.Status = cluster.DriftModified
+				if withDiff {
+					drift.Diff = []cluster.FieldDrift{{Path: "spec.replicas", Git: "1", Cluster: "3"}}
+				}
+			}
+			drifts = append(drifts, drift)
+		}
+		return drifts, nil
+	}
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	var report v11.DriftReport
+	w.Eventually(func() bool {
+		var err error
+		report, err = d.DriftReport(ctx, v11.DriftOptions{Diff: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(report.Revisions) > 0
+	}, "Waiting for the repo to be synced")
+
+	var ids []string
+	for _, r := range report.Resources {
+		ids = append(ids, r.ID.String())
+		if r.ID.String() == svc && (r.Status != cluster.DriftModified || len(r.Diff) != 1) {
+			t.Errorf("expected %s to be modified, with the diff, got %#v", svc, r)
+		}
+	}
+	if len(ids) < 2 || !sort.StringsAreSorted(ids) {
+		t.Errorf("expected a drift for each resource, in order of ID, got %v", ids)
+	}
+	// Without garbage collection, synced resources aren't marked, so
+	// they can't be looked for
+	if report.Extraneous || syncSets[len(syncSets)-1] != "" {
+		t.Errorf("expected extraneous resources not to be looked for, got %v and sync sets %v", report.Extraneous, syncSets)
+	}
+}
+
 // When I restart fluxd, there won't be any jobs in the cache
 func TestDaemon_JobStatusWithNoCache(t *testing.T) {
 	d, start, clean, _, _ := mockDaemon(t)
@@ -578,8 +975,12 @@ func mockDaemon(t *testing.T) (*Daemon, func(), func(), *cluster.Mock, *mockEven
 	shutdown := make(chan struct{})
 	wg := &sync.WaitGroup{}
 
-	// Jobs queue (starts itself)
-	jobs := job.NewQueue(shutdown, wg)
+	// Jobs queue (starts itself). This has its own shutdown, since
+	// the daemon may be enqueueing a job (e.g., for an automated
+	// update) when told to stop.
+	jshutdown := make(chan struct{})
+	jwg := &sync.WaitGroup{}
+	jobs := job.NewQueue(jshutdown, jwg)
 
 	// Finally, the daemon
 	d := &Daemon{
@@ -609,6 +1010,8 @@ func mockDaemon(t *testing.T) (*Daemon, func(), func(), *cluster.Mock, *mockEven
 		// Close daemon first so we don't get errors if the queue closes before the daemon
 		close(shutdown)
 		wg.Wait()
+		close(jshutdown)
+		jwg.Wait()
 		repoCleanup()
 	}
 	return d, start, stop, k8s, events
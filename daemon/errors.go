@@ -1,10 +1,12 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
 
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/update"
 )
 
 func manifestLoadError(reason error) error {
@@ -60,3 +62,79 @@ daemon if possible:
 `,
 	}
 }
+
+var lintingDisabledError = &fluxerr.Error{
+	Type: fluxerr.User,
+	Err:  errors.New("manifest linting is not enabled"),
+	Help: `Manifest linting is not enabled
+
+There is no lint report to show, because the daemon isn't running
+with linting turned on. To lint manifests each time they're synced,
+run fluxd with the argument
+
+    --lint-manifests
+
+`,
+}
+
+var driftUnsupportedError = &fluxerr.Error{
+	Type: fluxerr.Missing,
+	Err:  errors.New("the cluster does not support comparing resources with manifests"),
+	Help: `Cannot compare the cluster with git
+
+The kind of cluster this daemon is running against can't compare the
+resources in it with the manifests in git, so there is no drift report
+to show.
+`,
+}
+
+func unknownRevisionError(rev string, reason error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  reason,
+		Help: `Revision not found
+
+The revision ` + rev + ` could not be checked out of the git repo, to
+find the images to roll back to. Check that it is the name or hash of
+a commit on the branch fluxd is syncing. The full error was:
+
+    ` + reason.Error() + `
+
+`,
+	}
+}
+
+func noRollbackError(spec update.RollbackSpec, reason error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  reason,
+		Help: `Nothing to roll back to
+
+Flux could not find the images to roll back ` + spec.ResourceID.String() + ` to:
+
+    ` + reason.Error() + `
+
+Without a revision, the most recent release of the controller made
+by flux (whether by fluxctl, or automated) is undone; releases
+made by editing the manifests in git are not recorded. Give a revision
+with --revision to go back to the images at that revision instead.
+`,
+	}
+}
+
+func invalidImagesOptionsError(reason error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  reason,
+		Help: `Invalid options for listing images
+
+The images could not be listed, because:
+
+    ` + reason.Error() + `
+
+Tag filters are written as for tag policies, e.g., 'semver:~1.2' or
+'regexp:^build-\d+$', and are globs if not prefixed; images can be
+sorted by 'created' or 'semver'.
+`,
+	}
+}
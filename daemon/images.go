@@ -2,27 +2,52 @@ package daemon
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v6"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
 )
 
-func (d *Daemon) pollForNewImages(logger log.Logger) {
+// pollForNewImages releases any new images for automated services,
+// and unlocks services whose locks have expired. Updates to services
+// outside their release window are held back; the time at which the
+// first of those windows opens, or the next lock expires, is
+// returned, or the zero time if there are none.
+func (d *Daemon) pollForNewImages(logger log.Logger) (opens time.Time) {
 	logger.Log("msg", "polling images")
 
 	ctx := context.Background()
+	now := time.Now()
 
-	candidateServicesPolicyMap, err := d.getUnlockedAutomatedServicesPolicyMap(ctx)
+	servicesPolicyMap, err := d.servicesWithPolicies(ctx)
 	if err != nil {
 		logger.Log("error", errors.Wrap(err, "getting unlocked automated services"))
 		return
 	}
+	// Locks that have expired are removed; and, like a release
+	// window opening, the next lock to expire is a reason to look
+	// again.
+	if expires := d.expireLocks(ctx, servicesPolicyMap, now, logger); !expires.IsZero() {
+		defer func() {
+			if opens.IsZero() || expires.Before(opens) {
+				opens = expires
+			}
+		}()
+	}
+	candidateServicesPolicyMap := unlockedAutomated(servicesPolicyMap, now)
 	if len(candidateServicesPolicyMap) == 0 {
 		logger.Log("msg", "no automated services")
+		d.setHeldUpdates(nil)
+		d.setAutomatedImages(nil)
 		return
 	}
 	// Find images to check
@@ -31,6 +56,8 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 		logger.Log("error", errors.Wrap(err, "checking services for new images"))
 		return
 	}
+	services = d.withFileContainers(ctx, services, logger)
+	d.setAutomatedImages(services)
 	// Check the latest available image(s) for each service
 	imageRepos, err := update.FetchImageRepos(d.Registry, clusterContainers(services), logger)
 	if err != nil {
@@ -39,7 +66,15 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 	}
 
 	changes := &update.Automated{}
+	held := map[flux.ResourceID]v6.HeldUpdate{}
 	for _, service := range services {
+		window, hasWindow, err := candidateServicesPolicyMap[service.ID].ReleaseWindow()
+		if err != nil {
+			logger.Log("service", service.ID, "error", errors.Wrap(err, "not releasing service with invalid release window"))
+			continue
+		}
+		windowOpen := !hasWindow || window.Contains(now)
+
 		for _, container := range service.ContainersOrNil() {
 			logger := log.With(logger, "service", service.ID, "container", container.Name, "currentimage", container.Image)
 
@@ -53,37 +88,142 @@ func (d *Daemon) pollForNewImages(logger log.Logger) {
 			repo := currentImageID.Name
 			logger.Log("repo", repo, "pattern", pattern)
 
-			filteredImages := imageRepos.GetRepoImages(repo).Filter(pattern)
+			filteredImages := imageRepos.GetRepoImages(repo).ForPlatform(service.Platform).Exclude(d.ImageExclusions).FilterAndSort(pattern)
 
-			if latest, ok := filteredImages.Latest(); ok && latest.ID != currentImageID {
+			if latest, ok := filteredImages.Latest(); ok && !latest.Matches(currentImageID) {
 				if latest.ID.Tag == "" {
 					logger.Log("msg", "untagged image in available images", "action", "skip", "available", repo)
 					continue
 				}
-				newImage := currentImageID.WithNewTag(latest.ID.Tag)
+				newImage := currentImageID.UpdatedTo(latest)
+				if !windowOpen {
+					h := held[service.ID]
+					h.Until = window.NextOpen(now)
+					h.Changes = append(h.Changes, update.ContainerUpdate{
+						Container: container.Name,
+						Current:   currentImageID,
+						Target:    newImage,
+					})
+					held[service.ID] = h
+					if opens.IsZero() || h.Until.Before(opens) {
+						opens = h.Until
+					}
+					logger.Log("msg", "holding image update until release window opens", "newimage", newImage, "until", h.Until)
+					continue
+				}
 				changes.Add(service.ID, container, newImage)
 				logger.Log("msg", "added image to changes", "newimage", newImage)
 			}
 		}
 	}
 
+	d.setHeldUpdates(held)
 	if len(changes.Changes) > 0 {
 		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
 	}
+	return opens
+}
+
+func (d *Daemon) setHeldUpdates(held map[flux.ResourceID]v6.HeldUpdate) {
+	d.heldMu.Lock()
+	d.heldUpdates = held
+	d.heldMu.Unlock()
+}
+
+func (d *Daemon) setAutomatedImages(services []cluster.Controller) {
+	var images []image.Name
+	for _, service := range services {
+		for _, container := range service.ContainersOrNil() {
+			images = append(images, container.Image.Name)
+		}
+	}
+	d.automatedMu.Lock()
+	d.automatedImages = images
+	d.automatedMu.Unlock()
+}
+
+// AutomatedImages gives the images used by automated workloads, as of
+// the last time they were checked for new images.
+func (d *Daemon) AutomatedImages() []image.Name {
+	d.automatedMu.RLock()
+	defer d.automatedMu.RUnlock()
+	return d.automatedImages
+}
+
+// heldUpdate gives the automated update being held back for the
+// service, if there is one.
+func (d *Daemon) heldUpdate(id flux.ResourceID) *v6.HeldUpdate {
+	d.heldMu.RLock()
+	defer d.heldMu.RUnlock()
+	if h, ok := d.heldUpdates[id]; ok {
+		return &h
+	}
+	return nil
+}
+
+// unlockedAutomated returns the policies of the services that are
+// automated, and not locked at the time given
+func unlockedAutomated(services policy.ResourceMap, now time.Time) policy.ResourceMap {
+	automatedServices := services.OnlyWithPolicy(policy.Automated)
+	lockedServices := services.LockedAt(now)
+	return automatedServices.Without(lockedServices)
+}
+
+// withFileContainers returns the controllers given, with the
+// containers that their manifests have in other files (e.g., the
+// values files of a HelmRelease's chart) added; these aren't to be
+// seen in the cluster. If the manifests can't be loaded, the
+// controllers are returned as they are.
+func (d *Daemon) withFileContainers(ctx context.Context, controllers []cluster.Controller, logger log.Logger) []cluster.Controller {
+	workloads, err := d.fileWorkloads(ctx)
+	if err != nil {
+		logger.Log("error", errors.Wrap(err, "loading manifests for images in values files"))
+		return controllers
+	}
+	result := make([]cluster.Controller, len(controllers))
+	for i, c := range controllers {
+		result[i] = c
+		if wl, ok := workloads[c.ID.String()]; ok {
+			result[i] = c.WithFileContainers(wl)
+		}
+	}
+	return result
 }
 
-// getUnlockedAutomatedServicesPolicyMap returns a resource policy map for all unlocked automated services
-func (d *Daemon) getUnlockedAutomatedServicesPolicyMap(ctx context.Context) (policy.ResourceMap, error) {
-	var services policy.ResourceMap
+// fileWorkloads returns the workloads in the repo that have
+// containers in other files than their manifests. These are kept for
+// the revision they were loaded at, so the repo is only cloned and
+// loaded again when the branch has moved on.
+func (d *Daemon) fileWorkloads(ctx context.Context) (map[string]resource.Workload, error) {
+	d.fileWorkloadsMu.Lock()
+	defer d.fileWorkloadsMu.Unlock()
+	if rev, err := d.Repo.Revision(ctx, d.GitConfig.Branch); err == nil && d.fileWorkloadsRev != "" && rev == d.fileWorkloadsRev {
+		return d.fileWorkloadsByID, nil
+	}
+
+	var rev string
+	workloads := map[string]resource.Workload{}
 	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
 		var err error
-		services, err = d.Manifests.ServicesWithPolicies(checkout.ManifestDir())
-		return err
+		if rev, err = checkout.HeadRevision(ctx); err != nil {
+			return err
+		}
+		resources, err := d.Manifests.LoadManifests(checkout.Dir(), checkout.ManifestDir())
+		if err != nil {
+			return err
+		}
+		for id, res := range resources {
+			if inFiles, ok := res.(resource.ContainersInFiles); ok && len(inFiles.FileContainers()) > 0 {
+				if wl, ok := res.(resource.Workload); ok {
+					workloads[id] = wl
+				}
+			}
+		}
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	automatedServices := services.OnlyWithPolicy(policy.Automated)
-	lockedServices := services.OnlyWithPolicy(policy.Locked)
-	return automatedServices.Without(lockedServices), nil
+	d.fileWorkloadsRev, d.fileWorkloadsByID = rev, workloads
+	return workloads, nil
 }
@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/update"
+)
+
+// expireLocks unlocks those of the services given whose locks have
+// expired. It returns the time at which the first of the remaining
+// locks expires, or the zero time if none of them has an expiry.
+func (d *Daemon) expireLocks(ctx context.Context, services policy.ResourceMap, now time.Time, logger log.Logger) (next time.Time) {
+	updates := policy.Updates{}
+	for id, policies := range services.OnlyWithPolicy(policy.Locked) {
+		until, ok, err := policies.LockedUntil()
+		switch {
+		case !ok:
+			continue
+		case err != nil:
+			logger.Log("service", id, "error", errors.Wrap(err, "not expiring lock"))
+			continue
+		case now.Before(until):
+			if next.IsZero() || until.Before(next) {
+				next = until
+			}
+			continue
+		}
+		updates[id] = policy.Update{
+			Remove: policy.Set{}.Add(policy.Locked, policy.LockedMsg, policy.LockedUser, policy.LockedUntil),
+		}
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	logger.Log("msg", "unlocking services with expired locks", "count", len(updates))
+	if _, err := d.UpdateManifests(ctx, update.Spec{
+		Type:  update.Policy,
+		Cause: update.Cause{User: update.UserAutomated, Message: "lock expired"},
+		Spec:  updates,
+	}); err != nil {
+		logger.Log("error", errors.Wrap(err, "unlocking services with expired locks"))
+	}
+	return
+}
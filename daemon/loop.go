@@ -2,6 +2,8 @@ package daemon
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,9 +15,12 @@ import (
 	"context"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/image"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/resource"
 	fluxsync "github.com/weaveworks/flux/sync"
@@ -34,6 +39,34 @@ type LoopVars struct {
 	initOnce       sync.Once
 	syncSoon       chan struct{}
 	pollImagesSoon chan struct{}
+
+	lintMu     sync.RWMutex
+	lintReport v11.LintReport
+
+	manifestsMu     sync.RWMutex
+	manifestsReport v11.ManifestsReport
+
+	heldMu      sync.RWMutex
+	heldUpdates map[flux.ResourceID]v6.HeldUpdate
+
+	automatedMu     sync.RWMutex
+	automatedImages []image.Name
+
+	// the workloads with containers given outside their manifests,
+	// and the revision they were loaded at
+	fileWorkloadsMu   sync.Mutex
+	fileWorkloadsRev  string
+	fileWorkloadsByID map[string]resource.Workload
+
+	// the revision last refused for each repo (by URL), so the
+	// refusal is reported once rather than at every sync
+	refusedMu   sync.Mutex
+	refusedRevs map[string]string
+
+	// the revision last verified for each repo (by URL), so its
+	// history needn't be verified again
+	verifiedMu   sync.Mutex
+	verifiedRevs map[string]string
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -59,6 +92,12 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 	// every timer tick as well as every mirror refresh.
 	syncHead := ""
 
+	// The other repos each get a loop of their own, for syncing
+	for _, gr := range d.GitRepos {
+		wg.Add(1)
+		go d.repoLoop(stop, wg, gr, log.With(logger, "url", gr.Repo.Origin().URL))
+	}
+
 	// Ask for a sync, and to poll images, straight away
 	d.AskForSync()
 	d.AskForImagePoll()
@@ -74,8 +113,14 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				default:
 				}
 			}
-			d.pollForNewImages(logger)
-			imagePollTimer.Reset(d.RegistryPollInterval)
+			wait := d.RegistryPollInterval
+			// If updates are being held back, look again when the
+			// first release window opens (or lock expires), in case
+			// that's sooner.
+			if opens := d.pollForNewImages(logger); !opens.IsZero() && time.Until(opens) < wait {
+				wait = time.Until(opens)
+			}
+			imagePollTimer.Reset(wait)
 		case <-imagePollTimer.C:
 			d.AskForImagePoll()
 		case <-d.syncSoon:
@@ -126,11 +171,59 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 					logger.Log("err", err)
 				}
 				cancel()
+				// The job may have pushed to the other repos too
+				for _, gr := range d.GitRepos {
+					gr.Repo.Notify()
+				}
 			}
 		}
 	}
 }
 
+// repoLoop syncs from a repo other than the main repo: at least every
+// `SyncInterval`, and whenever its HEAD moves.
+func (d *Daemon) repoLoop(stop chan struct{}, wg *sync.WaitGroup, gr GitRepo, logger log.Logger) {
+	defer wg.Done()
+
+	syncTimer := time.NewTimer(d.SyncInterval)
+	syncHead := ""
+	for {
+		select {
+		case <-stop:
+			logger.Log("stopping", "true")
+			return
+		case <-syncTimer.C:
+			if err := d.syncRepo(gr, logger); err != nil {
+				logger.Log("err", err)
+			}
+			syncTimer.Reset(d.SyncInterval)
+		case <-gr.Repo.C:
+			ctx, cancel := context.WithTimeout(context.Background(), gitOpTimeout)
+			newSyncHead, err := gr.Repo.Revision(ctx, gr.Config.Branch)
+			cancel()
+			if err != nil {
+				logger.Log("err", err)
+				continue
+			}
+			if newSyncHead == syncHead {
+				continue
+			}
+			logger.Log("event", "refreshed", "branch", gr.Config.Branch, "HEAD", newSyncHead)
+			syncHead = newSyncHead
+			if !syncTimer.Stop() {
+				select {
+				case <-syncTimer.C:
+				default:
+				}
+			}
+			if err := d.syncRepo(gr, logger); err != nil {
+				logger.Log("err", err)
+			}
+			syncTimer.Reset(d.SyncInterval)
+		}
+	}
+}
+
 // Ask for a sync, or if there's one waiting, let that happen.
 func (d *LoopVars) AskForSync() {
 	d.ensureInit()
@@ -151,12 +244,35 @@ func (d *LoopVars) AskForImagePoll() {
 
 // -- extra bits the loop needs
 
-func (d *Daemon) doSync(logger log.Logger) (retErr error) {
+// syncGC says how to garbage collect when syncing from the repo
+// given.
+func (d *Daemon) syncGC(gr GitRepo) fluxsync.GC {
+	if !d.GarbageCollection && !d.GarbageCollectionDryRun {
+		return fluxsync.GC{}
+	}
+	return fluxsync.GC{
+		SyncSet: syncSetName(gr),
+		DryRun:  d.GarbageCollectionDryRun,
+	}
+}
+
+func (d *Daemon) doSync(logger log.Logger) error {
+	return d.syncRepo(d.repos()[0], logger)
+}
+
+// syncRepo syncs the cluster with the repo given. The reports of
+// manifests skipped, and of linting, are kept for the main repo only.
+func (d *Daemon) syncRepo(gr GitRepo, logger log.Logger) (retErr error) {
 	started := time.Now().UTC()
 	defer func() {
 		syncDuration.With(
 			fluxmetrics.LabelSuccess, fmt.Sprint(retErr == nil),
 		).Observe(time.Since(started).Seconds())
+		if retErr == nil {
+			syncLastSuccess.With(
+				fluxmetrics.LabelURL, gr.Repo.Origin().URL,
+			).Set(float64(time.Now().Unix()))
+		}
 	}()
 	// We don't care how long this takes overall, only about not
 	// getting bogged down in certain operations, so use an
@@ -169,7 +285,7 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		defer cancel()
-		working, err = d.Repo.Clone(ctx, d.GitConfig)
+		working, err = gr.Repo.Clone(ctx, gr.Config)
 		if err != nil {
 			return err
 		}
@@ -187,15 +303,24 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		return err
 	}
 
-	// Get a map of all resources defined in the repo
-	allResources, err := d.Manifests.LoadManifests(working.Dir(), working.ManifestDir())
-	if err != nil {
-		return errors.Wrap(err, "loading resources from repo")
+	// The revision is verified at every sync, whether or not the
+	// sync tag has moved: the tag is only a pointer into the
+	// upstream, and anyone who can push can move it.
+	if gr.Config.VerifySignatures {
+		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
+		err := d.verifyRevision(ctx, gr, working, newTagRev)
+		cancel()
+		if err != nil {
+			return d.refuseSync(gr, newTagRev, err, logger)
+		}
+		d.verified(gr, newTagRev)
 	}
 
+	// Apply all the resources defined in the repo
+	main := gr.Repo == d.Repo
+	allIDs, err := d.applyManifests(gr, newTagRev, working, main, logger)
 	var syncErrors []event.ResourceError
-	// TODO supply deletes argument from somewhere (command-line?)
-	if err := fluxsync.Sync(d.Manifests, allResources, d.Cluster, false, logger); err != nil {
+	if err != nil {
 		logger.Log("err", err)
 		switch syncerr := err.(type) {
 		case cluster.SyncError:
@@ -219,10 +344,10 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		var err error
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		if oldTagRev != "" {
-			commits, err = d.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, d.GitConfig.Path)
+			commits, err = gr.Repo.CommitsBetween(ctx, oldTagRev, newTagRev, gr.Config.Path)
 		} else {
 			initialSync = true
-			commits, err = d.Repo.CommitsBefore(ctx, newTagRev, d.GitConfig.Path)
+			commits, err = gr.Repo.CommitsBefore(ctx, newTagRev, gr.Config.Path)
 		}
 		cancel()
 		if err != nil {
@@ -232,10 +357,11 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 
 	// Figure out which service IDs changed in this release
 	changedResources := map[string]resource.Resource{}
+	serviceIDs := flux.ResourceIDSet{}
 
 	if initialSync {
 		// no synctag, We are syncing everything from scratch
-		changedResources = allResources
+		serviceIDs.Add(allIDs)
 	} else {
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
 		changedFiles, err := working.ChangedFiles(ctx, oldTagRev)
@@ -250,7 +376,6 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 		}
 	}
 
-	serviceIDs := flux.ResourceIDSet{}
 	for _, r := range changedResources {
 		serviceIDs.Add([]flux.ResourceID{r.ResourceID()})
 	}
@@ -345,6 +470,25 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 					},
 				})
 				includes[event.EventAutoRelease] = true
+			case update.Rollback:
+				spec := n.Spec.Spec.(update.RollbackSpec)
+				noteEvents = append(noteEvents, event.Event{
+					ServiceIDs: n.Result.AffectedResources(),
+					Type:       event.EventRollback,
+					StartedAt:  started,
+					EndedAt:    time.Now().UTC(),
+					LogLevel:   event.LogLevelInfo,
+					Metadata: &event.RollbackEventMetadata{
+						ReleaseEventCommon: event.ReleaseEventCommon{
+							Revision: commits[i].Revision,
+							Result:   n.Result,
+							Error:    n.Result.Error(),
+						},
+						Spec:  spec,
+						Cause: n.Spec.Cause,
+					},
+				})
+				includes[event.EventRollback] = true
 			case update.Policy:
 				// Use this to mean any change to policy
 				includes[event.EventUpdatePolicy] = true
@@ -398,9 +542,9 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	}
 
 	if oldTagRev != newTagRev {
-		logger.Log("tag", d.GitConfig.SyncTag, "old", oldTagRev, "new", newTagRev)
+		logger.Log("tag", gr.Config.SyncTag, "old", oldTagRev, "new", newTagRev)
 		ctx, cancel := context.WithTimeout(ctx, gitOpTimeout)
-		err := d.Repo.Refresh(ctx)
+		err := gr.Repo.Refresh(ctx)
 		cancel()
 		return err
 	}
@@ -408,8 +552,180 @@ func (d *Daemon) doSync(logger log.Logger) (retErr error) {
 	return nil
 }
 
+// refuseSync records that the revision given won't be synced from
+// the repo, and why, with an event (if that's not already been done
+// for the revision), and returns the reason as an error.
+func (d *Daemon) refuseSync(gr GitRepo, revision string, reason error, logger log.Logger) error {
+	url := gr.Repo.Origin().URL
+	d.refusedMu.Lock()
+	defer d.refusedMu.Unlock()
+	if d.refusedRevs[url] == revision {
+		return reason
+	}
+
+	now := time.Now().UTC()
+	if err := d.LogEvent(event.Event{
+		Type:      event.EventSyncRefused,
+		StartedAt: now,
+		EndedAt:   now,
+		LogLevel:  event.LogLevelError,
+		Metadata: &event.SyncRefusedEventMetadata{
+			Revision: revision,
+			Reason:   reason.Error(),
+		},
+	}); err != nil {
+		logger.Log("err", err)
+		// Try again next time, so the refusal is reported
+		return reason
+	}
+	if d.refusedRevs == nil {
+		d.refusedRevs = map[string]string{}
+	}
+	d.refusedRevs[url] = revision
+	return reason
+}
+
 func isUnknownRevision(err error) bool {
 	return err != nil &&
 		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
 			strings.Contains(err.Error(), "bad revision"))
 }
+
+// applyManifests syncs the cluster with the resources in the
+// checkout given, and returns the IDs of all of them. If the
+// resources can't be loaded, or (when linting blocks syncs) have
+// findings, nothing is applied; if only some fail to apply, the
+// error is a cluster.SyncError.
+//
+// If the manifests can be walked, they are, so that what's held in
+// memory doesn't grow with the repo: a walk to load and lint them,
+// then walks to apply them in batches (see fluxsync.SyncWalk).
+// Otherwise, they are all loaded at once.
+func (d *Daemon) applyManifests(gr GitRepo, revision string, working *git.Checkout, main bool, logger log.Logger) ([]flux.ResourceID, error) {
+	blocked := func(findings []cluster.LintFinding) error {
+		return fmt.Errorf("not syncing revision %s, since linting found %d problem(s) in the manifests", revision, len(findings))
+	}
+	var ids []flux.ResourceID
+
+	walker, ok := d.Manifests.(cluster.ManifestWalker)
+	if !ok || !walker.WalksManifests() {
+		allResources, err := d.loadManifests(revision, working, main)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading resources from repo")
+		}
+		if d.LintManifests {
+			if findings := d.lint(revision, allResources, main, logger); len(findings) > 0 && d.LintBlocksSync {
+				return nil, blocked(findings)
+			}
+		}
+		for _, res := range allResources {
+			ids = append(ids, res.ResourceID())
+		}
+		// TODO supply deletes argument from somewhere (command-line?)
+		return ids, fluxsync.Sync(d.Manifests, allResources, d.Cluster, false, d.syncGC(gr), logger)
+	}
+
+	var skipped []cluster.SkippedFile
+	walk := func(sources []string, fn func(resource.Resource) error) error {
+		if len(sources) == 0 {
+			var err error
+			skipped, err = walker.WalkManifests(working.Dir(), []string{working.ManifestDir()}, fn)
+			return err
+		}
+		paths := make([]string, len(sources))
+		for i, source := range sources {
+			paths[i] = filepath.Join(working.Dir(), source)
+		}
+		_, err := walker.WalkManifests(working.Dir(), paths, fn)
+		return err
+	}
+	linter, _ := d.Manifests.(cluster.Linter)
+	var findings []cluster.LintFinding
+	plan, err := fluxsync.PlanWalk(d.Cluster, walk, func(res resource.Resource) error {
+		ids = append(ids, res.ResourceID())
+		if d.LintManifests && linter != nil {
+			findings = append(findings, linter.Lint(map[string]resource.Resource{res.ResourceID().String(): res})...)
+		}
+		return nil
+	})
+	if main {
+		d.keepManifestsReport(revision, skipped, err)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "loading resources from repo")
+	}
+	if d.LintManifests {
+		// As Lint would give them, had it been given all the resources
+		sort.SliceStable(findings, func(i, j int) bool {
+			return findings[i].ID.String() < findings[j].ID.String()
+		})
+		d.reportLint(revision, findings, main, logger)
+		if len(findings) > 0 && d.LintBlocksSync {
+			return nil, blocked(findings)
+		}
+	}
+	return ids, fluxsync.SyncWalk(d.Manifests, plan, d.Cluster, d.syncGC(gr), fluxsync.DefaultBatchSize, logger)
+}
+
+// loadManifests loads all the resources in the checkout given and,
+// if asked to, keeps a report of the files skipped (if the manifests
+// can say), or of the error that stopped them being loaded, for the
+// revision given.
+func (d *Daemon) loadManifests(revision string, working *git.Checkout, keepReport bool) (map[string]resource.Resource, error) {
+	var resources map[string]resource.Resource
+	var skipped []cluster.SkippedFile
+	var err error
+	if reporter, ok := d.Manifests.(cluster.SkipReporter); ok {
+		resources, skipped, err = reporter.LoadManifestsReporting(working.Dir(), working.ManifestDir())
+	} else {
+		resources, err = d.Manifests.LoadManifests(working.Dir(), working.ManifestDir())
+	}
+
+	if keepReport {
+		d.keepManifestsReport(revision, skipped, err)
+	}
+	return resources, err
+}
+
+// keepManifestsReport keeps a report of the files skipped, or of the
+// error that stopped the manifests being loaded, for the revision
+// given.
+func (d *Daemon) keepManifestsReport(revision string, skipped []cluster.SkippedFile, err error) {
+	report := v11.ManifestsReport{Revision: revision, Skipped: skipped}
+	if err != nil {
+		fileErr, ok := cluster.AsFileError(err)
+		if !ok {
+			fileErr = &cluster.FileError{Message: err.Error()}
+		}
+		report.Error = fileErr
+	}
+	d.manifestsMu.Lock()
+	d.manifestsReport = report
+	d.manifestsMu.Unlock()
+}
+
+// lint checks the resources given, if the manifests support that,
+// and (if asked to) keeps the findings as the lint report for the
+// revision given.
+func (d *Daemon) lint(revision string, resources map[string]resource.Resource, keepReport bool, logger log.Logger) []cluster.LintFinding {
+	var findings []cluster.LintFinding
+	if linter, ok := d.Manifests.(cluster.Linter); ok {
+		findings = linter.Lint(resources)
+	}
+	return d.reportLint(revision, findings, keepReport, logger)
+}
+
+// reportLint logs that there are findings, if there are, and (if
+// asked to) keeps them as the lint report for the revision given.
+func (d *Daemon) reportLint(revision string, findings []cluster.LintFinding, keepReport bool, logger log.Logger) []cluster.LintFinding {
+	if len(findings) > 0 {
+		logger.Log("msg", "linting found problems in manifests; see `fluxctl lint`", "revision", revision, "findings", len(findings))
+	}
+	if !keepReport {
+		return findings
+	}
+	d.lintMu.Lock()
+	d.lintReport = v11.LintReport{Revision: revision, Findings: findings}
+	d.lintMu.Unlock()
+	return findings
+}
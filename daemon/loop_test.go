@@ -3,6 +3,7 @@ package daemon
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -21,6 +22,7 @@ import (
 	"github.com/weaveworks/flux/event"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
+	"github.com/weaveworks/flux/gpg/gpgtest"
 	"github.com/weaveworks/flux/job"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
@@ -211,6 +213,263 @@ func TestDoSync_NoNewCommits(t *testing.T) {
 	}
 }
 
+func TestDoSync_LintBlocksSync(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	if _, err := d.LintReport(context.Background()); err == nil {
+		t.Error("expected an error asking for the lint report when linting is not enabled")
+	}
+
+	// The test manifests use deprecated API versions, and don't give
+	// resource limits
+	d.Manifests = &kubernetes.Manifests{}
+	d.LintManifests = true
+	d.LintBlocksSync = true
+
+	syncCalled := 0
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		syncCalled++
+		return nil
+	}
+
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err == nil {
+		t.Error("expected sync to fail, since there are lint findings")
+	}
+	if syncCalled != 0 {
+		t.Errorf("expected sync not to be called, was called %d times", syncCalled)
+	}
+
+	report, err := d.LintReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Revision == "" || len(report.Findings) == 0 {
+		t.Errorf("expected findings for a revision, got %#v", report)
+	}
+
+	d.LintBlocksSync = false
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Error(err)
+	}
+	if syncCalled != 1 {
+		t.Errorf("expected sync to be called once when not blocked, was called %d times", syncCalled)
+	}
+}
+
+func TestDoSync_RefusesUnsignedCommits(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	// None of the commits in the test repo are signed
+	d.GitConfig.VerifySignatures = true
+
+	syncCalled := 0
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		syncCalled++
+		return nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err == nil {
+			t.Error("expected sync to fail, since the commits aren't signed")
+		}
+	}
+	if syncCalled != 0 {
+		t.Errorf("expected sync not to be called, was called %d times", syncCalled)
+	}
+
+	// The refusal is reported once, rather than at each attempt
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 1 || es[0].Type != event.EventSyncRefused {
+		t.Fatalf("expected one %s event, got %#v", event.EventSyncRefused, es)
+	}
+	if metadata := es[0].Metadata.(*event.SyncRefusedEventMetadata); metadata.Revision == "" || metadata.Reason == "" {
+		t.Errorf("expected the revision and reason in the event, got %#v", metadata)
+	}
+}
+
+func TestDoSync_RefusesSyncTagMovedToUnsignedCommit(t *testing.T) {
+	signingKey, gpgCleanup := gpgtest.GPGKey(t)
+	defer gpgCleanup()
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	d.GitConfig.VerifySignatures = true
+	d.GitConfig.SigningKey = signingKey
+	syncCalled := 0
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		syncCalled++
+		return nil
+	}
+
+	// pushCommit pushes a commit, signed with the key given if there
+	// is one, and moves the sync tag onto it, likewise signed.
+	pushCommit := func(key string) {
+		config := d.GitConfig
+		config.SigningKey = key
+		co, err := d.Repo.Clone(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer co.Clean()
+		file := filepath.Join(co.ManifestDir(), "helloworld-deploy.yaml")
+		def, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, append(def, []byte("# another revision\n")...), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := co.CommitAndPush(ctx, git.CommitAction{Message: "another revision", SigningKey: key}, nil); err != nil {
+			t.Fatal(err)
+		}
+		head, err := co.HeadRevision(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := co.MoveSyncTagAndPush(ctx, head, "Sync pointer"); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Repo.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The history before the signed sync tag is trusted, though it
+	// isn't signed
+	pushCommit(signingKey)
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatalf("expected a signed commit with a signed sync tag to be synced, got %s", err)
+	}
+	if syncCalled != 1 {
+		t.Fatalf("expected sync to be called once, was called %d times", syncCalled)
+	}
+
+	// Someone who can push moves the tag onto an unsigned commit; it
+	// mustn't be synced, whether or not the daemon remembers the
+	// revision it last verified
+	pushCommit("")
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err == nil {
+		t.Error("expected sync to fail, since the tag was moved onto an unsigned commit")
+	}
+	d.verifiedRevs = nil
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err == nil {
+		t.Error("expected sync to fail after a restart, since the tag was moved onto an unsigned commit")
+	}
+	if syncCalled != 1 {
+		t.Errorf("expected sync not to be called again, was called %d times", syncCalled)
+	}
+}
+
+// commandManifests is manifests that run commands from the repo.
+type commandManifests struct {
+	cluster.Manifests
+}
+
+func (commandManifests) RunsCommands() bool {
+	return true
+}
+
+func TestWithClone_VerifiesBeforeCommands(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	// None of the commits in the test repo are signed; but without
+	// commands to run from them, that doesn't matter outside of syncs
+	d.GitConfig.VerifySignatures = true
+	if err := d.WithClone(context.Background(), func(*git.Checkout) error { return nil }); err != nil {
+		t.Errorf("expected clone to be usable without commands being run, got %v", err)
+	}
+
+	d.Manifests = commandManifests{k8s}
+	err := d.WithClone(context.Background(), func(*git.Checkout) error {
+		t.Error("expected an unverified clone not to be used, when commands may be run")
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error, since the commits aren't signed")
+	}
+}
+
+func TestDoSync_StrictManifests(t *testing.T) {
+	d, cleanup := daemon(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	// Add a document that isn't a resource to one of the manifest
+	// files
+	var path string
+	var line int
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		file := filepath.Join(checkout.ManifestDir(), "multi.yaml")
+		def, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		line = strings.Count(string(def), "\n") + 2
+		if err := ioutil.WriteFile(file, append(def, []byte("---\ndebug: true\n")...), 0666); err != nil {
+			return err
+		}
+		if path, err = filepath.Rel(checkout.Dir(), file); err != nil {
+			return err
+		}
+		commitAction := git.CommitAction{Author: "", Message: "add a document that isn't a resource"}
+		return checkout.CommitAndPush(ctx, commitAction, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	k8s.SyncFunc = func(def cluster.SyncDef) error {
+		return nil
+	}
+
+	// Not strict, so the file is skipped
+	d.Manifests = &kubernetes.Manifests{}
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	report, err := d.ManifestsReport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Revision == "" || report.Error != nil {
+		t.Errorf("expected a report of a successful load, got %#v", report)
+	}
+	var found bool
+	for _, s := range report.Skipped {
+		if s.Path == path && s.Line == line {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected %s:%d to be reported as skipped, got %#v", path, line, report.Skipped)
+	}
+
+	// Strict, so the file stops the sync
+	d.Manifests = &kubernetes.Manifests{Strict: true}
+	if err := d.doSync(log.NewLogfmtLogger(ioutil.Discard)); err == nil {
+		t.Error("expected sync to fail in strict mode")
+	}
+	report, err = d.ManifestsReport(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Error == nil || report.Error.Path != path || report.Error.Line != line {
+		t.Errorf("expected an error at %s:%d in the report, got %#v", path, line, report.Error)
+	}
+}
+
 func TestDoSync_WithNewCommit(t *testing.T) {
 	d, cleanup := daemon(t)
 	defer cleanup()
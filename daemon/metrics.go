@@ -38,6 +38,17 @@ var (
 		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 15, 20, 30, 45, 60, 120},
 	}, []string{})
 
+	// The time of the last successful sync, so it's easier to tell
+	// when syncs have stopped succeeding (e.g., alert when
+	// `time() - flux_daemon_sync_last_success_timestamp_seconds` is
+	// more than a few sync intervals).
+	syncLastSuccess = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "sync_last_success_timestamp_seconds",
+		Help:      "Time of the last successful git-to-cluster synchronisation, as a Unix timestamp.",
+	}, []string{fluxmetrics.LabelURL})
+
 	queueLength = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
 		Namespace: "flux",
 		Subsystem: "daemon",
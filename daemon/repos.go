@@ -0,0 +1,353 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cluster"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/git/mergerequest"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/policy"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/update"
+)
+
+// GitRepo is a git repo the daemon syncs from, besides its main repo
+// (given by Daemon.Repo and Daemon.GitConfig). Each is synced in a
+// loop of its own; and changes to the resources defined in it, by
+// releases or policy updates, are committed to it.
+type GitRepo struct {
+	Repo   *git.Repo
+	Config git.Config
+	// MergeRequests opens merge requests for changes proposed in the
+	// repo; nil if they are not to be opened
+	MergeRequests mergerequest.Opener
+}
+
+// repos gives all the repos the daemon syncs from, with the main repo
+// first.
+func (d *Daemon) repos() []GitRepo {
+	return append([]GitRepo{{Repo: d.Repo, Config: d.GitConfig, MergeRequests: d.MergeRequests}}, d.GitRepos...)
+}
+
+func (d *Daemon) withCloneOf(ctx context.Context, gr GitRepo, fn func(*git.Checkout) error) error {
+	co, err := d.clone(ctx, gr)
+	if err != nil {
+		return err
+	}
+	defer co.Clean()
+	return fn(co)
+}
+
+// clone clones the repo given. If its commits must be signed, and
+// loading the manifests may run commands from the repo, the head of
+// the branch is verified first (as it would be for a sync); a command
+// is no more to be run from an unverified commit than the commit is
+// to be synced.
+func (d *Daemon) clone(ctx context.Context, gr GitRepo) (*git.Checkout, error) {
+	co, err := gr.Repo.Clone(ctx, gr.Config)
+	if err != nil {
+		return nil, err
+	}
+	if d.verifyBeforeCommands(gr) {
+		headRev, err := co.HeadRevision(ctx)
+		if err == nil {
+			err = d.verifyRevision(ctx, gr, co, headRev)
+		}
+		if err != nil {
+			co.Clean()
+			return nil, err
+		}
+		d.verified(gr, headRev)
+	}
+	return co, nil
+}
+
+// verifyRevision checks that the revision given, and each commit
+// before it back to the last revision trusted, has a good signature.
+// A revision is trusted if the sync tag points at it and is itself
+// signed by a key in the keyring, or if it's been verified already;
+// failing both, the whole history is checked.
+func (d *Daemon) verifyRevision(ctx context.Context, gr GitRepo, co *git.Checkout, rev string) error {
+	trusted, err := co.VerifySyncTag(ctx)
+	if err != nil {
+		trusted = d.verifiedRevision(ctx, gr, co)
+	}
+	return co.VerifyCommits(ctx, trusted, rev)
+}
+
+// verifiedRevision gives the revision last verified for the repo
+// given, if there is one and it's in the checkout given.
+func (d *Daemon) verifiedRevision(ctx context.Context, gr GitRepo, co *git.Checkout) string {
+	d.verifiedMu.Lock()
+	rev := d.verifiedRevs[gr.Repo.Origin().URL]
+	d.verifiedMu.Unlock()
+	if rev == "" || !co.HasRevision(ctx, rev) {
+		return ""
+	}
+	return rev
+}
+
+// verified records that the revision given, and its history, have
+// been verified for the repo given.
+func (d *Daemon) verified(gr GitRepo, rev string) {
+	d.verifiedMu.Lock()
+	defer d.verifiedMu.Unlock()
+	if d.verifiedRevs == nil {
+		d.verifiedRevs = map[string]string{}
+	}
+	d.verifiedRevs[gr.Repo.Origin().URL] = rev
+}
+
+// verifyBeforeCommands reports whether commits of the repo given
+// must be verified before commands from them are run.
+func (d *Daemon) verifyBeforeCommands(gr GitRepo) bool {
+	cr, ok := d.Manifests.(cluster.CommandRunner)
+	return gr.Config.VerifySignatures && ok && cr.RunsCommands()
+}
+
+// syncSetName names the resources synced from a repo, for garbage
+// collection. It includes the branch and path, so that resources
+// synced by another daemon, from elsewhere in the same repo, are left
+// alone.
+func syncSetName(gr GitRepo) string {
+	return fmt.Sprintf("git:%s?branch=%s&path=%s", gr.Repo.Origin().URL, gr.Config.Branch, gr.Config.Path)
+}
+
+// servicesWithPolicies gives the policies for the resources defined
+// in all the repos. If the main repo can't be read, that's an error;
+// the others are passed over (after logging), so that one repo being
+// unavailable doesn't stop the rest working.
+func (d *Daemon) servicesWithPolicies(ctx context.Context) (policy.ResourceMap, error) {
+	var services policy.ResourceMap
+	err := d.WithClone(ctx, func(checkout *git.Checkout) error {
+		var err error
+		services, err = d.Manifests.ServicesWithPolicies(checkout.ManifestDir())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, gr := range d.GitRepos {
+		err := d.withCloneOf(ctx, gr, func(checkout *git.Checkout) error {
+			more, err := d.Manifests.ServicesWithPolicies(checkout.ManifestDir())
+			for id, policies := range more {
+				if _, ok := services[id]; !ok {
+					services[id] = policies
+				}
+			}
+			return err
+		})
+		if err != nil {
+			d.Logger.Log("url", gr.Repo.Origin().URL, "err", err)
+		}
+	}
+	return services, nil
+}
+
+// repoUpdate gives the update to make in a repo, to the resources
+// given; or, if ids is nil, to whichever resources the update is for.
+type repoUpdate func(gr GitRepo, ids []flux.ResourceID) updateFunc
+
+// makeJobFromUpdate turns a repoUpdate into a jobFunc that will run
+// the update with a fresh clone of each repo defining any of the
+// resources given (or of every repo, if ids is nil), and merge the
+// results.
+func (d *Daemon) makeJobFromUpdate(ids []flux.ResourceID, update repoUpdate) jobFunc {
+	return func(ctx context.Context, jobID job.ID, logger log.Logger) (job.Result, error) {
+		var result job.Result
+		repos := d.repos()
+		// Everything is cloned before anything is updated, so that
+		// the resources can be assigned to the repos defining them.
+		checkouts := make([]*git.Checkout, len(repos))
+		defer func() {
+			for _, co := range checkouts {
+				if co != nil {
+					co.Clean()
+				}
+			}
+		}()
+		for i, gr := range repos {
+			co, err := d.clone(ctx, gr)
+			if err != nil {
+				if i == 0 {
+					return result, err
+				}
+				logger.Log("url", gr.Repo.Origin().URL, "err", err)
+				continue
+			}
+			checkouts[i] = co
+		}
+
+		assigned, err := d.assignResources(ids, checkouts, logger)
+		if err != nil {
+			return result, err
+		}
+		for i, gr := range repos {
+			if checkouts[i] == nil || (assigned[i] != nil && len(assigned[i]) == 0) {
+				continue
+			}
+			repoResult, err := update(gr, assigned[i])(ctx, jobID, checkouts[i], logger)
+			mergeJobResult(&result, repoResult)
+			if err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+}
+
+// assignResources gives, for each repo checked out, the resources (of
+// those given) defined in it. Those defined in no repo are assigned
+// to the main repo, which will report them as not found. If there's
+// only one repo, or the resources aren't known, there's no need to
+// look, and all are nil, i.e., unrestricted.
+func (d *Daemon) assignResources(ids []flux.ResourceID, checkouts []*git.Checkout, logger log.Logger) ([][]flux.ResourceID, error) {
+	assigned := make([][]flux.ResourceID, len(checkouts))
+	if ids == nil || len(checkouts) == 1 {
+		return assigned, nil
+	}
+
+	unassigned := flux.ResourceIDSet{}
+	unassigned.Add(ids)
+	for i, co := range checkouts {
+		assigned[i] = []flux.ResourceID{}
+		if co == nil {
+			continue
+		}
+		resources, err := d.Manifests.LoadManifests(co.Dir(), co.ManifestDir())
+		if err != nil {
+			if i == 0 {
+				return nil, manifestLoadError(err)
+			}
+			logger.Log("url", d.GitRepos[i-1].Repo.Origin().URL, "err", err)
+			continue
+		}
+		for _, id := range ids {
+			if _, ok := resources[id.String()]; ok && unassigned.Contains(id) {
+				assigned[i] = append(assigned[i], id)
+				delete(unassigned, id)
+			}
+		}
+	}
+	assigned[0] = append(assigned[0], unassigned.ToSlice()...)
+	return assigned, nil
+}
+
+// mergeJobResult merges the result of an update in one repo into the
+// result of the job. The revision is that of the first commit made;
+// proposals from every repo are kept; and a resource's result from the repo in which it was found is used
+// in preference to that of another repo, which will have skipped it.
+func mergeJobResult(into *job.Result, result job.Result) {
+	if into.Revision == "" {
+		into.Revision = result.Revision
+	}
+	if into.Spec == nil {
+		into.Spec = result.Spec
+	}
+	into.Proposals = append(into.Proposals, result.Proposals...)
+	if result.Result == nil {
+		return
+	}
+	if into.Result == nil {
+		into.Result = update.Result{}
+	}
+	for id, res := range result.Result {
+		if existing, ok := into.Result[id]; ok && !(existing.Status == update.ReleaseStatusSkipped && existing.Error == update.NotInRepo) {
+			continue
+		}
+		into.Result[id] = res
+	}
+}
+
+// resourcesChanged gives the resources to which changes are to be
+// made, or nil if they may be made to any resource.
+func resourcesChanged(c release.Changes) []flux.ResourceID {
+	var ids []flux.ResourceID
+	switch c := c.(type) {
+	case update.ReleaseSpec:
+		for _, spec := range c.ServiceSpecs {
+			id, err := spec.AsID()
+			if err != nil {
+				// e.g., `<all>`
+				return nil
+			}
+			ids = append(ids, id)
+		}
+	case update.ContainerSpecs:
+		for id := range c.ContainerSpecs {
+			ids = append(ids, id)
+		}
+	case *update.Automated:
+		seen := flux.ResourceIDSet{}
+		for _, change := range c.Changes {
+			if !seen.Contains(change.ServiceID) {
+				seen.Add([]flux.ResourceID{change.ServiceID})
+				ids = append(ids, change.ServiceID)
+			}
+		}
+	case *update.RollbackRelease:
+		ids = append(ids, c.Spec.ResourceID)
+	default:
+		return nil
+	}
+	return ids
+}
+
+// changesTo gives the changes, restricted to those to the resources
+// given; or as they are, if ids is nil.
+func changesTo(c release.Changes, ids []flux.ResourceID) release.Changes {
+	if ids == nil {
+		return c
+	}
+	only := flux.ResourceIDSet{}
+	only.Add(ids)
+	switch c := c.(type) {
+	case update.ReleaseSpec:
+		var specs []update.ResourceSpec
+		for _, spec := range c.ServiceSpecs {
+			if id, err := spec.AsID(); err == nil && only.Contains(id) {
+				specs = append(specs, spec)
+			}
+		}
+		c.ServiceSpecs = specs
+		return c
+	case update.ContainerSpecs:
+		specs := map[flux.ResourceID][]update.ContainerUpdate{}
+		for id, updates := range c.ContainerSpecs {
+			if only.Contains(id) {
+				specs[id] = updates
+			}
+		}
+		c.ContainerSpecs = specs
+		return c
+	case *update.Automated:
+		automated := &update.Automated{}
+		for _, change := range c.Changes {
+			if only.Contains(change.ServiceID) {
+				automated.Changes = append(automated.Changes, change)
+			}
+		}
+		return automated
+	}
+	return c
+}
+
+// policyUpdatesTo gives the policy updates to the resources given; or
+// them all, if ids is nil.
+func policyUpdatesTo(updates policy.Updates, ids []flux.ResourceID) policy.Updates {
+	if ids == nil {
+		return updates
+	}
+	only := policy.Updates{}
+	for _, id := range ids {
+		if u, ok := updates[id]; ok {
+			only[id] = u
+		}
+	}
+	return only
+}
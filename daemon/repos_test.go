@@ -0,0 +1,81 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/job"
+	"github.com/weaveworks/flux/resource"
+	"github.com/weaveworks/flux/update"
+)
+
+func TestChangesToRepo(t *testing.T) {
+	foo := flux.MustParseResourceID("default:deployment/foo")
+	bar := flux.MustParseResourceID("default:deployment/bar")
+
+	spec := update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{update.MakeResourceSpec(foo), update.MakeResourceSpec(bar)},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+	}
+	if ids := resourcesChanged(spec); !reflect.DeepEqual(ids, []flux.ResourceID{foo, bar}) {
+		t.Errorf("expected changes to foo and bar, got %v", ids)
+	}
+	restricted := changesTo(spec, []flux.ResourceID{bar}).(update.ReleaseSpec)
+	if !reflect.DeepEqual(restricted.ServiceSpecs, []update.ResourceSpec{update.MakeResourceSpec(bar)}) {
+		t.Errorf("expected release of bar only, got %v", restricted.ServiceSpecs)
+	}
+	if restricted.ImageSpec != spec.ImageSpec {
+		t.Errorf("expected image spec to be kept, got %q", restricted.ImageSpec)
+	}
+	if _, ok := changesTo(spec, nil).(update.ReleaseSpec); !ok {
+		t.Error("expected unrestricted changes to be kept as they are")
+	}
+
+	all := update.ReleaseSpec{ServiceSpecs: []update.ResourceSpec{update.ResourceSpecAll}}
+	if ids := resourcesChanged(all); ids != nil {
+		t.Errorf("expected a release of <all> to be unrestricted, got %v", ids)
+	}
+
+	automated := &update.Automated{}
+	automated.Add(foo, resource.Container{Name: "app"}, mustParseImageRef("alpine:1"))
+	automated.Add(bar, resource.Container{Name: "app"}, mustParseImageRef("alpine:1"))
+	automated.Add(foo, resource.Container{Name: "app"}, mustParseImageRef("nginx:1"))
+	if ids := resourcesChanged(automated); !reflect.DeepEqual(ids, []flux.ResourceID{foo, bar}) {
+		t.Errorf("expected automated changes to foo and bar, got %v", ids)
+	}
+	if changes := changesTo(automated, []flux.ResourceID{foo}).(*update.Automated).Changes; len(changes) != 2 {
+		t.Errorf("expected the two changes to foo, got %v", changes)
+	}
+}
+
+func TestMergeJobResult(t *testing.T) {
+	foo := flux.MustParseResourceID("default:deployment/foo")
+	bar := flux.MustParseResourceID("default:deployment/bar")
+
+	var result job.Result
+	mergeJobResult(&result, job.Result{
+		Revision: "main-rev",
+		Result: update.Result{
+			foo: update.ControllerResult{Status: update.ReleaseStatusSuccess},
+			bar: update.ControllerResult{Status: update.ReleaseStatusSkipped, Error: update.NotInRepo},
+		},
+	})
+	mergeJobResult(&result, job.Result{
+		Revision: "other-rev",
+		Result: update.Result{
+			foo: update.ControllerResult{Status: update.ReleaseStatusSkipped, Error: update.NotInRepo},
+			bar: update.ControllerResult{Status: update.ReleaseStatusSuccess},
+		},
+	})
+
+	if result.Revision != "main-rev" {
+		t.Errorf("expected revision of first commit, got %q", result.Revision)
+	}
+	for _, id := range []flux.ResourceID{foo, bar} {
+		if result.Result[id].Status != update.ReleaseStatusSuccess {
+			t.Errorf("expected %s to have succeeded, got %+v", id, result.Result[id])
+		}
+	}
+}
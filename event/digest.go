@@ -0,0 +1,249 @@
+package event
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+// EventDigest is the type of the summary event emitted by a Digest.
+const EventDigest = "digest"
+
+// How many workloads to name as most-updated in a digest.
+const digestTopWorkloads = 5
+
+// DigestFailure records a release or automated release that failed,
+// in whole or for a particular workload.
+type DigestFailure struct {
+	ID    flux.ResourceID `json:"id,omitempty"`
+	Error string          `json:"error"`
+}
+
+// WorkloadCount is the number of times a workload was updated within
+// the period of a digest.
+type WorkloadCount struct {
+	ID    flux.ResourceID `json:"id"`
+	Count int             `json:"count"`
+}
+
+// DigestEventMetadata is the metadata for a summary of the release
+// and automation activity over a period.
+type DigestEventMetadata struct {
+	// The number of events of each type that were aggregated
+	Counts map[string]int `json:"counts"`
+	// Failures reported by the releases in the period
+	Failures []DigestFailure `json:"failures,omitempty"`
+	// The workloads updated most often, most frequent first
+	MostUpdated []WorkloadCount `json:"mostUpdated,omitempty"`
+}
+
+func (dem *DigestEventMetadata) Type() string {
+	return EventDigest
+}
+
+// Digest aggregates release and automated release events, and
+// periodically writes a single summary event for each of its
+// channels. A channel is an EventWriter given to `Channel`; the
+// events logged through a channel are summarised in its own digest,
+// which is written to that EventWriter. Any other events are passed
+// through unchanged.
+//
+// Since events are held in memory until the end of the period, those
+// collected since the last digest will be lost if the process exits
+// without `Loop` being told to stop.
+type Digest struct {
+	period time.Duration
+
+	mu       sync.Mutex
+	closed   bool
+	channels map[string]*digestChannel
+}
+
+// digestChannel is what's been collected for a channel since its
+// last digest.
+type digestChannel struct {
+	next    EventWriter
+	start   time.Time
+	counts  map[string]int
+	fails   []DigestFailure
+	updated map[flux.ResourceID]int
+}
+
+// NewDigest constructs a Digest which writes a summary to each of its
+// channels every `period`, once `Loop` has been started.
+func NewDigest(period time.Duration) *Digest {
+	return &Digest{
+		period:   period,
+		channels: map[string]*digestChannel{},
+	}
+}
+
+// Channel returns an EventWriter that records release and automated
+// release events for the digest of the channel named, and forwards
+// anything else to `next`; the digest is written to `next` too.
+func (d *Digest) Channel(name string, next EventWriter) EventWriter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := &digestChannel{next: next}
+	c.reset(time.Now().UTC())
+	d.channels[name] = c
+	return digestWriter{digest: d, channel: name}
+}
+
+type digestWriter struct {
+	digest  *Digest
+	channel string
+}
+
+func (w digestWriter) LogEvent(e Event) error {
+	return w.digest.logEvent(w.channel, e)
+}
+
+func (c *digestChannel) reset(start time.Time) {
+	c.start = start
+	c.counts = map[string]int{}
+	c.fails = nil
+	c.updated = map[flux.ResourceID]int{}
+}
+
+// logEvent records a release or automated release for the next
+// digest of the channel, and forwards anything else. Once the digest
+// has been closed, everything is forwarded.
+func (d *Digest) logEvent(channel string, e Event) error {
+	var common ReleaseEventCommon
+	digested := false
+	switch metadata := e.Metadata.(type) {
+	case *ReleaseEventMetadata:
+		common, digested = metadata.ReleaseEventCommon, true
+	case *AutoReleaseEventMetadata:
+		common, digested = metadata.ReleaseEventCommon, true
+	}
+
+	d.mu.Lock()
+	c := d.channels[channel]
+	if d.closed || !digested {
+		d.mu.Unlock()
+		return c.next.LogEvent(e)
+	}
+	defer d.mu.Unlock()
+	c.counts[e.Type]++
+	if common.Error != "" && len(common.Result) == 0 {
+		c.fails = append(c.fails, DigestFailure{Error: common.Error})
+	}
+	for id, result := range common.Result {
+		switch result.Status {
+		case update.ReleaseStatusSuccess:
+			c.updated[id]++
+		case update.ReleaseStatusFailed:
+			c.fails = append(c.fails, DigestFailure{ID: id, Error: result.Error})
+		}
+	}
+	return nil
+}
+
+// Flush writes a summary of the events collected so far for each
+// channel, to those that have had any, and starts a new period.
+func (d *Digest) Flush() error {
+	return d.flush(false)
+}
+
+// flush takes the digests due under the lock, and writes them once
+// it's released. If `close` is true, events logged from then on are
+// forwarded rather than collected, so none arrive too late to be in
+// the last digest.
+func (d *Digest) flush(close bool) error {
+	now := time.Now().UTC()
+
+	type pending struct {
+		channel string
+		next    EventWriter
+		event   Event
+	}
+	var due []pending
+	d.mu.Lock()
+	d.closed = d.closed || close
+	for name, c := range d.channels {
+		if len(c.counts) > 0 {
+			due = append(due, pending{channel: name, next: c.next, event: c.digest(now)})
+		}
+		c.reset(now)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].channel < due[j].channel })
+	var firstErr error
+	for _, p := range due {
+		if err := p.next.LogEvent(p.event); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "writing digest for %s", p.channel)
+		}
+	}
+	return firstErr
+}
+
+// digest makes the summary event for what the channel has collected.
+func (c *digestChannel) digest(now time.Time) Event {
+	ev := Event{
+		ServiceIDs: make([]flux.ResourceID, 0, len(c.updated)),
+		Type:       EventDigest,
+		StartedAt:  c.start,
+		EndedAt:    now,
+		LogLevel:   LogLevelInfo,
+		Metadata: &DigestEventMetadata{
+			Counts:      c.counts,
+			Failures:    c.fails,
+			MostUpdated: mostUpdated(c.updated, digestTopWorkloads),
+		},
+	}
+	for id := range c.updated {
+		ev.ServiceIDs = append(ev.ServiceIDs, id)
+	}
+	if len(c.fails) > 0 {
+		ev.LogLevel = LogLevelWarn
+	}
+	return ev
+}
+
+// Loop writes the digests at the end of each period. When told to
+// stop, it writes them once more, with anything collected up to then,
+// and returns; events logged after that are forwarded as they are.
+func (d *Digest) Loop(stop <-chan struct{}, wg *sync.WaitGroup, logger log.Logger) {
+	defer wg.Done()
+	ticker := time.NewTicker(d.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if err := d.flush(true); err != nil {
+				logger.Log("err", err)
+			}
+			return
+		case <-ticker.C:
+			if err := d.Flush(); err != nil {
+				logger.Log("err", err)
+			}
+		}
+	}
+}
+
+func mostUpdated(updated map[flux.ResourceID]int, n int) []WorkloadCount {
+	counts := make([]WorkloadCount, 0, len(updated))
+	for id, count := range updated {
+		counts = append(counts, WorkloadCount{ID: id, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count == counts[j].Count {
+			return counts[i].ID.String() < counts[j].ID.String()
+		}
+		return counts[i].Count > counts[j].Count
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
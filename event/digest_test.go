@@ -0,0 +1,183 @@
+package event
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/update"
+)
+
+type recordingWriter []Event
+
+func (w *recordingWriter) LogEvent(e Event) error {
+	*w = append(*w, e)
+	return nil
+}
+
+// lockedWriter is a recordingWriter that can be written to from
+// several goroutines.
+type lockedWriter struct {
+	mu     sync.Mutex
+	events recordingWriter
+}
+
+func (w *lockedWriter) LogEvent(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.events.LogEvent(e)
+}
+
+func autoRelease(results update.Result) Event {
+	return Event{
+		Type: EventAutoRelease,
+		Metadata: &AutoReleaseEventMetadata{
+			ReleaseEventCommon: ReleaseEventCommon{Result: results},
+		},
+	}
+}
+
+func TestDigest_Aggregates(t *testing.T) {
+	var out recordingWriter
+	d := NewDigest(0).Channel("test", &out)
+	digest := d.(digestWriter).digest
+
+	foo := flux.MustParseResourceID("default:deployment/foo")
+	bar := flux.MustParseResourceID("default:deployment/bar")
+
+	for _, e := range []Event{
+		autoRelease(update.Result{foo: {Status: update.ReleaseStatusSuccess}}),
+		autoRelease(update.Result{foo: {Status: update.ReleaseStatusSuccess}, bar: {Status: update.ReleaseStatusFailed, Error: "boom"}}),
+		{Type: EventRelease, Metadata: &ReleaseEventMetadata{ReleaseEventCommon: ReleaseEventCommon{Error: "no such service"}}},
+		{Type: EventLock, ServiceIDs: []flux.ResourceID{foo}},
+	} {
+		if err := d.LogEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(out) != 1 || out[0].Type != EventLock {
+		t.Fatalf("expected only the lock event to be passed through, got %v", out)
+	}
+
+	if err := digest.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("expected a digest event to be written, got %d events", len(out))
+	}
+	ev := out[1]
+	if ev.Type != EventDigest || ev.LogLevel != LogLevelWarn {
+		t.Errorf("unexpected digest event: %+v", ev)
+	}
+	metadata := ev.Metadata.(*DigestEventMetadata)
+	if metadata.Counts[EventAutoRelease] != 2 || metadata.Counts[EventRelease] != 1 {
+		t.Errorf("unexpected counts: %v", metadata.Counts)
+	}
+	if len(metadata.Failures) != 2 {
+		t.Errorf("expected two failures, got %v", metadata.Failures)
+	}
+	if len(metadata.MostUpdated) != 1 || metadata.MostUpdated[0] != (WorkloadCount{ID: foo, Count: 2}) {
+		t.Errorf("unexpected most updated: %v", metadata.MostUpdated)
+	}
+
+	// Nothing new, so nothing sent
+	if err := digest.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Errorf("expected no further events, got %d", len(out))
+	}
+}
+
+func TestDigest_PerChannel(t *testing.T) {
+	var a, b recordingWriter
+	d := NewDigest(0)
+	chanA, chanB := d.Channel("a", &a), d.Channel("b", &b)
+
+	foo := flux.MustParseResourceID("default:deployment/foo")
+	bar := flux.MustParseResourceID("default:deployment/bar")
+	for _, e := range []Event{
+		autoRelease(update.Result{foo: {Status: update.ReleaseStatusSuccess}}),
+		autoRelease(update.Result{foo: {Status: update.ReleaseStatusSuccess}}),
+	} {
+		if err := chanA.LogEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := chanB.LogEvent(autoRelease(update.Result{bar: {Status: update.ReleaseStatusSuccess}})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct {
+		out     recordingWriter
+		id      flux.ResourceID
+		count   int
+		release int
+	}{
+		"a": {a, foo, 2, 2},
+		"b": {b, bar, 1, 1},
+	} {
+		if len(c.out) != 1 {
+			t.Errorf("expected one digest for channel %s, got %v", name, c.out)
+			continue
+		}
+		metadata := c.out[0].Metadata.(*DigestEventMetadata)
+		if metadata.Counts[EventAutoRelease] != c.release {
+			t.Errorf("expected %d automated releases in the digest for channel %s, got %v", c.release, name, metadata.Counts)
+		}
+		if len(metadata.MostUpdated) != 1 || metadata.MostUpdated[0] != (WorkloadCount{ID: c.id, Count: c.count}) {
+			t.Errorf("unexpected most updated for channel %s: %v", name, metadata.MostUpdated)
+		}
+	}
+}
+
+// Events logged while the digest is stopping are either in the last
+// digest, or passed on as they are; none are lost.
+func TestDigest_Shutdown(t *testing.T) {
+	var out lockedWriter
+	d := NewDigest(time.Hour)
+	ch := d.Channel("test", &out)
+	foo := flux.MustParseResourceID("default:deployment/foo")
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go d.Loop(stop, wg, log.NewNopLogger())
+
+	const senders, each = 4, 250
+	sendersWg := &sync.WaitGroup{}
+	for i := 0; i < senders; i++ {
+		sendersWg.Add(1)
+		go func() {
+			defer sendersWg.Done()
+			for j := 0; j < each; j++ {
+				if err := ch.LogEvent(autoRelease(update.Result{foo: {Status: update.ReleaseStatusSuccess}})); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	close(stop)
+	wg.Wait()
+	sendersWg.Wait()
+
+	total := 0
+	for _, e := range out.events {
+		switch e.Type {
+		case EventDigest:
+			total += e.Metadata.(*DigestEventMetadata).Counts[EventAutoRelease]
+		case EventAutoRelease:
+			total++
+		}
+	}
+	if total != senders*each {
+		t.Errorf("expected all %d events to be accounted for, got %d", senders*each, total)
+	}
+}
@@ -19,11 +19,14 @@ const (
 	EventSync         = "sync"
 	EventRelease      = "release"
 	EventAutoRelease  = "autorelease"
+	EventRollback     = "rollback"
 	EventAutomate     = "automate"
 	EventDeautomate   = "deautomate"
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventSyncRefused  = "sync_refused"
+	EventPropose      = "propose"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -66,6 +69,10 @@ type Event struct {
 	// Metadata is Event.Type-specific metadata. If an event has no metadata,
 	// this will be nil.
 	Metadata EventMetadata `json:"metadata,omitempty"`
+
+	// Links to dashboards relevant to this event, expanded from the
+	// configured link templates.
+	Links []Link `json:"links,omitempty"`
 }
 
 type EventWriter interface {
@@ -129,6 +136,22 @@ func (e Event) String() string {
 			"Automated release of %s",
 			strings.Join(strImageIDs, ", "),
 		)
+	case EventRollback:
+		metadata := e.Metadata.(*RollbackEventMetadata)
+		strImageIDs := metadata.Result.ChangedImages()
+		if len(strImageIDs) == 0 {
+			strImageIDs = []string{"no image changes"}
+		}
+		var user string
+		if metadata.Cause.User != "" {
+			user = fmt.Sprintf(", by %s", metadata.Cause.User)
+		}
+		return fmt.Sprintf(
+			"Rolled back: %s to %s%s",
+			metadata.Spec.ResourceID,
+			strings.Join(strImageIDs, ", "),
+			user,
+		)
 	case EventCommit:
 		metadata := e.Metadata.(*CommitEventMetadata)
 		svcStr := "<no changes>"
@@ -163,6 +186,29 @@ func (e Event) String() string {
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strServiceIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strServiceIDs, ", "))
+	case EventSyncRefused:
+		metadata := e.Metadata.(*SyncRefusedEventMetadata)
+		return fmt.Sprintf("Sync refused: %s, since %s", shortRevision(metadata.Revision), metadata.Reason)
+	case EventPropose:
+		metadata := e.Metadata.(*ProposeEventMetadata)
+		svcStr := "<no changes>"
+		if len(strServiceIDs) > 0 {
+			svcStr = strings.Join(strServiceIDs, ", ")
+		}
+		where := metadata.Branch
+		if metadata.URL != "" {
+			where = metadata.URL
+		}
+		return fmt.Sprintf("Proposed: %s, %s, at %s", shortRevision(metadata.Revision), svcStr, where)
+	case EventDigest:
+		metadata := e.Metadata.(*DigestEventMetadata)
+		return fmt.Sprintf(
+			"Digest: %d release(s) and %d automated release(s) updating %d workload(s), %d failure(s)",
+			metadata.Counts[EventRelease],
+			metadata.Counts[EventAutoRelease],
+			len(e.ServiceIDs),
+			len(metadata.Failures),
+		)
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -186,6 +232,17 @@ func (c CommitEventMetadata) ShortRevision() string {
 	return shortRevision(c.Revision)
 }
 
+// ProposeEventMetadata is the metadata for when changes are committed
+// to a branch of their own, to be reviewed before they're merged into
+// the branch synced.
+type ProposeEventMetadata struct {
+	Revision string        `json:"revision"`
+	Branch   string        `json:"branch"`
+	URL      string        `json:"url,omitempty"` // of the merge request, if one was opened
+	Spec     *update.Spec  `json:"spec"`
+	Result   update.Result `json:"result,omitempty"`
+}
+
 // Commit represents the commit information in a sync event. We could
 // use git.Commit, but that would lead to an import cycle, and may
 // anyway represent coupling (of an internal API to serialised data)
@@ -232,6 +289,15 @@ func (ev *SyncEventMetadata) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// SyncRefusedEventMetadata is the metadata for when a revision is not
+// synced, because something about it can't be trusted.
+type SyncRefusedEventMetadata struct {
+	// The revision that would have been synced
+	Revision string `json:"revision"`
+	// Why it wasn't, e.g., a commit in its history isn't signed
+	Reason string `json:"reason"`
+}
+
 type ReleaseEventCommon struct {
 	Revision string        // the revision which has the changes for the release
 	Result   update.Result `json:"result"`
@@ -253,6 +319,14 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// RollbackEventMetadata is for when a service is rolled back to the
+// images it used before a release, or at an earlier revision
+type RollbackEventMetadata struct {
+	ReleaseEventCommon
+	Spec  update.RollbackSpec `json:"spec"`
+	Cause update.Cause        `json:"cause"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -288,6 +362,13 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventRollback:
+		var metadata RollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	case EventCommit:
 		var metadata CommitEventMetadata
 		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
@@ -302,6 +383,27 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventSyncRefused:
+		var metadata SyncRefusedEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventPropose:
+		var metadata ProposeEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventDigest:
+		var metadata DigestEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	default:
 		if len(wireEvent.MetadataBytes) > 0 {
 			var metadata UnknownEventMetadata
@@ -333,6 +435,14 @@ func (cem *SyncEventMetadata) Type() string {
 	return EventSync
 }
 
+func (srm *SyncRefusedEventMetadata) Type() string {
+	return EventSyncRefused
+}
+
+func (pem *ProposeEventMetadata) Type() string {
+	return EventPropose
+}
+
 func (rem *ReleaseEventMetadata) Type() string {
 	return EventRelease
 }
@@ -341,6 +451,10 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (rem *RollbackEventMetadata) Type() string {
+	return EventRollback
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
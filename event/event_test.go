@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/update"
 )
 
@@ -44,6 +45,62 @@ func TestEvent_ParseReleaseMetaData(t *testing.T) {
 	}
 }
 
+func TestEvent_ParseRollbackMetadata(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	origEvent := Event{
+		Type: EventRollback,
+		Metadata: &RollbackEventMetadata{
+			Cause: cause,
+			Spec:  update.RollbackSpec{ResourceID: id, Kind: update.ReleaseKindExecute},
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := e.Metadata.(*RollbackEventMetadata)
+	if !ok {
+		t.Fatalf("Wrong event type unmarshalled: %#v", e.Metadata)
+	}
+	if r.Spec.ResourceID != id || r.Cause != cause {
+		t.Fatal("Rollback event wasn't marshalled/unmarshalled")
+	}
+}
+
+func TestEvent_ParseProposeMetadata(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	origEvent := Event{
+		Type:       EventPropose,
+		ServiceIDs: []flux.ResourceID{id},
+		Metadata: &ProposeEventMetadata{
+			Revision: "f8d5f0f4a3ad1d0fe6b35da7e3d1fa1a35fb4b63",
+			Branch:   "flux-propose/1a2b3c4d5e6f",
+			URL:      "https://github.com/weaveworks/flux-example/pull/1",
+			Spec:     &update.Spec{Type: update.Images, Cause: cause, Spec: spec},
+		},
+	}
+
+	bytes, _ := json.Marshal(origEvent)
+
+	e := Event{}
+	if err := e.UnmarshalJSON(bytes); err != nil {
+		t.Fatal(err)
+	}
+	p, ok := e.Metadata.(*ProposeEventMetadata)
+	if !ok {
+		t.Fatalf("Wrong event type unmarshalled: %#v", e.Metadata)
+	}
+	if p.Branch != "flux-propose/1a2b3c4d5e6f" || p.Spec == nil || p.Spec.Cause != cause {
+		t.Fatal("Propose event wasn't marshalled/unmarshalled")
+	}
+	if msg := e.String(); msg != "Proposed: f8d5f0f, default:deployment/helloworld, at https://github.com/weaveworks/flux-example/pull/1" {
+		t.Errorf("unexpected summary of propose event: %s", msg)
+	}
+}
+
 func TestEvent_ParseNoMetadata(t *testing.T) {
 	origEvent := Event{
 		Type: EventLock,
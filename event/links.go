@@ -0,0 +1,194 @@
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// How far either side of an event the time range given to link
+// templates extends, so that dashboards show some context.
+const linkWindow = 15 * time.Minute
+
+// Link is a URL to an external dashboard (e.g., Grafana, a log
+// search, or an APM service) relevant to an event.
+type Link struct {
+	Name string `json:"name"`
+	// The workload this link is for, if the link template refers
+	// to the workload
+	ServiceID string `json:"serviceID,omitempty"`
+	URL       string `json:"url"`
+}
+
+// LinkTemplate is a named URL template, expanded for each event. The
+// template is a Go text/template, and has these fields available:
+//
+//	.Namespace, .Kind, .Name   the components of the workload ID
+//	.Workload                  the whole workload ID
+//	.From, .To                 the time range of the event, as time.Time
+//	.FromMillis, .ToMillis     the time range in Unix milliseconds
+//
+// If the template refers to any of the workload fields, it is
+// expanded once per workload affected by the event; otherwise, once
+// per event. What each action in the template gives is escaped for
+// where it is in the URL: as a query component after the `?`, and as
+// a path segment before it.
+type LinkTemplate struct {
+	Name        string
+	tmpl        *template.Template
+	perWorkload bool
+}
+
+type linkVars struct {
+	Namespace, Kind, Name string
+	Workload              string
+	From, To              time.Time
+	FromMillis, ToMillis  int64
+}
+
+// ParseLinkTemplate parses a link template given as `name=template`.
+func ParseLinkTemplate(s string) (LinkTemplate, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return LinkTemplate{}, fmt.Errorf("invalid link template %q; expected <name>=<template>", s)
+	}
+	tmpl, err := template.New(parts[0]).Option("missingkey=error").Funcs(template.FuncMap{
+		"pathEscape":  escaper(url.PathEscape),
+		"queryEscape": escaper(url.QueryEscape),
+	}).Parse(parts[1])
+	if err != nil {
+		return LinkTemplate{}, err
+	}
+	inQuery := false
+	escapeActions(tmpl.Tree.Root, &inQuery)
+	perWorkload := false
+	for _, field := range []string{".Namespace", ".Kind", ".Name", ".Workload"} {
+		if strings.Contains(parts[1], field) {
+			perWorkload = true
+			break
+		}
+	}
+	return LinkTemplate{Name: parts[0], tmpl: tmpl, perWorkload: perWorkload}, nil
+}
+
+// Links expands the template for the event given.
+func (t LinkTemplate) Links(e Event) ([]Link, error) {
+	from, to := e.StartedAt.Add(-linkWindow), e.EndedAt.Add(linkWindow)
+	vars := linkVars{
+		From:       from,
+		To:         to,
+		FromMillis: from.UnixNano() / int64(time.Millisecond),
+		ToMillis:   to.UnixNano() / int64(time.Millisecond),
+	}
+
+	if !t.perWorkload {
+		url, err := t.expand(vars)
+		if err != nil {
+			return nil, err
+		}
+		return []Link{{Name: t.Name, URL: url}}, nil
+	}
+
+	var links []Link
+	for _, id := range e.ServiceIDs {
+		vars.Namespace, vars.Kind, vars.Name = id.Components()
+		vars.Workload = id.String()
+		url, err := t.expand(vars)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, Link{Name: t.Name, ServiceID: vars.Workload, URL: url})
+	}
+	return links, nil
+}
+
+// escapeActions appends an escaping function to the pipeline of each
+// action in the list given, and in those nested in it. `inQuery`
+// records whether the text so far has reached the query.
+func escapeActions(list *parse.ListNode, inQuery *bool) {
+	if list == nil {
+		return
+	}
+	for _, n := range list.Nodes {
+		switch n := n.(type) {
+		case *parse.TextNode:
+			*inQuery = *inQuery || bytes.IndexByte(n.Text, '?') >= 0
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				continue // it declares a variable, so gives nothing
+			}
+			escape := "pathEscape"
+			if *inQuery {
+				escape = "queryEscape"
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(escape).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeActions(n.List, inQuery)
+			escapeActions(n.ElseList, inQuery)
+		case *parse.RangeNode:
+			escapeActions(n.List, inQuery)
+			escapeActions(n.ElseList, inQuery)
+		case *parse.WithNode:
+			escapeActions(n.List, inQuery)
+			escapeActions(n.ElseList, inQuery)
+		}
+	}
+}
+
+// escaper gives a template function that escapes any value, printed
+// as the template would print it.
+func escaper(escape func(string) string) func(interface{}) string {
+	return func(v interface{}) string {
+		return escape(fmt.Sprint(v))
+	}
+}
+
+func (t LinkTemplate) expand(vars linkVars) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// LinkingWriter is an EventWriter which adds links, expanded from
+// its templates, to each event before passing it on. A template that
+// fails to expand is logged and left out, rather than holding up the
+// event.
+type LinkingWriter struct {
+	next      EventWriter
+	templates []LinkTemplate
+	logger    log.Logger
+}
+
+func NewLinkingWriter(next EventWriter, templates []LinkTemplate, logger log.Logger) *LinkingWriter {
+	return &LinkingWriter{next: next, templates: templates, logger: logger}
+}
+
+func (w *LinkingWriter) LogEvent(e Event) error {
+	return w.next.LogEvent(AddLinks(e, w.templates, w.logger))
+}
+
+// AddLinks gives the event with links added, expanded from each of
+// the templates; those that fail to expand are logged, and left out.
+func AddLinks(e Event, templates []LinkTemplate, logger log.Logger) Event {
+	for _, t := range templates {
+		links, err := t.Links(e)
+		if err != nil {
+			logger.Log("link", t.Name, "event", e.Type, "err", err)
+			continue
+		}
+		e.Links = append(e.Links, links...)
+	}
+	return e
+}
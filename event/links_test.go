@@ -0,0 +1,103 @@
+package event
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestParseLinkTemplate_Invalid(t *testing.T) {
+	for _, s := range []string{"", "grafana", "=http://x", "grafana=", "logs=http://x/{{.Nope"} {
+		if _, err := ParseLinkTemplate(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestLinkingWriter(t *testing.T) {
+	grafana, err := ParseLinkTemplate("grafana=https://grafana/d/abc?var-ns={{.Namespace}}&var-name={{.Name}}&from={{.FromMillis}}&to={{.ToMillis}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := ParseLinkTemplate("logs=https://logs/search?since={{.From.Unix}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out recordingWriter
+	w := NewLinkingWriter(&out, []LinkTemplate{grafana, logs}, log.NewNopLogger())
+
+	at := time.Unix(1000000, 0)
+	foo := flux.MustParseResourceID("default:deployment/foo")
+	bar := flux.MustParseResourceID("prod:deployment/bar")
+	if err := w.LogEvent(Event{
+		Type:       EventRelease,
+		ServiceIDs: []flux.ResourceID{foo, bar},
+		StartedAt:  at,
+		EndedAt:    at,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := at.Add(-linkWindow), at.Add(linkWindow)
+	expected := []Link{
+		{Name: "grafana", ServiceID: foo.String(), URL: "https://grafana/d/abc?var-ns=default&var-name=foo&from=999100000&to=1000900000"},
+		{Name: "grafana", ServiceID: bar.String(), URL: "https://grafana/d/abc?var-ns=prod&var-name=bar&from=999100000&to=1000900000"},
+		{Name: "logs", URL: "https://logs/search?since=999100"},
+	}
+	if !reflect.DeepEqual(expected, out[0].Links) {
+		t.Errorf("expected links %#v, got %#v (%s to %s)", expected, out[0].Links, from, to)
+	}
+}
+
+// The values put into links are escaped, as a path segment or query
+// component depending on where they are
+func TestLinkingWriter_Escapes(t *testing.T) {
+	logs, err := ParseLinkTemplate("logs=https://logs/w/{{.Workload}}/{{if .Name}}{{.Name}}{{end}}?q={{.Workload}}&kind={{.Kind}}&from={{.From.Format \"2006-01-02T15:04:05Z07:00\"}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out recordingWriter
+	w := NewLinkingWriter(&out, []LinkTemplate{logs}, log.NewNopLogger())
+
+	at := time.Date(2018, 1, 1, 12, 0, 0, 0, time.FixedZone("", 3600))
+	id := flux.MustParseResourceID("default:deployment/foo")
+	if err := w.LogEvent(Event{Type: EventRelease, ServiceIDs: []flux.ResourceID{id}, StartedAt: at, EndedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Link{{
+		Name:      "logs",
+		ServiceID: id.String(),
+		URL:       "https://logs/w/default:deployment%2Ffoo/foo?q=default%3Adeployment%2Ffoo&kind=deployment&from=2018-01-01T11%3A45%3A00%2B01%3A00",
+	}}
+	if !reflect.DeepEqual(expected, out[0].Links) {
+		t.Errorf("expected links %#v, got %#v", expected, out[0].Links)
+	}
+}
+
+// A template that can't be expanded for an event is logged, and left
+// out of its links
+func TestLinkingWriter_LogsErrors(t *testing.T) {
+	bad, err := ParseLinkTemplate("bad=https://logs/{{.From.Nope}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out recordingWriter
+	var logged bytes.Buffer
+	w := NewLinkingWriter(&out, []LinkTemplate{bad}, log.NewLogfmtLogger(&logged))
+	if err := w.LogEvent(Event{Type: EventRelease}); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || len(out[0].Links) != 0 {
+		t.Errorf("expected the event to be passed on without links, got %#v", out)
+	}
+	if !strings.Contains(logged.String(), "link=bad") {
+		t.Errorf("expected the failure to be logged, got %q", logged.String())
+	}
+}
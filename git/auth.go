@@ -0,0 +1,269 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Auth says how to authenticate with a remote, and which SSH host
+// keys to trust, beyond what's set up for git and SSH in the
+// environment (i.e., the deploy key, and the known hosts in the SSH
+// config).
+type Auth struct {
+	// Username and Password are given to the server for HTTPS URLs,
+	// rather than git prompting for them. The password can be a
+	// token, in which case the username may not matter to the host.
+	Username string
+	Password string
+	// KnownHostsFile, if set, is the only file of host keys trusted
+	// for SSH URLs; those in the SSH config are not used.
+	KnownHostsFile string
+	// HostKeyFingerprints, if given, are the fingerprints of the host
+	// keys to trust for SSH URLs, as printed by `ssh-keygen -l` (e.g.,
+	// "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"). Before the
+	// repo is cloned, the host's keys are fetched, and those that
+	// match are written to KnownHostsFile.
+	HostKeyFingerprints []string
+}
+
+// defaultUsername is given with a password, if no username is; hosts
+// that take tokens as passwords tend to accept any username.
+const defaultUsername = "git"
+
+// credentialHelper gives git the username and password from the
+// environment of the git command, so they need not be written in the
+// URL (or anywhere else) to be used.
+const credentialHelper = `!f() { test "$1" = get && echo "username=${FLUX_GIT_USERNAME}" && echo "password=${FLUX_GIT_PASSWORD}"; }; f`
+
+// args returns the arguments to give git, before the command, for it
+// to use the credentials.
+func (a Auth) args() []string {
+	if a.Password == "" {
+		return nil
+	}
+	// The first, empty helper resets any helpers configured already
+	return []string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}
+}
+
+// env returns the environment entries to give git for it to use the
+// credentials and known hosts.
+func (a Auth) env() []string {
+	var env []string
+	if a.Password != "" {
+		username := a.Username
+		if username == "" {
+			username = defaultUsername
+		}
+		env = append(env, "FLUX_GIT_USERNAME="+username, "FLUX_GIT_PASSWORD="+a.Password)
+	}
+	if a.KnownHostsFile != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o StrictHostKeyChecking=yes -o GlobalKnownHostsFile=/dev/null -o UserKnownHostsFile="+shellQuote(a.KnownHostsFile))
+	}
+	return env
+}
+
+// shellQuote quotes a string so that the shell will take it as a
+// single word, as it is.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// hostKeyAlgorithms are those asked for in turn, when fetching the
+// keys of a host; a host has at most one key of each type, and only
+// gives the key for the algorithm agreed on.
+var hostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	"rsa-sha2-256", // an RSA key, for hosts that no longer accept SHA-1 signatures
+	ssh.KeyAlgoRSA,
+}
+
+// errHostKeyFetched stops an SSH handshake once the host key is in
+// hand; there's no need (nor the means) to authenticate.
+var errHostKeyFetched = errors.New("host key fetched")
+
+// pinHostKeys fetches the keys of the SSH host in the URL given, and
+// writes those that match the fingerprints in the Auth to its known
+// hosts file. It's an error if none match, since then the host can't
+// be trusted.
+func (a Auth) pinHostKeys(ctx context.Context, repoURL string) error {
+	if len(a.HostKeyFingerprints) == 0 {
+		return nil
+	}
+	addr, user, ok := sshAddress(repoURL)
+	if !ok {
+		return fmt.Errorf("host key fingerprints are given for %s, but it is not an SSH URL", repoURL)
+	}
+	pinned := map[string]bool{}
+	for _, f := range a.HostKeyFingerprints {
+		pinned[f] = true
+	}
+
+	var lines []string
+	seen := map[string]bool{}
+	var fetched bool
+	var fetchErr error
+	for _, algo := range hostKeyAlgorithms {
+		key, err := fetchHostKey(ctx, addr, user, algo)
+		if err != nil {
+			// The host may well not have a key of every type
+			fetchErr = err
+			continue
+		}
+		fetched = true
+		fingerprint := ssh.FingerprintSHA256(key)
+		if pinned[fingerprint] && !seen[fingerprint] {
+			seen[fingerprint] = true
+			lines = append(lines, knownhosts.Line([]string{knownhosts.Normalize(addr)}, key))
+		}
+	}
+	if len(lines) == 0 {
+		if !fetched {
+			return errors.Wrapf(fetchErr, "fetching host keys from %s", addr)
+		}
+		return fmt.Errorf("none of the host keys of %s match the fingerprints given", addr)
+	}
+	return ioutil.WriteFile(a.KnownHostsFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// fetchHostKey gets the host key of the SSH server at the address
+// given, for the host key algorithm given, by starting a handshake.
+func fetchHostKey(ctx context.Context, addr, user, algo string) (ssh.PublicKey, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(opTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              user,
+		HostKeyAlgorithms: []string{algo},
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKeyFetched
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if key != nil {
+		return key, nil
+	}
+	return nil, err
+}
+
+// sshAddress returns the host and port, and user, to connect to for
+// an SSH URL (`ssh://user@host:port/path`), or an scp-like address
+// (`user@host:path`). It returns false if the URL is neither.
+func sshAddress(repoURL string) (addr, user string, ok bool) {
+	user = defaultUsername
+	// An scp-like address parses as a URL, with the host as the
+	// scheme and the rest opaque
+	if parsed, err := url.Parse(repoURL); err == nil && parsed.Scheme != "" && parsed.Opaque == "" {
+		switch parsed.Scheme {
+		case "ssh", "git+ssh", "ssh+git":
+		default:
+			return "", "", false
+		}
+		if parsed.User != nil {
+			user = parsed.User.Username()
+		}
+		port := parsed.Port()
+		if port == "" {
+			port = "22"
+		}
+		return net.JoinHostPort(parsed.Hostname(), port), user, parsed.Hostname() != ""
+	}
+	i := strings.Index(repoURL, ":")
+	if i <= 0 || strings.Contains(repoURL[:i], "/") {
+		return "", "", false
+	}
+	host := repoURL[:i]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		user, host = host[:at], host[at+1:]
+	}
+	return net.JoinHostPort(host, "22"), user, host != ""
+}
+
+// AuthConfig says where to find the credentials, and the host keys,
+// to use with a repo.
+type AuthConfig struct {
+	// Username is given with the password, for HTTPS URLs
+	Username string `yaml:"username"`
+	// The password or token, for HTTPS URLs, is read from either a
+	// file (e.g., mounted from a secret), or an environment variable
+	PasswordFile string `yaml:"passwordFile"`
+	PasswordEnv  string `yaml:"passwordEnv"`
+	// Host keys to trust, for SSH URLs, given either as a known_hosts
+	// file, or as fingerprints
+	KnownHostsFile      string   `yaml:"knownHostsFile"`
+	HostKeyFingerprints []string `yaml:"hostKeyFingerprints"`
+}
+
+// Auth checks the config makes sense for the URL given, and returns
+// the Auth it describes, with the password read from wherever it is
+// given. If the SSH host keys are given as fingerprints, the keys
+// that match will be written to pinnedKnownHostsFile.
+func (c AuthConfig) Auth(repoURL, pinnedKnownHostsFile string) (Auth, error) {
+	auth := Auth{
+		Username:            c.Username,
+		KnownHostsFile:      c.KnownHostsFile,
+		HostKeyFingerprints: c.HostKeyFingerprints,
+	}
+	isHTTPS := strings.HasPrefix(repoURL, "https://")
+
+	if c.Username != "" || c.PasswordFile != "" || c.PasswordEnv != "" {
+		switch {
+		case !isHTTPS:
+			return Auth{}, fmt.Errorf("a username and password can only be given for https:// URLs, not %s", repoURL)
+		case c.PasswordFile != "" && c.PasswordEnv != "":
+			return Auth{}, errors.New("the password can be given by a file, or an environment variable, but not both")
+		case c.PasswordFile != "":
+			bytes, err := ioutil.ReadFile(c.PasswordFile)
+			if err != nil {
+				return Auth{}, errors.Wrap(err, "reading password file")
+			}
+			auth.Password = strings.TrimSpace(string(bytes))
+		case c.PasswordEnv != "":
+			auth.Password = os.Getenv(c.PasswordEnv)
+		}
+		if auth.Password == "" {
+			return Auth{}, fmt.Errorf("no password given for %s", repoURL)
+		}
+	}
+
+	if c.KnownHostsFile != "" || len(c.HostKeyFingerprints) > 0 {
+		if _, _, ok := sshAddress(repoURL); !ok {
+			return Auth{}, fmt.Errorf("host keys can only be given for SSH URLs, not %s", repoURL)
+		}
+		if c.KnownHostsFile != "" && len(c.HostKeyFingerprints) > 0 {
+			return Auth{}, errors.New("host keys can be given by a known_hosts file, or by fingerprints, but not both")
+		}
+		for _, f := range c.HostKeyFingerprints {
+			if !strings.HasPrefix(f, "SHA256:") {
+				return Auth{}, fmt.Errorf("host key fingerprint %q is not a SHA256 fingerprint, as printed by ssh-keygen -l", f)
+			}
+		}
+		if len(c.HostKeyFingerprints) > 0 {
+			auth.KnownHostsFile = pinnedKnownHostsFile
+		}
+	}
+	return auth, nil
+}
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+)
+
+func TestAuthConfig(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	passwordFile := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("FLUX_TEST_GIT_TOKEN", "t0k3n")
+	defer os.Unsetenv("FLUX_TEST_GIT_TOKEN")
+
+	for _, c := range []struct {
+		url      string
+		config   AuthConfig
+		expected Auth
+	}{
+		{"git@github.com:example/repo", AuthConfig{}, Auth{}},
+		{"https://git.example.com/repo.git", AuthConfig{Username: "flux", PasswordFile: passwordFile},
+			Auth{Username: "flux", Password: "s3cr3t"}},
+		{"https://git.example.com/repo.git", AuthConfig{PasswordEnv: "FLUX_TEST_GIT_TOKEN"},
+			Auth{Password: "t0k3n"}},
+		{"ssh://git@git.example.com:2222/repo", AuthConfig{KnownHostsFile: "/etc/fluxd/known_hosts"},
+			Auth{KnownHostsFile: "/etc/fluxd/known_hosts"}},
+		{"git@git.example.com:repo", AuthConfig{HostKeyFingerprints: []string{"SHA256:abc"}},
+			Auth{KnownHostsFile: "/var/fluxd/keygen/known_hosts", HostKeyFingerprints: []string{"SHA256:abc"}}},
+	} {
+		auth, err := c.config.Auth(c.url, "/var/fluxd/keygen/known_hosts")
+		if err != nil {
+			t.Errorf("%s %+v: %s", c.url, c.config, err)
+			continue
+		}
+		if auth.Username != c.expected.Username || auth.Password != c.expected.Password ||
+			auth.KnownHostsFile != c.expected.KnownHostsFile || len(auth.HostKeyFingerprints) != len(c.expected.HostKeyFingerprints) {
+			t.Errorf("%s %+v: expected %+v, got %+v", c.url, c.config, c.expected, auth)
+		}
+	}
+
+	for _, c := range []struct {
+		url    string
+		config AuthConfig
+	}{
+		{"git@github.com:example/repo", AuthConfig{Username: "flux", PasswordFile: passwordFile}},
+		{"https://git.example.com/repo.git", AuthConfig{PasswordFile: passwordFile, PasswordEnv: "FLUX_TEST_GIT_TOKEN"}},
+		{"https://git.example.com/repo.git", AuthConfig{PasswordFile: filepath.Join(dir, "nonexistent")}},
+		{"https://git.example.com/repo.git", AuthConfig{Username: "flux", PasswordEnv: "FLUX_TEST_GIT_UNSET"}},
+		{"https://git.example.com/repo.git", AuthConfig{KnownHostsFile: "/etc/fluxd/known_hosts"}},
+		{"git@github.com:example/repo", AuthConfig{KnownHostsFile: "/etc/fluxd/known_hosts", HostKeyFingerprints: []string{"SHA256:abc"}}},
+		{"git@github.com:example/repo", AuthConfig{HostKeyFingerprints: []string{"16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48"}}},
+	} {
+		if _, err := c.config.Auth(c.url, "/var/fluxd/keygen/known_hosts"); err == nil {
+			t.Errorf("%s %+v: expected error", c.url, c.config)
+		}
+	}
+}
+
+func TestSSHAddress(t *testing.T) {
+	for url, expected := range map[string][2]string{
+		"git@github.com:weaveworks/flux":            {"github.com:22", "git"},
+		"github.com:weaveworks/flux":                {"github.com:22", "git"},
+		"ssh://git@github.com/weaveworks/flux":      {"github.com:22", "git"},
+		"ssh://flux@git.example.com:2222/repo":      {"git.example.com:2222", "flux"},
+		"git+ssh://git.example.com/weaveworks/flux": {"git.example.com:22", "git"},
+	} {
+		addr, user, ok := sshAddress(url)
+		if !ok || addr != expected[0] || user != expected[1] {
+			t.Errorf("%s: expected %v, got %s, %s (%v)", url, expected, addr, user, ok)
+		}
+	}
+	for _, url := range []string{
+		"https://github.com/weaveworks/flux",
+		"/home/flux/repo",
+		"file:///home/flux/repo",
+	} {
+		if _, _, ok := sshAddress(url); ok {
+			t.Errorf("%s: expected not to be taken as an SSH URL", url)
+		}
+	}
+}
+
+// serveSSH accepts SSH connections on a local port, presenting the
+// host key given, and refusing to authenticate anyone.
+func serveSSH(t *testing.T, hostKey ssh.Signer) (addr string, stop func()) {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, errors.New("no one is allowed in")
+		},
+	}
+	config.AddHostKey(hostKey)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestPinHostKeys(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, stop := serveSSH(t, hostKey)
+	defer stop()
+	_, port, _ := net.SplitHostPort(addr)
+	url := "ssh://git@127.0.0.1:" + port + "/repo"
+
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	knownHosts := filepath.Join(dir, "known_hosts")
+
+	fingerprint := ssh.FingerprintSHA256(hostKey.PublicKey())
+	auth := Auth{KnownHostsFile: knownHosts, HostKeyFingerprints: []string{fingerprint}}
+	if err := auth.pinHostKeys(context.Background(), url); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := ioutil.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hosts, key, _, _, err := ssh.ParseKnownHosts(bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0] != "[127.0.0.1]:"+port || ssh.FingerprintSHA256(key) != fingerprint {
+		t.Errorf("expected the host key for [127.0.0.1]:%s to be pinned, got %q", port, string(bytes))
+	}
+
+	os.Remove(knownHosts)
+	auth.HostKeyFingerprints = []string{"SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"}
+	if err := auth.pinHostKeys(context.Background(), url); err == nil {
+		t.Error("expected error when the host key doesn't match the fingerprint")
+	}
+	if _, err := os.Stat(knownHosts); !os.IsNotExist(err) {
+		t.Error("expected no known hosts to be written when the host key doesn't match")
+	}
+}
+
+func TestMirrorHTTPSAuth(t *testing.T) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is needed to serve the repo")
+	}
+	reposDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	repoDir := filepath.Join(reposDir, "repo")
+	if err := os.Mkdir(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRepo(repoDir, []string{"another"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + reposDir, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "flux" || password != "t0k3n" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	// The test server's http:// URL needs the same credentials as an https:// URL would
+	origin := Remote{URL: server.URL + "/repo/.git"}
+
+	for _, c := range []struct {
+		auth Auth
+		ok   bool
+	}{
+		{Auth{}, false},
+		{Auth{Username: "flux", Password: "wrong"}, false},
+		{Auth{Username: "flux", Password: "t0k3n"}, true},
+	} {
+		dir, cleanup := testfiles.TempDir(t)
+		origin.Auth = c.auth
+		_, err := mirror(context.Background(), dir, origin)
+		cleanup()
+		if c.ok && err != nil {
+			t.Errorf("with %+v: expected mirroring to succeed, got %s", c.auth, err)
+		} else if !c.ok && err == nil {
+			t.Errorf("with %+v: expected mirroring to fail", c.auth)
+		}
+		if err != nil && strings.Contains(err.Error(), "t0k3n") {
+			t.Errorf("expected the password not to appear in the error, got %s", err)
+		}
+	}
+}
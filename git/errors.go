@@ -2,6 +2,7 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	fluxerr "github.com/weaveworks/flux/errors"
@@ -54,10 +55,12 @@ write to the upstream git repository.
 	if strings.HasPrefix(url, "http://") ||
 		strings.HasPrefix(url, "https://") {
 		help = help + `
-Usually, git URLs starting with "http://" or "https://" will not work
-well with flux, because they require the user to supply credentials
-interactively. If possible, use an SSH URL (starting with "ssh://", or
-of the form "user@host:path/to/repo").
+Git URLs starting with "http://" or "https://" need credentials to be
+supplied, since they can't be given interactively. For an "https://"
+URL, give the daemon a username and password (or token) with
+--git-https-username and --git-https-password-file; and check that
+they allow pushing to the repository. Otherwise, use an SSH URL
+(starting with "ssh://", or of the form "user@host:path/to/repo").
 `
 	} else {
 		help = help + `
@@ -119,3 +122,28 @@ check the box to allow write access.
 `,
 	}
 }
+
+func UnverifiedCommitError(revision, problem string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("commit %s %s", revision, problem),
+		Help: `Refusing to sync a commit that isn't signed by a trusted key
+
+The daemon was started with --git-verify-signatures, so it will only
+sync a revision if it, and every commit since the last revision
+trusted, has a good signature made by a key in its GPG keyring. This
+commit
+
+    ` + revision + `
+
+` + problem + `, so nothing after the last revision synced will be
+applied until the problem is fixed.
+
+If the commit should be trusted, check that the public key it's signed
+with was imported, with --git-gpg-key-import. Otherwise, the branch
+will need to be rewritten so that the commit is removed or signed; or,
+if you've checked the commit yourself, the sync tag moved past it,
+with a tag signed by a key in the keyring.
+`,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -65,6 +66,82 @@ func TestCommit(t *testing.T) {
 	}
 }
 
+func TestCommitAndPushBranch(t *testing.T) {
+	checkout, repo, cleanup := CheckoutWithConfig(t, TestConfig)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	head, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propose := func(change string) git.PushedBranch {
+		// So the notes pushed already are known
+		if err := repo.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+		co, err := repo.Clone(ctx, TestConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer co.Clean()
+		// The same file each time
+		var files []string
+		for file := range testfiles.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		if err := ioutil.WriteFile(filepath.Join(co.ManifestDir(), files[0]), []byte(change), 0666); err != nil {
+			t.Fatal(err)
+		}
+		branch, err := co.CommitAndPushBranch(ctx, git.CommitAction{Message: "Proposed change"}, &Note{Comment: "proposed"}, "flux-propose/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return branch
+	}
+
+	first := propose("PROPOSED CHANGE")
+	if first.Name != "flux-propose/test" || first.Existed || first.Updated || first.Revision == "" || first.Revision == head {
+		t.Errorf("expected a new branch to be pushed, got %+v", first)
+	}
+
+	// The same change again goes to the same branch, which is left as
+	// it is
+	second := propose("PROPOSED CHANGE")
+	if second.Name != first.Name || !second.Existed || second.Revision != first.Revision {
+		t.Errorf("expected the branch %+v to be found, got %+v", first, second)
+	}
+
+	// A different change replaces what's on the branch
+	third := propose("ANOTHER PROPOSED CHANGE")
+	if third.Name != first.Name || third.Existed || !third.Updated || third.Revision == first.Revision {
+		t.Errorf("expected the branch %+v to be replaced, got %+v", first, third)
+	}
+
+	// ... and the branch synced is left alone
+	if err := repo.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := repo.Revision(ctx, TestConfig.Branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != head {
+		t.Errorf("expected %s to be at %s still, got %s", TestConfig.Branch, head, rev)
+	}
+	proposed, err := repo.Revision(ctx, third.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposed != third.Revision {
+		t.Errorf("expected the branch %s to be at %s, got %s", third.Name, third.Revision, proposed)
+	}
+}
+
 func TestCheckout(t *testing.T) {
 	repo, cleanup := Repo(t)
 	defer cleanup()
@@ -175,3 +252,65 @@ func TestCheckout(t *testing.T) {
 	close(sd)
 	sg.Wait()
 }
+
+func TestExport(t *testing.T) {
+	checkout, _, cleanup := CheckoutWithConfig(t, TestConfig)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before, err := checkout.HeadRevision(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changedFile string
+	for file := range testfiles.Files {
+		changedFile = file
+		break
+	}
+	path := filepath.Join(checkout.ManifestDir(), changedFile)
+	if err := ioutil.WriteFile(path, []byte("CHANGED"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout.CommitAndPush(ctx, git.CommitAction{Message: "Changed file"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := checkout.Export(ctx, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Clean()
+
+	contents, err := ioutil.ReadFile(filepath.Join(export.ManifestDir(), changedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != testfiles.Files[changedFile] {
+		t.Errorf("expected exported file to be as it was before the commit, got %q", string(contents))
+	}
+	contents, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "CHANGED" {
+		t.Errorf("expected file in checkout to be untouched, got %q", string(contents))
+	}
+
+	// Once cleaned up, git forgets about the export
+	export.Clean()
+	worktrees, _ := ioutil.ReadDir(filepath.Join(checkout.Dir(), ".git", "worktrees"))
+	if len(worktrees) != 0 {
+		t.Errorf("expected no working trees to be recorded after clean, got %d", len(worktrees))
+	}
+
+	// A revision can't be taken as an option
+	if _, err := checkout.Export(ctx, "--orphan=x"); err == nil {
+		t.Error("expected error exporting a revision that looks like an option")
+	}
+	if _, err := checkout.Export(ctx, "no-such-revision"); err == nil {
+		t.Error("expected error exporting a revision that doesn't exist")
+	}
+}
@@ -0,0 +1,149 @@
+// Package mergerequest opens merge requests (or, as GitHub calls
+// them, pull requests) for branches pushed to a git host, by using
+// the host's API.
+package mergerequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/git"
+)
+
+// The hosts merge requests can be opened on.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+const requestTimeout = 20 * time.Second
+
+// Opener opens merge requests in a repo.
+type Opener interface {
+	// Open opens a merge request to merge the branch given into the
+	// base branch, and returns the URL of the merge request.
+	Open(ctx context.Context, branch, base, title, description string) (string, error)
+}
+
+// New returns an Opener for the repo at the remote given, on the
+// host given (GitHub or GitLab), which authenticates with the token
+// given. For GitHub, the API of hosts other than github.com is taken
+// to be that of GitHub Enterprise.
+func New(host string, remote git.Remote, token string) (Opener, error) {
+	hostname, path, ok := remote.HostAndPath()
+	if !ok {
+		return nil, fmt.Errorf("merge requests can only be opened for repos on a host, not %s", remote.URL)
+	}
+	if token == "" {
+		return nil, errors.New("no token given for opening merge requests")
+	}
+	switch host {
+	case GitHub:
+		api := "https://api.github.com"
+		if hostname != "github.com" {
+			api = "https://" + hostname + "/api/v3"
+		}
+		return &github{api: api, repo: path, token: token, client: http.DefaultClient}, nil
+	case GitLab:
+		return &gitlab{api: "https://" + hostname + "/api/v4", project: path, token: token, client: http.DefaultClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown host %q for merge requests; expected %q or %q", host, GitHub, GitLab)
+	}
+}
+
+// github opens pull requests with the GitHub API.
+type github struct {
+	api    string
+	repo   string // e.g., weaveworks/flux
+	token  string
+	client *http.Client
+}
+
+func (g *github) Open(ctx context.Context, branch, base, title, description string) (string, error) {
+	var created struct {
+		URL string `json:"html_url"`
+	}
+	err := postJSON(ctx, g.client, g.api+"/repos/"+g.repo+"/pulls", map[string]string{
+		"Authorization": "token " + g.token,
+		"Accept":        "application/vnd.github.v3+json",
+	}, map[string]string{
+		"title": title,
+		"head":  branch,
+		"base":  base,
+		"body":  description,
+	}, &created)
+	if err != nil {
+		return "", errors.Wrap(err, "opening pull request")
+	}
+	return created.URL, nil
+}
+
+// gitlab opens merge requests with the GitLab API.
+type gitlab struct {
+	api     string
+	project string // the path, e.g., weaveworks/flux
+	token   string
+	client  *http.Client
+}
+
+func (g *gitlab) Open(ctx context.Context, branch, base, title, description string) (string, error) {
+	var created struct {
+		URL string `json:"web_url"`
+	}
+	err := postJSON(ctx, g.client, g.api+"/projects/"+url.PathEscape(g.project)+"/merge_requests", map[string]string{
+		"Private-Token": g.token,
+	}, map[string]string{
+		"title":         title,
+		"source_branch": branch,
+		"target_branch": base,
+		"description":   description,
+	}, &created)
+	if err != nil {
+		return "", errors.Wrap(err, "opening merge request")
+	}
+	return created.URL, nil
+}
+
+// postJSON posts the body given, as JSON, and decodes the JSON
+// response into the value given. Responses other than 2xx are
+// errors, including what the API said in the response.
+func postJSON(ctx context.Context, client *http.Client, u string, headers map[string]string, body, into interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s from %s: %s", resp.Status, u, strings.TrimSpace(string(respBody)))
+	}
+	return json.Unmarshal(respBody, into)
+}
@@ -0,0 +1,94 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/flux/git"
+)
+
+func TestNew(t *testing.T) {
+	for _, c := range []struct {
+		host, url, api string
+	}{
+		{GitHub, "git@github.com:weaveworks/flux", "https://api.github.com"},
+		{GitHub, "ssh://git@github.example.com/team/config", "https://github.example.com/api/v3"},
+		{GitLab, "https://gitlab.com/team/sub/config.git", "https://gitlab.com/api/v4"},
+	} {
+		opener, err := New(c.host, git.Remote{URL: c.url}, "t0k3n")
+		if err != nil {
+			t.Errorf("%s %s: %s", c.host, c.url, err)
+			continue
+		}
+		var api string
+		switch o := opener.(type) {
+		case *github:
+			api = o.api
+		case *gitlab:
+			api = o.api
+		}
+		if api != c.api {
+			t.Errorf("%s %s: expected API at %s, got %s", c.host, c.url, c.api, api)
+		}
+	}
+
+	for _, c := range []struct {
+		host, url, token string
+	}{
+		{"bitbucket", "git@bitbucket.org:team/config", "t0k3n"},
+		{GitHub, "/home/flux/config", "t0k3n"},
+		{GitHub, "git@github.com:weaveworks/flux", ""},
+	} {
+		if _, err := New(c.host, git.Remote{URL: c.url}, c.token); err == nil {
+			t.Errorf("%s %s: expected error", c.host, c.url)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization") + r.Header.Get("Private-Token")
+		gotBody = nil
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		if gotAuth == "token wrong" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/weaveworks/flux/pull/1", "web_url": "https://gitlab.com/team/sub/config/merge_requests/1"}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	gh := &github{api: server.URL, repo: "weaveworks/flux", token: "t0k3n", client: server.Client()}
+	u, err := gh.Open(ctx, "flux-propose/abc", "master", "Release", "Proposed by flux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://github.com/weaveworks/flux/pull/1" || gotPath != "/repos/weaveworks/flux/pulls" || gotAuth != "token t0k3n" ||
+		gotBody["head"] != "flux-propose/abc" || gotBody["base"] != "master" || gotBody["title"] != "Release" {
+		t.Errorf("unexpected pull request: %s %s %q %v -> %s", gotPath, gotAuth, gotBody, err, u)
+	}
+
+	gl := &gitlab{api: server.URL, project: "team/sub/config", token: "t0k3n", client: server.Client()}
+	u, err = gl.Open(ctx, "flux-propose/abc", "master", "Release", "Proposed by flux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "https://gitlab.com/team/sub/config/merge_requests/1" || gotPath != "/projects/team%2Fsub%2Fconfig/merge_requests" || gotAuth != "t0k3n" ||
+		gotBody["source_branch"] != "flux-propose/abc" || gotBody["target_branch"] != "master" {
+		t.Errorf("unexpected merge request: %s %s %q -> %s", gotPath, gotAuth, gotBody, u)
+	}
+
+	gh.token = "wrong"
+	if _, err := gh.Open(ctx, "flux-propose/abc", "master", "Release", ""); err == nil {
+		t.Error("expected error when the API refuses the request")
+	}
+}
@@ -0,0 +1,27 @@
+package git
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	fetchDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "git",
+		Name:      "fetch_duration_seconds",
+		Help:      "Duration of fetches from the upstream git repo into the mirror, in seconds.",
+		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 15, 20},
+	}, []string{fluxmetrics.LabelSuccess})
+
+	// How far the mirror lags behind the upstream repo is, at most,
+	// the time since the last successful fetch.
+	lastFetch = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "git",
+		Name:      "last_fetch_timestamp_seconds",
+		Help:      "Time of the last successful fetch from the upstream git repo into the mirror, as a Unix timestamp.",
+	}, []string{fluxmetrics.LabelURL})
+)
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"strings"
 
@@ -43,11 +44,11 @@ func clone(ctx context.Context, workingDir, repoURL, repoBranch string) (path st
 	return repoPath, nil
 }
 
-func mirror(ctx context.Context, workingDir, repoURL string) (path string, err error) {
+func mirror(ctx context.Context, workingDir string, origin Remote) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone", "--mirror"}
-	args = append(args, repoURL, repoPath)
-	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
+	args = append(args, origin.URL, repoPath)
+	if err := execGitRemoteCmd(ctx, workingDir, nil, origin.Auth, args...); err != nil {
 		return "", errors.Wrap(err, "git clone --mirror")
 	}
 	return repoPath, nil
@@ -56,58 +57,89 @@ func mirror(ctx context.Context, workingDir, repoURL string) (path string, err e
 // checkPush sanity-checks that we can write to the upstream repo
 // (being able to `clone` is an adequate check that we can read the
 // upstream).
-func checkPush(ctx context.Context, workingDir, upstream string) error {
+func checkPush(ctx context.Context, workingDir string, upstream Remote) error {
 	// --force just in case we fetched the tag from upstream when cloning
 	if err := execGitCmd(ctx, workingDir, nil, "tag", "--force", CheckPushTag); err != nil {
 		return errors.Wrap(err, "tag for write check")
 	}
-	if err := execGitCmd(ctx, workingDir, nil, "push", "--force", upstream, "tag", CheckPushTag); err != nil {
+	if err := execGitRemoteCmd(ctx, workingDir, nil, upstream.Auth, "push", "--force", upstream.URL, "tag", CheckPushTag); err != nil {
 		return errors.Wrap(err, "attempt to push tag")
 	}
-	return execGitCmd(ctx, workingDir, nil, "push", "--delete", upstream, "tag", CheckPushTag)
+	return execGitRemoteCmd(ctx, workingDir, nil, upstream.Auth, "push", "--delete", upstream.URL, "tag", CheckPushTag)
 }
 
 func commit(ctx context.Context, workingDir string, commitAction CommitAction) error {
-	commitAuthor := commitAction.Author
-	if commitAuthor != "" {
-		if err := execGitCmd(ctx,
-			workingDir, nil,
-			"commit",
-			"--no-verify", "-a", "--author", commitAuthor, "-m", commitAction.Message,
-		); err != nil {
-			return errors.Wrap(err, "git commit")
-		}
-		return nil
+	args := []string{"commit", "--no-verify", "-a", "-m", commitAction.Message}
+	if commitAction.Author != "" {
+		args = append(args, "--author", commitAction.Author)
+	}
+	if commitAction.SigningKey != "" {
+		args = append(args, "--gpg-sign="+commitAction.SigningKey)
 	}
-	if err := execGitCmd(ctx,
-		workingDir, nil,
-		"commit",
-		"--no-verify", "-a", "-m", commitAction.Message,
-	); err != nil {
+	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
 		return errors.Wrap(err, "git commit")
 	}
 	return nil
 }
 
 // push the refs given to the upstream repo
-func push(ctx context.Context, workingDir, upstream string, refs []string) error {
-	args := append([]string{"push", upstream}, refs...)
-	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
+func push(ctx context.Context, workingDir string, upstream Remote, refs []string) error {
+	args := append([]string{"push", upstream.URL}, refs...)
+	if err := execGitRemoteCmd(ctx, workingDir, nil, upstream.Auth, args...); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream.URL, refs))
+	}
+	return nil
+}
+
+// worktree checks out the revision given into the (empty or absent)
+// directory given, as a working tree separate from the one in
+// workingDir. The revision is resolved to a commit first, so that
+// whatever it is, it can't be taken as an option.
+func worktree(ctx context.Context, workingDir, dir, rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("invalid revision %q", rev)
+	}
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, workingDir, out, "rev-parse", "--verify", rev+"^{commit}"); err != nil {
+		return errors.Wrap(err, "git rev-parse "+rev)
+	}
+	commit := strings.TrimSpace(out.String())
+	if err := execGitCmd(ctx, workingDir, nil, "worktree", "add", "--detach", dir, commit); err != nil {
+		return errors.Wrap(err, "git worktree add "+rev)
 	}
 	return nil
 }
 
-// fetch updates refs from the upstream.
-func fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
+// pruneWorktrees removes what git knows about working trees (added
+// with `worktree` above) that have since been removed.
+func pruneWorktrees(ctx context.Context, workingDir string) error {
+	if err := execGitCmd(ctx, workingDir, nil, "worktree", "prune"); err != nil {
+		return errors.Wrap(err, "git worktree prune")
+	}
+	return nil
+}
+
+// fetch updates refs from the upstream, which is given by name or
+// URL, using the auth given.
+func fetch(ctx context.Context, workingDir, upstream string, auth Auth, refspec ...string) error {
 	args := append([]string{"fetch", "--tags", upstream}, refspec...)
-	if err := execGitCmd(ctx, workingDir, nil, args...); err != nil &&
-		!strings.Contains(err.Error(), "Couldn't find remote ref") {
+	if err := execGitRemoteCmd(ctx, workingDir, nil, auth, args...); err != nil &&
+		!strings.Contains(strings.ToLower(err.Error()), "couldn't find remote ref") {
 		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
 	}
 	return nil
 }
 
+// fetchRef gets the commits at the ref given from the upstream, so
+// they can be looked at; unlike `fetch`, it updates no refs or tags
+// (besides FETCH_HEAD).
+func fetchRef(ctx context.Context, workingDir string, upstream Remote, ref string) error {
+	if err := execGitRemoteCmd(ctx, workingDir, nil, upstream.Auth, "fetch", "--no-tags", upstream.URL, ref); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git fetch %s %s", upstream.URL, ref))
+	}
+	return nil
+}
+
 func refExists(ctx context.Context, workingDir, ref string) (bool, error) {
 	if err := execGitCmd(ctx, workingDir, nil, "rev-list", ref); err != nil {
 		if strings.Contains(err.Error(), "unknown revision") {
@@ -177,6 +209,31 @@ func refRevision(ctx context.Context, path, ref string) (string, error) {
 	return strings.TrimSpace(out.String()), nil
 }
 
+// remoteRevision asks the upstream for the revision of the ref given,
+// and returns the empty string if there's no such ref.
+func remoteRevision(ctx context.Context, workingDir string, upstream Remote, ref string) (string, error) {
+	out := &bytes.Buffer{}
+	if err := execGitRemoteCmd(ctx, workingDir, out, upstream.Auth, "ls-remote", upstream.URL, ref); err != nil {
+		return "", errors.Wrap(err, "git ls-remote "+ref)
+	}
+	for _, line := range splitList(out.String()) {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", nil
+}
+
+// treeRevision gives the hash of the tree (i.e., the files) at the
+// ref given.
+func treeRevision(ctx context.Context, path, ref string) (string, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(ctx, path, out, "rev-parse", "--verify", ref+"^{tree}"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
 func revlist(ctx context.Context, path, ref string) ([]string, error) {
 	out := &bytes.Buffer{}
 	if err := execGitCmd(ctx, path, out, "rev-list", ref); err != nil {
@@ -226,17 +283,73 @@ func splitList(s string) []string {
 	return strings.Split(outStr, "\n")
 }
 
-// Move the tag to the ref given and push that tag upstream
-func moveTagAndPush(ctx context.Context, path string, tag, ref, msg, upstream string) error {
-	if err := execGitCmd(ctx, path, nil, "tag", "--force", "-a", "-m", msg, tag, ref); err != nil {
+// Move the tag to the ref given and push that tag upstream. If a
+// signing key is given, the tag is signed with it.
+func moveTagAndPush(ctx context.Context, path string, tag, ref, msg string, upstream Remote, signingKey string) error {
+	args := []string{"tag", "--force", "-a", "-m", msg}
+	if signingKey != "" {
+		args = append(args, "--local-user="+signingKey)
+	}
+	args = append(args, tag, ref)
+	if err := execGitCmd(ctx, path, nil, args...); err != nil {
 		return errors.Wrap(err, "moving tag "+tag)
 	}
-	if err := execGitCmd(ctx, path, nil, "push", "--force", upstream, "tag", tag); err != nil {
+	if err := execGitRemoteCmd(ctx, path, nil, upstream.Auth, "push", "--force", upstream.URL, "tag", tag); err != nil {
 		return errors.Wrap(err, "pushing tag to origin")
 	}
 	return nil
 }
 
+// signatureProblems describes each signature status given by `git
+// log --format=%G?`, other than those which are good: G (valid) and U
+// (valid, but for a key of unknown trust, which is how keys imported
+// into the keyring are, unless they're also given trust).
+var signatureProblems = map[string]string{
+	"B": "has a bad signature",
+	"X": "has a good signature that has expired",
+	"Y": "has a good signature made by a key that has since expired",
+	"R": "has a good signature made by a key that has been revoked",
+	"E": "is signed with a key that isn't in the keyring",
+	"N": "is not signed",
+}
+
+// verifyCommits checks the signature of each commit given by the
+// refspec, in the order (newest first) `git log` gives them, and
+// returns an error about the first without a good signature.
+func verifyCommits(ctx context.Context, path string, refspec ...string) error {
+	out := &bytes.Buffer{}
+	args := append([]string{"log", "--format=%H %G?"}, refspec...)
+	if err := execGitCmd(ctx, path, out, args...); err != nil {
+		return err
+	}
+	for _, line := range splitList(out.String()) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("unexpected output from git log: %q", line)
+		}
+		if problem, bad := signatureProblems[fields[1]]; bad {
+			return UnverifiedCommitError(fields[0], problem)
+		} else if fields[1] != "G" && fields[1] != "U" {
+			return UnverifiedCommitError(fields[0], "has a signature of unknown status "+fields[1])
+		}
+	}
+	return nil
+}
+
+// verifyTag checks that the tag given is signed by a key in the
+// keyring, and returns the commit it points at.
+func verifyTag(ctx context.Context, path, tag string) (string, error) {
+	if err := execGitCmd(ctx, path, nil, "verify-tag", tag); err != nil {
+		return "", errors.Wrap(err, "verifying tag "+tag)
+	}
+	return refRevision(ctx, path, tag)
+}
+
+// hasCommit reports whether the commit given is in the repo.
+func hasCommit(ctx context.Context, path, rev string) bool {
+	return execGitCmd(ctx, path, nil, "cat-file", "-e", rev+"^{commit}") == nil
+}
+
 func changedFiles(ctx context.Context, path, subPath, ref string) ([]string, error) {
 	// Remove leading slash if present. diff doesn't work when using github style root paths.
 	if len(subPath) > 0 && subPath[0] == '/' {
@@ -253,6 +366,12 @@ func changedFiles(ctx context.Context, path, subPath, ref string) ([]string, err
 }
 
 func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	return execGitRemoteCmd(ctx, dir, out, Auth{}, args...)
+}
+
+// execGitRemoteCmd runs a git command that talks to a remote, with
+// the auth given for it.
+func execGitRemoteCmd(ctx context.Context, dir string, out io.Writer, auth Auth, args ...string) error {
 	if trace {
 		print("TRACE: git")
 		for _, arg := range args {
@@ -260,12 +379,12 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 		}
 		println()
 	}
-	c := exec.CommandContext(ctx, "git", args...)
+	c := exec.CommandContext(ctx, "git", append(auth.args(), args...)...)
 
 	if dir != "" {
 		c.Dir = dir
 	}
-	c.Env = env()
+	c.Env = append(env(), auth.env()...)
 	c.Stdout = ioutil.Discard
 	if out != nil {
 		c.Stdout = out
@@ -289,7 +408,13 @@ func execGitCmd(ctx context.Context, dir string, out io.Writer, args ...string)
 }
 
 func env() []string {
-	return []string{"GIT_TERMINAL_PROMPT=0"}
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	// gpg, which git runs to sign and verify commits, looks here for
+	// the keyring if it's set, so let it through.
+	if home, ok := os.LookupEnv("GNUPGHOME"); ok {
+		env = append(env, "GNUPGHOME="+home)
+	}
+	return env
 }
 
 // check returns true if there are changes locally.
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/weaveworks/flux/cluster/kubernetes/testfiles"
+	"github.com/weaveworks/flux/gpg/gpgtest"
 )
 
 const (
@@ -210,12 +211,60 @@ func TestCheckPush(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = checkPush(context.Background(), working, upstreamDir)
+	err = checkPush(context.Background(), working, Remote{URL: upstreamDir})
 	if err != nil {
 		t.Fatal(err)
 	}
 }
 
+func TestVerifyCommits(t *testing.T) {
+	signingKey, gpgCleanup := gpgtest.GPGKey(t)
+	defer gpgCleanup()
+
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	if err := createRepo(newDir, []string{"config"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := updateFile(filepath.Join(newDir, "config"), map[string]string{"signed.yaml": fmt.Sprintf("revision: %d\n", i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := execCommand("git", "-C", newDir, "add", "--all"); err != nil {
+			t.Fatal(err)
+		}
+		if err := commit(ctx, newDir, CommitAction{Message: "Signed revision", SigningKey: signingKey}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := verifyCommits(ctx, newDir, "HEAD~2..HEAD"); err != nil {
+		t.Errorf("expected signed commits to verify, got %s", err)
+	}
+	if err := verifyCommits(ctx, newDir, "HEAD~3..HEAD"); err == nil {
+		t.Error("expected unsigned commit to fail verification")
+	}
+
+	if err := execCommand("git", "-C", newDir, "tag", "-a", "-m", "unsigned", "unsigned", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyTag(ctx, newDir, "unsigned"); err == nil {
+		t.Error("expected unsigned tag to fail verification")
+	}
+	if err := execCommand("git", "-C", newDir, "tag", "-s", "-u", signingKey, "-m", "signed", "signed", "HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := verifyTag(ctx, newDir, "signed")
+	if err != nil {
+		t.Fatalf("expected signed tag to verify, got %s", err)
+	}
+	if parent, _ := refRevision(ctx, newDir, "HEAD~1"); rev != parent {
+		t.Errorf("expected signed tag to give %s, got %s", parent, rev)
+	}
+}
+
 func createRepo(dir string, subdirs []string) error {
 	var (
 		err      error
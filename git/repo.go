@@ -2,12 +2,17 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 
 	"context"
 	"time"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
 )
 
 const (
@@ -47,7 +52,51 @@ const (
 
 // Remote points at a git repo somewhere.
 type Remote struct {
-	URL string // clone from here
+	URL  string // clone from here
+	Auth Auth   // and authenticate like this, if need be
+}
+
+// Equivalent says whether the URL given points at the same repo as
+// the remote, though it may be written differently; e.g.,
+// `git@github.com:weaveworks/flux` and
+// `https://github.com/weaveworks/flux.git` are equivalent.
+func (r Remote) Equivalent(u string) bool {
+	return strings.EqualFold(canonicalURL(r.URL), canonicalURL(u))
+}
+
+// HostAndPath returns the host of the remote, and the path of the
+// repo on that host, without any `.git` suffix; e.g., `github.com`
+// and `weaveworks/flux`. It returns false if the URL can't be parsed
+// as a URL or an scp-like address (`user@host:path`), which means it's
+// a local path.
+func (r Remote) HostAndPath() (host, path string, ok bool) {
+	return splitURL(r.URL)
+}
+
+func splitURL(u string) (host, path string, ok bool) {
+	if strings.HasPrefix(u, "file://") {
+		return "", "", false
+	}
+	if parsed, err := url.Parse(u); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+		host, path = parsed.Hostname(), parsed.Path
+	} else if i := strings.Index(u, ":"); i > 0 && !strings.Contains(u[:i], "/") {
+		host, path = u[strings.LastIndex(u[:i], "@")+1:i], u[i+1:]
+	} else {
+		return "", "", false
+	}
+	return host, strings.TrimSuffix(strings.Trim(path, "/"), ".git"), true
+}
+
+// canonicalURL reduces a git URL to its host and path, leaving out
+// the scheme, user, port and any `.git` suffix. What can't be parsed
+// as a URL or an scp-like address (`user@host:path`) is taken to be a
+// local path, and left as it is.
+func canonicalURL(u string) string {
+	host, path, ok := splitURL(u)
+	if !ok {
+		return u
+	}
+	return host + "/" + path
 }
 
 type Repo struct {
@@ -213,7 +262,7 @@ func (r *Repo) Start(shutdown <-chan struct{}, done *sync.WaitGroup) error {
 	for {
 
 		r.mu.RLock()
-		url := r.origin.URL
+		origin := r.origin
 		dir := r.dir
 		status := r.status
 		r.mu.RUnlock()
@@ -233,9 +282,16 @@ func (r *Repo) Start(shutdown <-chan struct{}, done *sync.WaitGroup) error {
 				return err
 			}
 
+			// The host keys are fetched afresh each time, so that keys
+			// rotated by the host are picked up, if they're still pinned
 			ctx, cancel := context.WithTimeout(bg, opTimeout)
-			dir, err = mirror(ctx, rootdir, url)
+			err = origin.Auth.pinHostKeys(ctx, origin.URL)
 			cancel()
+			if err == nil {
+				ctx, cancel := context.WithTimeout(bg, opTimeout)
+				dir, err = mirror(ctx, rootdir, origin)
+				cancel()
+			}
 			if err == nil {
 				r.mu.Lock()
 				r.dir = dir
@@ -254,7 +310,7 @@ func (r *Repo) Start(shutdown <-chan struct{}, done *sync.WaitGroup) error {
 
 		case RepoCloned:
 			ctx, cancel := context.WithTimeout(bg, opTimeout)
-			err := checkPush(ctx, dir, url)
+			err := checkPush(ctx, dir, origin)
 			cancel()
 			if err == nil {
 				r.setReady()
@@ -331,9 +387,17 @@ func (r *Repo) refreshLoop(shutdown <-chan struct{}) error {
 
 // fetch gets updated refs, and associated objects, from the upstream.
 func (r *Repo) fetch(ctx context.Context) error {
-	if err := fetch(ctx, r.dir, "origin"); err != nil {
+	started := time.Now()
+	err := fetch(ctx, r.dir, "origin", r.origin.Auth)
+	fetchDuration.With(
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(started).Seconds())
+	if err != nil {
 		return err
 	}
+	lastFetch.With(
+		fluxmetrics.LabelURL, r.origin.URL,
+	).Set(float64(time.Now().Unix()))
 	return nil
 }
 
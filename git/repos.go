@@ -0,0 +1,75 @@
+package git
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RepoConfig says where to find a git repo, which branch and path in
+// it to use, how often to poll it for changes, and how to
+// authenticate with it.
+type RepoConfig struct {
+	URL          string        `yaml:"url"`
+	Branch       string        `yaml:"branch"`
+	Path         string        `yaml:"path"`
+	PollInterval time.Duration `yaml:"pollInterval"`
+	AuthConfig   `yaml:",inline"`
+	// MergeRequests names the host (github or gitlab) on which to
+	// open merge requests for changes proposed in the repo, using the
+	// API token in MergeRequestTokenFile
+	MergeRequests         string `yaml:"mergeRequests"`
+	MergeRequestTokenFile string `yaml:"mergeRequestTokenFile"`
+}
+
+type reposFile struct {
+	Repos []RepoConfig `yaml:"repos"`
+}
+
+// ParseRepoConfigs parses a list of repos, given in YAML like
+//
+//	repos:
+//	- url: git@github.com:example/team-a
+//	  branch: master
+//	  path: deploy
+//	  pollInterval: 1m
+//	- url: https://git.example.com/team-b.git
+//	  username: flux
+//	  passwordFile: /etc/fluxd/git/team-b-token
+//	- url: ssh://git@git.example.com:2222/team-c
+//	  hostKeyFingerprints:
+//	  - SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8
+//	- url: git@github.com:example/team-d
+//	  mergeRequests: github
+//	  mergeRequestTokenFile: /etc/fluxd/github/token
+//
+// The branch, path and poll interval may be left out, in which case
+// they are left empty for the caller to fill in with defaults. The
+// fields of AuthConfig may be given, to authenticate with each repo
+// in its own way. Since
+// each repo has its own sync tag and notes, a repo can be listed only
+// once.
+func ParseRepoConfigs(data []byte) ([]RepoConfig, error) {
+	var file reposFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing repos: %s", err)
+	}
+	seen := map[string]bool{}
+	for i, repo := range file.Repos {
+		if repo.URL == "" {
+			return nil, fmt.Errorf("repo %d has no url", i+1)
+		}
+		if seen[repo.URL] {
+			return nil, fmt.Errorf("repo %s is listed more than once", repo.URL)
+		}
+		seen[repo.URL] = true
+		if repo.PollInterval < 0 {
+			return nil, fmt.Errorf("repo %s has a negative poll interval", repo.URL)
+		}
+		if (repo.MergeRequests == "") != (repo.MergeRequestTokenFile == "") {
+			return nil, fmt.Errorf("repo %s needs both mergeRequests and mergeRequestTokenFile, for merge requests to be opened", repo.URL)
+		}
+	}
+	return file.Repos, nil
+}
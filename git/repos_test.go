@@ -0,0 +1,47 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRepoConfigs(t *testing.T) {
+	repos, err := ParseRepoConfigs([]byte(`repos:
+- url: git@github.com:example/team-a
+  branch: release
+  path: deploy
+  pollInterval: 1m
+- url: git@github.com:example/team-b
+- url: https://git.example.com/team-c.git
+  username: flux
+  passwordEnv: TEAM_C_TOKEN
+- url: git@github.com:example/team-d
+  mergeRequests: github
+  mergeRequestTokenFile: /etc/fluxd/github/token
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RepoConfig{
+		{URL: "git@github.com:example/team-a", Branch: "release", Path: "deploy", PollInterval: time.Minute},
+		{URL: "git@github.com:example/team-b"},
+		{URL: "https://git.example.com/team-c.git", AuthConfig: AuthConfig{Username: "flux", PasswordEnv: "TEAM_C_TOKEN"}},
+		{URL: "git@github.com:example/team-d", MergeRequests: "github", MergeRequestTokenFile: "/etc/fluxd/github/token"},
+	}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Errorf("expected %+v, got %+v", expected, repos)
+	}
+
+	for _, bad := range []string{
+		"repos:\n- branch: master\n",
+		"repos:\n- url: git@github.com:example/team-a\n- url: git@github.com:example/team-a\n  path: other\n",
+		"repos:\n- url: git@github.com:example/team-a\n  paths: [deploy]\n",
+		"repos:\n- url: git@github.com:example/team-a\n  pollInterval: soon\n",
+		"repos:\n- url: git@github.com:example/team-a\n  mergeRequests: github\n",
+	} {
+		if _, err := ParseRepoConfigs([]byte(bad)); err == nil {
+			t.Errorf("expected error parsing\n%s", bad)
+		}
+	}
+}
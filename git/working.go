@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -17,6 +18,11 @@ type Config struct {
 	UserEmail   string
 	SetAuthor   bool
 	SkipMessage string
+	// SigningKey, if set, is the GPG key with which to sign commits
+	// and the sync tag; and if VerifySignatures is set, the commits
+	// to be synced must each be signed by a key in the keyring.
+	SigningKey       string
+	VerifySignatures bool
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -36,8 +42,9 @@ type Commit struct {
 
 // CommitAction - struct holding commit information
 type CommitAction struct {
-	Author  string
-	Message string
+	Author     string
+	Message    string
+	SigningKey string
 }
 
 // Clone returns a local working clone of the sync'ed `*Repo`, using
@@ -63,7 +70,7 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	}
 
 	r.mu.RLock()
-	if err := fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
+	if err := fetch(ctx, repoDir, r.dir, Auth{}, realNotesRef+":"+realNotesRef); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
@@ -98,27 +105,131 @@ func (c *Checkout) ManifestDir() string {
 // CommitAndPush commits changes made in this checkout, along with any
 // extra data as a note, and pushes the commit and note to the remote repo.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}) error {
-	if !check(ctx, c.dir, c.config.Path) {
-		return ErrNoChanges
+	if err := c.commitWithNote(ctx, commitAction, note); err != nil {
+		return err
 	}
+	return c.pushWithNotes(ctx, c.config.Branch)
+}
 
-	commitAction.Message += c.config.SkipMessage
+// PushedBranch is a branch to which changes were pushed, rather than
+// to the branch checked out.
+type PushedBranch struct {
+	Name     string
+	Revision string
+	// Existed is true if the branch was already there upstream, with
+	// the same changes, so nothing was pushed
+	Existed bool
+	// Updated is true if the branch was there upstream, but with
+	// other changes (or the changes made to an earlier revision), and
+	// has been replaced
+	Updated bool
+}
 
-	if err := commit(ctx, c.dir, commitAction); err != nil {
-		return err
+// CommitAndPushBranch commits changes made in this checkout, along
+// with any extra data as a note, and pushes the commit to the branch
+// named (and the note, as usual), rather than the branch checked out.
+// If the branch is upstream already, with the same changes made to
+// the same revision, nothing is pushed; otherwise, the branch is
+// replaced with the commit.
+func (c *Checkout) CommitAndPushBranch(ctx context.Context, commitAction CommitAction, note interface{}, name string) (PushedBranch, error) {
+	base, err := refRevision(ctx, c.dir, "HEAD")
+	if err != nil {
+		return PushedBranch{}, err
 	}
+	if err := c.commit(ctx, commitAction); err != nil {
+		return PushedBranch{}, err
+	}
+	branch := PushedBranch{Name: name}
 
-	if note != nil {
-		rev, err := refRevision(ctx, c.dir, "HEAD")
+	// This is checked before adding the note, since the same changes
+	// committed within the same second make the same commit, which
+	// may have its note already
+	existing, err := remoteRevision(ctx, c.dir, c.upstream, "refs/heads/"+name)
+	if err != nil {
+		return PushedBranch{}, err
+	}
+	if existing != "" {
+		same, err := c.sameChange(ctx, existing, base, name)
 		if err != nil {
-			return err
+			return PushedBranch{}, err
 		}
-		if err := addNote(ctx, c.dir, rev, c.config.NotesRef, note); err != nil {
-			return err
+		if same {
+			branch.Revision, branch.Existed = existing, true
+			return branch, nil
 		}
+		branch.Updated = true
+	}
+	if err := c.addNote(ctx, note); err != nil {
+		return PushedBranch{}, err
+	}
+	if err := c.pushWithNotes(ctx, "+HEAD:refs/heads/"+name); err != nil {
+		return PushedBranch{}, err
+	}
+	branch.Revision, err = refRevision(ctx, c.dir, "HEAD")
+	return branch, err
+}
+
+// sameChange reports whether the revision given, at the head of the
+// upstream branch named, makes the same change as the commit at HEAD;
+// that is, it has the same files, and is made to the same (base)
+// revision.
+func (c *Checkout) sameChange(ctx context.Context, rev, base, branch string) (bool, error) {
+	if err := fetchRef(ctx, c.dir, c.upstream, "refs/heads/"+branch); err != nil {
+		return false, err
 	}
+	tree, err := treeRevision(ctx, c.dir, "HEAD")
+	if err != nil {
+		return false, err
+	}
+	revTree, err := treeRevision(ctx, c.dir, rev)
+	if err != nil {
+		return false, err
+	}
+	revParent, err := refRevision(ctx, c.dir, rev+"^")
+	if err != nil {
+		return false, err
+	}
+	return revTree == tree && revParent == base, nil
+}
 
-	refs := []string{c.config.Branch}
+// commitWithNote commits the changes in the checkout, and adds the
+// note, if there is one, to the commit.
+func (c *Checkout) commitWithNote(ctx context.Context, commitAction CommitAction, note interface{}) error {
+	if err := c.commit(ctx, commitAction); err != nil {
+		return err
+	}
+	return c.addNote(ctx, note)
+}
+
+// commit commits the changes in the checkout, if there are any.
+func (c *Checkout) commit(ctx context.Context, commitAction CommitAction) error {
+	if !check(ctx, c.dir, c.config.Path) {
+		return ErrNoChanges
+	}
+
+	commitAction.Message += c.config.SkipMessage
+	if commitAction.SigningKey == "" {
+		commitAction.SigningKey = c.config.SigningKey
+	}
+	return commit(ctx, c.dir, commitAction)
+}
+
+// addNote adds the note given, if not nil, to the commit at HEAD.
+func (c *Checkout) addNote(ctx context.Context, note interface{}) error {
+	if note == nil {
+		return nil
+	}
+	rev, err := refRevision(ctx, c.dir, "HEAD")
+	if err != nil {
+		return err
+	}
+	return addNote(ctx, c.dir, rev, c.config.NotesRef, note)
+}
+
+// pushWithNotes pushes the ref given, and the notes ref if there are
+// any notes, to the remote repo.
+func (c *Checkout) pushWithNotes(ctx context.Context, ref string) error {
+	refs := []string{ref}
 	ok, err := refExists(ctx, c.dir, c.realNotesRef)
 	if ok {
 		refs = append(refs, c.realNotesRef)
@@ -126,7 +237,7 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		return err
 	}
 
-	if err := push(ctx, c.dir, c.upstream.URL, refs); err != nil {
+	if err := push(ctx, c.dir, c.upstream, refs); err != nil {
 		return PushError(c.upstream.URL, err)
 	}
 	return nil
@@ -146,7 +257,32 @@ func (c *Checkout) SyncRevision(ctx context.Context) (string, error) {
 }
 
 func (c *Checkout) MoveSyncTagAndPush(ctx context.Context, ref, msg string) error {
-	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, ref, msg, c.upstream.URL)
+	return moveTagAndPush(ctx, c.dir, c.config.SyncTag, ref, msg, c.upstream, c.config.SigningKey)
+}
+
+// VerifyCommits checks that newRev, and each commit after
+// trustedRev up to newRev, are signed by a key in the keyring; the
+// history of trustedRev is taken as already checked. If there's no
+// trustedRev, every commit up to and including newRev is checked.
+func (c *Checkout) VerifyCommits(ctx context.Context, trustedRev, newRev string) error {
+	if trustedRev == "" {
+		return verifyCommits(ctx, c.dir, newRev)
+	}
+	if err := verifyCommits(ctx, c.dir, "--max-count=1", newRev); err != nil {
+		return err
+	}
+	return verifyCommits(ctx, c.dir, trustedRev+".."+newRev)
+}
+
+// VerifySyncTag checks that the sync tag is signed by a key in the
+// keyring, and returns the revision it points at.
+func (c *Checkout) VerifySyncTag(ctx context.Context) (string, error) {
+	return verifyTag(ctx, c.dir, c.config.SyncTag)
+}
+
+// HasRevision reports whether the commit given is in the checkout.
+func (c *Checkout) HasRevision(ctx context.Context, rev string) bool {
+	return hasCommit(ctx, c.dir, rev)
 }
 
 // ChangedFiles does a git diff listing changed files
@@ -160,6 +296,48 @@ func (c *Checkout) ChangedFiles(ctx context.Context, ref string) ([]string, erro
 	return list, err
 }
 
+// Export is a copy of the files in a repo as they were at some
+// revision. It has its own directory, which is removed by Clean.
+type Export struct {
+	dir  string
+	path string
+	// the repo the export is a working tree of
+	repoDir string
+}
+
+// Dir returns the path to the exported files
+func (e *Export) Dir() string {
+	return e.dir
+}
+
+// ManifestDir returns the path to the exported manifests files
+func (e *Export) ManifestDir() string {
+	return filepath.Join(e.dir, e.path)
+}
+
+// Clean removes the exported files, and the record of them in the
+// repo they were exported from.
+func (e *Export) Clean() {
+	if e.dir != "" {
+		os.RemoveAll(e.dir)
+		pruneWorktrees(context.Background(), e.repoDir)
+	}
+}
+
+// Export checks out the revision given into a directory of its own,
+// leaving the files in this checkout as they are.
+func (c *Checkout) Export(ctx context.Context, rev string) (*Export, error) {
+	dir, err := ioutil.TempDir(os.TempDir(), "flux-export")
+	if err != nil {
+		return nil, err
+	}
+	if err := worktree(ctx, c.dir, dir, rev); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Export{dir: dir, path: c.config.Path, repoDir: c.dir}, nil
+}
+
 func (c *Checkout) NoteRevList(ctx context.Context) (map[string]struct{}, error) {
 	return noteRevList(ctx, c.dir, c.realNotesRef)
 }
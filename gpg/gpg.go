@@ -0,0 +1,59 @@
+// Package gpg looks after the GPG keyring used when signing commits,
+// and verifying their signatures.
+package gpg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImportKeys imports the keys in the file given, or in each of the
+// files in the directory given, into the keyring; this is the default
+// keyring, or that in $GNUPGHOME, if it's set. It returns the names
+// of the files imported.
+func ImportKeys(src string) ([]string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if err := importKey(src); err != nil {
+			return nil, err
+		}
+		return []string{filepath.Base(src)}, nil
+	}
+
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+	var imported []string
+	for _, info := range infos {
+		// Mounted secrets and config maps have hidden files and
+		// directories alongside the keys; skip those.
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		if err := importKey(filepath.Join(src, info.Name())); err != nil {
+			return imported, err
+		}
+		imported = append(imported, info.Name())
+	}
+	return imported, nil
+}
+
+func importKey(path string) error {
+	errOut := &bytes.Buffer{}
+	cmd := exec.Command("gpg", "--batch", "--import", path)
+	cmd.Stderr = errOut
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "importing GPG key from %s: %s", path, strings.TrimSpace(errOut.String()))
+	}
+	return nil
+}
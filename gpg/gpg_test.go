@@ -0,0 +1,58 @@
+package gpg
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux/gpg/gpgtest"
+)
+
+func TestImportKeys(t *testing.T) {
+	fingerprint, cleanup := gpgtest.GPGKey(t)
+	key, err := exec.Command("gpg", "--batch", "--armor", "--export", fingerprint).Output()
+	cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "flux-gpg-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "flux.asc"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// As seen in mounted secrets
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	_, cleanup = gpgtest.Keyring(t)
+	defer cleanup()
+	imported, err := ImportKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || imported[0] != "flux.asc" {
+		t.Errorf("expected flux.asc to be imported, got %v", imported)
+	}
+	out, err := exec.Command("gpg", "--batch", "--list-keys", "--with-colons").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), fingerprint) {
+		t.Errorf("expected key %s in keyring, got:\n%s", fingerprint, out)
+	}
+
+	if _, err := ImportKeys(filepath.Join(dir, "..data")); err != nil {
+		t.Errorf("expected empty directory to import nothing, got error %s", err)
+	}
+	if _, err := ImportKeys(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error importing missing file")
+	}
+}
@@ -0,0 +1,72 @@
+// Package gpgtest has helpers for tests that need a GPG keyring, and
+// a key in it.
+package gpgtest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// GPGKey makes a keyring in a temporary directory, points $GNUPGHOME
+// at it, and generates a signing key, with no passphrase, in it. It
+// returns the key's fingerprint, and a func that removes the keyring
+// and puts $GNUPGHOME back. If gpg isn't installed, the test is
+// skipped.
+func GPGKey(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+	home, cleanup := Keyring(t)
+	if err := gpg(home, ioutil.Discard, "--passphrase", "", "--quick-gen-key", "Flux Test <flux-test@example.com>", "ed25519", "sign", "never"); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	if err := gpg(home, out, "--list-secret-keys", "--with-colons"); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" && len(fields) > 9 {
+			return fields[9], cleanup
+		}
+	}
+	cleanup()
+	t.Fatal("no fingerprint found for generated key")
+	return "", nil
+}
+
+// Keyring makes an empty keyring in a temporary directory, and points
+// $GNUPGHOME at it. It returns the directory, and a func that removes
+// it and puts $GNUPGHOME back.
+func Keyring(t *testing.T) (string, func()) {
+	home, err := ioutil.TempDir("", "flux-gpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, wasSet := os.LookupEnv("GNUPGHOME")
+	os.Setenv("GNUPGHOME", home)
+	return home, func() {
+		// gpg starts an agent for the keyring, which would otherwise
+		// outlive the directory.
+		exec.Command("gpgconf", "--homedir", home, "--kill", "gpg-agent").Run()
+		os.RemoveAll(home)
+		if wasSet {
+			os.Setenv("GNUPGHOME", old)
+		} else {
+			os.Unsetenv("GNUPGHOME")
+		}
+	}
+}
+
+func gpg(home string, out io.Writer, args ...string) error {
+	cmd := exec.Command("gpg", append([]string{"--homedir", home, "--batch"}, args...)...)
+	cmd.Stdout = out
+	return cmd.Run()
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/event"
@@ -66,7 +68,17 @@ func (c *Client) ListImages(ctx context.Context, s update.ResourceSpec) ([]v6.Im
 
 func (c *Client) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesOptions) ([]v6.ImageStatus, error) {
 	var res []v6.ImageStatus
-	err := c.Get(ctx, &res, transport.ListImagesWithOptions, "service", string(opts.Spec), "containerFields", strings.Join(opts.OverrideContainerFields, ","))
+	params := []string{"service", string(opts.Spec), "containerFields", strings.Join(opts.OverrideContainerFields, ",")}
+	if opts.TagFilter != "" {
+		params = append(params, "tagFilter", opts.TagFilter)
+	}
+	if opts.Sort != "" {
+		params = append(params, "sort", opts.Sort)
+	}
+	if opts.Limit != 0 {
+		params = append(params, "limit", strconv.Itoa(opts.Limit))
+	}
+	err := c.Get(ctx, &res, transport.ListImagesWithOptions, params...)
 	return res, err
 }
 
@@ -104,6 +116,24 @@ func (c *Client) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 	return res, err
 }
 
+func (c *Client) LintReport(ctx context.Context) (v11.LintReport, error) {
+	var res v11.LintReport
+	err := c.Get(ctx, &res, transport.LintReport)
+	return res, err
+}
+
+func (c *Client) DriftReport(ctx context.Context, opts v11.DriftOptions) (v11.DriftReport, error) {
+	var res v11.DriftReport
+	err := c.Get(ctx, &res, transport.DriftReport, "diff", strconv.FormatBool(opts.Diff))
+	return res, err
+}
+
+func (c *Client) ManifestsReport(ctx context.Context) (v11.ManifestsReport, error) {
+	var res v11.ManifestsReport
+	err := c.Get(ctx, &res, transport.ManifestsReport)
+	return res, err
+}
+
 // --- Request helpers
 
 // post is a simple query-param only post request
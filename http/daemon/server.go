@@ -3,6 +3,7 @@ package daemon
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	transport "github.com/weaveworks/flux/http"
 	"github.com/weaveworks/flux/job"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
@@ -55,6 +57,9 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.SyncStatus).HandlerFunc(handle.SyncStatus)
 	r.Get(transport.Export).HandlerFunc(handle.Export)
 	r.Get(transport.GitRepoConfig).HandlerFunc(handle.GitRepoConfig)
+	r.Get(transport.LintReport).HandlerFunc(handle.LintReport)
+	r.Get(transport.ManifestsReport).HandlerFunc(handle.ManifestsReport)
+	r.Get(transport.DriftReport).HandlerFunc(handle.DriftReport)
 
 	// These handlers persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
@@ -115,6 +120,18 @@ func (s HTTPServer) ListImagesWithOptions(w http.ResponseWriter, r *http.Request
 		opts.OverrideContainerFields = strings.Split(containerFields, ",")
 	}
 
+	// tagFilter, sort, limit - Choose which images to return for each container.
+	opts.TagFilter = queryValues.Get("tagFilter")
+	opts.Sort = queryValues.Get("sort")
+	if limit := queryValues.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing limit %q", limit))
+			return
+		}
+		opts.Limit = n
+	}
+
 	d, err := s.server.ListImagesWithOptions(r.Context(), opts)
 	if err != nil {
 		transport.ErrorResponse(w, r, err)
@@ -170,6 +187,42 @@ func (s HTTPServer) GitRepoConfig(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, res)
 }
 
+func (s HTTPServer) LintReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.server.LintReport(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, report)
+}
+
+func (s HTTPServer) ManifestsReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.server.ManifestsReport(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, report)
+}
+
+func (s HTTPServer) DriftReport(w http.ResponseWriter, r *http.Request) {
+	var opts v11.DriftOptions
+	if diff := r.URL.Query().Get("diff"); diff != "" {
+		d, err := strconv.ParseBool(diff)
+		if err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing diff %q", diff))
+			return
+		}
+		opts.Diff = d
+	}
+	report, err := s.server.DriftReport(r.Context(), opts)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, report)
+}
+
 // --- handlers supporting deprecated requests
 
 func (s HTTPServer) UpdateImages(w http.ResponseWriter, r *http.Request) {
@@ -9,6 +9,9 @@ const (
 	SyncStatus            = "SyncStatus"
 	Export                = "Export"
 	GitRepoConfig         = "GitRepoConfig"
+	LintReport            = "LintReport"
+	ManifestsReport       = "ManifestsReport"
+	DriftReport           = "DriftReport"
 
 	UpdateImages           = "UpdateImages"
 	UpdatePolicies         = "UpdatePolicies"
@@ -22,5 +25,6 @@ var (
 	RegisterDaemonV8  = "RegisterDaemonV8"
 	RegisterDaemonV9  = "RegisterDaemonV9"
 	RegisterDaemonV10 = "RegisterDaemonV10"
+	RegisterDaemonV11 = "RegisterDaemonV11"
 	LogEvent          = "LogEvent"
 )
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/image"
+)
+
+const branchRefPrefix = "refs/heads/"
+
+func gitChange(url, branch string) v9.Change {
+	return v9.Change{Kind: v9.GitChange, Source: v9.GitUpdate{URL: url, Branch: branch}}
+}
+
+func imageChange(ref string) (v9.Change, error) {
+	// Pushes by digest are given as `name@sha256:...`, which isn't
+	// parsed as a ref; but only the name is needed.
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+	r, err := image.ParseRef(ref)
+	if err != nil {
+		return v9.Change{}, errors.Wrapf(err, "parsing image %q", ref)
+	}
+	return v9.Change{Kind: v9.ImageChange, Source: v9.ImageUpdate{Name: r.Name}}, nil
+}
+
+func parseGitHub(r *http.Request, body []byte) ([]v9.Change, error) {
+	// There's a ping when the webhook is created, and possibly other
+	// events if it's been set up to send them; only pushes count.
+	if r.Header.Get("X-GitHub-Event") != "push" {
+		return nil, nil
+	}
+	var payload struct {
+		Ref        string `json:"ref"`
+		Repository struct {
+			SSHURL string `json:"ssh_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing GitHub push")
+	}
+	if !strings.HasPrefix(payload.Ref, branchRefPrefix) {
+		return nil, nil
+	}
+	return []v9.Change{gitChange(payload.Repository.SSHURL, strings.TrimPrefix(payload.Ref, branchRefPrefix))}, nil
+}
+
+func parseGitLab(r *http.Request, body []byte) ([]v9.Change, error) {
+	if r.Header.Get("X-Gitlab-Event") != "Push Hook" {
+		return nil, nil
+	}
+	var payload struct {
+		Ref     string `json:"ref"`
+		Project struct {
+			GitSSHURL string `json:"git_ssh_url"`
+		} `json:"project"`
+		// Older versions of GitLab give only this.
+		Repository struct {
+			GitSSHURL string `json:"git_ssh_url"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing GitLab push")
+	}
+	if !strings.HasPrefix(payload.Ref, branchRefPrefix) {
+		return nil, nil
+	}
+	url := payload.Project.GitSSHURL
+	if url == "" {
+		url = payload.Repository.GitSSHURL
+	}
+	return []v9.Change{gitChange(url, strings.TrimPrefix(payload.Ref, branchRefPrefix))}, nil
+}
+
+func parseBitbucket(r *http.Request, body []byte) ([]v9.Change, error) {
+	if r.Header.Get("X-Event-Key") != "repo:push" {
+		return nil, nil
+	}
+	var payload struct {
+		Repository struct {
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"repository"`
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing Bitbucket push")
+	}
+	var changes []v9.Change
+	for _, c := range payload.Push.Changes {
+		// A deleted branch has no new state.
+		if c.New != nil && c.New.Type == "branch" {
+			changes = append(changes, gitChange(payload.Repository.Links.HTML.Href, c.New.Name))
+		}
+	}
+	return changes, nil
+}
+
+func parseDockerHub(_ *http.Request, body []byte) ([]v9.Change, error) {
+	var payload struct {
+		Repository struct {
+			RepoName string `json:"repo_name"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing Docker Hub push")
+	}
+	change, err := imageChange(payload.Repository.RepoName)
+	if err != nil {
+		return nil, err
+	}
+	return []v9.Change{change}, nil
+}
+
+func parseQuay(_ *http.Request, body []byte) ([]v9.Change, error) {
+	var payload struct {
+		DockerURL string `json:"docker_url"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing Quay push")
+	}
+	change, err := imageChange(payload.DockerURL)
+	if err != nil {
+		return nil, err
+	}
+	return []v9.Change{change}, nil
+}
+
+// parseGCR parses the message Google Cloud Pub/Sub pushes to a
+// subscription to the `gcr` topic, which carries the notification
+// from the registry.
+func parseGCR(_ *http.Request, body []byte) ([]v9.Change, error) {
+	var payload struct {
+		Message struct {
+			Data []byte `json:"data"` // base64, which encoding/json decodes
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "parsing GCR push")
+	}
+	var notification struct {
+		Action string `json:"action"`
+		Digest string `json:"digest"`
+		Tag    string `json:"tag"`
+	}
+	if err := json.Unmarshal(payload.Message.Data, &notification); err != nil {
+		return nil, errors.Wrap(err, "parsing GCR notification")
+	}
+	if notification.Action != "INSERT" {
+		return nil, nil
+	}
+	ref := notification.Tag
+	if ref == "" {
+		ref = notification.Digest
+	}
+	if ref == "" {
+		return nil, errors.New("GCR notification has neither a tag nor a digest")
+	}
+	change, err := imageChange(ref)
+	if err != nil {
+		return nil, err
+	}
+	return []v9.Change{change}, nil
+}
@@ -0,0 +1,164 @@
+// Package webhook receives the notifications sent by git hosts and
+// image registries when something is pushed, so that the daemon can
+// sync or look for new images straight away, rather than waiting for
+// its next poll.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	"github.com/weaveworks/flux/api/v9"
+	fluxerr "github.com/weaveworks/flux/errors"
+	transport "github.com/weaveworks/flux/http"
+)
+
+// GitHub caps webhook payloads at 25MB; nothing else sends bigger.
+const maxPayloadSize = 25 << 20
+
+// Notifier is told about the changes pushed; *daemon.Daemon is one.
+type Notifier interface {
+	NotifyChange(context.Context, v9.Change) error
+}
+
+var ErrorUnauthorized = &fluxerr.Error{
+	Type: fluxerr.User,
+	Help: `The webhook request failed authentication
+
+This means the webhook was not set up with the secret given to fluxd
+with --webhook-secret. For GitHub and Bitbucket, supply it as the
+webhook's secret; for GitLab, as its secret token; and for Docker Hub,
+Quay and GCR (which can't sign webhooks), in the URL, as
+'?secret=<secret>'.
+`,
+	Err: errors.New("webhook failed authentication"),
+}
+
+// A source is somewhere webhooks come from. It has its own way of
+// proving the webhook was sent by someone knowing the secret, and its
+// own payload, from which the changes are parsed.
+type source struct {
+	verify func(secret []byte, r *http.Request, body []byte) bool
+	parse  func(r *http.Request, body []byte) ([]v9.Change, error)
+}
+
+var sources = map[string]source{
+	"github":    {verifyHubSignature, parseGitHub},
+	"gitlab":    {verifyGitLabToken, parseGitLab},
+	"bitbucket": {verifyHubSignature, parseBitbucket},
+	"dockerhub": {verifyQuerySecret, parseDockerHub},
+	"quay":      {verifyQuerySecret, parseQuay},
+	"gcr":       {verifyQuerySecret, parseGCR},
+}
+
+// NewHandler gives an HTTP handler that receives webhooks at
+// `/<source>`, where source is one of github, gitlab, bitbucket,
+// dockerhub, quay or gcr, and passes on the changes they tell of to
+// the notifier.
+func NewHandler(n Notifier, secret string, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	for name, src := range sources {
+		h := handler{
+			name:     name,
+			source:   src,
+			notifier: n,
+			secret:   []byte(secret),
+			logger:   log.With(logger, "source", name),
+		}
+		r.NewRoute().Name(name).Methods("POST").Path("/" + name).Handler(h)
+	}
+	r.NewRoute().Name("NotFound").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transport.WriteError(w, r, http.StatusNotFound, transport.MakeAPINotFound(r.URL.Path))
+	})
+	return r
+}
+
+type handler struct {
+	name     string
+	source   source
+	notifier Notifier
+	secret   []byte
+	logger   log.Logger
+}
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if !h.source.verify(h.secret, r, body) {
+		h.logger.Log("err", ErrorUnauthorized.Err)
+		transport.WriteError(w, r, http.StatusUnauthorized, ErrorUnauthorized)
+		return
+	}
+
+	changes, err := h.source.parse(r, body)
+	if err != nil {
+		h.logger.Log("err", err)
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	for _, change := range changes {
+		switch source := change.Source.(type) {
+		case v9.GitUpdate:
+			h.logger.Log("kind", change.Kind, "url", source.URL, "branch", source.Branch)
+		case v9.ImageUpdate:
+			h.logger.Log("kind", change.Kind, "image", source.Name)
+		}
+		if err := h.notifier.NotifyChange(r.Context(), change); err != nil {
+			transport.ErrorResponse(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyHubSignature checks the signature GitHub and Bitbucket give,
+// which is an HMAC of the body, keyed with the secret.
+func verifyHubSignature(secret []byte, r *http.Request, body []byte) bool {
+	sig := r.Header.Get("X-Hub-Signature-256")
+	if sig == "" {
+		sig = r.Header.Get("X-Hub-Signature")
+	}
+	var hashFunc func() hash.Hash
+	switch {
+	case strings.HasPrefix(sig, "sha256="):
+		hashFunc = sha256.New
+	case strings.HasPrefix(sig, "sha1="):
+		hashFunc = sha1.New
+	default:
+		return false
+	}
+	got, err := hex.DecodeString(sig[strings.Index(sig, "=")+1:])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(hashFunc, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// verifyGitLabToken checks the token GitLab gives, which is the
+// secret itself.
+func verifyGitLabToken(secret []byte, r *http.Request, _ []byte) bool {
+	return subtle.ConstantTimeCompare(secret, []byte(r.Header.Get("X-Gitlab-Token"))) == 1
+}
+
+// verifyQuerySecret checks the secret given in the URL, for those
+// registries that don't sign webhooks.
+func verifyQuerySecret(secret []byte, r *http.Request, _ []byte) bool {
+	return subtle.ConstantTimeCompare(secret, []byte(r.URL.Query().Get("secret"))) == 1
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/image"
+)
+
+const secret = "s3cr3t"
+
+type mockNotifier struct {
+	changes []v9.Change
+}
+
+func (n *mockNotifier) NotifyChange(_ context.Context, c v9.Change) error {
+	n.changes = append(n.changes, c)
+	return nil
+}
+
+func post(path string, header http.Header, body string) (int, []v9.Change) {
+	notifier := &mockNotifier{}
+	handler := NewHandler(notifier, secret, log.NewNopLogger())
+	req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w.Code, notifier.changes
+}
+
+func sign(body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func mustParseName(t *testing.T, s string) image.Name {
+	ref, err := image.ParseRef(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Name
+}
+
+func TestGitHub(t *testing.T) {
+	body := `{"ref": "refs/heads/master", "repository": {"ssh_url": "git@github.com:weaveworks/flux-example.git"}}`
+	header := http.Header{
+		"X-Github-Event":      {"push"},
+		"X-Hub-Signature-256": {sign(body)},
+	}
+	code, changes := post("/github", header, body)
+	if code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, code)
+	}
+	expected := []v9.Change{gitChange("git@github.com:weaveworks/flux-example.git", "master")}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+
+	header.Set("X-Hub-Signature-256", sign(body+" "))
+	if code, changes := post("/github", header, body); code != http.StatusUnauthorized || len(changes) > 0 {
+		t.Errorf("expected badly signed push to be refused, got status %d and changes %+v", code, changes)
+	}
+
+	header.Set("X-Hub-Signature-256", sign(`{}`))
+	header.Set("X-Github-Event", "ping")
+	if code, changes := post("/github", header, `{}`); code != http.StatusOK || len(changes) > 0 {
+		t.Errorf("expected ping to be accepted and ignored, got status %d and changes %+v", code, changes)
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	body := `{"ref": "refs/heads/release", "project": {"git_ssh_url": "git@gitlab.com:example/config.git"}}`
+	header := http.Header{
+		"X-Gitlab-Event": {"Push Hook"},
+		"X-Gitlab-Token": {secret},
+	}
+	_, changes := post("/gitlab", header, body)
+	expected := []v9.Change{gitChange("git@gitlab.com:example/config.git", "release")}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+
+	header.Set("X-Gitlab-Token", "guess")
+	if code, _ := post("/gitlab", header, body); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestBitbucket(t *testing.T) {
+	body := `{
+  "repository": {"links": {"html": {"href": "https://bitbucket.org/example/config"}}},
+  "push": {"changes": [
+    {"new": {"type": "branch", "name": "master"}},
+    {"new": {"type": "tag", "name": "v1"}},
+    {"new": null}
+  ]}
+}`
+	header := http.Header{
+		"X-Event-Key":     {"repo:push"},
+		"X-Hub-Signature": {sign(body)},
+	}
+	_, changes := post("/bitbucket", header, body)
+	expected := []v9.Change{gitChange("https://bitbucket.org/example/config", "master")}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestRegistries(t *testing.T) {
+	gcrData := base64.StdEncoding.EncodeToString([]byte(`{"action": "INSERT", "digest": "gcr.io/example/app@sha256:0123", "tag": "gcr.io/example/app:v1"}`))
+	for _, c := range []struct {
+		path, body, image string
+	}{
+		{"/dockerhub", `{"push_data": {"tag": "v1"}, "repository": {"repo_name": "example/app"}}`, "example/app"},
+		{"/quay", `{"docker_url": "quay.io/example/app", "updated_tags": ["v1"]}`, "quay.io/example/app"},
+		{"/gcr", `{"message": {"data": "` + gcrData + `"}}`, "gcr.io/example/app"},
+	} {
+		code, changes := post(c.path+"?secret="+secret, nil, c.body)
+		if code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", c.path, http.StatusOK, code)
+			continue
+		}
+		expected := []v9.Change{{Kind: v9.ImageChange, Source: v9.ImageUpdate{Name: mustParseName(t, c.image)}}}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("%s: expected %+v, got %+v", c.path, expected, changes)
+		}
+
+		if code, _ := post(c.path, nil, c.body); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected push without secret to be refused, got status %d", c.path, code)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package image
+
+import (
+	"time"
+
+	glob "github.com/ryanuber/go-glob"
+)
+
+// Exclusions describes images that should never be considered the
+// newest candidate, whatever the policies of the workloads using
+// them; e.g., release candidates, or builds so old that a newer tag
+// matching the same pattern is unlikely to be wanted.
+type Exclusions struct {
+	// Images created (or first seen) longer ago than this are
+	// excluded; zero means no limit. Images of unknown age are never
+	// excluded on this basis.
+	OlderThan time.Duration
+	// Images with tags matching any of these globs (e.g., `*-rc*`)
+	// are excluded
+	Tags []string
+}
+
+// Excludes reports whether the image is excluded, as of the time
+// given.
+func (e Exclusions) Excludes(im Info, now time.Time) bool {
+	for _, g := range e.Tags {
+		if glob.Glob(g, im.ID.Tag) {
+			return true
+		}
+	}
+	if e.OlderThan > 0 {
+		if created := im.CreatedTS(); !created.IsZero() && now.Sub(created) > e.OlderThan {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the images that are not excluded, as of the time
+// given, in the same order. The result is nil only if `infos` is nil,
+// so that "no images" is still distinguishable from "no image data".
+func (e Exclusions) Filter(infos []Info, now time.Time) []Info {
+	if infos == nil || (e.OlderThan <= 0 && len(e.Tags) == 0) {
+		return infos
+	}
+	res := make([]Info, 0, len(infos))
+	for _, im := range infos {
+		if !e.Excludes(im, now) {
+			res = append(res, im)
+		}
+	}
+	return res
+}
@@ -14,12 +14,30 @@ const (
 	dockerHubHost = "index.docker.io"
 
 	oldDockerHubHost = "docker.io"
+	// the host that `docker pull` actually talks to
+	dockerHubRegistryHost = "registry-1.docker.io"
+
+	dockerHubLibrary = "library/"
+
+	// DefaultTag is the tag implied by an image ref without one.
+	DefaultTag = "latest"
 )
 
+// isDockerHub reports whether the domain given refers to DockerHub;
+// an empty domain is taken to mean DockerHub, by convention.
+func isDockerHub(domain string) bool {
+	switch strings.ToLower(domain) {
+	case "", oldDockerHubHost, dockerHubHost, dockerHubRegistryHost:
+		return true
+	}
+	return false
+}
+
 var (
 	ErrInvalidImageID   = errors.New("invalid image ID")
 	ErrBlankImageID     = errors.Wrap(ErrInvalidImageID, "blank image name")
 	ErrMalformedImageID = errors.Wrap(ErrInvalidImageID, `expected image name as either <image>:<tag> or just <image>`)
+	ErrMalformedDigest  = errors.Wrap(ErrInvalidImageID, `expected digest as <algorithm>:<hex>, e.g., sha256:...`)
 )
 
 // Name represents an unversioned (i.e., untagged) image a.k.a.,
@@ -57,31 +75,34 @@ func (i Name) String() string {
 
 // Repository returns the canonicalised path part of an Name.
 func (i Name) Repository() string {
-	switch i.Domain {
-	case "", oldDockerHubHost, dockerHubHost:
-		path := strings.Split(i.Image, "/")
-		if len(path) == 1 {
-			return "library/" + i.Image
-		}
-		return i.Image
-	default:
-		return i.Image
+	if isDockerHub(i.Domain) && !strings.Contains(i.Image, "/") {
+		return dockerHubLibrary + i.Image
 	}
+	return i.Image
 }
 
 // Registry returns the domain name of the Docker image registry, to
 // use to fetch the image or image metadata.
 func (i Name) Registry() string {
-	switch i.Domain {
-	case "", oldDockerHubHost:
+	return CanonicalDomain(i.Domain)
+}
+
+// CanonicalDomain returns the canonical form of a registry domain:
+// any of the names for DockerHub (including none at all) becomes
+// `index.docker.io`, and since domain names are not case sensitive,
+// others are lower-cased.
+func CanonicalDomain(domain string) string {
+	if isDockerHub(domain) {
 		return dockerHubHost
-	default:
-		return i.Domain
 	}
+	return strings.ToLower(domain)
 }
 
-// CanonicalName returns the canonicalised registry host and image parts
-// of the ID.
+// CanonicalName returns the canonicalised registry host and image
+// parts of the ID. Two names refer to the same image repository if
+// and only if their canonical names are equal; e.g., `nginx`,
+// `docker.io/nginx` and `index.docker.io/library/nginx` all have the
+// canonical name `index.docker.io/library/nginx`.
 func (i Name) CanonicalName() CanonicalName {
 	return CanonicalName{
 		Name: Name{
@@ -98,18 +119,23 @@ func (i Name) ToRef(tag string) Ref {
 	}
 }
 
-// Ref represents a versioned (i.e., tagged) image. The tag is
-// allowed to be empty, though it is in general undefined what that
-// means. As such, `Ref` also includes all `Name` values.
+// Ref represents a versioned (i.e., tagged) image, or an image
+// pinned by its digest, or both. The tag is allowed to be empty,
+// though it is in general undefined what that means. As such, `Ref`
+// also includes all `Name` values.
 //
 // Examples (stringified):
 //  * alpine:3.5
 //  * library/alpine:3.5
 //  * quay.io/weaveworks/flux:1.1.0
 //  * localhost:5000/arbitrary/path/to/repo:revision-sha1
+//  * alpine@sha256:7df6db5aa61ae9480f52f0b3a06a140ab98d427f86d8d5de0bedab9b8df6b1c0
+//  * alpine:3.5@sha256:7df6db5aa61ae9480f52f0b3a06a140ab98d427f86d8d5de0bedab9b8df6b1c0
 type Ref struct {
 	Name
 	Tag string
+	// the digest of the manifest, if the image is pinned to one
+	Digest string
 }
 
 // CanonicalRef is an image ref with none of the fields left to be
@@ -120,11 +146,14 @@ type CanonicalRef struct {
 
 // String returns the Ref as a string (i.e., unparsed) without canonicalising it.
 func (i Ref) String() string {
-	var tag string
+	var tag, digest string
 	if i.Tag != "" {
 		tag = ":" + i.Tag
 	}
-	return fmt.Sprintf("%s%s", i.Name.String(), tag)
+	if i.Digest != "" {
+		digest = "@" + i.Digest
+	}
+	return fmt.Sprintf("%s%s%s", i.Name.String(), tag, digest)
 }
 
 // ParseRef parses a string representation of an image id into an
@@ -140,6 +169,21 @@ func ParseRef(s string) (Ref, error) {
 		return id, ErrMalformedImageID
 	}
 
+	// A digest comes last, and cannot contain `@`
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		if !digestRegexp.MatchString(s[at+1:]) {
+			return id, ErrMalformedDigest
+		}
+		id.Digest = s[at+1:]
+		s = s[:at]
+		switch {
+		case s == "":
+			return id, ErrBlankImageID
+		case strings.Contains(s, "@"):
+			return id, ErrMalformedImageID
+		}
+	}
+
 	elements := strings.Split(s, "/")
 	switch len(elements) {
 	case 0: // NB strings.Split will never return []
@@ -180,6 +224,8 @@ var (
 	domainComponent = `([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
 	domain          = fmt.Sprintf(`localhost|(%s([.]%s)+)(:[0-9]+)?`, domainComponent, domainComponent)
 	domainRegexp    = regexp.MustCompile(domain)
+	// as in github.com/opencontainers/go-digest
+	digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
 )
 
 // ImageID is serialized/deserialized as a string
@@ -203,24 +249,82 @@ func (i Ref) CanonicalRef() CanonicalRef {
 	name := i.CanonicalName()
 	return CanonicalRef{
 		Ref: Ref{
-			Name: name.Name,
-			Tag:  i.Tag,
+			Name:   name.Name,
+			Tag:    i.Tag,
+			Digest: i.Digest,
 		},
 	}
 }
 
+// Equivalent reports whether the two refs refer to the same image,
+// once canonicalised and with `DefaultTag` in place of a missing tag;
+// e.g., `nginx` is equivalent to `docker.io/library/nginx:latest`. If
+// both refs have a digest, the digests are compared rather than the
+// tags, since it is the digest that determines the image. A ref with
+// a digest is not equivalent to one without, since that cannot be
+// known from the refs alone.
+func (i Ref) Equivalent(other Ref) bool {
+	if i.CanonicalName() != other.CanonicalName() {
+		return false
+	}
+	switch {
+	case i.Digest != "" && other.Digest != "":
+		return i.Digest == other.Digest
+	case i.Digest != "" || other.Digest != "":
+		return false
+	}
+	return i.tagOrDefault() == other.tagOrDefault()
+}
+
+func (i Ref) tagOrDefault() string {
+	if i.Tag == "" {
+		return DefaultTag
+	}
+	return i.Tag
+}
+
 func (i Ref) Components() (domain, repo, tag string) {
 	return i.Domain, i.Image, i.Tag
 }
 
-// WithNewTag makes a new copy of an ImageID with a new tag
+// WithNewTag makes a new copy of an ImageID with a new tag. Any
+// digest is dropped, since it would belong to the old tag.
 func (i Ref) WithNewTag(t string) Ref {
 	var img Ref
 	img = i
 	img.Tag = t
+	img.Digest = ""
 	return img
 }
 
+// WithNewDigest makes a new copy of an ImageID pinned to a new
+// digest.
+func (i Ref) WithNewDigest(d string) Ref {
+	var img Ref
+	img = i
+	img.Digest = d
+	return img
+}
+
+// UpdatedTo returns the ref to use in place of this one to refer to
+// the image described by `im`, keeping to the form of this ref: in
+// particular, if this ref is pinned by digest, so is the result. If
+// the image is itself referred to by digest, that digest is used;
+// otherwise that of its manifest list, if it has one, so the ref still
+// refers to the image for every platform.
+func (i Ref) UpdatedTo(im Info) Ref {
+	ref := i.WithNewTag(im.ID.Tag)
+	switch {
+	case im.ID.Digest != "":
+		ref = ref.WithNewDigest(im.ID.Digest)
+	case i.Digest != "" && im.ListDigest != "":
+		ref = ref.WithNewDigest(im.ListDigest)
+	case i.Digest != "" && im.Digest != "":
+		ref = ref.WithNewDigest(im.Digest)
+	}
+	return ref
+}
+
 // Info has the metadata we are able to determine about an image ref,
 // from its registry.
 type Info struct {
@@ -229,28 +333,41 @@ type Info struct {
 	// the digest we got when fetching the metadata, which will be
 	// different each time a manifest is uploaded for the reference
 	Digest string `json:",omitempty"`
+	// for a multi-platform image, the digest of the manifest list,
+	// which is what a ref is usually pinned to (e.g., as reported by
+	// `docker push`); Digest is that of the platform's manifest
+	ListDigest string `json:",omitempty"`
 	// an identifier for the *image* this reference points to; this
 	// will be the same for references that point at the same image
 	// (but does not necessarily equal Docker's image ID)
 	ImageID string `json:",omitempty"`
 	// the time at which the image pointed at was created
 	CreatedAt time.Time `json:",omitempty"`
+	// the time at which the image was first seen, if recorded; used
+	// in place of CreatedAt when the registry doesn't supply one
+	FirstSeen time.Time `json:",omitempty"`
+	// the labels in the image's configuration, e.g., recording the
+	// commit it was built from
+	Labels map[string]string `json:",omitempty"`
+	// the platform the image was built for, if known
+	OS   string `json:",omitempty"`
+	Arch string `json:",omitempty"`
+	// for a multi-platform image, the images for other platforms
+	// of interest
+	Variants []Variant `json:",omitempty"`
 }
 
 // MarshalJSON returns the Info value in JSON (as bytes). It is
-// implemented so that we can omit the `CreatedAt` value when it's
-// zero, which would otherwise be tricky for e.g., JavaScript to
-// detect.
+// implemented so that we can omit the `CreatedAt` and `FirstSeen`
+// values when they're zero, which would otherwise be tricky for
+// e.g., JavaScript to detect.
 func (im Info) MarshalJSON() ([]byte, error) {
 	type InfoAlias Info // alias to shed existing MarshalJSON implementation
-	var t string
-	if !im.CreatedAt.IsZero() {
-		t = im.CreatedAt.UTC().Format(time.RFC3339Nano)
-	}
 	encode := struct {
 		InfoAlias
 		CreatedAt string `json:",omitempty"`
-	}{InfoAlias(im), t}
+		FirstSeen string `json:",omitempty"`
+	}{InfoAlias(im), formatTime(im.CreatedAt), formatTime(im.FirstSeen)}
 	return json.Marshal(encode)
 }
 
@@ -261,19 +378,79 @@ func (im *Info) UnmarshalJSON(b []byte) error {
 	unencode := struct {
 		InfoAlias
 		CreatedAt string `json:",omitempty"`
+		FirstSeen string `json:",omitempty"`
 	}{}
 	json.Unmarshal(b, &unencode)
 	*im = Info(unencode.InfoAlias)
-	if unencode.CreatedAt == "" {
-		im.CreatedAt = time.Time{}
-	} else {
-		t, err := time.Parse(time.RFC3339, unencode.CreatedAt)
-		if err != nil {
-			return err
-		}
-		im.CreatedAt = t.UTC()
+	var err error
+	if im.CreatedAt, err = parseTime(unencode.CreatedAt); err != nil {
+		return err
+	}
+	im.FirstSeen, err = parseTime(unencode.FirstSeen)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
 	}
-	return nil
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// Labels conventionally used to record the revision of the source
+// from which an image was built; see
+// https://github.com/opencontainers/image-spec/blob/master/annotations.md
+// and http://label-schema.org/rc1/.
+const (
+	LabelRevision       = "org.opencontainers.image.revision"
+	LabelSchemaRevision = "org.label-schema.vcs-ref"
+)
+
+// Revision returns the revision (e.g., git commit) from which the
+// image was built, if it's recorded in the image's labels.
+func (im Info) Revision() string {
+	if rev := im.Labels[LabelRevision]; rev != "" {
+		return rev
+	}
+	return im.Labels[LabelSchemaRevision]
+}
+
+// CreatedTS returns the time at which the image was created or,
+// failing that, when it was first seen; either may be zero.
+func (im Info) CreatedTS() time.Time {
+	if !im.CreatedAt.IsZero() {
+		return im.CreatedAt
+	}
+	return im.FirstSeen
+}
+
+// Matches reports whether the image described is that referred to by
+// the ref given; by digest, if the ref has one, otherwise by tag.
+func (im Info) Matches(ref Ref) bool {
+	if im.ID.CanonicalName() != ref.CanonicalName() {
+		return false
+	}
+	if ref.Digest != "" {
+		return im.HasDigest(ref.Digest)
+	}
+	return im.ID.Equivalent(ref)
+}
+
+// HasDigest reports whether the digest given is that of the image's
+// manifest, or of the manifest list it's in.
+func (im Info) HasDigest(digest string) bool {
+	return digest != "" && (im.Digest == digest || im.ListDigest == digest)
 }
 
 // ByCreatedDesc is a shim used to sort image info by creation date
@@ -282,14 +459,5 @@ type ByCreatedDesc []Info
 func (is ByCreatedDesc) Len() int      { return len(is) }
 func (is ByCreatedDesc) Swap(i, j int) { is[i], is[j] = is[j], is[i] }
 func (is ByCreatedDesc) Less(i, j int) bool {
-	switch {
-	case is[i].CreatedAt.IsZero():
-		return true
-	case is[j].CreatedAt.IsZero():
-		return false
-	case is[i].CreatedAt.Equal(is[j].CreatedAt):
-		return is[i].ID.String() < is[j].ID.String()
-	default:
-		return is[i].CreatedAt.After(is[j].CreatedAt)
-	}
+	return NewerByCreated(&is[i], &is[j])
 }
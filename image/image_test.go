@@ -6,11 +6,16 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
-const constTime = "2017-01-13T16:22:58.009923189Z"
+const (
+	constTime = "2017-01-13T16:22:58.009923189Z"
+	digestA   = "sha256:7df6db5aa61ae9480f52f0b3a06a140ab98d427f86d8d5de0bedab9b8df6b1c0"
+	digestB   = "sha256:0e2b2e7bd0d5bcb5e2e5a189880b8e6a1e7bb7baf9e6d1d0b3a8ab2f1d3ac1b9"
+)
 
 var (
 	testTime, _ = time.Parse(time.RFC3339Nano, constTime)
@@ -43,6 +48,10 @@ func TestParseRef(t *testing.T) {
 		{"alpine:mytag", dockerHubHost, "library/alpine", "index.docker.io/library/alpine:mytag"},
 		// The old registry path should be replaced with the new one
 		{"docker.io/library/alpine", dockerHubHost, "library/alpine", "index.docker.io/library/alpine"},
+		{"docker.io/alpine", dockerHubHost, "library/alpine", "index.docker.io/library/alpine"},
+		{"registry-1.docker.io/library/alpine:3.5", dockerHubHost, "library/alpine", "index.docker.io/library/alpine:3.5"},
+		// Domains are not case sensitive
+		{"Quay.io/weaveworks/flux:1.0", "quay.io", "weaveworks/flux", "quay.io/weaveworks/flux:1.0"},
 		// It's possible to have a domain with a single-element path
 		{"localhost/hello:v1.1", "localhost", "hello", "localhost/hello:v1.1"},
 		{"localhost:5000/hello:v1.1", "localhost:5000", "hello", "localhost:5000/hello:v1.1"},
@@ -52,6 +61,10 @@ func TestParseRef(t *testing.T) {
 		{"quay.io/library/alpine:latest", "quay.io", "library/alpine", "quay.io/library/alpine:latest"},
 		{"quay.io/library/alpine:mytag", "quay.io", "library/alpine", "quay.io/library/alpine:mytag"},
 		{"localhost:5000/path/to/repo/alpine:mytag", "localhost:5000", "path/to/repo/alpine", "localhost:5000/path/to/repo/alpine:mytag"},
+		// Images can be pinned by digest, with or without a tag
+		{"alpine@" + digestA, dockerHubHost, "library/alpine", "index.docker.io/library/alpine@" + digestA},
+		{"alpine:3.5@" + digestA, dockerHubHost, "library/alpine", "index.docker.io/library/alpine:3.5@" + digestA},
+		{"localhost:5000/hello@" + digestA, "localhost:5000", "hello", "localhost:5000/hello@" + digestA},
 	} {
 		i, err := ParseRef(x.test)
 		if err != nil {
@@ -72,6 +85,72 @@ func TestParseRef(t *testing.T) {
 	}
 }
 
+func TestRefEquivalent(t *testing.T) {
+	for _, x := range []struct {
+		a, b       string
+		equivalent bool
+	}{
+		{"nginx", "docker.io/library/nginx:latest", true},
+		{"nginx", "index.docker.io/nginx", true},
+		{"nginx:1.15", "registry-1.docker.io/library/nginx:1.15", true},
+		{"quay.io/weaveworks/flux:1.0", "QUAY.IO/weaveworks/flux:1.0", true},
+		{"nginx", "nginx:1.15", false},
+		{"nginx", "quay.io/nginx", false},
+		{"weaveworks/flux", "quay.io/weaveworks/flux", false},
+		{"nginx@" + digestA, "docker.io/library/nginx:1.15@" + digestA, true},
+		{"nginx@" + digestA, "nginx@" + digestB, false},
+		{"nginx:1.15@" + digestA, "nginx:1.15", false},
+	} {
+		a, b := mustParseRef(x.a), mustParseRef(x.b)
+		if a.Equivalent(b) != x.equivalent || b.Equivalent(a) != x.equivalent {
+			t.Errorf("expected %q equivalent to %q to be %v", x.a, x.b, x.equivalent)
+		}
+	}
+}
+
+func TestUpdatedTo(t *testing.T) {
+	latest := Info{ID: mustParseRef("index.docker.io/library/nginx:1.15"), Digest: digestB}
+	for _, x := range []struct {
+		current, expected string
+	}{
+		{"nginx:1.14", "nginx:1.15"},
+		{"nginx@" + digestA, "nginx:1.15@" + digestB},
+		{"docker.io/nginx:1.14@" + digestA, "docker.io/nginx:1.15@" + digestB},
+	} {
+		if got := mustParseRef(x.current).UpdatedTo(latest); got.String() != x.expected {
+			t.Errorf("updating %q: expected %q, got %q", x.current, x.expected, got.String())
+		}
+		if !latest.Matches(mustParseRef(x.expected)) {
+			t.Errorf("expected %q to match %q", x.expected, latest.ID)
+		}
+	}
+}
+
+func TestListDigest(t *testing.T) {
+	platformDigest := "sha256:" + strings.Repeat("c", 64)
+	info := Info{ID: mustParseRef("nginx:1.15"), Digest: platformDigest, ListDigest: digestB}
+	for _, ref := range []string{"nginx@" + digestB, "nginx:1.15@" + platformDigest, "nginx:1.15"} {
+		if !info.Matches(mustParseRef(ref)) {
+			t.Errorf("expected %s to match %+v", ref, info)
+		}
+	}
+	if info.Matches(mustParseRef("nginx@" + digestA)) {
+		t.Errorf("expected %s not to match %+v", digestA, info)
+	}
+	// Pinned refs are updated to the manifest list, so they work on any platform
+	if got := mustParseRef("nginx:1.14@" + digestA).UpdatedTo(info); got.String() != "nginx:1.15@"+digestB {
+		t.Errorf("expected update to pin the manifest list digest, got %s", got)
+	}
+}
+
+func mustParseRef(s string) Ref {
+	r, err := ParseRef(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
 func TestParseRefErrorCases(t *testing.T) {
 	for _, x := range []struct {
 		test string
@@ -80,6 +159,10 @@ func TestParseRefErrorCases(t *testing.T) {
 		{":tag"},
 		{"/leading/slash"},
 		{"trailing/slash/"},
+		{"alpine@"},
+		{"alpine@sha256"},
+		{"@" + digestA},
+		{"alpine@sha256:abc@" + digestA},
 	} {
 		_, err := ParseRef(x.test)
 		if err == nil {
@@ -151,6 +234,8 @@ func TestImageInfoSerialisation(t *testing.T) {
 	info := mustMakeInfo("my/image:tag", t0)
 	info.Digest = "sha256:digest"
 	info.ImageID = "sha256:layerID"
+	info.FirstSeen = t0.Add(-time.Hour)
+	info.Labels = map[string]string{LabelRevision: "abc123"}
 	bytes, err := json.Marshal(info)
 	if err != nil {
 		t.Fatal(err)
@@ -175,8 +260,10 @@ func TestImageInfoCreatedAtZero(t *testing.T) {
 	if err = json.Unmarshal(bytes, &info1); err != nil {
 		t.Fatal(err)
 	}
-	if _, ok := info1["CreatedAt"]; ok {
-		t.Errorf("serialised Info included zero time field; expected it to be omitted\n%s", string(bytes))
+	for _, field := range []string{"CreatedAt", "FirstSeen"} {
+		if _, ok := info1[field]; ok {
+			t.Errorf("serialised Info included zero time field %s; expected it to be omitted\n%s", field, string(bytes))
+		}
 	}
 }
 
@@ -199,3 +286,197 @@ func TestImage_OrderByCreationDate(t *testing.T) {
 		}
 	}
 }
+
+func TestImage_OrderWithoutTimestamps(t *testing.T) {
+	imA := mustMakeInfo("my/image:a", time.Time{})
+	imB := mustMakeInfo("my/image:b", time.Time{})
+	if NewerByCreated(&imA, &imB) == NewerByCreated(&imB, &imA) {
+		t.Fatal("expected images without timestamps to be ordered one way or the other")
+	}
+	imgs := []Info{imB, mustMakeInfo("my/image:c", testTime), imA}
+	Sort(imgs, NewerByCreated)
+	if imgs[0].ID.Tag != "a" || imgs[1].ID.Tag != "b" || imgs[2].ID.Tag != "c" {
+		t.Errorf("expected images without timestamps first, by ID, got %v", imgs)
+	}
+}
+
+func TestImage_OrderBySemver(t *testing.T) {
+	// tags listed in the order expected after sorting
+	tags := []string{"v2.0.0", "1.10", "1.10.0", "1.9.3", "1.9.3-rc.2", "1.9.3-rc.1", "1.9.3-beta", "1.2.0", "latest", "master-abc123"}
+	var imgs []Info
+	for i := len(tags) - 1; i >= 0; i-- {
+		imgs = append(imgs, mustMakeInfo("my/image:"+tags[i], testTime.Add(time.Duration(i)*time.Second)))
+	}
+	Sort(imgs, NewerBySemver)
+	for i, im := range imgs {
+		if im.ID.Tag != tags[i] {
+			for j, jim := range imgs {
+				t.Logf("%v: %v", j, jim.ID.String())
+			}
+			t.Fatalf("Not sorted in expected order at %d: expected %s, got %s", i, tags[i], im.ID.Tag)
+		}
+	}
+}
+
+func TestImage_OrderByFirstSeen(t *testing.T) {
+	imA := mustMakeInfo("my/image:0", time.Time{})
+	imB := mustMakeInfo("my/image:1", testTime)
+	imC := mustMakeInfo("my/image:2", time.Time{})
+	imB.FirstSeen = testTime.Add(time.Hour) // ignored, since there's a creation time
+	imA.FirstSeen = testTime.Add(time.Second)
+	imC.FirstSeen = testTime.Add(-time.Second)
+	imgs := []Info{imC, imB, imA}
+	Sort(imgs, NewerByCreated)
+	for i, im := range imgs {
+		if strconv.Itoa(i) != im.ID.Tag {
+			t.Fatalf("Not sorted in expected order at %d: got %s", i, im.ID.Tag)
+		}
+	}
+}
+
+func TestTagDatePattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		tag     string
+		want    time.Time
+		ok      bool
+	}{
+		{`(\d{8})=20060102`, "master-20181014-abc123", time.Date(2018, 10, 14, 0, 0, 0, 0, time.UTC), true},
+		{`\d{4}-\d{2}-\d{2}=2006-01-02`, "build-2018-10-14", time.Date(2018, 10, 14, 0, 0, 0, 0, time.UTC), true},
+		{`(\d{8})=20060102`, "master-abc123", time.Time{}, false},
+		{`(\d{8})=20060102`, "master-20181399", time.Time{}, false},
+	} {
+		p, err := ParseTagDatePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := p.Time(tt.tag)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("%q on %q: expected %v, %v; got %v, %v", tt.pattern, tt.tag, tt.want, tt.ok, got, ok)
+		}
+	}
+
+	for _, bad := range []string{"", "(\\d{8})", "=20060102", "(\\d{8})=", "(=20060102"} {
+		if _, err := ParseTagDatePattern(bad); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestTimestampFallback(t *testing.T) {
+	p, err := ParseTagDatePattern(`(\d{8})=20060102`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := testTime.Add(time.Hour)
+	fallback := TimestampFallback{TagDates: []TagDatePattern{p}, FirstSeen: true}
+
+	created := mustMakeInfo("my/image:20181014", testTime)
+	fallback.Apply(&created, seen)
+	if !created.CreatedAt.Equal(testTime) || !created.FirstSeen.IsZero() {
+		t.Errorf("expected image with creation time to be left alone, got %#v", created)
+	}
+
+	dated := mustMakeInfo("my/image:20181014", time.Time{})
+	fallback.Apply(&dated, seen)
+	if !dated.CreatedAt.Equal(time.Date(2018, 10, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected creation time from tag, got %#v", dated)
+	}
+
+	undated := mustMakeInfo("my/image:latest", time.Time{})
+	fallback.Apply(&undated, seen)
+	if !undated.CreatedAt.IsZero() || !undated.FirstSeen.Equal(seen) {
+		t.Errorf("expected first seen time, got %#v", undated)
+	}
+
+	fallback.FirstSeen = false
+	undated = mustMakeInfo("my/image:latest", time.Time{})
+	fallback.Apply(&undated, seen)
+	if !undated.FirstSeen.IsZero() {
+		t.Errorf("expected no first seen time, got %#v", undated)
+	}
+}
+
+func TestExclusions(t *testing.T) {
+	now := testTime.Add(48 * time.Hour)
+	old := mustMakeInfo("my/image:old", testTime)
+	recent := mustMakeInfo("my/image:recent", now.Add(-time.Hour))
+	undated := mustMakeInfo("my/image:undated", time.Time{})
+	seen := mustMakeInfo("my/image:seen", time.Time{})
+	seen.FirstSeen = testTime
+	rc := mustMakeInfo("my/image:1.0-rc1", now)
+	infos := []Info{old, recent, undated, seen, rc}
+
+	ex := Exclusions{OlderThan: 24 * time.Hour, Tags: []string{"*-rc*"}}
+	var got []string
+	for _, im := range ex.Filter(infos, now) {
+		got = append(got, im.ID.Tag)
+	}
+	if !reflect.DeepEqual(got, []string{"recent", "undated"}) {
+		t.Errorf("expected only recent and undated images, got %v", got)
+	}
+
+	if res := (Exclusions{}).Filter(infos, now); len(res) != len(infos) {
+		t.Errorf("expected no exclusions to exclude nothing, got %v", res)
+	}
+	if res := ex.Filter(nil, now); res != nil {
+		t.Errorf("expected nil for nil, got %#v", res)
+	}
+	if res := ex.Filter([]Info{rc}, now); res == nil || len(res) != 0 {
+		t.Errorf("expected empty non-nil result, got %#v", res)
+	}
+}
+
+func TestImageRevision(t *testing.T) {
+	info := mustMakeInfo("my/image:tag", testTime)
+	if rev := info.Revision(); rev != "" {
+		t.Errorf("expected no revision, got %q", rev)
+	}
+	info.Labels = map[string]string{LabelSchemaRevision: "abc123"}
+	if rev := info.Revision(); rev != "abc123" {
+		t.Errorf("expected revision from label-schema label, got %q", rev)
+	}
+	info.Labels[LabelRevision] = "def456"
+	if rev := info.Revision(); rev != "def456" {
+		t.Errorf("expected revision from OCI label in preference, got %q", rev)
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	for _, s := range []string{"linux", "linux/amd64", "linux/arm/v7", "windows/amd64"} {
+		p, err := ParsePlatform(s)
+		if err != nil {
+			t.Errorf("parsing %q: %v", s, err)
+		}
+		if p.String() != s {
+			t.Errorf("expected %q to roundtrip, got %q", s, p.String())
+		}
+	}
+	for _, s := range []string{"", "/amd64", "linux/arm/v7/extra"} {
+		if _, err := ParsePlatform(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestInfoForPlatform(t *testing.T) {
+	info := mustMakeInfo("my/image:tag", testTime)
+	info.OS, info.Arch, info.Digest = "linux", "amd64", digestA
+	info.Variants = []Variant{
+		{Platform: Platform{OS: "windows", Arch: "amd64"}, Digest: digestB, CreatedAt: testTime.Add(time.Hour)},
+	}
+
+	if got := info.ForPlatform(Platform{}); got.Digest != digestA {
+		t.Errorf("expected unspecified platform to leave info alone, got %#v", got)
+	}
+	if got := info.ForPlatform(Platform{Arch: "amd64"}); got.Digest != digestA {
+		t.Errorf("expected matching platform to leave info alone, got %#v", got)
+	}
+	got := info.ForPlatform(Platform{OS: "windows"})
+	if got.Digest != digestB || !got.CreatedAt.Equal(testTime.Add(time.Hour)) || got.OS != "windows" {
+		t.Errorf("expected windows variant, got %#v", got)
+	}
+	if got := info.ForPlatform(Platform{OS: "linux", Arch: "arm64"}); got.Digest != digestA {
+		t.Errorf("expected info as is for platform with no variant, got %#v", got)
+	}
+}
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// Newer is an ordering of images, which reports whether the image
+// `lhs` should come before the image `rhs` when sorting images newest
+// first.
+type Newer func(lhs, rhs *Info) bool
+
+// NewerByCreated orders images by creation time (or the time first
+// seen, if there's no creation time), most recent first. Images
+// without either come before all others, and images created at the
+// same time (or both without a time) are ordered by ID.
+func NewerByCreated(lhs, rhs *Info) bool {
+	lt, rt := lhs.CreatedTS(), rhs.CreatedTS()
+	switch {
+	case lt.Equal(rt):
+		return lhs.ID.String() < rhs.ID.String()
+	case lt.IsZero():
+		return true
+	case rt.IsZero():
+		return false
+	default:
+		return lt.After(rt)
+	}
+}
+
+// NewerBySemver orders images by treating their tags as semantic
+// versions, highest version first. The rules for precedence are those
+// of semver.org: a prerelease comes before the release it precedes,
+// and build metadata is ignored. Tags that are not valid versions
+// come after all that are, ordered by ID.
+func NewerBySemver(lhs, rhs *Info) bool {
+	lv, lerr := semver.NewVersion(lhs.ID.Tag)
+	rv, rerr := semver.NewVersion(rhs.ID.Tag)
+	switch {
+	case lerr != nil && rerr != nil:
+		return lhs.ID.String() < rhs.ID.String()
+	case lerr != nil:
+		return false
+	case rerr != nil:
+		return true
+	}
+	cmp := lv.Compare(rv)
+	if cmp == 0 {
+		// e.g., `1.10` and `1.10.0`, or `1.0.0+a` and `1.0.0+b`,
+		// are the same version but distinct tags; keep the order
+		// stable.
+		return lv.Original() < rv.Original()
+	}
+	return cmp > 0
+}
+
+// Sort orders the images given, newest first according to `newer`;
+// if `newer` is nil, by creation time.
+func Sort(infos []Info, newer Newer) {
+	if newer == nil {
+		newer = NewerByCreated
+	}
+	sort.Sort(&infoSort{infos: infos, newer: newer})
+}
+
+type infoSort struct {
+	infos []Info
+	newer Newer
+}
+
+func (s *infoSort) Len() int {
+	return len(s.infos)
+}
+
+func (s *infoSort) Swap(i, j int) {
+	s.infos[i], s.infos[j] = s.infos[j], s.infos[i]
+}
+
+func (s *infoSort) Less(i, j int) bool {
+	return s.newer(&s.infos[i], &s.infos[j])
+}
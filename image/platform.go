@@ -0,0 +1,98 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Platform is the operating system and architecture an image is
+// built for, as given in manifest lists (multi-platform images).
+type Platform struct {
+	OS      string `json:",omitempty"`
+	Arch    string `json:",omitempty"`
+	Variant string `json:",omitempty"`
+}
+
+// DefaultPlatform is the platform assumed when none is otherwise
+// given.
+var DefaultPlatform = Platform{OS: "linux", Arch: "amd64"}
+
+// ParsePlatform parses a platform given as `<os>[/<arch>[/<variant>]]`,
+// e.g., `linux/amd64`, `windows`, or `linux/arm/v7`.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q; expected <os>[/<arch>[/<variant>]]", s)
+	}
+	var p Platform
+	p.OS = parts[0]
+	if len(parts) > 1 {
+		p.Arch = parts[1]
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+func (p Platform) String() string {
+	s := p.OS
+	if p.Arch != "" {
+		s += "/" + p.Arch
+	}
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// IsZero reports whether the platform is unspecified.
+func (p Platform) IsZero() bool {
+	return p == Platform{}
+}
+
+// Matches reports whether the platform given satisfies this one;
+// i.e., agrees on each of the fields this platform specifies. So
+// `windows` matches `windows/amd64`, but not the other way around.
+func (p Platform) Matches(other Platform) bool {
+	return (p.OS == "" || strings.EqualFold(p.OS, other.OS)) &&
+		(p.Arch == "" || strings.EqualFold(p.Arch, other.Arch)) &&
+		(p.Variant == "" || strings.EqualFold(p.Variant, other.Variant))
+}
+
+// Variant is the metadata for an image built for a particular
+// platform, other than the one described by the Info it is part of.
+type Variant struct {
+	Platform
+	Digest    string    `json:",omitempty"`
+	ImageID   string    `json:",omitempty"`
+	CreatedAt time.Time `json:",omitempty"`
+}
+
+// Platform returns the platform the image metadata is for;
+// unspecified fields are empty.
+func (im Info) Platform() Platform {
+	return Platform{OS: im.OS, Arch: im.Arch}
+}
+
+// ForPlatform returns the image metadata as it applies to the
+// platform given; that is, for a multi-platform image, the digest,
+// image ID and creation time of the variant built for that
+// platform. If the platform is unspecified, or there's no such
+// variant, the metadata is returned as is.
+func (im Info) ForPlatform(p Platform) Info {
+	if p.IsZero() || p.Matches(im.Platform()) {
+		return im
+	}
+	for _, v := range im.Variants {
+		if p.Matches(v.Platform) {
+			im.OS, im.Arch = v.OS, v.Arch
+			im.Digest = v.Digest
+			im.ImageID = v.ImageID
+			im.CreatedAt = v.CreatedAt
+			return im
+		}
+	}
+	return im
+}
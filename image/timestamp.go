@@ -0,0 +1,80 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TagDatePattern finds a date embedded in an image tag, e.g., the
+// `20181014` in `master-20181014-abc123`. It is a regular expression
+// that finds the date in the tag, and a Go time layout (as in
+// `time.Parse`) for parsing it. If the expression has a capture
+// group, the first group is parsed; otherwise, the whole match.
+type TagDatePattern struct {
+	re     *regexp.Regexp
+	layout string
+}
+
+// ParseTagDatePattern parses a pattern given as
+// `<regexp>=<layout>`, e.g., `(\d{8})=20060102`.
+func ParseTagDatePattern(s string) (TagDatePattern, error) {
+	eq := strings.LastIndex(s, "=")
+	if eq <= 0 || eq == len(s)-1 {
+		return TagDatePattern{}, fmt.Errorf("invalid tag date pattern %q; expected <regexp>=<layout>", s)
+	}
+	re, err := regexp.Compile(s[:eq])
+	if err != nil {
+		return TagDatePattern{}, err
+	}
+	return TagDatePattern{re: re, layout: s[eq+1:]}, nil
+}
+
+// Time returns the date found in the tag, if there is one.
+func (p TagDatePattern) Time(tag string) (time.Time, bool) {
+	match := p.re.FindStringSubmatch(tag)
+	if match == nil {
+		return time.Time{}, false
+	}
+	s := match[0]
+	if len(match) > 1 {
+		s = match[1]
+	}
+	t, err := time.Parse(p.layout, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// TimestampFallback says how to date images for which the registry
+// gives no creation time (e.g., some schema1 manifests, or those
+// served by some proxies), so that they can still be ordered
+// usefully.
+type TimestampFallback struct {
+	// Patterns used, in order, to find a date in the tag; the first
+	// to match is used as the creation time
+	TagDates []TagDatePattern
+	// Whether to record when each image was first seen, which is
+	// used in place of a creation time if there is still none
+	FirstSeen bool
+}
+
+// Apply adjusts the image info given (or not), according to the
+// fallbacks. `firstSeen` is the time the image was first seen, which
+// is used if there's no date in the tag and it's called for.
+func (f TimestampFallback) Apply(im *Info, firstSeen time.Time) {
+	if !im.CreatedAt.IsZero() {
+		return
+	}
+	for _, p := range f.TagDates {
+		if t, ok := p.Time(im.ID.Tag); ok {
+			im.CreatedAt = t
+			return
+		}
+	}
+	if f.FirstSeen && im.FirstSeen.IsZero() {
+		im.FirstSeen = firstSeen.UTC()
+	}
+}
@@ -0,0 +1,120 @@
+package image
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// CalVer is a version scheme for calendar-versioned tags, e.g.,
+// `2018.10.14`, `18.10`, `v2018-10-14.3` or `20181014`. The captured
+// components are year, month, day and a micro (build) number; only the
+// year and month are required.
+//
+// Two-digit years are taken to be in this century, so that `18.11`
+// is newer than `2018.10`.
+var CalVer = func() *VersionScheme {
+	s := MustVersionScheme(`^v?(\d{4}|\d{2})[.\-_]?(\d{1,2})(?:[.\-_]?(\d{1,2}))?(?:[.\-_](\d+))?$`)
+	s.normalise = func(components []string) {
+		if len(components[1]) == 2 {
+			components[1] = "20" + components[1]
+		}
+	}
+	return s
+}()
+
+// VersionScheme orders tags by the components captured by a regular
+// expression. The components are compared in the order they are
+// captured, numerically if both are numbers, otherwise
+// lexically. This makes it possible to order tags that are dates or
+// build numbers, rather than semantic versions.
+type VersionScheme struct {
+	re *regexp.Regexp
+	// normalise, if set, rewrites the components captured so they can
+	// be compared
+	normalise func(components []string)
+}
+
+// NewVersionScheme compiles the expression given, which must have at
+// least one capture group.
+func NewVersionScheme(expr string) (*VersionScheme, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("version scheme %q has no capture groups", expr)
+	}
+	return &VersionScheme{re: re}, nil
+}
+
+// MustVersionScheme is NewVersionScheme which panics on error, for
+// package-level schemes.
+func MustVersionScheme(expr string) *VersionScheme {
+	s, err := NewVersionScheme(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *VersionScheme) String() string {
+	return s.re.String()
+}
+
+// Matches reports whether the tag is a version in this scheme.
+func (s *VersionScheme) Matches(tag string) bool {
+	return s.re.MatchString(tag)
+}
+
+// Newer orders images by version in this scheme, highest first. A
+// component that wasn't captured comes before any that was, so
+// `2018.10` is older than `2018.10.1`. Tags that are not versions in
+// this scheme come after all that are, ordered by ID.
+func (s *VersionScheme) Newer(lhs, rhs *Info) bool {
+	lv, rv := s.re.FindStringSubmatch(lhs.ID.Tag), s.re.FindStringSubmatch(rhs.ID.Tag)
+	switch {
+	case lv == nil && rv == nil:
+		return lhs.ID.String() < rhs.ID.String()
+	case lv == nil:
+		return false
+	case rv == nil:
+		return true
+	}
+	if s.normalise != nil {
+		s.normalise(lv)
+		s.normalise(rv)
+	}
+	for i := 1; i < len(lv); i++ {
+		if cmp := compareComponent(lv[i], rv[i]); cmp != 0 {
+			return cmp > 0
+		}
+	}
+	return lhs.ID.String() < rhs.ID.String()
+}
+
+func compareComponent(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	an, aerr := strconv.ParseUint(a, 10, 64)
+	bn, berr := strconv.ParseUint(b, 10, 64)
+	if aerr == nil && berr == nil {
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	}
+	if a < b {
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,123 @@
+// Package install makes the manifests for running fluxd in a
+// cluster: the deployment and its service account, the RBAC rules
+// letting it manage the cluster, the secret holding its SSH key, and
+// (unless image scanning is disabled) memcached.
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
+)
+
+// ImageRepository is where the fluxd images are published.
+const ImageRepository = "quay.io/weaveworks/flux"
+
+// DefaultImage gives the fluxd image for the version given, which is
+// that of the fluxctl making the manifests; or, for a build with no
+// version, the latest image.
+func DefaultImage(version string) string {
+	if version == "" || version == "unversioned" {
+		version = "latest"
+	}
+	return ImageRepository + ":" + version
+}
+
+// TemplateParameters are the settings the manifests are made from.
+type TemplateParameters struct {
+	GitURL    string
+	GitBranch string
+	// GitPath is the path within the repo to find the manifests in;
+	// the whole repo, if empty
+	GitPath   string
+	Namespace string
+	// Image is the fluxd image to run; the latest, if empty
+	Image string
+	// RegistryScanning is whether fluxd scans image registries for
+	// new images; if not, memcached isn't needed
+	RegistryScanning bool
+	// AdditionalFluxArgs are more arguments for fluxd
+	AdditionalFluxArgs []string
+}
+
+var namespaceRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// FillInTemplates makes the manifests, given the parameters. They're
+// returned by file name, so they can be written out as files; or
+// given to kubectl in the order of ManifestNames.
+func FillInTemplates(params TemplateParameters) (map[string][]byte, error) {
+	if params.GitURL == "" {
+		return nil, errors.New("no git URL given")
+	}
+	if params.GitBranch == "" {
+		params.GitBranch = "master"
+	}
+	if params.Namespace == "" {
+		params.Namespace = "default"
+	}
+	if !namespaceRegexp.MatchString(params.Namespace) {
+		return nil, fmt.Errorf("invalid namespace %q; it must be lower case letters, numbers and '-', starting and ending with a letter or number", params.Namespace)
+	}
+	if params.Image == "" {
+		params.Image = DefaultImage("")
+	}
+
+	result := map[string][]byte{}
+	for name, text := range templates {
+		if name == "memcache-dep.yaml" || name == "memcache-svc.yaml" {
+			if !params.RegistryScanning {
+				continue
+			}
+		}
+		if name == "flux-namespace.yaml" && params.Namespace == "default" {
+			continue
+		}
+		tmpl, err := template.New(name).Funcs(template.FuncMap{"quote": quote}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing template %s: %s", name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, params); err != nil {
+			return nil, fmt.Errorf("filling in template %s: %s", name, err)
+		}
+		result[name] = buf.Bytes()
+	}
+	return result, nil
+}
+
+// ManifestNames gives the names of the manifests in the order they
+// should be applied, so that, e.g., a namespace is created before
+// anything in it.
+func ManifestNames(manifests map[string][]byte) []string {
+	var names []string
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if oi, oj := order(names[i]), order(names[j]); oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func order(name string) int {
+	switch name {
+	case "flux-namespace.yaml":
+		return 0
+	case "flux-deployment.yaml":
+		// Last, so everything it needs is there when it starts
+		return 2
+	}
+	return 1
+}
+
+// quote makes a string safe to use as a YAML scalar, by giving it
+// in double quotes (as JSON would, which YAML understands).
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
@@ -0,0 +1,117 @@
+package install
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	kresource "github.com/weaveworks/flux/cluster/kubernetes/resource"
+	"github.com/weaveworks/flux/resource"
+)
+
+func render(t *testing.T, params TemplateParameters) map[string]resource.Resource {
+	manifests, err := FillInTemplates(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all bytes.Buffer
+	for _, name := range ManifestNames(manifests) {
+		all.Write(manifests[name])
+	}
+	resources, err := kresource.ParseMultidoc(all.Bytes(), "install")
+	if err != nil {
+		t.Fatalf("manifests don't parse: %s\n%s", err, all.String())
+	}
+	return resources
+}
+
+func TestFillInTemplates(t *testing.T) {
+	resources := render(t, TemplateParameters{
+		GitURL:           "git@github.com:weaveworks/flux-example",
+		GitPath:          "workloads",
+		Namespace:        "flux",
+		RegistryScanning: true,
+	})
+	// Resources without a namespace are parsed as being in "default"
+	for _, id := range []string{
+		"default:namespace/flux",
+		"flux:serviceaccount/flux",
+		"default:clusterrole/flux-flux",
+		"default:clusterrolebinding/flux-flux",
+		"flux:secret/flux-git-deploy",
+		"flux:deployment/flux",
+		"flux:deployment/memcached",
+		"flux:service/memcached",
+	} {
+		if _, ok := resources[id]; !ok {
+			t.Errorf("expected %s in manifests", id)
+		}
+	}
+
+	manifests, _ := FillInTemplates(TemplateParameters{
+		GitURL:           "git@github.com:weaveworks/flux-example",
+		GitPath:          "workloads: web",
+		RegistryScanning: true,
+	})
+	deployment := string(manifests["flux-deployment.yaml"])
+	for _, arg := range []string{
+		`- "--git-url=git@github.com:weaveworks/flux-example"`,
+		`- "--git-branch=master"`,
+		`- "--git-path=workloads: web"`,
+		`- --memcached-hostname=memcached.default.svc.cluster.local`,
+	} {
+		if !strings.Contains(deployment, arg) {
+			t.Errorf("expected deployment to have %s, got\n%s", arg, deployment)
+		}
+	}
+	if _, ok := manifests["flux-namespace.yaml"]; ok {
+		t.Error("expected no namespace to be made for the namespace default")
+	}
+}
+
+func TestNoRegistryScanning(t *testing.T) {
+	resources := render(t, TemplateParameters{GitURL: "git@github.com:weaveworks/flux-example"})
+	if _, ok := resources["default:deployment/memcached"]; ok {
+		t.Error("expected no memcached when registry scanning is disabled")
+	}
+	manifests, _ := FillInTemplates(TemplateParameters{GitURL: "git@github.com:weaveworks/flux-example"})
+	if !strings.Contains(string(manifests["flux-deployment.yaml"]), "- --registry-disable-scanning") {
+		t.Error("expected fluxd to be told not to scan registries")
+	}
+}
+
+func TestFillInTemplatesErrors(t *testing.T) {
+	for _, params := range []TemplateParameters{
+		{},
+		{GitURL: "git@github.com:weaveworks/flux-example", Namespace: "Not_A_Namespace"},
+	} {
+		if _, err := FillInTemplates(params); err == nil {
+			t.Errorf("expected error from %+v", params)
+		}
+	}
+}
+
+// Installs in different namespaces don't share cluster-wide resources,
+// so one doesn't replace the other's
+func TestFillInTemplatesNamespaces(t *testing.T) {
+	for _, ns := range []string{"default", "flux"} {
+		resources := render(t, TemplateParameters{GitURL: "git@github.com:weaveworks/flux-example", Namespace: ns})
+		for _, id := range []string{"default:clusterrole/flux-" + ns, "default:clusterrolebinding/flux-" + ns} {
+			if _, ok := resources[id]; !ok {
+				t.Errorf("expected %s in manifests for namespace %s", id, ns)
+			}
+		}
+	}
+}
+
+func TestDefaultImage(t *testing.T) {
+	for version, image := range map[string]string{
+		"1.8.0":       "quay.io/weaveworks/flux:1.8.0",
+		"":            "quay.io/weaveworks/flux:latest",
+		"unversioned": "quay.io/weaveworks/flux:latest",
+	} {
+		if got := DefaultImage(version); got != image {
+			t.Errorf("expected image %s for version %q, got %s", image, version, got)
+		}
+	}
+}
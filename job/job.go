@@ -33,6 +33,20 @@ type Result struct {
 	Revision string        `json:"revision,omitempty"`
 	Spec     *update.Spec  `json:"spec,omitempty"`
 	Result   update.Result `json:"result,omitempty"`
+	// Proposals are the branches the changes were pushed to, for
+	// review, instead of to the branch synced
+	Proposals []Proposal `json:"proposals,omitempty"`
+}
+
+// Proposal is a branch with changes to be reviewed, and merged into
+// the branch synced, rather than being committed to it directly.
+type Proposal struct {
+	Branch   string `json:"branch"`
+	Revision string `json:"revision"`
+	URL      string `json:"url,omitempty"` // of the merge request, if one was opened
+	// Pending is true if the same changes were proposed already, so
+	// the branch was there before
+	Pending bool `json:"pending,omitempty"`
 }
 
 // Status holds the possible states of a job; either,
@@ -8,6 +8,9 @@ const (
 	LabelRoute   = "route"
 	LabelMethod  = "method"
 	LabelSuccess = "success"
+	LabelStatus  = "status"
+	LabelURL     = "url"
+	LabelHost    = "host"
 
 	// Labels for release metrics
 	LabelAction      = "action"
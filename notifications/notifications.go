@@ -0,0 +1,311 @@
+// Package notifications sends events from the daemon to places
+// other than the upstream service: Slack, and any HTTP endpoint that
+// will take a webhook.
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"gopkg.in/yaml.v2"
+
+	"github.com/weaveworks/flux/event"
+)
+
+const (
+	// How many events can be waiting for each sink, before more are
+	// dropped.
+	queueLength = 100
+	// How many times delivery of an event is tried, and the backoff
+	// between tries, which doubles each time up to the maximum.
+	maxAttempts    = 5
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+	// How long to wait for a sink to respond.
+	sendTimeout = 10 * time.Second
+)
+
+const (
+	SinkSlack   = "slack"
+	SinkWebhook = "webhook"
+)
+
+// SinkConfig configures one place to send events. Which of the
+// fields are used depends on the type of sink.
+type SinkConfig struct {
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+	// The types of event to send (e.g., release, autorelease, sync);
+	// all of them, if empty
+	Events []string `yaml:"events"`
+
+	// For Slack, the channel and user name to post as, if not those
+	// set in the incoming webhook
+	Channel  string `yaml:"channel"`
+	Username string `yaml:"username"`
+
+	// For webhooks, extra headers to send (e.g., for authorisation),
+	// and a template for the body, if not the event as JSON
+	Headers  map[string]string `yaml:"headers"`
+	Template string            `yaml:"template"`
+}
+
+type configFile struct {
+	Sinks []SinkConfig `yaml:"sinks"`
+}
+
+// ParseConfig parses a list of sinks, given in YAML like
+//
+//	sinks:
+//	- type: slack
+//	  url: https://hooks.slack.com/services/T000/B000/XXXX
+//	  channel: '#deploys'
+//	  events: [release, autorelease, sync_refused]
+//	- type: webhook
+//	  url: https://example.com/hooks/flux
+//	  headers:
+//	    Authorization: Bearer s3cr3t
+//	  template: '{"text": {{ json .Message }}}'
+//
+// and returns the sinks ready to use.
+func ParseConfig(data []byte) ([]Sink, error) {
+	var file configFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing notification sinks: %s", err)
+	}
+	var sinks []Sink
+	for i, c := range file.Sinks {
+		if c.URL == "" {
+			return nil, fmt.Errorf("sink %d has no url", i+1)
+		}
+		var (
+			sender sender
+			err    error
+		)
+		switch c.Type {
+		case SinkSlack:
+			sender = newSlack(c)
+		case SinkWebhook:
+			sender, err = newWebhook(c)
+		default:
+			err = fmt.Errorf("unknown type %q; expected %q or %q", c.Type, SinkSlack, SinkWebhook)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sink %d: %s", i+1, err)
+		}
+		sink := Sink{Name: fmt.Sprintf("%s %s", c.Type, redact(c.URL)), sender: sender}
+		if len(c.Events) > 0 {
+			sink.events = map[string]bool{}
+			for _, t := range c.Events {
+				sink.events[t] = true
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// redact gives a URL fit for logging. Slack webhook URLs, and others,
+// have the secret in the path, so only the scheme and host are kept.
+func redact(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// post sends the body given to the URL, and interprets the response.
+// Sinks mostly refuse bad requests with a 4xx status, which won't
+// get any better if retried, except when they're asking for requests
+// to slow down.
+func post(ctx context.Context, endpoint string, headers map[string]string, contentType string, body []byte) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "fluxd")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s responded with %s: %s", redact(endpoint), resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// sender sends a single event somewhere. An error that's a
+// permanentError won't be any different if tried again.
+type sender interface {
+	send(context.Context, event.Event) error
+}
+
+type permanentError struct {
+	error
+}
+
+// Sink is somewhere to send the events of the types it accepts.
+type Sink struct {
+	Name   string
+	sender sender
+	events map[string]bool
+}
+
+// Accepts says whether events of the type given should be sent to
+// the sink.
+func (s Sink) Accepts(eventType string) bool {
+	return s.events == nil || s.events[eventType]
+}
+
+// Writer is an EventWriter that sends each event to those of its
+// sinks that accept it, before passing it on to the EventWriter it
+// wraps, if there is one. The events are sent in the background, by
+// Loop, and retried with backoff if they fail, so that a sink being
+// slow or unavailable doesn't hold up the daemon. If a sink falls too
+// far behind, events for it are dropped.
+type Writer struct {
+	next    event.EventWriter
+	sinks   []Sink
+	links   []event.LinkTemplate
+	queues  []chan event.Event
+	digests []event.EventWriter
+	logger  log.Logger
+	backoff time.Duration
+}
+
+// NewWriter constructs a Writer sending events to the sinks given,
+// with links expanded from the templates given, once Loop has been
+// started; and passing them on as they are to `next`, which may be
+// nil.
+func NewWriter(next event.EventWriter, sinks []Sink, links []event.LinkTemplate, logger log.Logger) *Writer {
+	w := &Writer{
+		next:    next,
+		sinks:   sinks,
+		links:   links,
+		logger:  logger,
+		backoff: initialBackoff,
+	}
+	for range sinks {
+		w.queues = append(w.queues, make(chan event.Event, queueLength))
+	}
+	return w
+}
+
+// DigestTo has the release and automated release events for each
+// sink collected in a channel of the digest given, so that the sink
+// is sent a summary of them each period, rather than each event.
+func (w *Writer) DigestTo(d *event.Digest) {
+	w.digests = make([]event.EventWriter, len(w.sinks))
+	for i, sink := range w.sinks {
+		w.digests[i] = d.Channel(fmt.Sprintf("sink %d (%s)", i+1, sink.Name), sinkQueue{w, i})
+	}
+}
+
+func (w *Writer) LogEvent(e event.Event) error {
+	linked := event.AddLinks(e, w.links, w.logger)
+	for i, sink := range w.sinks {
+		if !sink.Accepts(e.Type) {
+			continue
+		}
+		if w.digests != nil {
+			w.digests[i].LogEvent(linked)
+			continue
+		}
+		w.enqueue(i, linked)
+	}
+	if w.next == nil {
+		return nil
+	}
+	return w.next.LogEvent(e)
+}
+
+func (w *Writer) enqueue(i int, e event.Event) {
+	select {
+	case w.queues[i] <- e:
+	default:
+		w.logger.Log("sink", w.sinks[i].Name, "err", "too many events waiting to be sent; dropping event", "event", e.Type)
+	}
+}
+
+// sinkQueue is an EventWriter that queues events for one sink of a
+// Writer; it's the channel that sink's digest is written to.
+type sinkQueue struct {
+	w *Writer
+	i int
+}
+
+func (q sinkQueue) LogEvent(e event.Event) error {
+	q.w.enqueue(q.i, e)
+	return nil
+}
+
+// Loop sends the events queued for each sink, until told to stop.
+// Events still waiting when it stops are not sent.
+func (w *Writer) Loop(stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	sinksWg := &sync.WaitGroup{}
+	for i := range w.sinks {
+		sinksWg.Add(1)
+		go func(sink Sink, queue <-chan event.Event) {
+			defer sinksWg.Done()
+			logger := log.With(w.logger, "sink", sink.Name)
+			for {
+				select {
+				case <-stop:
+					return
+				case e := <-queue:
+					w.deliver(stop, sink, e, logger)
+				}
+			}
+		}(w.sinks[i], w.queues[i])
+	}
+	sinksWg.Wait()
+}
+
+// deliver sends the event to the sink, trying again (after a wait)
+// if that fails, until it's tried too many times or is told to stop.
+func (w *Writer) deliver(stop <-chan struct{}, sink Sink, e event.Event, logger log.Logger) {
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := sink.sender.send(ctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+		if _, permanent := err.(permanentError); permanent || attempt == maxAttempts {
+			logger.Log("err", err, "event", e.Type, "attempts", attempt, "giving-up", true)
+			return
+		}
+		logger.Log("err", err, "event", e.Type, "attempts", attempt, "retry-in", backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
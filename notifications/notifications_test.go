@@ -0,0 +1,226 @@
+package notifications
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/event"
+)
+
+// endpoint is an HTTP server that records the requests it gets, and
+// responds with each of the statuses given in turn (then 200).
+type endpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   chan string
+	headers  chan http.Header
+}
+
+func newEndpoint(statuses ...int) *endpoint {
+	e := &endpoint{
+		statuses: statuses,
+		bodies:   make(chan string, 10),
+		headers:  make(chan http.Header, 10),
+	}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		e.mu.Lock()
+		status := http.StatusOK
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		e.mu.Unlock()
+		w.WriteHeader(status)
+		e.bodies <- string(body)
+		e.headers <- r.Header
+	}))
+	return e
+}
+
+func (e *endpoint) next(t *testing.T) (string, http.Header) {
+	select {
+	case body := <-e.bodies:
+		return body, <-e.headers
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for request")
+		return "", nil
+	}
+}
+
+func (e *endpoint) expectNothing(t *testing.T) {
+	select {
+	case body := <-e.bodies:
+		t.Errorf("expected no more requests, got %s", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func startWriter(t *testing.T, config string, next event.EventWriter) (*Writer, func()) {
+	sinks, err := ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(next, sinks, nil, log.NewNopLogger())
+	w.backoff = time.Millisecond
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go w.Loop(stop, wg)
+	return w, func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+type recordingWriter []event.Event
+
+func (r *recordingWriter) LogEvent(e event.Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, config := range []string{
+		`sinks: [{type: slack}]`,
+		`sinks: [{type: email, url: "mailto:ops@example.com"}]`,
+		`sinks: [{type: webhook, url: "https://example.com", template: "{{ .Message "}]`,
+		`sinks: [{type: slack, url: "https://example.com", colour: red}]`,
+	} {
+		if _, err := ParseConfig([]byte(config)); err == nil {
+			t.Errorf("expected error parsing %q", config)
+		}
+	}
+}
+
+func TestWebhookTemplateAndFiltering(t *testing.T) {
+	hook := newEndpoint()
+	defer hook.Close()
+	next := &recordingWriter{}
+	w, stop := startWriter(t, `
+sinks:
+- type: webhook
+  url: `+hook.URL+`
+  events: [lock]
+  headers:
+    Authorization: Bearer s3cr3t
+  template: '{"type": {{ json .Type }}, "text": {{ json .Message }}}'
+`, next)
+	defer stop()
+
+	id := mustParseID(t, "default:deployment/helloworld")
+	for _, e := range []event.Event{
+		{Type: event.EventUnlock, ServiceIDs: serviceIDs(id)},
+		{Type: event.EventLock, ServiceIDs: serviceIDs(id)},
+	} {
+		if err := w.LogEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body, header := hook.next(t)
+	if expected := `{"type": "lock", "text": "Locked: default:deployment/helloworld"}`; body != expected {
+		t.Errorf("expected body %s, got %s", expected, body)
+	}
+	if auth := header.Get("Authorization"); auth != "Bearer s3cr3t" {
+		t.Errorf("expected Authorization header to be sent, got %q", auth)
+	}
+	hook.expectNothing(t)
+
+	// All events are passed on, whether sent to a sink or not
+	if len(*next) != 2 {
+		t.Errorf("expected both events to be passed on, got %v", *next)
+	}
+}
+
+// With a digest, each sink is sent a summary of the releases it
+// accepts, rather than each of them
+func TestDigestPerSink(t *testing.T) {
+	all, locks := newEndpoint(), newEndpoint()
+	defer all.Close()
+	defer locks.Close()
+	w, stop := startWriter(t, `
+sinks:
+- type: webhook
+  url: `+all.URL+`
+  template: '{{ json .Message }}'
+- type: webhook
+  url: `+locks.URL+`
+  events: [lock]
+  template: '{{ json .Message }}'
+`, nil)
+	defer stop()
+	digest := event.NewDigest(time.Hour)
+	w.DigestTo(digest)
+
+	id := mustParseID(t, "default:deployment/helloworld")
+	for _, e := range []event.Event{
+		{Type: event.EventAutoRelease, Metadata: &event.AutoReleaseEventMetadata{}},
+		{Type: event.EventLock, ServiceIDs: serviceIDs(id)},
+	} {
+		if err := w.LogEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, hook := range []*endpoint{all, locks} {
+		if body, _ := hook.next(t); body != `"Locked: default:deployment/helloworld"` {
+			t.Errorf("expected the lock event to be sent as it is, got %s", body)
+		}
+	}
+
+	if err := digest.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := all.next(t); body != `"Digest: 0 release(s) and 1 automated release(s) updating 0 workload(s), 0 failure(s)"` {
+		t.Errorf("expected a digest, got %s", body)
+	}
+	all.expectNothing(t)
+	locks.expectNothing(t)
+}
+
+func TestRetries(t *testing.T) {
+	// A server error is tried again, but a bad request isn't
+	flaky := newEndpoint(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer flaky.Close()
+	refusing := newEndpoint(http.StatusBadRequest)
+	defer refusing.Close()
+	w, stop := startWriter(t, `
+sinks:
+- type: webhook
+  url: `+flaky.URL+`
+- type: webhook
+  url: `+refusing.URL+`
+`, nil)
+	defer stop()
+
+	if err := w.LogEvent(event.Event{Type: event.EventLock, ServiceIDs: serviceIDs(mustParseID(t, "default:deployment/helloworld"))}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		flaky.next(t)
+	}
+	flaky.expectNothing(t)
+	refusing.next(t)
+	refusing.expectNothing(t)
+}
+
+func TestGivesUp(t *testing.T) {
+	down := newEndpoint(500, 500, 500, 500, 500, 500)
+	defer down.Close()
+	w, stop := startWriter(t, `sinks: [{type: webhook, url: "`+down.URL+`"}]`, nil)
+	defer stop()
+
+	if err := w.LogEvent(event.Event{Type: event.EventLock}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxAttempts; i++ {
+		down.next(t)
+	}
+	down.expectNothing(t)
+}
@@ -0,0 +1,150 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/update"
+)
+
+// slack posts events to a Slack incoming webhook.
+type slack struct {
+	url      string
+	channel  string
+	username string
+}
+
+func newSlack(c SinkConfig) *slack {
+	return &slack{url: c.URL, channel: c.Channel, username: c.Username}
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Fallback string   `json:"fallback,omitempty"`
+	Color    string   `json:"color,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Text     string   `json:"text"`
+	Markdown []string `json:"mrkdwn_in,omitempty"`
+}
+
+func (s *slack) send(ctx context.Context, e event.Event) error {
+	body, err := json.Marshal(s.message(e))
+	if err != nil {
+		return permanentError{err}
+	}
+	return post(ctx, s.url, nil, "application/json", body)
+}
+
+// message makes the Slack message for an event: its summary, then
+// the details of what happened to each workload, then any links.
+func (s *slack) message(e event.Event) slackMessage {
+	msg := slackMessage{
+		Channel:  s.channel,
+		Username: s.username,
+		Text:     slackEscape(e.String()),
+	}
+
+	var lines []string
+	failed := false
+	switch metadata := e.Metadata.(type) {
+	case *event.ReleaseEventMetadata:
+		lines, failed = resultLines(metadata.Result, metadata.Error)
+	case *event.AutoReleaseEventMetadata:
+		lines, failed = resultLines(metadata.Result, metadata.Error)
+	case *event.RollbackEventMetadata:
+		lines, failed = resultLines(metadata.Result, metadata.Error)
+	case *event.SyncEventMetadata:
+		for _, err := range metadata.Errors {
+			lines = append(lines, fmt.Sprintf("`%s` (%s): %s", err.ID, slackEscape(err.Path), slackEscape(err.Error)))
+		}
+		failed = len(metadata.Errors) > 0
+	case *event.SyncRefusedEventMetadata:
+		lines = append(lines, slackEscape(metadata.Reason))
+		failed = true
+	case *event.ProposeEventMetadata:
+		lines, failed = resultLines(metadata.Result, "")
+		if metadata.URL != "" {
+			lines = append(lines, fmt.Sprintf("<%s|Merge request for %s>", metadata.URL, slackEscape(metadata.Branch)))
+		}
+	}
+	if len(lines) > 0 {
+		color := "good"
+		switch {
+		case e.LogLevel == event.LogLevelError:
+			color = "danger"
+		case failed || e.LogLevel == event.LogLevelWarn:
+			color = "warning"
+		}
+		msg.Attachments = append(msg.Attachments, slackAttachment{
+			Fallback: strings.Join(lines, "\n"),
+			Color:    color,
+			Text:     strings.Join(lines, "\n"),
+			Markdown: []string{"text"},
+		})
+	}
+
+	if len(e.Links) > 0 {
+		var links []string
+		for _, l := range e.Links {
+			name := l.Name
+			if l.ServiceID != "" {
+				name = fmt.Sprintf("%s (%s)", l.Name, l.ServiceID)
+			}
+			links = append(links, fmt.Sprintf("<%s|%s>", l.URL, slackEscape(name)))
+		}
+		msg.Attachments = append(msg.Attachments, slackAttachment{
+			Title: "Links",
+			Text:  strings.Join(links, "\n"),
+		})
+	}
+	return msg
+}
+
+// resultLines describes the outcome of a release for each workload
+// it changed or failed to change, and says whether any failed.
+func resultLines(result update.Result, releaseErr string) ([]string, bool) {
+	var lines []string
+	failed := false
+	if releaseErr != "" && len(result) == 0 {
+		lines = append(lines, slackEscape(releaseErr))
+		failed = true
+	}
+	ids := make([]flux.ResourceID, 0, len(result))
+	for id := range result {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	for _, id := range ids {
+		r := result[id]
+		switch r.Status {
+		case update.ReleaseStatusSuccess:
+			var images []string
+			for _, c := range r.PerContainer {
+				images = append(images, c.Target.String())
+			}
+			sort.Strings(images)
+			lines = append(lines, fmt.Sprintf("`%s`: %s", id, strings.Join(images, ", ")))
+		case update.ReleaseStatusFailed:
+			lines = append(lines, fmt.Sprintf("`%s`: failed: %s", id, slackEscape(r.Error)))
+			failed = true
+		}
+	}
+	return lines, failed
+}
+
+// slackEscape escapes the characters Slack treats as control
+// characters in message text.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,130 @@
+package notifications
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/event"
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/update"
+)
+
+func mustParseID(t *testing.T, s string) flux.ResourceID {
+	id, err := flux.ParseResourceID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func serviceIDs(ids ...flux.ResourceID) []flux.ResourceID {
+	return ids
+}
+
+func TestSlackRelease(t *testing.T) {
+	hook := newEndpoint()
+	defer hook.Close()
+	w, stop := startWriter(t, `
+sinks:
+- type: slack
+  url: `+hook.URL+`
+  channel: '#deploys'
+  username: flux
+`, nil)
+	defer stop()
+
+	ok, bad := mustParseID(t, "default:deployment/helloworld"), mustParseID(t, "default:deployment/sidecar")
+	target, err := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.LogEvent(event.Event{
+		Type:       event.EventAutoRelease,
+		ServiceIDs: serviceIDs(ok),
+		LogLevel:   event.LogLevelInfo,
+		Metadata: &event.AutoReleaseEventMetadata{
+			ReleaseEventCommon: event.ReleaseEventCommon{
+				Result: update.Result{
+					ok:  {Status: update.ReleaseStatusSuccess, PerContainer: []update.ContainerUpdate{{Container: "helloworld", Target: target}}},
+					bad: {Status: update.ReleaseStatusFailed, Error: "<no such container>"},
+				},
+			},
+		},
+		Links: []event.Link{{Name: "grafana", URL: "https://grafana.example.com/d/abc"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := hook.next(t)
+	var msg slackMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := slackMessage{
+		Channel:  "#deploys",
+		Username: "flux",
+		Text:     "Automated release of quay.io/weaveworks/helloworld:master-a000002",
+		Attachments: []slackAttachment{
+			{
+				Fallback: "`default:deployment/helloworld`: quay.io/weaveworks/helloworld:master-a000002\n`default:deployment/sidecar`: failed: &lt;no such container&gt;",
+				Color:    "warning",
+				Text:     "`default:deployment/helloworld`: quay.io/weaveworks/helloworld:master-a000002\n`default:deployment/sidecar`: failed: &lt;no such container&gt;",
+				Markdown: []string{"text"},
+			},
+			{
+				Title: "Links",
+				Text:  "<https://grafana.example.com/d/abc|grafana>",
+			},
+		},
+	}
+	if !reflect.DeepEqual(msg, expected) {
+		t.Errorf("expected\n%#v\ngot\n%#v", expected, msg)
+	}
+}
+
+func TestSlackSyncRefused(t *testing.T) {
+	msg := newSlack(SinkConfig{}).message(event.Event{
+		Type:     event.EventSyncRefused,
+		LogLevel: event.LogLevelError,
+		Metadata: &event.SyncRefusedEventMetadata{
+			Revision: "1234567890abcdef",
+			Reason:   "commit 1234567890abcdef is not signed",
+		},
+	})
+	if msg.Text != "Sync refused: 1234567, since commit 1234567890abcdef is not signed" {
+		t.Errorf("unexpected text %q", msg.Text)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Color != "danger" {
+		t.Errorf("expected one attachment, coloured as an error, got %#v", msg.Attachments)
+	}
+}
+
+func TestSlackPropose(t *testing.T) {
+	id := mustParseID(t, "default:deployment/helloworld")
+	target, err := image.ParseRef("quay.io/weaveworks/helloworld:master-a000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := newSlack(SinkConfig{}).message(event.Event{
+		Type:       event.EventPropose,
+		ServiceIDs: serviceIDs(id),
+		LogLevel:   event.LogLevelInfo,
+		Metadata: &event.ProposeEventMetadata{
+			Revision: "1234567890abcdef",
+			Branch:   "flux-propose/abcdef123456",
+			URL:      "https://github.com/example/config/pull/1",
+			Result: update.Result{
+				id: {Status: update.ReleaseStatusSuccess, PerContainer: []update.ContainerUpdate{{Container: "helloworld", Target: target}}},
+			},
+		},
+	})
+	if msg.Text != "Proposed: 1234567, default:deployment/helloworld, at https://github.com/example/config/pull/1" {
+		t.Errorf("unexpected text %q", msg.Text)
+	}
+	expected := "`default:deployment/helloworld`: quay.io/weaveworks/helloworld:master-a000002\n<https://github.com/example/config/pull/1|Merge request for flux-propose/abcdef123456>"
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Text != expected || msg.Attachments[0].Color != "good" {
+		t.Errorf("expected one attachment with the result and merge request, got %#v", msg.Attachments)
+	}
+}
@@ -0,0 +1,81 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/event"
+)
+
+// webhook posts events to any HTTP endpoint, either as JSON (as
+// they're sent upstream), or in whatever form a template gives.
+type webhook struct {
+	url     string
+	headers map[string]string
+	tmpl    *template.Template
+}
+
+// webhookVars are the fields a webhook template can use.
+type webhookVars struct {
+	Type       string
+	LogLevel   string
+	Message    string // the one-line summary of the event
+	ServiceIDs []string
+	StartedAt  time.Time
+	EndedAt    time.Time
+	Event      event.Event // all of it, including the metadata
+}
+
+var templateFuncs = template.FuncMap{
+	// json gives a value as JSON, so templates can make a JSON body
+	// without having to escape everything themselves.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newWebhook(c SinkConfig) (*webhook, error) {
+	w := &webhook{url: c.URL, headers: c.Headers}
+	if c.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Option("missingkey=error").Parse(c.Template)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing template")
+		}
+		w.tmpl = tmpl
+	}
+	return w, nil
+}
+
+func (w *webhook) send(ctx context.Context, e event.Event) error {
+	body, err := w.body(e)
+	if err != nil {
+		return permanentError{err}
+	}
+	return post(ctx, w.url, w.headers, "application/json", body)
+}
+
+func (w *webhook) body(e event.Event) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	err := w.tmpl.Execute(&buf, webhookVars{
+		Type:       e.Type,
+		LogLevel:   e.LogLevel,
+		Message:    e.String(),
+		ServiceIDs: e.ServiceIDStrings(),
+		StartedAt:  e.StartedAt,
+		EndedAt:    e.EndedAt,
+		Event:      e,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "expanding template")
+	}
+	return buf.Bytes(), nil
+}
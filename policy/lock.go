@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseLockExpiry parses when a lock is to expire, given either as a
+// time (in RFC3339 format, e.g., 2018-10-01T17:00:00Z) or as a
+// duration from now (e.g., 2h30m).
+func ParseLockExpiry(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("lock expiry %q is not in the future", s)
+		}
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("lock expiry %q is neither a duration (e.g., 2h) nor a time (e.g., 2018-10-01T17:00:00Z)", s)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("lock expiry %q is not in the future", s)
+	}
+	return t, nil
+}
+
+// LockedUntil gives the time the lock in the policies expires, if
+// it's been given one.
+func (s Set) LockedUntil() (time.Time, bool, error) {
+	text, ok := s.Get(LockedUntil)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("lock expiry %q: %s", text, err)
+	}
+	return t, true, nil
+}
+
+// LockedAt says whether the policies lock the workload at the time
+// given; that is, whether it's locked, and the lock hasn't expired.
+// A lock with an expiry that can't be understood is taken to hold.
+func (s Set) LockedAt(now time.Time) bool {
+	if !s.Contains(Locked) {
+		return false
+	}
+	until, ok, err := s.LockedUntil()
+	return !ok || err != nil || now.Before(until)
+}
+
+// LockedAt gives the workloads that are locked at the time given.
+func (s ResourceMap) LockedAt(now time.Time) ResourceMap {
+	newMap := ResourceMap{}
+	for k, v := range s {
+		if v.LockedAt(now) {
+			newMap[k] = v
+		}
+	}
+	return newMap
+}
@@ -0,0 +1,47 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestParseLockExpiry(t *testing.T) {
+	now := mustParseTime(t, "2018-10-01T09:00:00Z")
+	for in, expected := range map[string]string{
+		"2h30m":                     "2018-10-01T11:30:00Z",
+		"2018-10-02T17:00:00+01:00": "2018-10-02T16:00:00Z",
+	} {
+		got, err := ParseLockExpiry(in, now)
+		if err != nil {
+			t.Errorf("%q: %s", in, err)
+			continue
+		}
+		if !got.Equal(mustParseTime(t, expected)) {
+			t.Errorf("%q: expected %s, got %s", in, expected, got)
+		}
+	}
+
+	for _, in := range []string{"", "-1h", "0s", "2018-09-30T09:00:00Z", "tomorrow"} {
+		if _, err := ParseLockExpiry(in, now); err == nil {
+			t.Errorf("expected error parsing %q", in)
+		}
+	}
+}
+
+func TestLockedAt(t *testing.T) {
+	now := mustParseTime(t, "2018-10-01T09:00:00Z")
+	for _, c := range []struct {
+		policies Set
+		locked   bool
+	}{
+		{Set{}, false},
+		{Set{}.Add(Automated).Set(LockedUntil, "2018-10-01T10:00:00Z"), false},
+		{Set{}.Add(Locked), true},
+		{Set{}.Add(Locked).Set(LockedUntil, "2018-10-01T10:00:00Z"), true},
+		{Set{}.Add(Locked).Set(LockedUntil, "2018-10-01T09:00:00Z"), false},
+		{Set{}.Add(Locked).Set(LockedUntil, "when I say so"), true},
+	} {
+		if got := c.policies.LockedAt(now); got != c.locked {
+			t.Errorf("%s: expected locked=%v, got %v", c.policies, c.locked, got)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	glob "github.com/ryanuber/go-glob"
+
+	"github.com/weaveworks/flux/image"
+)
+
+const (
+	globPrefix   = "glob:"
+	regexpPrefix = "regexp:"
+	calverPrefix = "calver:"
+	semverPrefix = "semver:"
+)
+
+// PatternAll matches every tag, and orders images by creation time.
+var PatternAll = NewPattern("*")
+
+// Pattern is a tag filter, as given in a tag policy: it decides which
+// image tags are eligible, and how eligible images are ordered, so
+// that the first is considered the newest.
+type Pattern interface {
+	// Matches reports whether the tag is eligible
+	Matches(tag string) bool
+	// String returns the pattern as it appears in the policy; globs
+	// are given without the (optional) prefix
+	String() string
+	// Newer is the ordering of images matched by the pattern
+	Newer(a, b *image.Info) bool
+}
+
+// GlobPattern matches tags using shell-style globbing, and orders
+// images by creation time.
+type GlobPattern string
+
+// RegexpPattern matches tags using a regular expression. If the
+// expression has capture groups, images are ordered by the captured
+// components, as in `image.VersionScheme`; otherwise, by creation
+// time. An invalid expression matches nothing.
+type RegexpPattern struct {
+	expr   string
+	re     *regexp.Regexp
+	scheme *image.VersionScheme
+}
+
+// CalVerPattern matches tags that are calendar versions and match
+// the glob given (if any), and orders images by date.
+type CalVerPattern struct {
+	given string // the glob as given, which may be empty
+	glob  GlobPattern
+}
+
+// SemverPattern matches tags that are semantic versions satisfying
+// the constraint given (if any), e.g., `~1.2` for any 1.2.x, and
+// orders images by version. An invalid constraint matches nothing.
+type SemverPattern struct {
+	constraint  string
+	constraints *semver.Constraints
+}
+
+// NewPattern parses the value of a tag policy, which may be prefixed
+// with the kind of pattern:
+//
+//	glob:<glob>        e.g., `glob:master-*`
+//	regexp:<regexp>    e.g., `regexp:^build-(\d+)$`
+//	calver:<glob>      e.g., `calver:2018.*`, or just `calver:`
+//	semver:<range>     e.g., `semver:~1.2`, `semver:>=1.0, <2.0`, or just `semver:`
+//
+// A value with no recognised prefix is treated as a glob.
+func NewPattern(pattern string) Pattern {
+	switch {
+	case strings.HasPrefix(pattern, regexpPrefix):
+		expr := strings.TrimPrefix(pattern, regexpPrefix)
+		re, _ := regexp.Compile(expr)
+		scheme, _ := image.NewVersionScheme(expr)
+		return RegexpPattern{expr: expr, re: re, scheme: scheme}
+	case strings.HasPrefix(pattern, calverPrefix):
+		given := strings.TrimPrefix(pattern, calverPrefix)
+		g := given
+		if g == "" {
+			g = "*"
+		}
+		return CalVerPattern{given: given, glob: GlobPattern(g)}
+	case strings.HasPrefix(pattern, semverPrefix):
+		constraint := strings.TrimPrefix(pattern, semverPrefix)
+		p := SemverPattern{constraint: constraint}
+		if constraint != "" {
+			p.constraints, _ = semver.NewConstraint(constraint)
+		}
+		return p
+	}
+	return GlobPattern(strings.TrimPrefix(pattern, globPrefix))
+}
+
+// ValidatePattern returns an error if the pattern given (as for
+// NewPattern) can never match, because it's a regular expression or
+// a semver range that doesn't parse.
+func ValidatePattern(pattern string) error {
+	switch {
+	case strings.HasPrefix(pattern, regexpPrefix):
+		if _, err := regexp.Compile(strings.TrimPrefix(pattern, regexpPrefix)); err != nil {
+			return fmt.Errorf("invalid regexp in tag pattern %q: %s", pattern, err)
+		}
+	case strings.HasPrefix(pattern, semverPrefix):
+		if constraint := strings.TrimPrefix(pattern, semverPrefix); constraint != "" {
+			if _, err := semver.NewConstraint(constraint); err != nil {
+				return fmt.Errorf("invalid semver range in tag pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// HasPatternPrefix reports whether the value given is prefixed with
+// a kind of pattern.
+func HasPatternPrefix(pattern string) bool {
+	for _, prefix := range []string{globPrefix, regexpPrefix, calverPrefix, semverPrefix} {
+		if strings.HasPrefix(pattern, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g GlobPattern) Matches(tag string) bool {
+	return glob.Glob(string(g), tag)
+}
+
+func (g GlobPattern) String() string {
+	return string(g)
+}
+
+func (g GlobPattern) Newer(a, b *image.Info) bool {
+	return image.NewerByCreated(a, b)
+}
+
+func (r RegexpPattern) Matches(tag string) bool {
+	if r.re == nil {
+		return false
+	}
+	return r.re.MatchString(tag)
+}
+
+func (r RegexpPattern) String() string {
+	return regexpPrefix + r.expr
+}
+
+func (r RegexpPattern) Newer(a, b *image.Info) bool {
+	if r.scheme == nil {
+		return image.NewerByCreated(a, b)
+	}
+	return r.scheme.Newer(a, b)
+}
+
+func (c CalVerPattern) Matches(tag string) bool {
+	return c.glob.Matches(tag) && image.CalVer.Matches(tag)
+}
+
+func (c CalVerPattern) String() string {
+	return calverPrefix + c.given
+}
+
+func (c CalVerPattern) Newer(a, b *image.Info) bool {
+	return image.CalVer.Newer(a, b)
+}
+
+func (s SemverPattern) Matches(tag string) bool {
+	v, err := semver.NewVersion(tag)
+	if err != nil {
+		return false
+	}
+	if s.constraint == "" {
+		return true
+	}
+	return s.constraints != nil && s.constraints.Check(v)
+}
+
+func (s SemverPattern) String() string {
+	return semverPrefix + s.constraint
+}
+
+func (s SemverPattern) Newer(a, b *image.Info) bool {
+	return image.NewerBySemver(a, b)
+}
@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/weaveworks/flux/image"
+)
+
+func TestPatternMatches(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{"*", []string{"", "latest", "v1"}, nil},
+		{"glob:master-*", []string{"master-abc"}, []string{"dev-abc"}},
+		{"master-*", []string{"master-abc"}, []string{"dev-abc"}},
+		{`regexp:^build-(\d+)$`, []string{"build-1", "build-200"}, []string{"build-x", "rebuild-1"}},
+		{`regexp:(`, nil, []string{"(", ""}},
+		{"calver:", []string{"2018.10.14", "18.10", "20181014", "v2018-10-14.3"}, []string{"1.2.3", "latest", "master-2018"}},
+		{"calver:2018.*", []string{"2018.10.14"}, []string{"2017.10.14"}},
+		{"semver:", []string{"1.2.3", "v1.2", "2.0.0-rc.1"}, []string{"latest", "master-a000001"}},
+		{"semver:~1.2", []string{"1.2.0", "1.2.9", "v1.2.3"}, []string{"1.3.0", "1.1.9", "1.2.4-rc.1", "latest"}},
+		{"semver:>=1.0, <2.0", []string{"1.0.0", "1.9.9"}, []string{"2.0.0", "0.9.0"}},
+		{"semver:~>>1", nil, []string{"1.0.0"}},
+	} {
+		p := NewPattern(tt.pattern)
+		for _, tag := range tt.matches {
+			assert.True(t, p.Matches(tag), "%q should match %q", tt.pattern, tag)
+		}
+		for _, tag := range tt.misses {
+			assert.False(t, p.Matches(tag), "%q should not match %q", tt.pattern, tag)
+		}
+	}
+}
+
+func TestPatternOrdering(t *testing.T) {
+	info := func(tag string) image.Info {
+		ref, err := image.ParseRef("my/image:" + tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return image.Info{ID: ref}
+	}
+
+	for _, tt := range []struct {
+		pattern string
+		sorted  []string
+	}{
+		{`regexp:^build-(\d+)$`, []string{"build-100", "build-20", "build-3"}},
+		{`regexp:^(\d+)\.(\d+)-(\w+)$`, []string{"2.1-b", "2.1-a", "1.10-a", "1.9-z"}},
+		{"calver:", []string{"18.11", "2018.10.14.2", "2018.10.14", "20181002", "2018.10", "17.12"}},
+		{"semver:~1.2", []string{"1.2.10", "1.2.9", "1.2.1"}},
+	} {
+		p := NewPattern(tt.pattern)
+		var infos []image.Info
+		for i := len(tt.sorted) - 1; i >= 0; i-- {
+			infos = append(infos, info(tt.sorted[i]))
+		}
+		image.Sort(infos, p.Newer)
+		var got []string
+		for _, i := range infos {
+			got = append(got, i.ID.Tag)
+		}
+		assert.Equal(t, tt.sorted, got, tt.pattern)
+	}
+}
+
+func TestPatternString(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"*":                 "*",
+		"glob:master-*":     "master-*",
+		`regexp:^build-\d+`: `regexp:^build-\d+`,
+		"calver:":           "calver:",
+		"calver:2018.*":     "calver:2018.*",
+		"semver:":           "semver:",
+		"semver:~1.2":       "semver:~1.2",
+	} {
+		assert.Equal(t, expected, NewPattern(pattern).String(), pattern)
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	assert.NoError(t, Set{TagPrefix("app"): "semver:~1.2", TagAll: "glob:*", Locked: "("}.ValidatePatterns())
+	assert.Error(t, Set{TagPrefix("app"): "semver:~>>1"}.ValidatePatterns())
+	assert.Error(t, Set{TagAll: "regexp:("}.ValidatePatterns())
+}
+
+func TestHasPatternPrefix(t *testing.T) {
+	assert.True(t, HasPatternPrefix("glob:*"))
+	assert.True(t, HasPatternPrefix("regexp:.*"))
+	assert.True(t, HasPatternPrefix("calver:"))
+	assert.True(t, HasPatternPrefix("semver:~1.2"))
+	assert.False(t, HasPatternPrefix("master-*"))
+}
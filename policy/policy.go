@@ -14,6 +14,14 @@ const (
 	LockedMsg  = Policy("locked_msg")
 	Automated  = Policy("automated")
 	TagAll     = Policy("tag_all")
+
+	// LockedUntil is when a lock expires (RFC3339), after which the
+	// daemon unlocks the workload.
+	LockedUntil = Policy("locked_until")
+
+	// ReleaseWindow restricts automated releases to the times given;
+	// see ParseWindow.
+	ReleaseWindow = Policy("release_window")
 )
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -36,15 +44,11 @@ func Tag(policy Policy) bool {
 	return strings.HasPrefix(string(policy), "tag.")
 }
 
-func GetTagPattern(services ResourceMap, service flux.ResourceID, container string) string {
+func GetTagPattern(services ResourceMap, service flux.ResourceID, container string) Pattern {
 	if services == nil {
-		return "*"
-	}
-	policies := services[service]
-	if pattern, ok := policies.Get(TagPrefix(container)); ok {
-		return strings.TrimPrefix(pattern, "glob:")
+		return PatternAll
 	}
-	return "*"
+	return services[service].TagPattern(container)
 }
 
 type Updates map[flux.ResourceID]Update
@@ -116,6 +120,28 @@ func (s Set) Get(p Policy) (string, bool) {
 	return v, ok
 }
 
+// TagPattern returns the tag filter given in the policies for the
+// container named, or PatternAll if there isn't one.
+func (s Set) TagPattern(container string) Pattern {
+	if pattern, ok := s.Get(TagPrefix(container)); ok {
+		return NewPattern(pattern)
+	}
+	return PatternAll
+}
+
+// ValidatePatterns returns an error if any of the tag patterns in the
+// set can never match, as for ValidatePattern.
+func (s Set) ValidatePatterns() error {
+	for p, v := range s {
+		if Tag(p) || p == TagAll {
+			if err := ValidatePattern(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (s Set) Without(omit Policy) Set {
 	newMap := Set{}
 	for p, v := range s {
@@ -91,7 +91,7 @@ func Test_GetTagPattern(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := GetTagPattern(tt.args.services, tt.args.service, tt.args.container); got != tt.want {
+			if got := GetTagPattern(tt.args.services, tt.args.service, tt.args.container); got.String() != tt.want {
 				t.Errorf("GetTagPattern() = %v, want %v", got, tt.want)
 			}
 		})
@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Window is the times each week at which automated releases may be
+// made, given as one or more periods separated by semicolons. A
+// period is the days (optional; every day, if left out), the time of
+// day, and the time zone (optional; UTC, if left out), e.g.,
+//
+//	Mon-Fri 09:00-17:00 Europe/London
+//	Sat,Sun 22:00-02:00; Wed 12:00-13:00
+//
+// A period that ends before it starts runs over midnight, into the
+// day after each of the days given.
+type Window struct {
+	periods []period
+}
+
+type period struct {
+	days       [7]bool
+	start, end time.Duration // since midnight
+	loc        *time.Location
+}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseWindow parses a release window, as given in the
+// `release_window` policy.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	for _, text := range strings.Split(s, ";") {
+		p, err := parsePeriod(strings.TrimSpace(text))
+		if err != nil {
+			return Window{}, fmt.Errorf("release window %q: %s", s, err)
+		}
+		w.periods = append(w.periods, p)
+	}
+	return w, nil
+}
+
+func parsePeriod(s string) (period, error) {
+	p := period{loc: time.UTC}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return p, fmt.Errorf("empty period")
+	}
+	if !strings.Contains(fields[0], ":") {
+		if err := p.parseDays(fields[0]); err != nil {
+			return p, err
+		}
+		fields = fields[1:]
+	} else {
+		for d := range p.days {
+			p.days[d] = true
+		}
+	}
+
+	switch len(fields) {
+	case 2:
+		loc, err := time.LoadLocation(fields[1])
+		if err != nil {
+			return p, err
+		}
+		p.loc = loc
+		fallthrough
+	case 1:
+		times := strings.Split(fields[0], "-")
+		if len(times) != 2 {
+			return p, fmt.Errorf("expected a time range like 09:00-17:00, got %q", fields[0])
+		}
+		var err error
+		if p.start, err = parseTimeOfDay(times[0]); err != nil {
+			return p, err
+		}
+		if p.end, err = parseTimeOfDay(times[1]); err != nil {
+			return p, err
+		}
+		if p.start == p.end {
+			return p, fmt.Errorf("time range %q is empty", fields[0])
+		}
+	default:
+		return p, fmt.Errorf("expected [days] start-end [time zone], got %q", s)
+	}
+	return p, nil
+}
+
+func (p *period) parseDays(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		names := strings.Split(item, "-")
+		if len(names) > 2 {
+			return fmt.Errorf("expected a day or range of days, got %q", item)
+		}
+		from, err := parseDay(names[0])
+		if err != nil {
+			return err
+		}
+		to := from
+		if len(names) == 2 {
+			if to, err = parseDay(names[1]); err != nil {
+				return err
+			}
+		}
+		// A range may wrap around the end of the week, e.g., Fri-Mon.
+		for d := from; ; d = (d + 1) % 7 {
+			p.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseDay(s string) (time.Weekday, error) {
+	name := strings.ToLower(s)
+	for d, day := range dayNames {
+		if name == day || name == strings.ToLower(time.Weekday(d).String()) {
+			return time.Weekday(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m > 0) {
+		return 0, fmt.Errorf("expected a time of day like 09:00, got %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Contains says whether releases may be made at the time given.
+func (w Window) Contains(t time.Time) bool {
+	for _, p := range w.periods {
+		if p.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p period) contains(t time.Time) bool {
+	t = t.In(p.loc)
+	day := t.Weekday()
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if p.start < p.end {
+		return p.days[day] && since >= p.start && since < p.end
+	}
+	return (p.days[day] && since >= p.start) || (p.days[(day+6)%7] && since < p.end)
+}
+
+// NextOpen gives the time, at or after that given, at which releases
+// may next be made.
+func (w Window) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	var next time.Time
+	for _, p := range w.periods {
+		local := t.In(p.loc)
+		for d := 0; d <= 7; d++ {
+			open := time.Date(local.Year(), local.Month(), local.Day()+d, int(p.start/time.Hour), int(p.start%time.Hour/time.Minute), 0, 0, p.loc)
+			if p.days[open.Weekday()] && open.After(t) {
+				if next.IsZero() || open.Before(next) {
+					next = open
+				}
+				break
+			}
+		}
+	}
+	return next
+}
+
+// ReleaseWindow gives the release window in the policies, if there is
+// one.
+func (s Set) ReleaseWindow() (Window, bool, error) {
+	text, ok := s.Get(ReleaseWindow)
+	if !ok {
+		return Window{}, false, nil
+	}
+	w, err := ParseWindow(text)
+	return w, true, err
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestWindowContains(t *testing.T) {
+	for _, c := range []struct {
+		window string
+		in     []string
+		out    []string
+	}{
+		{
+			window: "Mon-Fri 09:00-17:00",
+			// 2018-10-01 is a Monday
+			in:  []string{"2018-10-01T09:00:00Z", "2018-10-05T16:59:59Z"},
+			out: []string{"2018-10-01T08:59:59Z", "2018-10-01T17:00:00Z", "2018-10-06T12:00:00Z"},
+		},
+		{
+			window: "Mon-Fri 09:00-17:00 Europe/London",
+			// London is on summer time, UTC+1
+			in:  []string{"2018-10-01T08:00:00Z"},
+			out: []string{"2018-10-01T16:30:00Z"},
+		},
+		{
+			window: "Fri-Sun 22:00-02:00",
+			in:     []string{"2018-10-05T23:00:00Z", "2018-10-08T01:00:00Z"},
+			out:    []string{"2018-10-05T01:00:00Z", "2018-10-08T23:00:00Z"},
+		},
+		{
+			window: "Sat,sunday 10:00-12:00; 20:00-21:00",
+			in:     []string{"2018-10-06T11:00:00Z", "2018-10-07T10:00:00Z", "2018-10-03T20:30:00Z"},
+			out:    []string{"2018-10-03T11:00:00Z", "2018-10-06T12:00:00Z"},
+		},
+	} {
+		w, err := ParseWindow(c.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range c.in {
+			if !w.Contains(mustParseTime(t, s)) {
+				t.Errorf("expected %q to contain %s", c.window, s)
+			}
+		}
+		for _, s := range c.out {
+			if w.Contains(mustParseTime(t, s)) {
+				t.Errorf("expected %q not to contain %s", c.window, s)
+			}
+		}
+	}
+}
+
+func TestWindowNextOpen(t *testing.T) {
+	w, err := ParseWindow("Mon-Fri 09:00-17:00 Europe/London; Sat 12:00-13:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for from, expected := range map[string]string{
+		"2018-10-01T10:00:00Z": "2018-10-01T10:00:00Z", // already open
+		"2018-10-01T17:00:00Z": "2018-10-02T08:00:00Z",
+		"2018-10-05T17:00:00Z": "2018-10-06T12:00:00Z",
+		"2018-10-06T13:00:00Z": "2018-10-08T08:00:00Z",
+		// London goes back to UTC+0 on the 28th
+		"2018-10-27T13:00:00Z": "2018-10-29T09:00:00Z",
+	} {
+		if next := w.NextOpen(mustParseTime(t, from)); !next.Equal(mustParseTime(t, expected)) {
+			t.Errorf("from %s, expected next opening at %s, got %s", from, expected, next.UTC().Format(time.RFC3339))
+		}
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 9-5",
+		"Mon-Fri 09:00",
+		"Mon-Fri 09:00-09:00",
+		"Mon-Fri 09:00-25:00",
+		"Funday 09:00-17:00",
+		"Mon-Wed-Fri 09:00-17:00",
+		"Mon-Fri 09:00-17:00 Nowhere/Special",
+		"Mon-Fri 09:00-17:00 Europe/London extra",
+		"Mon 09:00-10:00;",
+	} {
+		if _, err := ParseWindow(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/go-kit/kit/log"
+)
+
+const (
+	// ECR tokens last twelve hours; get a fresh one a while before
+	// that, so requests in flight don't see it expire.
+	ecrRefreshBefore = 30 * time.Minute
+	// Don't ask for a new token more often than this, however many
+	// requests are refused.
+	ecrMinRefresh = time.Minute
+	// When a token can't be got (e.g., because there are no AWS
+	// credentials, and the registry is used with pull secrets), wait
+	// before trying again, doubling the wait each time up to this.
+	ecrMaxBackoff = time.Hour
+)
+
+// ECR registries are at <account ID>.dkr.ecr.<region>.amazonaws.com
+// (or .amazonaws.com.cn, in China).
+var ecrHostRE = regexp.MustCompile(`^(\d+)\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// IsECRHost reports whether the host given is an AWS ECR registry.
+func IsECRHost(host string) bool {
+	return ecrHostRE.MatchString(host)
+}
+
+func parseECRHost(host string) (accountID, region string, ok bool) {
+	m := ecrHostRE.FindStringSubmatch(host)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+type ecrToken struct {
+	creds     creds
+	expiresAt time.Time
+	fetchedAt time.Time
+	// if the token couldn't be got, why, and how many times in a row
+	err      error
+	failures int
+}
+
+// ecrBackoffError is returned when credentials for a registry
+// couldn't be got recently, so aren't asked for again yet.
+type ecrBackoffError struct {
+	err     error
+	retryAt time.Time
+}
+
+func (e ecrBackoffError) Error() string {
+	return fmt.Sprintf("%s (not trying again until %s)", e.err, e.retryAt.Format(time.RFC3339))
+}
+
+// ECRCredentials obtains credentials for ECR registries from AWS,
+// using the default credential chain of the AWS SDK (i.e., the
+// environment, shared config, or the instance role), and keeps them
+// until shortly before they expire.
+type ECRCredentials struct {
+	fetch func(accountID, region string) (creds, time.Time, error)
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]ecrToken
+}
+
+func NewECRCredentials() *ECRCredentials {
+	return &ECRCredentials{
+		fetch:  fetchECRToken,
+		now:    time.Now,
+		tokens: map[string]ecrToken{},
+	}
+}
+
+// credsFor returns credentials for the ECR registry at host, reusing
+// those got previously if they are not about to expire. If they
+// couldn't be got, that's remembered, and they aren't asked for again
+// until after a backoff.
+func (e *ECRCredentials) credsFor(host string) (creds, error) {
+	accountID, region, ok := parseECRHost(host)
+	if !ok {
+		return creds{}, fmt.Errorf("%s is not an ECR registry", host)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	token, ok := e.tokens[host]
+	if ok && token.err != nil {
+		if retryAt := token.fetchedAt.Add(ecrBackoff(token.failures)); now.Before(retryAt) {
+			return creds{}, ecrBackoffError{err: token.err, retryAt: retryAt}
+		}
+	} else if ok && now.Add(ecrRefreshBefore).Before(token.expiresAt) {
+		return token.creds, nil
+	}
+	cred, expiresAt, err := e.fetch(accountID, region)
+	if err != nil {
+		failures := 1
+		if token.err != nil {
+			failures = token.failures + 1
+		}
+		e.tokens[host] = ecrToken{err: err, failures: failures, fetchedAt: now}
+		return creds{}, err
+	}
+	cred.registry = host
+	e.tokens[host] = ecrToken{creds: cred, expiresAt: expiresAt, fetchedAt: now}
+	return cred, nil
+}
+
+// refresh forgets the credentials for host, so they are got afresh
+// next time; e.g., because the registry has refused them.
+func (e *ECRCredentials) refresh(host string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if token, ok := e.tokens[host]; ok && token.err == nil && e.now().Sub(token.fetchedAt) >= ecrMinRefresh {
+		delete(e.tokens, host)
+	}
+}
+
+// ecrBackoff returns how long to wait before trying again to get
+// credentials, after failing the number of times given.
+func ecrBackoff(failures int) time.Duration {
+	backoff := ecrMinRefresh
+	for i := 1; i < failures && backoff < ecrMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > ecrMaxBackoff {
+		return ecrMaxBackoff
+	}
+	return backoff
+}
+
+func fetchECRToken(accountID, region string) (creds, time.Time, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	output, err := ecr.New(sess).GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(accountID)},
+	})
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	if len(output.AuthorizationData) == 0 {
+		return creds{}, time.Time{}, fmt.Errorf("no authorization data returned for ECR registry %s in %s", accountID, region)
+	}
+	data := output.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return creds{}, time.Time{}, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return creds{}, time.Time{}, fmt.Errorf("ECR authorization token has wrong number of fields (expected 2, got %d)", len(parts))
+	}
+	return creds{
+		provenance: "AWS ECR",
+		username:   parts[0],
+		password:   parts[1],
+	}, aws.TimeValue(data.ExpiresAt), nil
+}
+
+// ecrStore is an auth.CredentialStore that looks up ECR credentials
+// each time they are needed, so that a request made after they
+// expire gets new ones. If they can't be got from AWS, it falls back
+// to those configured for the host, if any; the failure is logged
+// only when credentials were actually asked for, rather than each
+// time during backoff.
+type ecrStore struct {
+	store
+	ecr    *ECRCredentials
+	host   string
+	logger log.Logger
+}
+
+func (s *ecrStore) Basic(url *url.URL) (string, string) {
+	cred, err := s.ecr.credsFor(s.host)
+	if err != nil {
+		if _, backingOff := err.(ecrBackoffError); !backingOff && s.logger != nil {
+			s.logger.Log("host", s.host, "err", err)
+		}
+		return s.store.Basic(url)
+	}
+	return cred.username, cred.password
+}
+
+// ecrRefreshing retries a request refused by an ECR registry once,
+// with new credentials.
+type ecrRefreshing struct {
+	transport http.RoundTripper
+	ecr       *ECRCredentials
+	host      string
+}
+
+func (t *ecrRefreshing) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.transport.RoundTrip(req)
+	// Only requests without a body can be sent again as they are;
+	// which is all of them, for scanning images.
+	if err != nil || res.StatusCode != http.StatusUnauthorized || req.Body != nil {
+		return res, err
+	}
+	res.Body.Close()
+	t.ecr.refresh(t.host)
+	return t.transport.RoundTrip(req)
+}
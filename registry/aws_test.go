@@ -0,0 +1,185 @@
+package registry
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testECRHost = "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+
+func TestParseECRHost(t *testing.T) {
+	accountID, region, ok := parseECRHost(testECRHost)
+	assert.True(t, ok)
+	assert.Equal(t, "123456789012", accountID)
+	assert.Equal(t, "eu-west-1", region)
+
+	_, region, ok = parseECRHost("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn")
+	assert.True(t, ok)
+	assert.Equal(t, "cn-north-1", region)
+
+	for _, host := range []string{"index.docker.io", "gcr.io", "dkr.ecr.eu-west-1.amazonaws.com", "123456789012.dkr.ecr.eu-west-1.amazonaws.com.evil.com"} {
+		assert.False(t, IsECRHost(host), host)
+	}
+}
+
+// fakeECR gives out a new password each time credentials are asked
+// for, which expires after twelve hours.
+type fakeECR struct {
+	now      time.Time
+	fetched  int
+	fail     bool
+	attempts int
+}
+
+func (f *fakeECR) credentials() *ECRCredentials {
+	return &ECRCredentials{
+		fetch: func(accountID, region string) (creds, time.Time, error) {
+			f.attempts++
+			if f.fail {
+				return creds{}, time.Time{}, errors.New("no AWS credentials")
+			}
+			f.fetched++
+			return creds{username: "AWS", password: f.password()}, f.now.Add(12 * time.Hour), nil
+		},
+		now:    func() time.Time { return f.now },
+		tokens: map[string]ecrToken{},
+	}
+}
+
+func (f *fakeECR) password() string {
+	return strings.Repeat("x", f.fetched)
+}
+
+func TestECRCredentialsExpiry(t *testing.T) {
+	fake := &fakeECR{now: time.Now()}
+	ecr := fake.credentials()
+
+	cred, err := ecr.credsFor(testECRHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", cred.password)
+	assert.Equal(t, testECRHost, cred.registry)
+
+	fake.now = fake.now.Add(11 * time.Hour)
+	cred, _ = ecr.credsFor(testECRHost)
+	assert.Equal(t, "x", cred.password, "expected credentials to be reused")
+
+	fake.now = fake.now.Add(45 * time.Minute)
+	cred, _ = ecr.credsFor(testECRHost)
+	assert.Equal(t, "xx", cred.password, "expected credentials to be refreshed before expiry")
+
+	_, err = ecr.credsFor("index.docker.io")
+	assert.Error(t, err)
+}
+
+func TestECRCredentialsRefresh(t *testing.T) {
+	fake := &fakeECR{now: time.Now()}
+	ecr := fake.credentials()
+
+	ecr.credsFor(testECRHost)
+	ecr.refresh(testECRHost)
+	cred, _ := ecr.credsFor(testECRHost)
+	assert.Equal(t, "x", cred.password, "expected credentials just got to be kept")
+
+	fake.now = fake.now.Add(2 * ecrMinRefresh)
+	ecr.refresh(testECRHost)
+	cred, _ = ecr.credsFor(testECRHost)
+	assert.Equal(t, "xx", cred.password)
+}
+
+// basicAuthChecker stands in for a registry, accepting only the
+// password given.
+type basicAuthChecker struct {
+	store    *ecrStore
+	password func() string
+	requests int
+}
+
+func (c *basicAuthChecker) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	status := http.StatusOK
+	if _, password := c.store.Basic(req.URL); password != c.password() {
+		status = http.StatusUnauthorized
+	}
+	return &http.Response{StatusCode: status, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestECRRefreshOnUnauthorized(t *testing.T) {
+	fake := &fakeECR{now: time.Now()}
+	ecr := fake.credentials()
+	registry := &basicAuthChecker{
+		store:    &ecrStore{ecr: ecr, host: testECRHost},
+		password: func() string { return "xx" },
+	}
+	tx := &ecrRefreshing{transport: registry, ecr: ecr, host: testECRHost}
+
+	// The first credentials are refused, but too recently got to be
+	// asked for again
+	req, _ := http.NewRequest("GET", "https://"+testECRHost+"/v2/", nil)
+	res, err := tx.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, 2, registry.requests)
+
+	// Later, they are refreshed and the request retried
+	fake.now = fake.now.Add(2 * ecrMinRefresh)
+	res, err = tx.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, 4, registry.requests)
+	assert.Equal(t, 2, fake.fetched)
+}
+
+func TestECRStoreFallback(t *testing.T) {
+	fake := &fakeECR{fail: true}
+	s := &ecrStore{
+		store: store{creds{username: "configured", password: "secret"}},
+		ecr:   fake.credentials(),
+		host:  testECRHost,
+	}
+	username, password := s.Basic(nil)
+	assert.Equal(t, "configured", username)
+	assert.Equal(t, "secret", password)
+}
+
+func TestECRCredentialsBackoff(t *testing.T) {
+	fake := &fakeECR{now: time.Now(), fail: true}
+	ecr := fake.credentials()
+
+	_, err := ecr.credsFor(testECRHost)
+	assert.Error(t, err)
+	assert.Equal(t, 1, fake.attempts)
+
+	// Failure is remembered, for a while
+	_, err = ecr.credsFor(testECRHost)
+	assert.IsType(t, ecrBackoffError{}, err)
+	ecr.refresh(testECRHost)
+	fake.now = fake.now.Add(ecrMinRefresh / 2)
+	ecr.credsFor(testECRHost)
+	assert.Equal(t, 1, fake.attempts, "expected no attempt during backoff")
+
+	// ... and the wait grows each time it fails again
+	fake.now = fake.now.Add(ecrMinRefresh)
+	ecr.credsFor(testECRHost)
+	assert.Equal(t, 2, fake.attempts)
+	fake.now = fake.now.Add(ecrMinRefresh + time.Second)
+	ecr.credsFor(testECRHost)
+	assert.Equal(t, 2, fake.attempts, "expected backoff to have doubled")
+	fake.now = fake.now.Add(ecrMinRefresh)
+	ecr.credsFor(testECRHost)
+	assert.Equal(t, 3, fake.attempts)
+
+	// Once credentials can be got, they're used straight away
+	fake.fail = false
+	fake.now = fake.now.Add(ecrMaxBackoff)
+	cred, err := ecr.credsFor(testECRHost)
+	assert.NoError(t, err)
+	assert.Equal(t, "x", cred.password)
+
+	assert.Equal(t, ecrMaxBackoff, ecrBackoff(100))
+}
@@ -11,6 +11,15 @@ type Reader interface {
 	GetKey(k Keyer) ([]byte, time.Time, error)
 }
 
+// MultiReader is a Reader that can also get many values in one round
+// trip. It returns the values found, by key (as given by
+// `Keyer.Key()`); keys that aren't present are absent from the
+// result, rather than an error.
+type MultiReader interface {
+	Reader
+	GetKeys([]Keyer) (map[string][]byte, error)
+}
+
 type Writer interface {
 	SetKey(k Keyer, v []byte) error
 }
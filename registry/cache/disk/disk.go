@@ -0,0 +1,253 @@
+// Package disk keeps image metadata in files, so that (given a
+// persistent volume) the cache survives the daemon restarting, and
+// needn't be filled again from the image registries.
+package disk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+const (
+	DefaultExpiry = time.Hour
+	// How often to remove expired entries. Expired entries are never
+	// returned in any case; this is just to reclaim the space.
+	sweepInterval = 10 * time.Minute
+)
+
+// The entries are kept in a directory named for the version of the
+// format used, so that if it's changed, the entries in the old format
+// are ignored (and removed), rather than misread. This should be
+// incremented whenever the format of entries changes.
+const schemaVersion = 1
+
+var schemaDir = fmt.Sprintf("v%d", schemaVersion)
+
+// schemaDirRE matches the names of directories of entries in any
+// format, so that other directories (the cache dir may be shared)
+// are left alone.
+var schemaDirRE = regexp.MustCompile(`^v[0-9]+$`)
+
+// DiskClient is a cache.Client that keeps each entry in its own file,
+// named for the hash of the key, under a directory.
+type DiskClient struct {
+	dir    string
+	ttl    time.Duration
+	logger log.Logger
+
+	quit chan struct{}
+	wait sync.WaitGroup
+}
+
+// DiskConfig defines how a DiskClient should be constructed.
+type DiskConfig struct {
+	Path   string
+	Expiry time.Duration
+	Logger log.Logger
+}
+
+// NewDiskClient makes a client keeping entries under the path given,
+// creating it if necessary, and removing any entries kept there in
+// an older format.
+func NewDiskClient(config DiskConfig) (*DiskClient, error) {
+	if config.Path == "" {
+		return nil, errors.New("no path given for disk cache")
+	}
+	dir := filepath.Join(config.Path, schemaDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "creating disk cache directory")
+	}
+
+	c := &DiskClient{
+		dir:    dir,
+		ttl:    config.Expiry,
+		logger: config.Logger,
+		quit:   make(chan struct{}),
+	}
+	if c.ttl == 0 {
+		c.ttl = DefaultExpiry
+	}
+	if err := c.removeOldSchemas(config.Path); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "removing entries in old format from disk cache"))
+	}
+
+	c.wait.Add(1)
+	go c.sweepLoop(sweepInterval)
+	return c, nil
+}
+
+// Each entry is the expiry time, as seconds since the epoch, followed
+// by the value. This means the expiry can be given back with the
+// value, as for memcached.
+
+// GetKey gets the value and its expiry time from the cache.
+func (c *DiskClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
+	path := c.path(k)
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, time.Time{}, cache.ErrNotCached
+		}
+		c.logger.Log("err", errors.Wrap(err, "reading from disk cache"))
+		return []byte{}, time.Time{}, err
+	}
+	// An entry too short to have an expiry is no use; like
+	// an expired entry, it'll be cleaned up by the next sweep.
+	if len(bytes) < 8 {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(bytes)), 0)
+	if time.Now().After(expiry) {
+		return []byte{}, time.Time{}, cache.ErrNotCached
+	}
+	return bytes[8:], expiry, nil
+}
+
+// GetKeys gets the values of many keys from the cache. Keys with no
+// value are absent from the result.
+func (c *DiskClient) GetKeys(ks []cache.Keyer) (map[string][]byte, error) {
+	res := make(map[string][]byte, len(ks))
+	for _, k := range ks {
+		v, _, err := c.GetKey(k)
+		switch {
+		case err == cache.ErrNotCached:
+			continue
+		case err != nil:
+			return nil, err
+		}
+		res[k.Key()] = v
+	}
+	return res, nil
+}
+
+var _ cache.MultiReader = &DiskClient{}
+
+// SetKey sets the value at a key. The value is written to a temporary
+// file first, then moved into place, so that no-one reading the entry
+// sees it half-written (and, if the daemon is restarted while
+// writing, it isn't left half-written).
+func (c *DiskClient) SetKey(k cache.Keyer, v []byte) error {
+	path := c.path(k)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "storing in disk cache"))
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		c.logger.Log("err", errors.Wrap(err, "storing in disk cache"))
+		return err
+	}
+	exBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(exBytes, uint64(time.Now().Add(c.ttl).Unix()))
+	_, err = f.Write(append(exBytes, v...))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		c.logger.Log("err", errors.Wrap(err, "storing in disk cache"))
+		return err
+	}
+	return nil
+}
+
+// Stop the disk client.
+func (c *DiskClient) Stop() {
+	close(c.quit)
+	c.wait.Wait()
+}
+
+// path gives the file for the key. Keys include image names, which
+// have slashes and colons, so it's named for a hash of the key, and
+// put in a subdirectory by the first byte of the hash so no one
+// directory gets too big.
+func (c *DiskClient) path(k cache.Keyer) string {
+	sum := sha256.Sum256([]byte(k.Key()))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func (c *DiskClient) sweepLoop(interval time.Duration) {
+	defer c.wait.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.sweep(time.Now()); err != nil {
+				c.logger.Log("err", errors.Wrap(err, "removing expired entries from disk cache"))
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// sweep removes the entries that have expired as of the time given,
+// and any leftover temporary files.
+func (c *DiskClient) sweep(now time.Time) error {
+	return filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".tmp-") {
+			// Give writes in progress time to finish
+			if now.Sub(info.ModTime()) > time.Minute {
+				os.Remove(path)
+			}
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		exBytes := make([]byte, 8)
+		_, err = io.ReadFull(f, exBytes)
+		f.Close()
+		if err != nil || now.After(time.Unix(int64(binary.BigEndian.Uint64(exBytes)), 0)) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// removeOldSchemas removes the directories of entries in any format
+// other than the current one.
+func (c *DiskClient) removeOldSchemas(root string) error {
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() && schemaDirRE.MatchString(info.Name()) && info.Name() != schemaDir {
+			if err := os.RemoveAll(filepath.Join(root, info.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
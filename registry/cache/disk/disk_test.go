@@ -0,0 +1,117 @@
+package disk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/registry/cache"
+)
+
+type key string
+
+func (k key) Key() string {
+	return string(k)
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "flux-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func newClient(t *testing.T, dir string, expiry time.Duration) *DiskClient {
+	c, err := NewDiskClient(DiskConfig{Path: dir, Expiry: expiry, Logger: log.NewNopLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSetGet(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	c := newClient(t, dir, time.Hour)
+	k := key("registryrepov3|index.docker.io/library/alpine")
+	if _, _, err := c.GetKey(k); err != cache.ErrNotCached {
+		t.Fatalf("expected ErrNotCached before setting, got %v", err)
+	}
+	if err := c.SetKey(k, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+
+	// The entry is still there for a new client, as after a restart
+	c = newClient(t, dir, time.Hour)
+	defer c.Stop()
+	v, expiry, err := c.GetKey(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("value")) {
+		t.Errorf("expected %q, got %q", "value", v)
+	}
+	if expiry.Before(time.Now().Add(59*time.Minute)) || expiry.After(time.Now().Add(time.Hour)) {
+		t.Errorf("expected expiry an hour from now, got %s", expiry)
+	}
+
+	values, err := c.GetKeys([]cache.Keyer{k, key("missing")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !bytes.Equal(values[string(k)], []byte("value")) {
+		t.Errorf("expected just the value set, got %v", values)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	c := newClient(t, dir, -time.Second)
+	defer c.Stop()
+	k := key("expired")
+	if err := c.SetKey(k, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.GetKey(k); err != cache.ErrNotCached {
+		t.Errorf("expected expired entry not to be returned, got %v", err)
+	}
+	if err := c.sweep(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.path(k)); !os.IsNotExist(err) {
+		t.Errorf("expected expired entry to be removed, got %v", err)
+	}
+}
+
+func TestOldSchemasRemoved(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	old := filepath.Join(dir, "v0")
+	others := []string{filepath.Join(dir, "vim"), filepath.Join(dir, "volumes"), filepath.Join(dir, "v1.bak")}
+	for _, d := range append(others, old) {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newClient(t, dir, time.Hour)
+	defer c.Stop()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expected entries in old format to be removed, got %v", err)
+	}
+	for _, d := range others {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("expected directory %s not to be removed, got %v", d, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// EncodingVersion is the version of the encoding used for values
+// written to the cache. It should be incremented when the encoding
+// of image metadata changes in a way that older values can't simply
+// be decoded as newer ones, with an upgrade to go with it (see
+// `upgrades` below).
+//
+// This is distinct from the version in the keys: changing that
+// invalidates the whole cache, whereas values encoded with an older
+// version are upgraded as they are read, and rewritten by the warmer
+// as it comes across them. So the keys weren't changed when the
+// envelope was introduced: values cached before then are read as
+// version 0, rather than thrown away.
+const EncodingVersion = 1
+
+// versioned is the envelope in which values are kept. Values written
+// before the encoding was versioned are bare, and are treated as
+// version 0.
+type versioned struct {
+	EncodingVersion int
+	Value           json.RawMessage
+}
+
+// upgrades[n] takes a value encoded with version n to version
+// n+1. Version 0 (unversioned) values are the same as version 1
+// values, less the envelope.
+var upgrades = []func(json.RawMessage) (json.RawMessage, error){
+	0: func(v json.RawMessage) (json.RawMessage, error) { return v, nil },
+}
+
+// encode serialises a value for writing to the cache, with the
+// current encoding version.
+func encode(v interface{}) ([]byte, error) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(versioned{
+		EncodingVersion: EncodingVersion,
+		Value:           bytes,
+	})
+}
+
+// decode deserialises a value read from the cache, upgrading it if
+// it was encoded with an older version. It returns the version the
+// value was encoded with, so the caller can decide whether to write
+// it back.
+//
+// A value from a newer version is decoded as it is, on the
+// assumption that it has only gained fields (which will be ignored);
+// this means running an older daemon against the same cache will
+// still work.
+func decode(bytes []byte, v interface{}) (int, error) {
+	var env versioned
+	if err := json.Unmarshal(bytes, &env); err != nil {
+		return 0, err
+	}
+	version, value := env.EncodingVersion, env.Value
+	if version == 0 || value == nil {
+		version, value = 0, json.RawMessage(bytes)
+	}
+	for n := version; n < EncodingVersion; n++ {
+		var err error
+		if value, err = upgrades[n](value); err != nil {
+			return version, errors.Wrapf(err, "upgrading cached value from encoding version %d", n)
+		}
+	}
+	return version, json.Unmarshal(value, v)
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/registry"
+	"github.com/weaveworks/flux/registry/mock"
+)
+
+func TestEncodingRoundtrip(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	info := image.Info{ID: ref, Digest: "sha256:abc", CreatedAt: time.Now().UTC()}
+
+	bytes, err := encode(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got image.Info
+	version, err := decode(bytes, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != EncodingVersion {
+		t.Errorf("expected encoding version %d, got %d", EncodingVersion, version)
+	}
+	if got.ID.String() != info.ID.String() || got.Digest != info.Digest || !got.CreatedAt.Equal(info.CreatedAt) {
+		t.Errorf("roundtrip failed: expected %#v, got %#v", info, got)
+	}
+}
+
+func TestDecodeUnversioned(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	bytes, err := json.Marshal(ImageRepository{
+		LastUpdate: time.Now(),
+		Images:     map[string]image.Info{"tag": {ID: ref}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repo ImageRepository
+	version, err := decode(bytes, &repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("expected unversioned value to be version 0, got %d", version)
+	}
+	if len(repo.Images) != 1 || repo.LastUpdate.IsZero() {
+		t.Errorf("unversioned value not decoded: %#v", repo)
+	}
+}
+
+func TestDecodeNewerVersion(t *testing.T) {
+	bytes := []byte(`{"EncodingVersion": 1000, "Value": {"Digest": "sha256:abc", "Signatures": ["sig"]}}`)
+	var info image.Info
+	version, err := decode(bytes, &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1000 || info.Digest != "sha256:abc" {
+		t.Errorf("expected newer value to be decoded as-is; got version %d, %#v", version, info)
+	}
+}
+
+// literalKey is a key given as it is stored, rather than made from an
+// image name.
+type literalKey string
+
+func (k literalKey) Key() string {
+	return string(k)
+}
+
+// TestReadPreEnvelope checks that values written before the encoding
+// was versioned, under the keys used then, are still read.
+func TestReadPreEnvelope(t *testing.T) {
+	c := &mem{}
+	c.SetKey(literalKey("registryrepov3|example.com/path/image"),
+		[]byte(`{"LastError":"","LastUpdate":"2018-06-01T12:00:00Z","Images":{"tag":{"ID":"example.com/path/image:tag","Digest":"sha256:abc","CreatedAt":"2018-05-01T12:00:00Z"}}}`))
+	c.SetKey(literalKey("registryhistoryv3|example.com/path/image|tag"),
+		[]byte(`{"ID":"example.com/path/image:tag","Digest":"sha256:abc","CreatedAt":"2018-05-01T12:00:00Z"}`))
+	cache := &Cache{Reader: c}
+
+	name, _ := image.ParseRef("example.com/path/image:tag")
+	images, err := cache.GetSortedRepositoryImages(name.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Digest != "sha256:abc" {
+		t.Errorf("expected the image cached before versioning, got %#v", images)
+	}
+	img, err := cache.GetImage(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Digest != "sha256:abc" || img.CreatedAt.IsZero() {
+		t.Errorf("expected the manifest cached before versioning, got %#v", img)
+	}
+}
+
+// TestWarmMigrates checks that the warmer rewrites manifests in the
+// cache that were encoded with an older version, rather than
+// refetching them.
+func TestWarmMigrates(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	c := &mem{}
+	legacy, _ := json.Marshal(image.Info{ID: ref, CreatedAt: time.Now()})
+	c.SetKey(NewManifestKey(ref.CanonicalRef()), legacy)
+
+	client := &mock.Client{
+		TagsFn: func() ([]string, error) {
+			return []string{"tag"}, nil
+		},
+		ManifestFn: func(tag string) (image.Info, error) {
+			t.Errorf("remote client was asked for manifest of %q, which was cached", tag)
+			return image.Info{ID: ref}, nil
+		},
+	}
+	warmer := &Warmer{clientFactory: &mock.ClientFactory{Client: client}, cache: c, burst: 10}
+	warmer.warm(context.TODO(), log.NewNopLogger(), ref.Name, registry.NoCredentials())
+
+	for _, key := range []Keyer{NewManifestKey(ref.CanonicalRef()), NewRepositoryKey(ref.CanonicalName())} {
+		bytes, _, err := c.GetKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v interface{}
+		if version, err := decode(bytes, &v); err != nil || version != EncodingVersion {
+			t.Errorf("expected %s to be rewritten with version %d; got version %d (err %v)", key.Key(), EncodingVersion, version, err)
+		}
+	}
+}
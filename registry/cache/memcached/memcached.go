@@ -120,6 +120,30 @@ func (c *MemcacheClient) GetKey(k cache.Keyer) ([]byte, time.Time, error) {
 	return cacheItem.Value[4:], time.Unix(int64(exTime), 0), nil
 }
 
+// GetKeys gets the values of many keys from the cache in a single
+// request (per server). Keys with no value are absent from the result.
+func (c *MemcacheClient) GetKeys(ks []cache.Keyer) (map[string][]byte, error) {
+	keys := make([]string, len(ks))
+	for i, k := range ks {
+		keys[i] = k.Key()
+	}
+	items, err := c.client.GetMulti(keys)
+	if err != nil {
+		c.logger.Log("err", errors.Wrap(err, "Fetching many keys from memcache"))
+		return nil, err
+	}
+	res := make(map[string][]byte, len(items))
+	for k, item := range items {
+		if len(item.Value) < 4 {
+			continue
+		}
+		res[k] = item.Value[4:]
+	}
+	return res, nil
+}
+
+var _ cache.MultiReader = &MemcacheClient{}
+
 // SetKey sets the value at a key.
 func (c *MemcacheClient) SetKey(k cache.Keyer, v []byte) error {
 	exTime := time.Now().Add(c.ttl).Unix()
@@ -40,6 +40,32 @@ func (i *instrumentedClient) GetKey(k Keyer) (_ []byte, ex time.Time, err error)
 	return i.next.GetKey(k)
 }
 
+// GetKeys gets many keys in one round trip, if the client wrapped can
+// do that; otherwise, it gets them one by one.
+func (i *instrumentedClient) GetKeys(ks []Keyer) (_ map[string][]byte, err error) {
+	defer func(begin time.Time) {
+		cacheRequestDuration.With(
+			fluxmetrics.LabelMethod, "GetKeys",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	if multi, ok := i.next.(MultiReader); ok {
+		return multi.GetKeys(ks)
+	}
+	res := map[string][]byte{}
+	for _, k := range ks {
+		v, _, err := i.next.GetKey(k)
+		switch {
+		case err == ErrNotCached:
+			continue
+		case err != nil:
+			return nil, err
+		}
+		res[k.Key()] = v
+	}
+	return res, nil
+}
+
 func (i *instrumentedClient) SetKey(k Keyer, v []byte) (err error) {
 	defer func(begin time.Time) {
 		cacheRequestDuration.With(
@@ -1,7 +1,6 @@
 package cache
 
 import (
-	"encoding/json"
 	"sort"
 	"time"
 
@@ -9,6 +8,7 @@ import (
 
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/registry"
 )
 
 var (
@@ -39,8 +39,48 @@ func (c *Cache) GetSortedRepositoryImages(id image.Name) ([]image.Info, error) {
 	if err != nil {
 		return nil, err
 	}
+	return sortedRepositoryImages(bytes)
+}
+
+// GetSortedRepositoriesImages returns the lists of image manifests
+// for many image repositories. If the cache client can get many keys
+// at once, it's done in a single request.
+func (c *Cache) GetSortedRepositoriesImages(ids []image.Name) map[image.CanonicalName]registry.RepositoryImages {
+	res := map[image.CanonicalName]registry.RepositoryImages{}
+	multi, ok := c.Reader.(MultiReader)
+	if !ok {
+		for _, id := range ids {
+			images, err := c.GetSortedRepositoryImages(id)
+			res[id.CanonicalName()] = registry.RepositoryImages{Images: images, Err: err}
+		}
+		return res
+	}
+
+	keys := make([]Keyer, len(ids))
+	for i, id := range ids {
+		keys[i] = NewRepositoryKey(id.CanonicalName())
+	}
+	values, err := multi.GetKeys(keys)
+	for i, id := range ids {
+		var r registry.RepositoryImages
+		switch bytes, found := values[keys[i].Key()]; {
+		case err != nil:
+			r.Err = err
+		case !found:
+			r.Err = ErrNotCached
+		default:
+			r.Images, r.Err = sortedRepositoryImages(bytes)
+		}
+		res[id.CanonicalName()] = r
+	}
+	return res
+}
+
+// sortedRepositoryImages decodes a cached image repository, and
+// returns its images sorted newest first.
+func sortedRepositoryImages(bytes []byte) ([]image.Info, error) {
 	var repo ImageRepository
-	if err = json.Unmarshal(bytes, &repo); err != nil {
+	if _, err := decode(bytes, &repo); err != nil {
 		return nil, err
 	}
 
@@ -64,8 +104,31 @@ func (c *Cache) GetSortedRepositoryImages(id image.Name) ([]image.Info, error) {
 }
 
 // GetImage gets the manifest of a specific image ref, from its
-// registry.
+// registry. Manifests are cached by tag, so a ref pinned by digest is
+// looked for among the images in its repository, unless it also has a
+// tag, and that tag still refers to the digest.
 func (c *Cache) GetImage(id image.Ref) (image.Info, error) {
+	if id.Digest == "" {
+		return c.getTaggedImage(id)
+	}
+	if id.Tag != "" {
+		if img, err := c.getTaggedImage(id); err == nil && img.HasDigest(id.Digest) {
+			return img, nil
+		}
+	}
+	images, err := c.GetSortedRepositoryImages(id.Name)
+	if err != nil {
+		return image.Info{}, err
+	}
+	for _, img := range images {
+		if img.HasDigest(id.Digest) {
+			return img, nil
+		}
+	}
+	return image.Info{}, ErrNotCached
+}
+
+func (c *Cache) getTaggedImage(id image.Ref) (image.Info, error) {
 	key := NewManifestKey(id.CanonicalRef())
 
 	val, _, err := c.Reader.GetKey(key)
@@ -73,8 +136,7 @@ func (c *Cache) GetImage(id image.Ref) (image.Info, error) {
 		return image.Info{}, err
 	}
 	var img image.Info
-	err = json.Unmarshal(val, &img)
-	if err != nil {
+	if _, err = decode(val, &img); err != nil {
 		return image.Info{}, err
 	}
 	return img, nil
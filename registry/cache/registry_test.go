@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/image"
+)
+
+// multiMem is a cache client that can get many keys at once, and
+// counts how often it's asked.
+type multiMem struct {
+	mem
+	gets, multiGets int
+}
+
+func (c *multiMem) GetKey(k Keyer) ([]byte, time.Time, error) {
+	c.gets++
+	return c.mem.GetKey(k)
+}
+
+func (c *multiMem) GetKeys(ks []Keyer) (map[string][]byte, error) {
+	c.multiGets++
+	res := map[string][]byte{}
+	for _, k := range ks {
+		if v, _, err := c.mem.GetKey(k); err == nil {
+			res[k.Key()] = v
+		}
+	}
+	return res, nil
+}
+
+func TestGetSortedRepositoriesImages(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	other, _ := image.ParseRef("example.com/path/other:tag")
+	missing, _ := image.ParseRef("example.com/path/missing:tag")
+
+	c := &multiMem{}
+	for _, r := range []image.Ref{ref, other} {
+		bytes, err := encode(ImageRepository{
+			LastUpdate: time.Now(),
+			Images:     map[string]image.Info{"tag": {ID: r, CreatedAt: time.Now()}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetKey(NewRepositoryKey(r.CanonicalName()), bytes)
+	}
+
+	res := (&Cache{Reader: c}).GetSortedRepositoriesImages([]image.Name{ref.Name, other.Name, missing.Name})
+	if c.multiGets != 1 || c.gets != 0 {
+		t.Errorf("expected a single multi-get; got %d multi-gets and %d gets", c.multiGets, c.gets)
+	}
+	for _, r := range []image.Ref{ref, other} {
+		result := res[r.CanonicalName()]
+		if result.Err != nil || len(result.Images) != 1 || result.Images[0].ID.String() != r.String() {
+			t.Errorf("expected one image for %s, got %#v", r.Name, result)
+		}
+	}
+	if result := res[missing.CanonicalName()]; result.Err != ErrNotCached {
+		t.Errorf("expected not cached error for %s, got %#v", missing.Name, result)
+	}
+}
+
+// TestGetSortedRepositoriesImagesInstrumented checks that the metadata
+// is still got in one request through the instrumented client, as
+// fluxd uses it.
+func TestGetSortedRepositoriesImagesInstrumented(t *testing.T) {
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+	missing, _ := image.ParseRef("example.com/path/missing:tag")
+
+	c := &multiMem{}
+	bytes, err := encode(ImageRepository{
+		LastUpdate: time.Now(),
+		Images:     map[string]image.Info{"tag": {ID: ref, CreatedAt: time.Now()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetKey(NewRepositoryKey(ref.CanonicalName()), bytes)
+
+	res := (&Cache{Reader: InstrumentClient(c)}).GetSortedRepositoriesImages([]image.Name{ref.Name, missing.Name})
+	if c.multiGets != 1 || c.gets != 0 {
+		t.Errorf("expected a single multi-get; got %d multi-gets and %d gets", c.multiGets, c.gets)
+	}
+	if result := res[ref.CanonicalName()]; result.Err != nil || len(result.Images) != 1 {
+		t.Errorf("expected one image for %s, got %#v", ref.Name, result)
+	}
+	if result := res[missing.CanonicalName()]; result.Err != ErrNotCached {
+		t.Errorf("expected not cached error for %s, got %#v", missing.Name, result)
+	}
+
+	// A client that can't get many keys at once is asked for each
+	single := &mem{}
+	single.SetKey(NewRepositoryKey(ref.CanonicalName()), bytes)
+	res = (&Cache{Reader: InstrumentClient(single)}).GetSortedRepositoriesImages([]image.Name{ref.Name, missing.Name})
+	if result := res[ref.CanonicalName()]; result.Err != nil || len(result.Images) != 1 {
+		t.Errorf("expected one image for %s, got %#v", ref.Name, result)
+	}
+	if result := res[missing.CanonicalName()]; result.Err != ErrNotCached {
+		t.Errorf("expected not cached error for %s, got %#v", missing.Name, result)
+	}
+}
+
+func TestGetImageByListDigest(t *testing.T) {
+	listDigest := "sha256:" + strings.Repeat("a", 64)
+	platformDigest := "sha256:" + strings.Repeat("b", 64)
+	ref, _ := image.ParseRef("example.com/path/image:tag")
+
+	c := &multiMem{}
+	info := image.Info{ID: ref, Digest: platformDigest, ListDigest: listDigest, CreatedAt: time.Now()}
+	bytes, err := encode(ImageRepository{
+		LastUpdate: time.Now(),
+		Images:     map[string]image.Info{"tag": info},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetKey(NewRepositoryKey(ref.CanonicalName()), bytes)
+
+	for _, d := range []string{listDigest, platformDigest} {
+		img, err := (&Cache{Reader: c}).GetImage(ref.WithNewTag("").WithNewDigest(d))
+		if err != nil || img.ID.String() != ref.String() {
+			t.Errorf("expected to find %s by digest %s, got %+v (%v)", ref, d, img, err)
+		}
+	}
+}
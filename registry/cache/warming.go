@@ -2,8 +2,8 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +25,27 @@ type Warmer struct {
 	burst         int
 	Priority      chan image.Name
 	Notify        func()
+	// TimestampFallback is applied to images fetched without a
+	// creation time
+	TimestampFallback image.TimestampFallback
+	// Workers is how many images are refreshed at once; if less
+	// than one, they're refreshed one at a time.
+	Workers int
+	// Automated, if set, gives the images used by automated
+	// workloads. These are refreshed ahead of the others each time
+	// round, since new tags for them are waiting to be released.
+	Automated func() []image.Name
+	// Backoff, if set, says whether requests to a registry host are
+	// being held back. Images from such hosts are put off until
+	// the backoff ends, so the workers can get on with others.
+	Backoff HostBackoff
+}
+
+// HostBackoff says until when requests to a registry host are being
+// held back (e.g., because it has asked for fewer requests); the time
+// is in the past, if they aren't.
+type HostBackoff interface {
+	BackoffUntil(host string) time.Time
 }
 
 // NewWarmer creates cache warmer that (when Loop is invoked) will
@@ -53,59 +74,160 @@ func (w *Warmer) Loop(logger log.Logger, stop <-chan struct{}, wg *sync.WaitGrou
 
 	refresh := time.Tick(askForNewImagesInterval)
 	imageCreds := imagesToFetchFunc()
-	backlog := imageCredsToBacklog(imageCreds)
+	backlog := w.backlog(imageCreds)
+	// Images asked for on the `Priority` channel, which go before
+	// anything in the backlog.
+	var priority []backlogItem
 
 	// We have some fine control over how long to spend on each fetch
 	// operation, since they are given a `context`. For now though,
-	// just rattle through them one by one, however long they take.
+	// just rattle through them, however long they take.
 	ctx := context.Background()
 
-	// NB the implicit contract here is that the prioritised
-	// image has to have been running the last time we
-	// requested the credentials.
-	priorityWarm := func(name image.Name) {
-		logger.Log("priority", name.String())
-		if creds, ok := imageCreds[name]; ok {
-			w.warm(ctx, logger, name, creds)
-		} else {
-			logger.Log("priority", name.String(), "err", "no creds available")
-		}
+	workers := w.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	work := make(chan backlogItem)
+	done := make(chan image.Name)
+	var workersWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workersWg.Add(1)
+		go func() {
+			defer workersWg.Done()
+			for im := range work {
+				w.warm(ctx, logger, im.Name, im.Credentials)
+				done <- im.Name
+			}
+		}()
 	}
+	// When the loop stops, let the workers finish what they're
+	// doing and report back, so none is left waiting.
+	defer func() {
+		close(work)
+		go func() {
+			workersWg.Wait()
+			close(done)
+		}()
+		for range done {
+		}
+	}()
+	inFlight := map[image.Name]bool{}
 
 	// This loop acts keeps a kind of priority queue, whereby image
 	// names coming in on the `Priority` channel are looked up first.
-	// If there are none, images used in the cluster are refreshed;
-	// but no more often than once every `askForNewImagesInterval`,
-	// since there is no effective back-pressure on cache refreshes
-	// and it would spin freely otherwise).
+	// If there are none, images used in the cluster are refreshed,
+	// automated workloads' first; but no more often than once every
+	// `askForNewImagesInterval`, since there is no effective
+	// back-pressure on cache refreshes and it would spin freely
+	// otherwise). An image is only refreshed by one worker at a time.
 	for {
+		// Find the next image to hand to a worker, if there's one
+		// ready; otherwise, when the first to be put off, because its
+		// registry host is being backed off from, can go.
+		now := time.Now()
+		queue, i, opens := &priority, -1, time.Time{}
+		for _, q := range []*[]backlogItem{&priority, &backlog} {
+			var qOpens time.Time
+			if i, qOpens = w.ready(*q, inFlight, now); i >= 0 {
+				queue = q
+				break
+			}
+			if opens.IsZero() || (!qOpens.IsZero() && qOpens.Before(opens)) {
+				opens = qOpens
+			}
+		}
+		var (
+			next   backlogItem
+			sendTo chan backlogItem // nil, so never chosen, unless there's an image ready
+			wakeUp <-chan time.Time
+		)
+		if i >= 0 {
+			next, sendTo = (*queue)[i], work
+		} else if !opens.IsZero() {
+			wakeUp = time.After(time.Until(opens))
+		}
+
 		select {
 		case <-stop:
 			logger.Log("stopping", "true")
 			return
 		case name := <-w.Priority:
-			priorityWarm(name)
-			continue
-		default:
+			logger.Log("priority", name.String())
+			// NB the implicit contract here is that the prioritised
+			// image has to have been running the last time we
+			// requested the credentials.
+			if creds, ok := imageCreds[name]; ok {
+				if !queued(priority, name) {
+					priority = append(priority, backlogItem{name, creds})
+				}
+			} else {
+				logger.Log("priority", name.String(), "err", "no creds available")
+			}
+		case sendTo <- next:
+			inFlight[next.Name] = true
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+		case name := <-done:
+			delete(inFlight, name)
+		case <-wakeUp:
+		case <-refresh:
+			if len(backlog) == 0 {
+				imageCreds = imagesToFetchFunc()
+				backlog = w.backlog(imageCreds)
+			}
 		}
+	}
+}
 
-		if len(backlog) > 0 {
-			im := backlog[0]
-			backlog = backlog[1:]
-			w.warm(ctx, logger, im.Name, im.Credentials)
-		} else {
-			select {
-			case <-stop:
-				logger.Log("stopping", "true")
-				return
-			case <-refresh:
-				imageCreds = imagesToFetchFunc()
-				backlog = imageCredsToBacklog(imageCreds)
-			case name := <-w.Priority:
-				priorityWarm(name)
+// queued reports whether the image is among the items given.
+func queued(items []backlogItem, name image.Name) bool {
+	for _, im := range items {
+		if im.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ready finds the first of the items that can be refreshed now: it's
+// not already being refreshed, and its registry host isn't being
+// backed off from. If there's none, it gives -1, and the earliest
+// time the backoff for one of the items' hosts ends (or the zero
+// time, if none is being backed off).
+func (w *Warmer) ready(items []backlogItem, inFlight map[image.Name]bool, now time.Time) (int, time.Time) {
+	var earliest time.Time
+	for i, im := range items {
+		if inFlight[im.Name] {
+			continue
+		}
+		if w.Backoff != nil {
+			if until := w.Backoff.BackoffUntil(im.CanonicalName().Domain); until.After(now) {
+				if earliest.IsZero() || until.Before(earliest) {
+					earliest = until
+				}
+				continue
 			}
 		}
+		return i, time.Time{}
+	}
+	return -1, earliest
+}
+
+// backlog gives the images to refresh, with those used by automated
+// workloads first.
+func (w *Warmer) backlog(imageCreds registry.ImageCreds) []backlogItem {
+	backlog := imageCredsToBacklog(imageCreds)
+	if w.Automated == nil {
+		return backlog
+	}
+	automated := map[image.Name]bool{}
+	for _, name := range w.Automated() {
+		automated[name] = true
 	}
+	sort.SliceStable(backlog, func(i, j int) bool {
+		return automated[backlog[i].Name] && !automated[backlog[j].Name]
+	})
+	return backlog
 }
 
 func imageCredsToBacklog(imageCreds registry.ImageCreds) []backlogItem {
@@ -131,7 +253,7 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 	repoKey := NewRepositoryKey(id.CanonicalName())
 	bytes, _, err := w.cache.GetKey(repoKey)
 	if err == nil {
-		err = json.Unmarshal(bytes, &repo)
+		_, err = decode(bytes, &repo)
 	} else if err == ErrNotCached {
 		err = nil
 	}
@@ -147,7 +269,7 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 	// attempting to refresh that value. Whatever happens, at the end
 	// we'll write something back.
 	defer func() {
-		bytes, err := json.Marshal(repo)
+		bytes, err := encode(repo)
 		if err == nil {
 			err = w.cache.SetKey(repoKey, bytes)
 		}
@@ -190,7 +312,10 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 			missing++
 		default:
 			var image image.Info
-			if err := json.Unmarshal(bytes, &image); err == nil {
+			if version, err := decode(bytes, &image); err == nil {
+				if version < EncodingVersion {
+					w.migrate(errorLogger, key, image)
+				}
 				newImages[tag] = image
 				continue // i.e., no need to update this one
 			}
@@ -230,10 +355,15 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 					errorLogger.Log("err", errors.Wrap(err, "requesting manifests"))
 					return
 				}
+				firstSeen := oldImages[imageID.Tag].FirstSeen
+				if firstSeen.IsZero() {
+					firstSeen = time.Now()
+				}
+				w.TimestampFallback.Apply(&img, firstSeen)
 
 				key := NewManifestKey(img.ID.CanonicalRef())
 				// Write back to memcached
-				val, err := json.Marshal(img)
+				val, err := encode(img)
 				if err != nil {
 					errorLogger.Log("err", errors.Wrap(err, "serializing tag to store in cache"))
 					return
@@ -283,6 +413,18 @@ func (w *Warmer) warm(ctx context.Context, logger log.Logger, id image.Name, cre
 	}
 }
 
+// migrate rewrites a value that was read from the cache in an older
+// encoding, so that it needn't be upgraded each time it's read.
+func (w *Warmer) migrate(logger log.Logger, key Keyer, v interface{}) {
+	bytes, err := encode(v)
+	if err == nil {
+		err = w.cache.SetKey(key, bytes)
+	}
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "rewriting cached value in current encoding"))
+	}
+}
+
 // StringSet is a set of strings.
 type StringSet map[string]struct{}
 
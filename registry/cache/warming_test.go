@@ -84,3 +84,112 @@ func TestWarm(t *testing.T) {
 		}
 	}
 }
+
+type backoffs map[string]time.Time
+
+func (b backoffs) BackoffUntil(host string) time.Time {
+	return b[host]
+}
+
+func TestWarmerBacklog(t *testing.T) {
+	var names []image.Name
+	imageCreds := registry.ImageCreds{}
+	for _, s := range []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d"} {
+		ref, _ := image.ParseRef(s)
+		names = append(names, ref.Name)
+		imageCreds[ref.Name] = registry.NoCredentials()
+	}
+	automated := names[2:]
+
+	warmer := &Warmer{Automated: func() []image.Name { return automated }}
+	backlog := warmer.backlog(imageCreds)
+	if len(backlog) != len(names) {
+		t.Fatalf("expected %d items in backlog, got %d", len(names), len(backlog))
+	}
+	for i, item := range backlog[:2] {
+		if item.Name != automated[0] && item.Name != automated[1] {
+			t.Errorf("expected automated images first, got %s at %d", item.Name, i)
+		}
+	}
+}
+
+func TestWarmerReady(t *testing.T) {
+	now := time.Now()
+	var items []backlogItem
+	for _, s := range []string{"busy.example.com/a", "busy.example.com/b", "example.com/c", "example.com/d"} {
+		ref, _ := image.ParseRef(s)
+		items = append(items, backlogItem{ref.Name, registry.NoCredentials()})
+	}
+	warmer := &Warmer{Backoff: backoffs{"busy.example.com": now.Add(time.Minute)}}
+
+	// Images from a host being backed off from are put off, as are
+	// those already being refreshed
+	i, _ := warmer.ready(items, map[image.Name]bool{items[2].Name: true}, now)
+	if i != 3 {
+		t.Errorf("expected item 3 to be ready, got %d", i)
+	}
+
+	// If nothing is ready, the end of the earliest backoff is given
+	i, opens := warmer.ready(items[:2], nil, now)
+	if i != -1 {
+		t.Errorf("expected nothing to be ready, got %d", i)
+	}
+	if !opens.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected to be told when backoff ends, got %s", opens)
+	}
+}
+
+func TestWarmerLoopStops(t *testing.T) {
+	started := make(chan struct{}, 10)
+	client := &mock.Client{
+		TagsFn: func() ([]string, error) {
+			started <- struct{}{}
+			time.Sleep(10 * time.Millisecond)
+			return []string{"tag"}, nil
+		},
+		ManifestFn: func(tag string) (image.Info, error) {
+			return image.Info{CreatedAt: time.Now()}, nil
+		},
+	}
+	imageCreds := registry.ImageCreds{}
+	for _, s := range []string{"example.com/a", "example.com/b", "example.com/c", "example.com/d"} {
+		ref, _ := image.ParseRef(s)
+		imageCreds[ref.Name] = registry.NoCredentials()
+	}
+	warmer := &Warmer{
+		clientFactory: &mock.ClientFactory{Client: client},
+		cache:         &mem{},
+		burst:         10,
+		Workers:       2,
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go warmer.Loop(log.NewNopLogger(), stop, wg, func() registry.ImageCreds { return imageCreds })
+
+	<-started
+	close(stop)
+
+	// Stopping waits for the workers to finish, rather than leaving
+	// them stuck trying to report back
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warmer loop did not stop")
+	}
+}
+
+func TestQueued(t *testing.T) {
+	a, _ := image.ParseRef("example.com/a")
+	b, _ := image.ParseRef("example.com/b")
+	items := []backlogItem{{a.Name, registry.NoCredentials()}}
+	if !queued(items, a.Name) || queued(items, b.Name) {
+		t.Errorf("expected only %s to be queued in %v", a.Name, items)
+	}
+}
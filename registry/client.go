@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/docker/distribution"
@@ -38,6 +39,9 @@ type Remote struct {
 	transport http.RoundTripper
 	repo      image.CanonicalName
 	base      string
+	// platforms of interest, in order of preference, for
+	// multi-platform images
+	platforms []image.Platform
 }
 
 // Adapt to docker distribution `reference.Named`.
@@ -62,6 +66,13 @@ func (a *Remote) Tags(ctx context.Context) ([]string, error) {
 	return repository.Tags(ctx).All(ctx)
 }
 
+// imageConfig is the part of an image's configuration (as in the
+// "config" field of the config blob, or of a schema1 v1-compatibility
+// entry) that we care about.
+type imageConfig struct {
+	Labels map[string]string `json:"Labels"`
+}
+
 // Manifest fetches the metadata for an image reference; currently
 // assumed to be in the same repo as that provided to `NewRemote(...)`
 func (a *Remote) Manifest(ctx context.Context, ref string) (image.Info, error) {
@@ -75,13 +86,73 @@ func (a *Remote) Manifest(ctx context.Context, ref string) (image.Info, error) {
 	}
 	var manifestDigest digest.Digest
 	digestOpt := client.ReturnContentDigest(&manifestDigest)
-	manifest, fetchErr := manifests.Get(ctx, digest.Digest(ref), digestOpt, distribution.WithTagOption{ref})
-
-interpret:
-	if fetchErr != nil {
+	manifest, err := manifests.Get(ctx, digest.Digest(ref), digestOpt, distribution.WithTagOption{ref})
+	if err != nil {
 		return image.Info{}, err
 	}
 
+	list, ok := manifest.(*manifestlist.DeserializedManifestList)
+	if !ok {
+		return a.interpret(ctx, repository, ref, manifest, manifestDigest)
+	}
+
+	// For a multi-platform image, the image for the first platform
+	// (in order of preference) found supplies the metadata; those
+	// for any other platforms of interest are kept as variants.
+	platforms := a.platforms
+	if len(platforms) == 0 {
+		platforms = []image.Platform{image.DefaultPlatform}
+	}
+	var info image.Info
+	var found bool
+	for _, p := range platforms {
+		for _, m := range list.ManifestList.Manifests {
+			if !p.Matches(image.Platform{OS: m.Platform.OS, Arch: m.Platform.Architecture, Variant: m.Platform.Variant}) {
+				continue
+			}
+			var platformDigest digest.Digest
+			platformManifest, err := manifests.Get(ctx, m.Digest, client.ReturnContentDigest(&platformDigest))
+			if err != nil {
+				return image.Info{}, err
+			}
+			if platformDigest == "" {
+				platformDigest = m.Digest
+			}
+			platformInfo, err := a.interpret(ctx, repository, ref, platformManifest, platformDigest)
+			if err != nil {
+				return image.Info{}, err
+			}
+			if platformInfo.OS == "" {
+				platformInfo.OS, platformInfo.Arch = m.Platform.OS, m.Platform.Architecture
+			}
+			if !found {
+				info, found = platformInfo, true
+			} else {
+				info.Variants = append(info.Variants, image.Variant{
+					Platform:  image.Platform{OS: m.Platform.OS, Arch: m.Platform.Architecture, Variant: m.Platform.Variant},
+					Digest:    platformInfo.Digest,
+					ImageID:   platformInfo.ImageID,
+					CreatedAt: platformInfo.CreatedAt,
+				})
+			}
+			break
+		}
+	}
+	if found {
+		info.ListDigest = manifestDigest.String()
+	}
+	if !found {
+		var names []string
+		for _, p := range platforms {
+			names = append(names, p.String())
+		}
+		return image.Info{}, errors.New("no suitable manifest (" + strings.Join(names, ", ") + ") in manifestlist")
+	}
+	return info, nil
+}
+
+// interpret extracts the metadata from a (single-platform) manifest.
+func (a *Remote) interpret(ctx context.Context, repository distribution.Repository, ref string, manifest distribution.Manifest, manifestDigest digest.Digest) (image.Info, error) {
 	info := image.Info{ID: a.repo.ToRef(ref), Digest: manifestDigest.String()}
 
 	// TODO(michael): can we type switch? Not sure how dependable the
@@ -91,19 +162,22 @@ interpret:
 		var man schema1.Manifest = deserialised.Manifest
 		// for decoding the v1-compatibility entry in schema1 manifests
 		var v1 struct {
-			ID      string    `json:"id"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
-			Arch    string    `json:"architecture"`
+			ID      string      `json:"id"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Arch    string      `json:"architecture"`
+			Config  imageConfig `json:"config"`
 		}
 
-		if err = json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err != nil {
+		if err := json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err != nil {
 			return image.Info{}, err
 		}
 		// This is not the ImageID that Docker uses, but assumed to
 		// identify the image as it's the topmost layer.
 		info.ImageID = v1.ID
 		info.CreatedAt = v1.Created
+		info.Labels = v1.Config.Labels
+		info.OS, info.Arch = v1.OS, v1.Arch
 	case *schema2.DeserializedManifest:
 		var man schema2.Manifest = deserialised.Manifest
 		configBytes, err := repository.Blobs(ctx).Get(ctx, man.Config.Digest)
@@ -112,9 +186,10 @@ interpret:
 		}
 
 		var config struct {
-			Arch    string    `json:"architecture"`
-			Created time.Time `json:"created"`
-			OS      string    `json:"os"`
+			Arch    string      `json:"architecture"`
+			Created time.Time   `json:"created"`
+			OS      string      `json:"os"`
+			Config  imageConfig `json:"config"`
 		}
 		if err = json.Unmarshal(configBytes, &config); err != nil {
 			return image.Info{}, err
@@ -122,16 +197,8 @@ interpret:
 		// This _is_ what Docker uses as its Image ID.
 		info.ImageID = man.Config.Digest.String()
 		info.CreatedAt = config.Created
-	case *manifestlist.DeserializedManifestList:
-		var list manifestlist.ManifestList = deserialised.ManifestList
-		// TODO(michael): is it valid to just pick the first one that matches?
-		for _, m := range list.Manifests {
-			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
-				manifest, fetchErr = manifests.Get(ctx, m.Digest, digestOpt)
-				goto interpret
-			}
-		}
-		return image.Info{}, errors.New("no suitable manifest (linux amd64) in manifestlist")
+		info.Labels = config.Config.Labels
+		info.OS, info.Arch = config.OS, config.Arch
 	default:
 		t := reflect.TypeOf(manifest)
 		return image.Info{}, errors.New("unknown manifest type: " + t.String())
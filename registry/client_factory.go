@@ -19,6 +19,12 @@ type RemoteClientFactory struct {
 	Limiters      *middleware.RateLimiters
 	Trace         bool
 	InsecureHosts []string
+	// Platforms are those of interest for multi-platform images, in
+	// order of preference; if empty, `image.DefaultPlatform`
+	Platforms []image.Platform
+	// ECR, if not nil, supplies the credentials for AWS ECR
+	// registries, in preference to any configured
+	ECR *ECRCredentials
 
 	mu               sync.Mutex
 	challengeManager challenge.Manager
@@ -98,13 +104,22 @@ func (f *RemoteClientFactory) ClientFor(repo image.CanonicalName, creds Credenti
 		f.Logger.Log("repo", repo.String(), "auth", cred.String(), "api", registryURL.String())
 	}
 
-	tokenHandler := auth.NewTokenHandler(tx, &store{cred}, repo.Image, "pull")
-	basicauthHandler := auth.NewBasicHandler(&store{cred})
+	var credStore auth.CredentialStore = &store{cred}
+	useECR := f.ECR != nil && IsECRHost(repo.Domain)
+	if useECR {
+		credStore = &ecrStore{store: store{cred}, ecr: f.ECR, host: repo.Domain, logger: f.Logger}
+	}
+
+	tokenHandler := auth.NewTokenHandler(tx, credStore, repo.Image, "pull")
+	basicauthHandler := auth.NewBasicHandler(credStore)
 	tx = transport.NewTransport(tx, auth.NewAuthorizer(manager, tokenHandler, basicauthHandler))
+	if useECR {
+		tx = &ecrRefreshing{transport: tx, ecr: f.ECR, host: repo.Domain}
+	}
 
 	// For the API base we want only the scheme and host.
 	registryURL.Path = ""
-	client := &Remote{transport: tx, repo: repo, base: registryURL.String()}
+	client := &Remote{transport: tx, repo: repo, base: registryURL.String(), platforms: f.Platforms}
 	return NewInstrumentedClient(client), nil
 }
 
@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/image"
 )
 
 // Registry Credentials
@@ -85,7 +87,9 @@ func ParseCredentials(from string, b []byte) (Credentials, error) {
 				return Credentials{}, errors.New("Invalid registry auth url. Must be a valid http address (e.g. https://gcr.io/v1/)")
 			}
 		}
-		host = u.Host
+		// Credentials are looked up by the canonical domain of an
+		// image, so store them that way.
+		host = image.CanonicalDomain(u.Host)
 
 		m[host] = creds{
 			registry:   host,
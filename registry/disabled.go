@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"errors"
+
+	fluxerr "github.com/weaveworks/flux/errors"
+	"github.com/weaveworks/flux/image"
+)
+
+// ErrScanningDisabled is given for any image, by a daemon told not to
+// scan image registries.
+var ErrScanningDisabled = &fluxerr.Error{
+	Type: fluxerr.Missing,
+	Err:  errors.New("image registry scanning is disabled"),
+	Help: `Image registry scanning is disabled
+
+The daemon was run with --registry-disable-scanning, so it doesn't
+know what images are available, to list them, release them, or
+update automated workloads. To use these, run the daemon without it.
+`,
+}
+
+// ImageScanDisabledRegistry is a Registry with no images, for when
+// images aren't being scanned.
+type ImageScanDisabledRegistry struct{}
+
+func (ImageScanDisabledRegistry) GetSortedRepositoryImages(image.Name) ([]image.Info, error) {
+	return nil, ErrScanningDisabled
+}
+
+func (ImageScanDisabledRegistry) GetSortedRepositoriesImages(names []image.Name) map[image.CanonicalName]RepositoryImages {
+	res := make(map[image.CanonicalName]RepositoryImages, len(names))
+	for _, name := range names {
+		res[name.CanonicalName()] = RepositoryImages{Err: ErrScanningDisabled}
+	}
+	return res
+}
+
+func (ImageScanDisabledRegistry) GetImage(image.Ref) (image.Info, error) {
+	return image.Info{}, ErrScanningDisabled
+}
@@ -3,18 +3,100 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/go-kit/kit/metrics/prometheus"
 	"github.com/pkg/errors"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
+
+	fluxmetrics "github.com/weaveworks/flux/metrics"
+)
+
+var (
+	rateLimitWaits = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "client",
+		Name:      "rate_limit_waits_total",
+		Help:      "Count of registry requests that had to wait for the rate limit, by host.",
+	}, []string{fluxmetrics.LabelHost})
+	rateLimitBackoffs = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "client",
+		Name:      "rate_limit_backoffs_total",
+		Help:      "Count of times requests to a registry host were held back, after it responded with 429 Too Many Requests or a server error, by host.",
+	}, []string{fluxmetrics.LabelHost})
+)
+
+const (
+	// When a host responds with 429 or a 5xx, requests to it are
+	// held back for this long, doubling for each such response in a
+	// row, up to the maximum; or for as long as the host asks, with
+	// Retry-After, if that's longer.
+	initialBackoff = 2 * time.Second
+	maxBackoff     = 5 * time.Minute
 )
 
 type RateLimiters struct {
 	RPS, Burst int
-	perHost    map[string]*rate.Limiter
+	perHost    map[string]*hostLimiter
 	mu         sync.Mutex
 }
 
+// hostLimiter limits the rate of requests to a host, and holds them
+// back altogether for a while if the host is struggling or has asked
+// for fewer requests.
+type hostLimiter struct {
+	rl *rate.Limiter
+
+	mu      sync.Mutex
+	backoff time.Duration
+	until   time.Time
+}
+
+// BackoffUntil gives the time until which requests to the host are
+// being held back, which is in the past if they aren't.
+func (limiters *RateLimiters) BackoffUntil(host string) time.Time {
+	limiters.mu.Lock()
+	h, ok := limiters.perHost[host]
+	limiters.mu.Unlock()
+	if !ok {
+		return time.Time{}
+	}
+	return h.backedOffUntil()
+}
+
+func (h *hostLimiter) backedOffUntil() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.until
+}
+
+// observe adjusts the backoff according to a response from the host.
+func (h *hostLimiter) observe(resp *http.Response, now time.Time) (backingOff bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		h.backoff = 0
+		return false
+	}
+	if h.backoff == 0 {
+		h.backoff = initialBackoff
+	} else if h.backoff *= 2; h.backoff > maxBackoff {
+		h.backoff = maxBackoff
+	}
+	wait := h.backoff
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(secs)*time.Second > wait {
+		wait = time.Duration(secs) * time.Second
+	}
+	if until := now.Add(wait); until.After(h.until) {
+		h.until = until
+	}
+	return true
+}
+
 // Limit returns a RoundTripper for a particular host. We expect to do
 // a number of requests to a particular host at a time.
 func (limiters *RateLimiters) RoundTripper(rt http.RoundTripper, host string) http.RoundTripper {
@@ -22,31 +104,55 @@ func (limiters *RateLimiters) RoundTripper(rt http.RoundTripper, host string) ht
 	defer limiters.mu.Unlock()
 
 	if limiters.perHost == nil {
-		limiters.perHost = map[string]*rate.Limiter{}
+		limiters.perHost = map[string]*hostLimiter{}
 	}
 	if _, ok := limiters.perHost[host]; !ok {
 		rl := rate.NewLimiter(rate.Limit(limiters.RPS), limiters.Burst)
-		limiters.perHost[host] = rl
+		limiters.perHost[host] = &hostLimiter{rl: rl}
 	}
 	return &RoundTripRateLimiter{
-		rl: limiters.perHost[host],
-		tx: rt,
+		host:    host,
+		limiter: limiters.perHost[host],
+		tx:      rt,
 	}
 }
 
 type RoundTripRateLimiter struct {
-	rl *rate.Limiter
-	tx http.RoundTripper
+	host    string
+	limiter *hostLimiter
+	tx      http.RoundTripper
 }
 
 func (t *RoundTripRateLimiter) RoundTrip(r *http.Request) (*http.Response, error) {
-	// Wait errors out if the request cannot be processed within
-	// the deadline. This is preemptive, instead of waiting the
-	// entire duration.
-	if err := t.rl.Wait(r.Context()); err != nil {
-		return nil, errors.Wrap(err, "rate limited")
+	// Hold back while the host is backed off from, unless the
+	// request can't wait that long.
+	if wait := time.Until(t.limiter.backedOffUntil()); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, errors.Wrap(r.Context().Err(), "backing off from "+t.host)
+		case <-timer.C:
+		}
+	}
+
+	// A request that can go now takes its token; one that can't
+	// takes nothing, and is counted before waiting below.
+	if !t.limiter.rl.Allow() {
+		rateLimitWaits.With(fluxmetrics.LabelHost, t.host).Add(1)
+		// Wait errors out if the request cannot be processed within
+		// the deadline. This is preemptive, instead of waiting the
+		// entire duration.
+		if err := t.limiter.rl.Wait(r.Context()); err != nil {
+			return nil, errors.Wrap(err, "rate limited")
+		}
+	}
+
+	resp, err := t.tx.RoundTrip(r)
+	if err == nil && t.limiter.observe(resp, time.Now()) {
+		rateLimitBackoffs.With(fluxmetrics.LabelHost, t.host).Add(1)
 	}
-	return t.tx.RoundTrip(r)
+	return resp, err
 }
 
 type ContextRoundTripper struct {
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	limiters := &RateLimiters{RPS: 10, Burst: 10}
+	limiters.RoundTripper(http.DefaultTransport, "example.com")
+	h := limiters.perHost["example.com"]
+	now := time.Now()
+
+	respond := func(status int, retryAfter string) bool {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return h.observe(resp, now)
+	}
+
+	if respond(http.StatusOK, "") {
+		t.Error("expected no backoff after 200 OK")
+	}
+	if until := limiters.BackoffUntil("example.com"); !until.IsZero() {
+		t.Errorf("expected no backoff, got until %s", until)
+	}
+
+	// Each failure in a row doubles the backoff
+	respond(http.StatusTooManyRequests, "")
+	respond(http.StatusServiceUnavailable, "")
+	if until := limiters.BackoffUntil("example.com"); !until.Equal(now.Add(2 * initialBackoff)) {
+		t.Errorf("expected backoff of %s, got until %s", 2*initialBackoff, until)
+	}
+
+	// .. unless the host asks for longer
+	respond(http.StatusTooManyRequests, "600")
+	if until := limiters.BackoffUntil("example.com"); !until.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("expected backoff until Retry-After, got until %s", until)
+	}
+
+	// A success resets the backoff, though not the time already
+	// given
+	respond(http.StatusOK, "")
+	if h.backoff != 0 {
+		t.Errorf("expected backoff to be reset, got %s", h.backoff)
+	}
+
+	if until := limiters.BackoffUntil("other.example.com"); !until.IsZero() {
+		t.Errorf("expected no backoff for unknown host, got until %s", until)
+	}
+}
@@ -51,6 +51,15 @@ func (m *Registry) GetSortedRepositoryImages(id image.Name) ([]image.Info, error
 	return imgs, m.Err
 }
 
+func (m *Registry) GetSortedRepositoriesImages(ids []image.Name) map[image.CanonicalName]registry.RepositoryImages {
+	res := map[image.CanonicalName]registry.RepositoryImages{}
+	for _, id := range ids {
+		imgs, err := m.GetSortedRepositoryImages(id)
+		res[id.CanonicalName()] = registry.RepositoryImages{Images: imgs, Err: err}
+	}
+	return res
+}
+
 func (m *Registry) GetImage(id image.Ref) (image.Info, error) {
 	for _, i := range m.Images {
 		if i.ID.String() == id.String() {
@@ -55,6 +55,22 @@ func (m *instrumentedRegistry) GetSortedRepositoryImages(id image.Name) (res []i
 	return
 }
 
+func (m *instrumentedRegistry) GetSortedRepositoriesImages(ids []image.Name) (res map[image.CanonicalName]RepositoryImages) {
+	start := time.Now()
+	res = m.next.GetSortedRepositoriesImages(ids)
+	success := true
+	for _, r := range res {
+		if r.Err != nil {
+			success = false
+			break
+		}
+	}
+	registryDuration.With(
+		fluxmetrics.LabelSuccess, strconv.FormatBool(success),
+	).Observe(time.Since(start).Seconds())
+	return
+}
+
 func (m *instrumentedRegistry) GetImage(id image.Ref) (res image.Info, err error) {
 	start := time.Now()
 	res, err = m.next.GetImage(id)
@@ -13,9 +13,21 @@ var (
 // Registry is a store of image metadata.
 type Registry interface {
 	GetSortedRepositoryImages(image.Name) ([]image.Info, error)
+	// GetSortedRepositoriesImages is GetSortedRepositoryImages for
+	// many image repositories at once; implementations may be able
+	// to do it in fewer round trips than asking for each in turn.
+	GetSortedRepositoriesImages([]image.Name) map[image.CanonicalName]RepositoryImages
 	GetImage(image.Ref) (image.Info, error)
 }
 
+// RepositoryImages is the outcome of asking for the images in an
+// image repository: either the images, sorted newest first, or the
+// error that meant they couldn't be had.
+type RepositoryImages struct {
+	Images []image.Info
+	Err    error
+}
+
 // ImageCreds is a record of which images need which credentials,
 // which is supplied to us (probably by interrogating the cluster)
 type ImageCreds map[image.Name]Credentials
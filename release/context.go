@@ -39,26 +39,70 @@ func (rc *ReleaseContext) Manifests() cluster.Manifests {
 	return rc.manifests
 }
 
-func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate) error {
-	err := func() error {
-		for _, update := range updates {
-			manifestBytes, err := ioutil.ReadFile(update.ManifestPath)
-			if err != nil {
-				return err
+// WriteUpdates writes the updates given to the files in the repo,
+// and returns those that were written. If the images of a workload
+// given in values files can't be updated, that workload is left as it
+// was, and marked as failed in the results, rather than failing the
+// whole release.
+func (rc *ReleaseContext) WriteUpdates(updates []*update.ControllerUpdate, results update.Result) ([]*update.ControllerUpdate, error) {
+	var written []*update.ControllerUpdate
+	for _, u := range updates {
+		if cu, ok := rc.manifests.(cluster.CommandUpdater); ok && cu.IsGenerated(u.ManifestPath) {
+			for _, container := range u.Updates {
+				if err := cu.UpdateGeneratedImage(u.ManifestPath, u.ResourceID, container.Container, container.Target); err != nil {
+					return nil, err
+				}
 			}
-			for _, container := range update.Updates {
-				manifestBytes, err = rc.manifests.UpdateImage(manifestBytes, update.ResourceID, container.Container, container.Target)
+			written = append(written, u)
+			continue
+		}
+		original, err := ioutil.ReadFile(u.ManifestPath)
+		if err != nil {
+			return nil, err
+		}
+		// Images given in values files are updated there,
+		// and the rest in the manifest
+		containers := u.Updates
+		if vu, ok := rc.manifests.(cluster.ValuesUpdater); ok {
+			containers = containers[:0:0]
+			var valuesErr error
+			for _, container := range u.Updates {
+				updated, err := vu.UpdateValuesImage(rc.repo.Dir(), u.ManifestPath, u.ResourceID, container.Container, container.Target)
 				if err != nil {
-					return err
+					valuesErr = err
+					break
+				}
+				if !updated {
+					containers = append(containers, container)
+				}
+			}
+			if valuesErr != nil {
+				if err := ioutil.WriteFile(u.ManifestPath, original, os.FileMode(0600)); err != nil {
+					return nil, err
 				}
+				result := results[u.ResourceID]
+				result.Status = update.ReleaseStatusFailed
+				result.Error = valuesErr.Error()
+				results[u.ResourceID] = result
+				continue
 			}
-			if err = ioutil.WriteFile(update.ManifestPath, manifestBytes, os.FileMode(0600)); err != nil {
-				return err
+		}
+		manifestBytes, err := ioutil.ReadFile(u.ManifestPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, container := range containers {
+			manifestBytes, err = rc.manifests.UpdateImage(manifestBytes, u.ResourceID, container.Container, container.Target)
+			if err != nil {
+				return nil, err
 			}
 		}
-		return nil
-	}()
-	return err
+		if err = ioutil.WriteFile(u.ManifestPath, manifestBytes, os.FileMode(0600)); err != nil {
+			return nil, err
+		}
+		written = append(written, u)
+	}
+	return written, nil
 }
 
 // ---
@@ -109,7 +153,9 @@ func (rc *ReleaseContext) SelectServices(results update.Result, prefilters, post
 			// defined.
 			return nil, fmt.Errorf("controller %s was requested and is running, but is not defined", s.ID)
 		}
-		update.Controller = s
+		// Images given in values files aren't to be seen in the
+		// cluster, so come from the repo
+		update.Controller = s.WithFileContainers(update.Resource)
 		forPostFiltering = append(forPostFiltering, update)
 	}
 
@@ -27,6 +27,7 @@ func Release(rc *ReleaseContext, changes Changes, logger log.Logger) (results up
 			changes.ReleaseType(),
 			changes.ReleaseKind(),
 		)
+		update.ObserveReleaseResult(results, changes.ReleaseType(), changes.ReleaseKind())
 	}(time.Now())
 
 	logger = log.With(logger, "type", "release")
@@ -37,7 +38,7 @@ func Release(rc *ReleaseContext, changes Changes, logger log.Logger) (results up
 		return nil, err
 	}
 
-	err = ApplyChanges(rc, updates, logger)
+	updates, err = ApplyChanges(rc, updates, results, logger)
 	if err != nil {
 		return results, MakeReleaseError(errors.Wrap(err, "applying changes"))
 	}
@@ -54,17 +55,19 @@ func Release(rc *ReleaseContext, changes Changes, logger log.Logger) (results up
 	return results, err
 }
 
-func ApplyChanges(rc *ReleaseContext, updates []*update.ControllerUpdate, logger log.Logger) error {
+// ApplyChanges writes the updates given, and returns those that were
+// written; see `WriteUpdates`.
+func ApplyChanges(rc *ReleaseContext, updates []*update.ControllerUpdate, results update.Result, logger log.Logger) ([]*update.ControllerUpdate, error) {
 	logger.Log("updates", len(updates))
 	if len(updates) == 0 {
 		logger.Log("exit", "no images to update for services given")
-		return nil
+		return nil, nil
 	}
 
 	timer := update.NewStageTimer("write_changes")
-	err := rc.WriteUpdates(updates)
+	written, err := rc.WriteUpdates(updates, results)
 	timer.ObserveDuration()
-	return err
+	return written, err
 }
 
 // VerifyChanges checks that the `after` resources are exactly the
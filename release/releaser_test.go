@@ -16,6 +16,7 @@ import (
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/git/gittest"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	registryMock "github.com/weaveworks/flux/registry/mock"
 	"github.com/weaveworks/flux/resource"
 	"github.com/weaveworks/flux/update"
@@ -436,6 +437,75 @@ func Test_ImageStatus(t *testing.T) {
 	}
 }
 
+func Test_TagFilter(t *testing.T) {
+	running := mockCluster(hwSvc, lockedSvc, testSvc)
+	semverRef, _ := image.ParseRef("quay.io/weaveworks/helloworld:1.2.3")
+	tooNewRef, _ := image.ParseRef("quay.io/weaveworks/helloworld:1.3.0")
+	registry := &registryMock.Registry{
+		Images: []image.Info{
+			{
+				ID:        newHwRef,
+				CreatedAt: timeNow,
+			},
+			{
+				ID:        tooNewRef,
+				CreatedAt: timeNow.Add(-time.Minute),
+			},
+			{
+				ID:        semverRef,
+				CreatedAt: timeNow.Add(-time.Hour),
+			},
+			{
+				ID:        newSidecarRef,
+				CreatedAt: timeNow,
+			},
+		},
+	}
+
+	checkout, cleanup := setup(t)
+	defer cleanup()
+	if _, err := cluster.UpdatePolicies(mockManifests, checkout.ManifestDir(), hwSvcID, policy.Update{
+		Add: policy.Set{policy.TagPrefix(helloContainer): "semver:~1.2"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &ReleaseContext{
+		cluster:   running,
+		manifests: mockManifests,
+		repo:      checkout,
+		registry:  registry,
+	}
+	spec := update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec},
+		ImageSpec:    update.ImageSpecLatest,
+		Kind:         update.ReleaseKindExecute,
+		Excludes:     []flux.ResourceID{},
+	}
+	expected := update.Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): update.ControllerResult{
+			Status: update.ReleaseStatusSuccess,
+			PerContainer: []update.ContainerUpdate{
+				update.ContainerUpdate{
+					Container: helloContainer,
+					Current:   oldRef,
+					Target:    semverRef,
+				},
+				update.ContainerUpdate{
+					Container: sidecarContainer,
+					Current:   sidecarRef,
+					Target:    newSidecarRef,
+				},
+			},
+		},
+		flux.MustParseResourceID("default:deployment/locked-service"): ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/test-service"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/multi-deploy"):   ignoredNotIncluded,
+		flux.MustParseResourceID("default:deployment/list-deploy"):    ignoredNotIncluded,
+	}
+	testRelease(t, ctx, spec, expected)
+}
+
 func Test_UpdateMultidoc(t *testing.T) {
 	egID := flux.MustParseResourceID("default:deployment/multi-deploy")
 	egSvc := cluster.Controller{
@@ -743,3 +813,72 @@ func Test_BadRelease(t *testing.T) {
 		t.Fatal("did not return an error, but was expected to fail verification")
 	}
 }
+
+// A Manifests implementation that can't update the images of one
+// workload, as though they were in values files but not found there.
+type valuesFailManifests struct {
+	kubernetes.Manifests
+	fail flux.ResourceID
+}
+
+func (m *valuesFailManifests) UpdateValuesImage(root, path string, id flux.ResourceID, container string, newImageID image.Ref) (bool, error) {
+	if id == m.fail {
+		return false, fmt.Errorf("did not find container %s in HelmRelease", container)
+	}
+	return false, nil
+}
+
+func Test_ValuesUpdateFailsOneWorkload(t *testing.T) {
+	egID := flux.MustParseResourceID("default:deployment/multi-deploy")
+	egSvc := cluster.Controller{
+		ID: egID,
+		Containers: cluster.ContainersOrExcuse{
+			Containers: []resource.Container{
+				{
+					Name:  "hello",
+					Image: oldRef,
+				},
+			},
+		},
+	}
+	checkout, cleanup := setup(t)
+	defer cleanup()
+	manifests := &valuesFailManifests{fail: hwSvcID}
+	ctx := &ReleaseContext{
+		cluster:   mockCluster(hwSvc, egSvc),
+		manifests: manifests,
+		repo:      checkout,
+		registry:  mockRegistry,
+	}
+	spec := update.ReleaseSpec{
+		ServiceSpecs: []update.ResourceSpec{hwSvcSpec, update.ResourceSpec(egID.String())},
+		ImageSpec:    update.ImageSpecFromRef(newHwRef),
+		Kind:         update.ReleaseKindExecute,
+	}
+	results, err := Release(ctx, spec, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := results[hwSvcID]; result.Status != update.ReleaseStatusFailed || result.Error == "" {
+		t.Errorf("expected %s to have failed, got %#v", hwSvcID, result)
+	}
+	if result := results[egID]; result.Status != update.ReleaseStatusSuccess {
+		t.Errorf("expected %s to have been updated, got %#v", egID, result)
+	}
+
+	resources, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, expected := range map[flux.ResourceID]image.Ref{hwSvcID: oldRef, egID: newHwRef} {
+		var got image.Ref
+		for _, c := range resources[id.String()].(resource.Workload).Containers() {
+			if c.Name == hwSvc.Containers.Containers[0].Name || c.Name == "hello" {
+				got = c.Image
+			}
+		}
+		if got != expected {
+			t.Errorf("expected image of %s to be %s, got %s", id, expected, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/job"
@@ -98,6 +99,33 @@ func (p *ErrorLoggingServer) GitRepoConfig(ctx context.Context, regenerate bool)
 	return p.server.GitRepoConfig(ctx, regenerate)
 }
 
+func (p *ErrorLoggingServer) LintReport(ctx context.Context) (_ v11.LintReport, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "LintReport", "error", err)
+		}
+	}()
+	return p.server.LintReport(ctx)
+}
+
+func (p *ErrorLoggingServer) ManifestsReport(ctx context.Context) (_ v11.ManifestsReport, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "ManifestsReport", "error", err)
+		}
+	}()
+	return p.server.ManifestsReport(ctx)
+}
+
+func (p *ErrorLoggingServer) DriftReport(ctx context.Context, opts v11.DriftOptions) (_ v11.DriftReport, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "DriftReport", "error", err)
+		}
+	}()
+	return p.server.DriftReport(ctx, opts)
+}
+
 type ErrorLoggingUpstreamServer struct {
 	*ErrorLoggingServer
 	server api.UpstreamServer
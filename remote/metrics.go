@@ -10,6 +10,7 @@ import (
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/job"
@@ -117,6 +118,36 @@ func (i *instrumentedServer) GitRepoConfig(ctx context.Context, regenerate bool)
 	return i.s.GitRepoConfig(ctx, regenerate)
 }
 
+func (i *instrumentedServer) LintReport(ctx context.Context) (_ v11.LintReport, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "LintReport",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.LintReport(ctx)
+}
+
+func (i *instrumentedServer) ManifestsReport(ctx context.Context) (_ v11.ManifestsReport, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ManifestsReport",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.ManifestsReport(ctx)
+}
+
+func (i *instrumentedServer) DriftReport(ctx context.Context, opts v11.DriftOptions) (_ v11.DriftReport, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "DriftReport",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.DriftReport(ctx, opts)
+}
+
 var _ api.UpstreamServer = &instrumentedUpstreamServer{}
 
 type instrumentedUpstreamServer struct {
@@ -11,8 +11,10 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
+	"github.com/weaveworks/flux/cluster"
 	"github.com/weaveworks/flux/guid"
 	"github.com/weaveworks/flux/image"
 	"github.com/weaveworks/flux/job"
@@ -48,6 +50,16 @@ type MockServer struct {
 
 	GitRepoConfigAnswer v6.GitConfig
 	GitRepoConfigError  error
+
+	LintReportAnswer v11.LintReport
+	LintReportError  error
+
+	ManifestsReportAnswer v11.ManifestsReport
+	ManifestsReportError  error
+
+	DriftReportArgTest func(v11.DriftOptions) error
+	DriftReportAnswer  v11.DriftReport
+	DriftReportError   error
 }
 
 func (p *MockServer) Ping(ctx context.Context) error {
@@ -99,6 +111,23 @@ func (p *MockServer) GitRepoConfig(ctx context.Context, regenerate bool) (v6.Git
 	return p.GitRepoConfigAnswer, p.GitRepoConfigError
 }
 
+func (p *MockServer) LintReport(context.Context) (v11.LintReport, error) {
+	return p.LintReportAnswer, p.LintReportError
+}
+
+func (p *MockServer) ManifestsReport(context.Context) (v11.ManifestsReport, error) {
+	return p.ManifestsReportAnswer, p.ManifestsReportError
+}
+
+func (p *MockServer) DriftReport(ctx context.Context, opts v11.DriftOptions) (v11.DriftReport, error) {
+	if p.DriftReportArgTest != nil {
+		if err := p.DriftReportArgTest(opts); err != nil {
+			return v11.DriftReport{}, err
+		}
+	}
+	return p.DriftReportAnswer, p.DriftReportError
+}
+
 var _ api.UpstreamServer = &MockServer{}
 
 // -- Battery of tests for an api.Server implementation. Since these
@@ -147,6 +176,54 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 		},
 	}
 
+	lintReportAnswer := v11.LintReport{
+		Revision: "abc123",
+		Findings: []cluster.LintFinding{
+			{
+				ID:      flux.MustParseResourceID("foobar:deployment/hello"),
+				Source:  "hello.yaml",
+				Rule:    "deprecated-api-version",
+				Message: "extensions/v1beta1 Deployment is deprecated; use apps/v1",
+			},
+		},
+	}
+
+	manifestsReportAnswer := v11.ManifestsReport{
+		Revision: "abc123",
+		Error: &cluster.FileError{
+			Path:    "broken.yaml",
+			Line:    3,
+			Message: "yaml: mapping values are not allowed in this context",
+		},
+		Skipped: []cluster.SkippedFile{
+			{Path: "README.md", Reason: "not a .yaml, .yml or .json file"},
+			{Path: "config.yaml", Line: 1, Reason: "document has no kind, so is not a resource"},
+		},
+	}
+
+	driftReportAnswer := v11.DriftReport{
+		Revisions:  map[string]string{"git@github.com:weaveworks/flux-example": "abc123"},
+		Extraneous: true,
+		Resources: []cluster.ResourceDrift{
+			{
+				ID:     flux.MustParseResourceID("foobar:deployment/hello"),
+				Source: "hello.yaml",
+				Status: cluster.DriftModified,
+				Diff:   []cluster.FieldDrift{{Path: "spec.replicas", Git: "2", Cluster: "5"}},
+			},
+			{
+				ID:     flux.MustParseResourceID("foobar:service/gone"),
+				Status: cluster.DriftExtraneous,
+			},
+		},
+	}
+	checkDriftOptions := func(opts v11.DriftOptions) error {
+		if !opts.Diff {
+			return errors.New("expected diff to be asked for")
+		}
+		return nil
+	}
+
 	syncStatusAnswer := []string{
 		"commit 1",
 		"commit 2",
@@ -175,6 +252,10 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 		UpdateManifestsArgTest: checkUpdateSpec,
 		UpdateManifestsAnswer:  job.ID(guid.New()),
 		SyncStatusAnswer:       syncStatusAnswer,
+		LintReportAnswer:       lintReportAnswer,
+		ManifestsReportAnswer:  manifestsReportAnswer,
+		DriftReportArgTest:     checkDriftOptions,
+		DriftReportAnswer:      driftReportAnswer,
 	}
 
 	ctx := context.Background()
@@ -239,4 +320,39 @@ func ServerTestBattery(t *testing.T, wrap func(mock api.UpstreamServer) api.Upst
 	if !reflect.DeepEqual(mock.SyncStatusAnswer, syncSt) {
 		t.Errorf("expected: %#v\ngot: %#v", mock.SyncStatusAnswer, syncSt)
 	}
+
+	report, err := client.LintReport(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.LintReportAnswer, report) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.LintReportAnswer, report)
+	}
+	mock.LintReportError = fmt.Errorf("lint report error")
+	if _, err = client.LintReport(ctx); err == nil {
+		t.Error("expected error from LintReport, got nil")
+	}
+
+	manifestsReport, err := client.ManifestsReport(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.ManifestsReportAnswer, manifestsReport) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.ManifestsReportAnswer, manifestsReport)
+	}
+	mock.ManifestsReportError = fmt.Errorf("manifests report error")
+	if _, err = client.ManifestsReport(ctx); err == nil {
+		t.Error("expected error from ManifestsReport, got nil")
+	}
+
+	driftReport, err := client.DriftReport(ctx, v11.DriftOptions{Diff: true})
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(mock.DriftReportAnswer, driftReport) {
+		t.Errorf("expected: %#v\ngot: %#v", mock.DriftReportAnswer, driftReport)
+	}
+	if _, err = client.DriftReport(ctx, v11.DriftOptions{}); err == nil {
+		t.Error("expected error from DriftReport without diff, got nil")
+	}
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/weaveworks/flux/api"
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 	"github.com/weaveworks/flux/api/v6"
 	"github.com/weaveworks/flux/api/v9"
 	"github.com/weaveworks/flux/job"
@@ -62,3 +63,15 @@ func (bc baseClient) SyncStatus(context.Context, string) ([]string, error) {
 func (bc baseClient) GitRepoConfig(context.Context, bool) (v6.GitConfig, error) {
 	return v6.GitConfig{}, remote.UpgradeNeededError(errors.New("GitRepoConfig method not implemented"))
 }
+
+func (bc baseClient) LintReport(context.Context) (v11.LintReport, error) {
+	return v11.LintReport{}, remote.UpgradeNeededError(errors.New("LintReport method not implemented"))
+}
+
+func (bc baseClient) ManifestsReport(context.Context) (v11.ManifestsReport, error) {
+	return v11.ManifestsReport{}, remote.UpgradeNeededError(errors.New("ManifestsReport method not implemented"))
+}
+
+func (bc baseClient) DriftReport(context.Context, v11.DriftOptions) (v11.DriftReport, error) {
+	return v11.DriftReport{}, remote.UpgradeNeededError(errors.New("DriftReport method not implemented"))
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+
+	"github.com/weaveworks/flux/api/v11"
+	"github.com/weaveworks/flux/remote"
+)
+
+// RPCClientV11 is the rpc-backed implementation of a server, for
+// talking to remote daemons. This version introduces the lint,
+// manifests and drift reports.
+type RPCClientV11 struct {
+	*RPCClientV10
+}
+
+type clientV11 interface {
+	v11.Server
+	v11.Upstream
+}
+
+var _ clientV11 = &RPCClientV11{}
+
+// NewClientV11 creates a new rpc-backed implementation of the server.
+func NewClientV11(conn io.ReadWriteCloser) *RPCClientV11 {
+	return &RPCClientV11{NewClientV10(conn)}
+}
+
+func (p *RPCClientV11) LintReport(ctx context.Context) (v11.LintReport, error) {
+	var resp LintReportResponse
+	err := p.client.Call("RPCServer.LintReport", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV11) ManifestsReport(ctx context.Context) (v11.ManifestsReport, error) {
+	var resp ManifestsReportResponse
+	err := p.client.Call("RPCServer.ManifestsReport", struct{}{}, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
+
+func (p *RPCClientV11) DriftReport(ctx context.Context, opts v11.DriftOptions) (v11.DriftReport, error) {
+	var resp DriftReportResponse
+	err := p.client.Call("RPCServer.DriftReport", opts, &resp)
+	if err != nil {
+		if _, ok := err.(rpc.ServerError); !ok && err != nil {
+			err = remote.FatalError{err}
+		}
+	} else if resp.ApplicationError != nil {
+		err = resp.ApplicationError
+	}
+	return resp.Result, err
+}
@@ -164,6 +164,7 @@ func listImagesWithOptions(ctx context.Context, client listImagesWithOptionsClie
 			if err != nil {
 				return images, err
 			}
+			newContainer.Available = opts.SelectImages(newContainer.Available)
 			images[i].Containers[j] = newContainer
 		}
 	}
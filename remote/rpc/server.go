@@ -7,6 +7,7 @@ import (
 	"net/rpc/jsonrpc"
 
 	"github.com/weaveworks/flux/api/v10"
+	"github.com/weaveworks/flux/api/v11"
 
 	"github.com/pkg/errors"
 
@@ -196,3 +197,54 @@ func (p *RPCServer) GitRepoConfig(regenerate bool, resp *GitRepoConfigResponse)
 	}
 	return err
 }
+
+type LintReportResponse struct {
+	Result           v11.LintReport
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) LintReport(_ struct{}, resp *LintReportResponse) error {
+	v, err := p.s.LintReport(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type ManifestsReportResponse struct {
+	Result           v11.ManifestsReport
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) ManifestsReport(_ struct{}, resp *ManifestsReportResponse) error {
+	v, err := p.s.ManifestsReport(context.Background())
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
+
+type DriftReportResponse struct {
+	Result           v11.DriftReport
+	ApplicationError *fluxerr.Error
+}
+
+func (p *RPCServer) DriftReport(opts v11.DriftOptions, resp *DriftReportResponse) error {
+	v, err := p.s.DriftReport(context.Background(), opts)
+	resp.Result = v
+	if err != nil {
+		if err, ok := errors.Cause(err).(*fluxerr.Error); ok {
+			resp.ApplicationError = err
+			return nil
+		}
+	}
+	return err
+}
@@ -27,3 +27,11 @@ type Workload interface {
 	// effect on any underlying file or cluster resource.
 	SetContainerImage(container string, ref image.Ref) error
 }
+
+// ContainersInFiles is implemented by workloads that can have
+// containers whose images are given in files other than their
+// manifest (e.g., the values files of a Helm chart), and so aren't to
+// be seen in the cluster.
+type ContainersInFiles interface {
+	FileContainers() []Container
+}
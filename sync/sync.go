@@ -1,6 +1,8 @@
 package sync
 
 import (
+	"sort"
+
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
@@ -9,8 +11,20 @@ import (
 	"github.com/weaveworks/flux/resource"
 )
 
+// GC says whether, and how, to garbage collect resources that were
+// synced and have since been removed from the repo.
+type GC struct {
+	// The name of the sync set, i.e., where the resources come from.
+	// Everything applied is marked as belonging to the sync set, and
+	// anything so marked that is no longer in the repo is deleted. If
+	// empty, nothing is marked or garbage collected.
+	SyncSet string
+	// DryRun says to log what would be deleted, rather than delete it
+	DryRun bool
+}
+
 // Sync synchronises the cluster to the files in a directory
-func Sync(m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster, deletes bool, logger log.Logger) error {
+func Sync(m cluster.Manifests, repoResources map[string]resource.Resource, clus cluster.Cluster, deletes bool, gc GC, logger log.Logger) error {
 	// Get a map of resources defined in the cluster
 	clusterBytes, err := clus.Export()
 
@@ -42,9 +56,177 @@ func Sync(m cluster.Manifests, repoResources map[string]resource.Resource, clus
 		prepareSyncApply(logger, clusterResources, id, res, &sync)
 	}
 
+	if gc.SyncSet != "" {
+		sync.SyncSet = gc.SyncSet
+		syncSetBytes, err := clus.ExportSyncSet(gc.SyncSet)
+		if err != nil {
+			return errors.Wrap(err, "exporting sync set from cluster")
+		}
+		syncSetResources, err := m.ParseManifests(syncSetBytes)
+		if err != nil {
+			return errors.Wrap(err, "parsing exported sync set")
+		}
+		repoIDs := make(map[string]bool, len(repoResources))
+		for id := range repoResources {
+			repoIDs[id] = true
+		}
+		for id, res := range syncSetResources {
+			prepareGCDelete(logger, repoIDs, id, res, gc.DryRun, &sync)
+		}
+	}
+
 	return clus.Sync(sync)
 }
 
+// DefaultBatchSize is the size, in bytes of manifests, of the batches
+// in which SyncWalk applies resources, unless told otherwise.
+const DefaultBatchSize = 4 << 20
+
+// Walk calls the func given with each resource to be synced from
+// the sources given (as named by `resource.Source()`), or from all
+// of them if there are none given, in turn; e.g., by walking the
+// manifests in a repo (see cluster.ManifestWalker). It may be called
+// more than once, and is expected to give the same resources each
+// time.
+type Walk func(sources []string, fn func(resource.Resource) error) error
+
+// WalkPlan is what's found by walking the resources to be synced
+// once, before any are applied.
+type WalkPlan struct {
+	// IDs has the ID of each resource walked
+	IDs     map[string]bool
+	walk    Walk
+	ranks   []int            // the ranks of the resources, lowest first
+	sources map[int][]string // the sources with resources of each rank
+}
+
+// PlanWalk walks the resources to be synced, and gives each to `fn`,
+// if that's not nil; e.g., to check it. Nothing is applied, so if
+// the walk (or `fn`) fails, the cluster is left as it is.
+func PlanWalk(clus cluster.Cluster, walk Walk, fn func(resource.Resource) error) (*WalkPlan, error) {
+	plan := &WalkPlan{IDs: map[string]bool{}, walk: walk, sources: map[int][]string{}}
+	rank := applyRank(clus)
+	seen := map[int]map[string]bool{}
+	err := walk(nil, func(res resource.Resource) error {
+		plan.IDs[res.ResourceID().String()] = true
+		r := rank(res)
+		if seen[r] == nil {
+			seen[r] = map[string]bool{}
+			plan.ranks = append(plan.ranks, r)
+		}
+		if !seen[r][res.Source()] {
+			seen[r][res.Source()] = true
+			plan.sources[r] = append(plan.sources[r], res.Source())
+		}
+		if fn != nil {
+			return fn(res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(plan.ranks)
+	return plan, nil
+}
+
+// SyncWalk is like Sync (without deletes), but walks the resources
+// planned, rather than being given them all at once, and applies
+// them in batches of no more than `batchSize` bytes (or of a single
+// resource, if it's bigger). So that they are applied in the order
+// the cluster needs, there's a walk for each rank of resource
+// present, of just the sources with resources of that rank. Only the
+// IDs of the resources, and a batch of them, are held at once,
+// besides what's exported from the cluster.
+func SyncWalk(m cluster.Manifests, plan *WalkPlan, clus cluster.Cluster, gc GC, batchSize int, logger log.Logger) error {
+	clusterBytes, err := clus.Export()
+	if err != nil {
+		return errors.Wrap(err, "exporting resource defs from cluster")
+	}
+	clusterResources, err := m.ParseManifests(clusterBytes)
+	if err != nil {
+		return errors.Wrap(err, "parsing exported resources")
+	}
+
+	var syncErrs cluster.SyncError
+	apply := func(sync cluster.SyncDef) error {
+		if len(sync.Actions) == 0 {
+			return nil
+		}
+		sync.SyncSet = gc.SyncSet
+		err := clus.Sync(sync)
+		if errs, ok := err.(cluster.SyncError); ok {
+			// Carry on with the other batches, as Sync would with
+			// the other resources
+			syncErrs = append(syncErrs, errs...)
+			return nil
+		}
+		return err
+	}
+
+	rank := applyRank(clus)
+	for _, r := range plan.ranks {
+		var batch cluster.SyncDef
+		var size int
+		err := plan.walk(plan.sources[r], func(res resource.Resource) error {
+			if rank(res) != r {
+				return nil
+			}
+			n := len(batch.Actions)
+			prepareSyncApply(logger, clusterResources, res.ResourceID().String(), res, &batch)
+			if len(batch.Actions) == n {
+				return nil
+			}
+			if size += len(res.Bytes()); size >= batchSize {
+				err := apply(batch)
+				batch, size = cluster.SyncDef{}, 0
+				return err
+			}
+			return nil
+		})
+		if err == nil {
+			err = apply(batch)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if gc.SyncSet != "" {
+		syncSetBytes, err := clus.ExportSyncSet(gc.SyncSet)
+		if err != nil {
+			return errors.Wrap(err, "exporting sync set from cluster")
+		}
+		syncSetResources, err := m.ParseManifests(syncSetBytes)
+		if err != nil {
+			return errors.Wrap(err, "parsing exported sync set")
+		}
+		var deletes cluster.SyncDef
+		for id, res := range syncSetResources {
+			prepareGCDelete(logger, plan.IDs, id, res, gc.DryRun, &deletes)
+		}
+		if err := apply(deletes); err != nil {
+			return err
+		}
+	}
+
+	// If `nil`, syncErrs is a cluster.SyncError(nil) rather than error(nil)
+	if syncErrs != nil {
+		return syncErrs
+	}
+	return nil
+}
+
+// applyRank gives the func for ranking resources to be applied in
+// the cluster given; if it doesn't care about order, they all have
+// the same rank.
+func applyRank(clus cluster.Cluster) func(resource.Resource) int {
+	if orderer, ok := clus.(cluster.ApplyOrderer); ok {
+		return orderer.ApplyRank
+	}
+	return func(resource.Resource) int { return 0 }
+}
+
 func prepareSyncDelete(logger log.Logger, repoResources map[string]resource.Resource, id string, res resource.Resource, sync *cluster.SyncDef) {
 	if len(repoResources) == 0 {
 		return
@@ -60,6 +242,36 @@ func prepareSyncDelete(logger log.Logger, repoResources map[string]resource.Reso
 	}
 }
 
+// prepareGCDelete deletes a resource which was synced, if it's no
+// longer in the repo. As with prepareSyncDelete, nothing is deleted
+// if there's nothing in the repo, since that's more likely a mistake
+// than an intention to delete everything.
+func prepareGCDelete(logger log.Logger, repoIDs map[string]bool, id string, res resource.Resource, dryRun bool, sync *cluster.SyncDef) {
+	if len(repoIDs) == 0 {
+		return
+	}
+	if repoIDs[id] {
+		return
+	}
+	if res.Policy().Contains(policy.Ignore) {
+		logger.Log("resource", res.ResourceID(), "ignore", "garbage collection")
+		return
+	}
+	for _, action := range sync.Actions {
+		if action.Delete != nil && action.Delete.ResourceID() == res.ResourceID() {
+			return
+		}
+	}
+	if dryRun {
+		logger.Log("resource", res.ResourceID(), "dry-run", "garbage collection")
+		return
+	}
+	logger.Log("resource", res.ResourceID(), "garbage collection", "delete")
+	sync.Actions = append(sync.Actions, cluster.SyncAction{
+		Delete: res,
+	})
+}
+
 func prepareSyncApply(logger log.Logger, clusterResources map[string]resource.Resource, id string, res resource.Resource, sync *cluster.SyncDef) {
 	if res.Policy().Contains(policy.Ignore) {
 		logger.Log("resource", res.ResourceID(), "ignore", "apply")
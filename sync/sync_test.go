@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -32,14 +33,14 @@ func TestSync(t *testing.T) {
 	// Start with nothing running. We should be told to apply all the things.
 	mockCluster := &cluster.Mock{}
 	manifests := &kubernetes.Manifests{}
-	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}}
+	var clus cluster.Cluster = &syncCluster{mockCluster, map[string][]byte{}, map[string]string{}}
 
 	resources, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDir())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if err := Sync(manifests, resources, clus, true, log.NewNopLogger()); err != nil {
+	if err := Sync(manifests, resources, clus, true, GC{}, log.NewNopLogger()); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
@@ -59,7 +60,202 @@ func TestSync(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := Sync(manifests, resources, clus, true, log.NewNopLogger()); err != nil {
+	if err := Sync(manifests, resources, clus, true, GC{}, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
+}
+
+const (
+	unsyncedDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: unsynced
+`
+	ignoredDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: ignored
+  annotations:
+    flux.weave.works/ignore: "true"
+`
+)
+
+func TestSyncGarbageCollect(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}
+	// Something that wasn't synced, and something that was but has
+	// since been marked to be ignored; both should be left alone.
+	clus.resources["default:deployment/unsynced"] = []byte(unsyncedDeployment)
+	clus.resources["default:deployment/ignored"] = []byte(ignoredDeployment)
+	clus.syncSets["default:deployment/ignored"] = "test"
+
+	gc := GC{SyncSet: "test"}
+	before, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sync(manifests, before, clus, false, gc, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	for id := range before {
+		if clus.syncSets[id] != "test" {
+			t.Errorf("expected %s to be marked as in the sync set", id)
+		}
+	}
+
+	for _, res := range testfiles.ServiceMap(checkout.ManifestDir()) {
+		if err := execCommand("rm", res[0]); err != nil {
+			t.Fatal(err)
+		}
+		commitAction := git.CommitAction{Author: "", Message: "deleted " + res[0]}
+		if err := checkout.CommitAndPush(context.Background(), commitAction, nil); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	after, err := manifests.LoadManifests(checkout.Dir(), checkout.ManifestDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed []string
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	if len(removed) == 0 {
+		t.Fatal("expected some resources to be removed from the repo")
+	}
+
+	// A dry run deletes nothing
+	if err := Sync(manifests, after, clus, false, GC{SyncSet: "test", DryRun: true}, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range removed {
+		if _, ok := clus.resources[id]; !ok {
+			t.Errorf("expected %s not to be deleted in a dry run", id)
+		}
+	}
+
+	if err := Sync(manifests, after, clus, false, gc, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range removed {
+		if _, ok := clus.resources[id]; ok {
+			t.Errorf("expected %s to be garbage collected", id)
+		}
+	}
+	for id := range after {
+		if _, ok := clus.resources[id]; !ok {
+			t.Errorf("expected %s still to be in the cluster", id)
+		}
+	}
+	for _, id := range []string{"default:deployment/unsynced", "default:deployment/ignored"} {
+		if _, ok := clus.resources[id]; !ok {
+			t.Errorf("expected %s not to be garbage collected", id)
+		}
+	}
+}
+
+// orderedCluster is a syncCluster that has services applied before
+// anything else, and records the batches it's given.
+type orderedCluster struct {
+	*syncCluster
+	batches [][]string
+}
+
+func (p *orderedCluster) ApplyRank(res resource.Resource) int {
+	if _, kind, _ := res.ResourceID().Components(); kind == "service" {
+		return 0
+	}
+	return 1
+}
+
+func (p *orderedCluster) Sync(def cluster.SyncDef) error {
+	var batch []string
+	for _, action := range def.Actions {
+		if action.Apply != nil {
+			batch = append(batch, action.Apply.ResourceID().String())
+		}
+	}
+	p.batches = append(p.batches, batch)
+	return p.syncCluster.Sync(def)
+}
+
+func TestSyncWalk(t *testing.T) {
+	checkout, cleanup := setup(t)
+	defer cleanup()
+
+	manifests := &kubernetes.Manifests{}
+	clus := &orderedCluster{syncCluster: &syncCluster{&cluster.Mock{}, map[string][]byte{}, map[string]string{}}}
+	var walked [][]string
+	walk := func(sources []string, fn func(resource.Resource) error) error {
+		walked = append(walked, sources)
+		paths := []string{checkout.ManifestDir()}
+		if len(sources) > 0 {
+			paths = nil
+			for _, source := range sources {
+				paths = append(paths, filepath.Join(checkout.Dir(), source))
+			}
+		}
+		_, err := manifests.WalkManifests(checkout.Dir(), paths, fn)
+		return err
+	}
+
+	checked := 0
+	plan, err := PlanWalk(clus, walk, func(resource.Resource) error {
+		checked++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != len(testfiles.ResourceMap) || len(plan.IDs) != len(testfiles.ResourceMap) {
+		t.Errorf("expected %d resources to be planned, checked %d and planned %#v", len(testfiles.ResourceMap), checked, plan.IDs)
+	}
+	if len(clus.batches) > 0 {
+		t.Fatalf("expected nothing to be applied by planning, got %#v", clus.batches)
+	}
+
+	// A batch size of one byte makes each resource a batch of its own
+	if err := SyncWalk(manifests, plan, clus, GC{SyncSet: "test"}, 1, log.NewNopLogger()); err != nil {
+		t.Fatal(err)
+	}
+	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
+	if len(clus.batches) != len(testfiles.ResourceMap) {
+		t.Errorf("expected a batch for each resource, got %#v", clus.batches)
+	}
+	// The files with services are walked again for them, and those
+	// with anything else for the rest
+	if len(walked) != 3 || !reflect.DeepEqual(walked[1], []string{"list.yaml", "multi.yaml"}) {
+		t.Errorf("expected a walk for each rank, of the files with resources of that rank; got %#v", walked)
+	}
+	seenOther := false
+	for _, batch := range clus.batches {
+		for _, id := range batch {
+			isService := strings.Contains(id, ":service/")
+			if isService && seenOther {
+				t.Errorf("expected services to be applied before anything else, got %#v", clus.batches)
+			}
+			seenOther = seenOther || !isService
+		}
+	}
+
+	// Resources removed from the repo are garbage collected
+	for _, res := range testfiles.ServiceMap(checkout.ManifestDir()) {
+		if err := execCommand("rm", res[0]); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if plan, err = PlanWalk(clus, walk, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncWalk(manifests, plan, clus, GC{SyncSet: "test"}, DefaultBatchSize, log.NewNopLogger()); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, manifests, clus, checkout.ManifestDir())
@@ -197,6 +393,7 @@ func execCommand(cmd string, args ...string) error {
 type syncCluster struct {
 	*cluster.Mock
 	resources map[string][]byte
+	syncSets  map[string]string // the sync set each resource was applied in
 }
 
 func (p *syncCluster) Sync(def cluster.SyncDef) error {
@@ -205,10 +402,14 @@ func (p *syncCluster) Sync(def cluster.SyncDef) error {
 		if action.Delete != nil {
 			println("Deleting " + action.Delete.ResourceID().String())
 			delete(p.resources, action.Delete.ResourceID().String())
+			delete(p.syncSets, action.Delete.ResourceID().String())
 		}
 		if action.Apply != nil {
 			println("Applying " + action.Apply.ResourceID().String())
 			p.resources[action.Apply.ResourceID().String()] = action.Apply.Bytes()
+			if def.SyncSet != "" {
+				p.syncSets[action.Apply.ResourceID().String()] = def.SyncSet
+			}
 		}
 	}
 	println("=== Done syncing ===")
@@ -225,6 +426,16 @@ func (p *syncCluster) Export() ([]byte, error) {
 	return bytes.Join(configs, []byte("\n---\n")), nil
 }
 
+func (p *syncCluster) ExportSyncSet(name string) ([]byte, error) {
+	var configs [][]byte
+	for id, config := range p.resources {
+		if p.syncSets[id] == name {
+			configs = append(configs, config)
+		}
+	}
+	return bytes.Join(configs, []byte("\n---\n")), nil
+}
+
 func resourcesToStrings(resources map[string]resource.Resource) map[string]string {
 	res := map[string]string{}
 	for k, r := range resources {
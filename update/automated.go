@@ -103,10 +103,14 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Contr
 					continue
 				}
 
-				// We transplant the tag here, to make sure we keep
-				// the format of the image name as it is in the
-				// resource (e.g., to avoid canonicalising it)
+				// We transplant the tag (and digest, if pinned) here,
+				// to make sure we keep the format of the image name
+				// as it is in the resource (e.g., to avoid
+				// canonicalising it)
 				newImageID := currentImageID.WithNewTag(change.ImageID.Tag)
+				if change.ImageID.Digest != "" {
+					newImageID = newImageID.WithNewDigest(change.ImageID.Digest)
+				}
 				containerUpdates = append(containerUpdates, ContainerUpdate{
 					Container: container.Name,
 					Current:   currentImageID,
@@ -78,14 +78,21 @@ func (f *IncludeFilter) Filter(u ControllerUpdate) ControllerResult {
 
 type LockedFilter struct {
 	IDs []flux.ResourceID
+	// Reasons gives why each is locked, if known, to be reported
+	// along with it having been skipped.
+	Reasons map[flux.ResourceID]string
 }
 
 func (f *LockedFilter) Filter(u ControllerUpdate) ControllerResult {
 	for _, id := range f.IDs {
 		if u.ResourceID == id {
+			reason := Locked
+			if msg := f.Reasons[id]; msg != "" {
+				reason = Locked + ": " + msg
+			}
 			return ControllerResult{
 				Status: ReleaseStatusSkipped,
-				Error:  Locked,
+				Error:  reason,
 			}
 		}
 	}
@@ -3,13 +3,14 @@ package update
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
-	glob "github.com/ryanuber/go-glob"
 
 	fluxerr "github.com/weaveworks/flux/errors"
 	"github.com/weaveworks/flux/image"
+	"github.com/weaveworks/flux/policy"
 	"github.com/weaveworks/flux/registry"
 	"github.com/weaveworks/flux/resource"
 )
@@ -40,14 +41,46 @@ type ImageInfos []image.Info
 
 // Filter returns only the images which match the tagGlob.
 func (ii ImageInfos) Filter(tagGlob string) ImageInfos {
+	return ii.filter(policy.GlobPattern(tagGlob))
+}
+
+// ForPlatform returns the images as they apply to the platform given;
+// see `image.Info.ForPlatform`.
+func (ii ImageInfos) ForPlatform(p image.Platform) ImageInfos {
+	if ii == nil || p.IsZero() {
+		return ii
+	}
+	res := make(ImageInfos, len(ii))
+	for i := range ii {
+		res[i] = ii[i].ForPlatform(p)
+	}
+	return res
+}
+
+// Exclude returns only the images not excluded, regardless of tag
+// pattern, by the exclusions given.
+func (ii ImageInfos) Exclude(exclusions image.Exclusions) ImageInfos {
+	return exclusions.Filter(ii, time.Now())
+}
+
+// FilterAndSort returns only the images with tags matching the
+// pattern, sorted newest first according to the pattern's ordering,
+// so that `Latest` gives the newest eligible image.
+func (ii ImageInfos) FilterAndSort(pattern policy.Pattern) ImageInfos {
+	filtered := ii.filter(pattern)
+	image.Sort(filtered, pattern.Newer)
+	return filtered
+}
+
+func (ii ImageInfos) filter(pattern policy.Pattern) ImageInfos {
 	var filtered ImageInfos
 	for _, i := range ii {
 		tag := i.ID.Tag
 		// Ignore latest if and only if it's not what the user wants.
-		if !strings.EqualFold(tagGlob, "latest") && strings.EqualFold(tag, "latest") {
+		if !strings.EqualFold(pattern.String(), "latest") && strings.EqualFold(tag, "latest") {
 			continue
 		}
-		if glob.Glob(tagGlob, tag) {
+		if pattern.Matches(tag) {
 			var im image.Info
 			im = i
 			filtered = append(filtered, im)
@@ -67,10 +100,15 @@ func (ii ImageInfos) Latest() (image.Info, bool) {
 }
 
 // FindWithRef returns image.Info given an image ref. If the image cannot be
-// found, it returns the image.Info with the ID provided.
+// found, it returns the image.Info with the ID provided. If the ref is
+// pinned by digest, the ID returned keeps the digest, and gains the
+// tag of the image found if it had none.
 func (ii ImageInfos) FindWithRef(ref image.Ref) image.Info {
 	for _, img := range ii {
-		if img.ID == ref {
+		if img.Matches(ref) {
+			if ref.Digest != "" {
+				img.ID = ref.WithNewTag(img.ID.Tag).WithNewDigest(ref.Digest)
+			}
 			return img
 		}
 	}
@@ -108,16 +146,19 @@ func FetchImageRepos(reg registry.Registry, cs containers, logger log.Logger) (I
 			imageRepos[container.Image.CanonicalName()] = nil
 		}
 	}
+	names := make([]image.Name, 0, len(imageRepos))
 	for repo := range imageRepos {
-		sortedRepoImages, err := reg.GetSortedRepositoryImages(repo.Name)
-		if err != nil {
+		names = append(names, repo.Name)
+	}
+	for repo, result := range reg.GetSortedRepositoriesImages(names) {
+		if result.Err != nil {
 			// Not an error if missing. Use empty images.
-			if !fluxerr.IsMissing(err) {
-				logger.Log("err", errors.Wrapf(err, "fetching image metadata for %s", repo))
+			if !fluxerr.IsMissing(result.Err) {
+				logger.Log("err", errors.Wrapf(result.Err, "fetching image metadata for %s", repo))
 				continue
 			}
 		}
-		imageRepos[repo] = sortedRepoImages
+		imageRepos[repo] = result.Images
 	}
 	return ImageRepos{imageRepos}, nil
 }
@@ -127,25 +168,27 @@ func exactImageRepos(reg registry.Registry, images []image.Ref) (ImageRepos, err
 	m := imageReposMap{}
 	for _, id := range images {
 		// We must check that the exact images requested actually exist. Otherwise we risk pushing invalid images to git.
-		exist, err := imageExists(reg, id)
+		info, exist, err := imageExists(reg, id)
 		if err != nil {
 			return ImageRepos{}, errors.Wrap(image.ErrInvalidImageID, err.Error())
 		}
 		if !exist {
 			return ImageRepos{}, errors.Wrap(image.ErrInvalidImageID, fmt.Sprintf("image %q does not exist", id))
 		}
-		m[id.CanonicalName()] = []image.Info{{ID: id}}
+		// Keep the digest, so that workloads pinned by digest can
+		// stay pinned.
+		m[id.CanonicalName()] = []image.Info{{ID: id, Digest: info.Digest, ListDigest: info.ListDigest}}
 	}
 	return ImageRepos{m}, nil
 }
 
-// Checks whether the given image exists in the repository.
-// Return true if exist, false otherwise.
+// Checks whether the given image exists in the repository, returning
+// its metadata if so.
 // FIXME(michael): never returns an error; should it?
-func imageExists(reg registry.Registry, imageID image.Ref) (bool, error) {
-	_, err := reg.GetImage(imageID)
+func imageExists(reg registry.Registry, imageID image.Ref) (image.Info, bool, error) {
+	info, err := reg.GetImage(imageID)
 	if err != nil {
-		return false, nil
+		return image.Info{}, false, nil
 	}
-	return true, nil
+	return info, true, nil
 }
@@ -18,6 +18,12 @@ var (
 		Help:      "Release method duration in seconds.",
 		Buckets:   stdprometheus.DefBuckets,
 	}, []string{fluxmetrics.LabelReleaseType, fluxmetrics.LabelReleaseKind, fluxmetrics.LabelSuccess})
+	releaseResults = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "fluxsvc",
+		Name:      "release_workloads_total",
+		Help:      "Count of workloads considered for release, by the status of their update.",
+	}, []string{fluxmetrics.LabelReleaseType, fluxmetrics.LabelReleaseKind, fluxmetrics.LabelStatus})
 	stageDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
 		Namespace: "flux",
 		Subsystem: "fluxsvc",
@@ -38,3 +44,15 @@ func ObserveRelease(start time.Time, success bool, releaseType ReleaseType, rele
 		fluxmetrics.LabelReleaseKind, string(releaseKind),
 	).Observe(time.Since(start).Seconds())
 }
+
+// ObserveReleaseResult counts the workloads in the result of a
+// release, by status.
+func ObserveReleaseResult(result Result, releaseType ReleaseType, releaseKind ReleaseKind) {
+	for _, res := range result {
+		releaseResults.With(
+			fluxmetrics.LabelReleaseType, string(releaseType),
+			fluxmetrics.LabelReleaseKind, string(releaseKind),
+			fluxmetrics.LabelStatus, string(res.Status),
+		).Add(1)
+	}
+}
@@ -1,13 +1,108 @@
 package update
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"text/tabwriter"
 
+	"github.com/ghodss/yaml"
+
 	"github.com/weaveworks/flux"
 )
 
+// The formats in which results can be output, for NewResultPrinter
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+)
+
+// ResultPrinter outputs a result set to the `io.Writer` provided, at
+// the given level of verbosity (as for PrintResults).
+type ResultPrinter func(out io.Writer, results Result, verbosity int) error
+
+// NewResultPrinter returns a ResultPrinter for the format named:
+// FormatTable (or the empty string) for the table printed by
+// PrintResults, or FormatJSON or FormatYAML for output that can be
+// read by other programs.
+func NewResultPrinter(format string) (ResultPrinter, error) {
+	switch format {
+	case "", FormatTable:
+		return func(out io.Writer, results Result, verbosity int) error {
+			PrintResults(out, results, verbosity)
+			return nil
+		}, nil
+	case FormatJSON:
+		return func(out io.Writer, results Result, verbosity int) error {
+			bytes, err := json.MarshalIndent(printableResults(results, verbosity), "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(out, "%s\n", bytes)
+			return err
+		}, nil
+	case FormatYAML:
+		return func(out io.Writer, results Result, verbosity int) error {
+			bytes, err := yaml.Marshal(printableResults(results, verbosity))
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(bytes)
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q; expected one of %s, %s or %s", format, FormatTable, FormatJSON, FormatYAML)
+}
+
+// printedResult is the outcome for a controller, as output in JSON
+// or YAML. This differs from ControllerResult (and Result) in being
+// meant for reading by people and scripts, rather than for the API.
+type printedResult struct {
+	Controller string                 `json:"controller"`
+	Status     ControllerUpdateStatus `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Updates    []printedUpdate        `json:"updates,omitempty"`
+}
+
+type printedUpdate struct {
+	Container string `json:"container"`
+	Current   string `json:"current"`
+	Target    string `json:"target"`
+}
+
+func printableResults(results Result, verbosity int) []printedResult {
+	printed := []printedResult{}
+	for _, serviceID := range results.ServiceIDs() {
+		result := results[flux.MustParseResourceID(serviceID)]
+		if !shouldPrint(result.Status, verbosity) {
+			continue
+		}
+		p := printedResult{Controller: serviceID, Status: result.Status, Error: result.Error}
+		for _, update := range result.PerContainer {
+			p.Updates = append(p.Updates, printedUpdate{
+				Container: update.Container,
+				Current:   update.Current.String(),
+				Target:    update.Target.String(),
+			})
+		}
+		printed = append(printed, p)
+	}
+	return printed
+}
+
+// shouldPrint reports whether a result with the status given is
+// output at the level of verbosity given.
+func shouldPrint(status ControllerUpdateStatus, verbosity int) bool {
+	switch status {
+	case ReleaseStatusIgnored:
+		return verbosity >= 2
+	case ReleaseStatusSkipped:
+		return verbosity >= 1
+	}
+	return true
+}
+
 // PrintResults outputs a result set to the `io.Writer` provided, at
 // the given level of verbosity:
 //  - 2 = include skipped and ignored resources
@@ -18,15 +113,8 @@ func PrintResults(out io.Writer, results Result, verbosity int) {
 	fmt.Fprintln(w, "CONTROLLER \tSTATUS \tUPDATES")
 	for _, serviceID := range results.ServiceIDs() {
 		result := results[flux.MustParseResourceID(serviceID)]
-		switch result.Status {
-		case ReleaseStatusIgnored:
-			if verbosity < 2 {
-				continue
-			}
-		case ReleaseStatusSkipped:
-			if verbosity < 1 {
-				continue
-			}
+		if !shouldPrint(result.Status, verbosity) {
+			continue
 		}
 
 		var extraLines []string
@@ -98,3 +98,62 @@ default/d    success
 		}
 	}
 }
+
+func TestResultPrinterFormats(t *testing.T) {
+	result := Result{
+		flux.MustParseResourceID("default:deployment/helloworld"): ControllerResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{
+				{
+					Container: "helloworld",
+					Current:   mustParseRef("quay.io/weaveworks/helloworld:master-a000002"),
+					Target:    mustParseRef("quay.io/weaveworks/helloworld:master-a000001"),
+				},
+			},
+		},
+		flux.MustParseResourceID("default:deployment/skipped"): ControllerResult{
+			Status: ReleaseStatusSkipped,
+			Error:  "not included",
+		},
+	}
+
+	for format, expected := range map[string]string{
+		FormatJSON: `[
+  {
+    "controller": "default:deployment/helloworld",
+    "status": "success",
+    "updates": [
+      {
+        "container": "helloworld",
+        "current": "quay.io/weaveworks/helloworld:master-a000002",
+        "target": "quay.io/weaveworks/helloworld:master-a000001"
+      }
+    ]
+  }
+]
+`,
+		FormatYAML: `- controller: default:deployment/helloworld
+  status: success
+  updates:
+  - container: helloworld
+    current: quay.io/weaveworks/helloworld:master-a000002
+    target: quay.io/weaveworks/helloworld:master-a000001
+`,
+	} {
+		printer, err := NewResultPrinter(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		if err := printer(out, result, 0); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", format, expected, out.String())
+		}
+	}
+
+	if _, err := NewResultPrinter("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
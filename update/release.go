@@ -3,6 +3,7 @@ package update
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -23,13 +24,16 @@ var (
 	ErrInvalidReleaseKind = errors.New("invalid release kind")
 )
 
-// ReleaseKind says whether a release is to be planned only, or planned then executed
+// ReleaseKind says whether a release is to be planned only, planned
+// then executed, or planned then proposed (committed to a branch of
+// its own, for review before it's merged into the branch synced)
 type ReleaseKind string
 type ReleaseType string
 
 const (
 	ReleaseKindPlan    ReleaseKind = "plan"
 	ReleaseKindExecute ReleaseKind = "execute"
+	ReleaseKindPropose ReleaseKind = "propose"
 )
 
 func ParseReleaseKind(s string) (ReleaseKind, error) {
@@ -38,6 +42,8 @@ func ParseReleaseKind(s string) (ReleaseKind, error) {
 		return ReleaseKindPlan, nil
 	case string(ReleaseKindExecute):
 		return ReleaseKindExecute, nil
+	case string(ReleaseKindPropose):
+		return ReleaseKindPropose, nil
 	default:
 		return "", ErrInvalidReleaseKind
 	}
@@ -157,8 +163,12 @@ func (s ReleaseSpec) filters(rc ReleaseContext) ([]ControllerFilter, []Controlle
 	if err != nil {
 		return nil, nil, err
 	}
-	lockedSet := services.OnlyWithPolicy(policy.Locked)
-	postfilters = append(postfilters, &LockedFilter{lockedSet.ToSlice()})
+	lockedSet := services.LockedAt(time.Now())
+	reasons := map[flux.ResourceID]string{}
+	for id, policies := range lockedSet {
+		reasons[id], _ = policies.Get(policy.LockedMsg)
+	}
+	postfilters = append(postfilters, &LockedFilter{lockedSet.ToSlice(), reasons})
 
 	return prefilters, postfilters, nil
 }
@@ -231,7 +241,14 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Cont
 		for _, container := range containers {
 			currentImageID := container.Image
 
-			filteredImages := imageRepos.GetRepoImages(currentImageID.Name).Filter("*")
+			// When releasing the latest images, only those allowed by
+			// the container's tag filter are eligible; an image given
+			// explicitly is taken as is.
+			pattern := policy.PatternAll
+			if s.ImageSpec == ImageSpecLatest && u.Resource != nil {
+				pattern = u.Resource.Policy().TagPattern(container.Name)
+			}
+			filteredImages := imageRepos.GetRepoImages(currentImageID.Name).ForPlatform(u.Controller.Platform).FilterAndSort(pattern)
 			latestImage, ok := filteredImages.Latest()
 			if !ok {
 				if currentImageID.CanonicalName() != singleRepo {
@@ -242,7 +259,7 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Cont
 				continue
 			}
 
-			if currentImageID == latestImage.ID {
+			if latestImage.Matches(currentImageID) {
 				ignoredOrSkipped = ReleaseStatusSkipped
 				continue
 			}
@@ -250,7 +267,7 @@ func (s ReleaseSpec) calculateImageUpdates(rc ReleaseContext, candidates []*Cont
 			// We want to update the image with respect to the form it
 			// appears in the manifest, whereas what we have is the
 			// canonical form.
-			newImageID := currentImageID.WithNewTag(latestImage.ID.Tag)
+			newImageID := currentImageID.UpdatedTo(latestImage)
 			containerUpdates = append(containerUpdates, ContainerUpdate{
 				Container: container.Name,
 				Current:   currentImageID,
@@ -325,7 +342,7 @@ func ParseImageSpec(s string) (ImageSpec, error) {
 	if err != nil {
 		return "", err
 	}
-	if id.Tag == "" {
+	if id.Tag == "" && id.Digest == "" {
 		return "", errors.Wrap(image.ErrInvalidImageID, "blank tag (if you want latest, explicitly state the tag :latest)")
 	}
 	return ImageSpec(id.String()), err
@@ -0,0 +1,175 @@
+package update
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/resource"
+)
+
+// RollbackSpec asks for the images used by a controller to be put
+// back as they were: either before the most recent release that
+// changed them, or, if Revision is given, as they are in the
+// manifests at that revision.
+type RollbackSpec struct {
+	ResourceID flux.ResourceID
+	Revision   string
+	Kind       ReleaseKind
+}
+
+// Undo gives the container updates that would reverse those recorded
+// for the controller in this result, or nil if it records none.
+func (r Result) Undo(id flux.ResourceID) []ContainerUpdate {
+	res, ok := r[id]
+	if !ok || res.Status != ReleaseStatusSuccess {
+		return nil
+	}
+	var undo []ContainerUpdate
+	for _, c := range res.PerContainer {
+		undo = append(undo, ContainerUpdate{
+			Container: c.Container,
+			Current:   c.Target,
+			Target:    c.Current,
+		})
+	}
+	return undo
+}
+
+// RollbackRelease is the release that carries out a RollbackSpec,
+// once the images to go back to are known.
+type RollbackRelease struct {
+	Spec RollbackSpec
+	// Revision is that of the release being undone, or that the
+	// images were taken from
+	Revision string
+	// Containers gives the images to go back to. If Current is
+	// given for a container, the controller must still be using
+	// that image, so that later changes aren't undone unawares.
+	Containers []ContainerUpdate
+}
+
+// RollbackTo makes the rollback that sets the images of the
+// controller to those of the containers given, whatever it is using
+// now.
+func (s RollbackSpec) RollbackTo(revision string, containers []resource.Container) *RollbackRelease {
+	r := &RollbackRelease{Spec: s, Revision: revision}
+	for _, c := range containers {
+		r.Containers = append(r.Containers, ContainerUpdate{Container: c.Name, Target: c.Image})
+	}
+	return r
+}
+
+// Undo makes the rollback that reverses the release of the controller
+// recorded at the revision given.
+func (s RollbackSpec) Undo(revision string, result Result) *RollbackRelease {
+	return &RollbackRelease{Spec: s, Revision: revision, Containers: result.Undo(s.ResourceID)}
+}
+
+// CalculateRelease checks the images to go back to against those in
+// the manifests, rather than those running (as ContainerSpecs does),
+// since it's the release recorded in git that is being undone.
+func (r *RollbackRelease) CalculateRelease(rc ReleaseContext, logger log.Logger) ([]*ControllerUpdate, Result, error) {
+	results := Result{}
+	all, err := rc.SelectServices(results, []ControllerFilter{&IncludeFilter{IDs: []flux.ResourceID{r.Spec.ResourceID}}}, nil)
+	if err != nil {
+		return nil, results, err
+	}
+
+	var updates []*ControllerUpdate
+	for _, u := range all {
+		containers := map[string]resource.Container{}
+		for _, c := range u.Resource.Containers() {
+			containers[c.Name] = c
+		}
+
+		var mismatch, notfound []string
+		var containerUpdates []ContainerUpdate
+		for _, spec := range r.Containers {
+			container, ok := containers[spec.Container]
+			switch {
+			case !ok:
+				notfound = append(notfound, spec.Container)
+				continue
+			case spec.Current != zeroImageRef && container.Image != spec.Current:
+				// The container has moved on since the release being
+				// undone; don't undo the later change too
+				mismatch = append(mismatch, spec.Container)
+				continue
+			case container.Image == spec.Target:
+				continue
+			}
+			containerUpdates = append(containerUpdates, ContainerUpdate{
+				Container: spec.Container,
+				Current:   container.Image,
+				Target:    spec.Target,
+			})
+		}
+
+		switch {
+		case len(notfound) > 0:
+			results[u.ResourceID] = ControllerResult{
+				Status: ReleaseStatusFailed,
+				Error:  fmt.Sprintf(ContainerNotFound, strings.Join(notfound, ", ")),
+			}
+		case len(mismatch) > 0:
+			results[u.ResourceID] = ControllerResult{
+				Status: ReleaseStatusFailed,
+				Error:  fmt.Sprintf(ContainerTagMismatch, strings.Join(mismatch, ", ")),
+			}
+		case len(containerUpdates) == 0:
+			results[u.ResourceID] = ControllerResult{
+				Status: ReleaseStatusSkipped,
+				Error:  ImageUpToDate,
+			}
+		default:
+			u.Updates = containerUpdates
+			updates = append(updates, u)
+			results[u.ResourceID] = ControllerResult{
+				Status:       ReleaseStatusSuccess,
+				PerContainer: u.Updates,
+			}
+		}
+	}
+
+	if res := results[r.Spec.ResourceID]; res.Status == ReleaseStatusFailed {
+		return updates, results, errors.New(res.Error)
+	}
+	return updates, results, nil
+}
+
+func (r *RollbackRelease) ReleaseKind() ReleaseKind {
+	return r.Spec.Kind
+}
+
+func (r *RollbackRelease) ReleaseType() ReleaseType {
+	return "rollback"
+}
+
+func (r *RollbackRelease) CommitMessage(result Result) string {
+	buf := &bytes.Buffer{}
+	if r.Spec.Revision != "" {
+		fmt.Fprintf(buf, "Roll back %s to images at %s\n", r.Spec.ResourceID, shortRevision(r.Revision))
+	} else {
+		fmt.Fprintf(buf, "Roll back release %s of %s\n", shortRevision(r.Revision), r.Spec.ResourceID)
+	}
+	for _, upd := range result[r.Spec.ResourceID].PerContainer {
+		fmt.Fprintf(buf, "\n- %s", upd.Target)
+	}
+	fmt.Fprintln(buf)
+	if err := result.Error(); err != "" {
+		fmt.Fprintf(buf, "\n%s", result.Error())
+	}
+	return buf.String()
+}
+
+func shortRevision(rev string) string {
+	if len(rev) <= 7 {
+		return rev
+	}
+	return rev[:7]
+}
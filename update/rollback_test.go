@@ -0,0 +1,50 @@
+package update
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/image"
+)
+
+func TestResultUndo(t *testing.T) {
+	id := flux.MustParseResourceID("default:deployment/helloworld")
+	failed := flux.MustParseResourceID("default:deployment/failed")
+	old, _ := image.ParseRef("quay.io/weaveworks/helloworld:1")
+	new, _ := image.ParseRef("quay.io/weaveworks/helloworld:2")
+
+	result := Result{
+		id: ControllerResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{
+				{Container: "greeter", Current: old, Target: new},
+			},
+		},
+		failed: ControllerResult{
+			Status: ReleaseStatusFailed,
+			PerContainer: []ContainerUpdate{
+				{Container: "greeter", Current: old, Target: new},
+			},
+		},
+	}
+
+	expected := []ContainerUpdate{{Container: "greeter", Current: new, Target: old}}
+	if got := result.Undo(id); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+	if got := result.Undo(failed); got != nil {
+		t.Errorf("expected nothing to undo for a failed release, got %#v", got)
+	}
+	if got := result.Undo(flux.MustParseResourceID("default:deployment/other")); got != nil {
+		t.Errorf("expected nothing to undo for a controller not released, got %#v", got)
+	}
+
+	spec := RollbackSpec{ResourceID: id, Kind: ReleaseKindExecute}
+	rollback := spec.Undo("1a2b3c4d5e6f", result)
+	msg := rollback.CommitMessage(Result{id: ControllerResult{Status: ReleaseStatusSuccess, PerContainer: expected}})
+	if !strings.HasPrefix(msg, "Roll back release 1a2b3c4 of default:deployment/helloworld\n") || !strings.Contains(msg, "- "+old.String()) {
+		t.Errorf("unexpected commit message:\n%s", msg)
+	}
+}
@@ -13,6 +13,7 @@ const (
 	Auto       = "auto"
 	Sync       = "sync"
 	Containers = "containers"
+	Rollback   = "rollback"
 )
 
 // How did this update get triggered?
@@ -71,6 +72,12 @@ func (spec *Spec) UnmarshalJSON(in []byte) error {
 			return err
 		}
 		spec.Spec = update
+	case Rollback:
+		var update RollbackSpec
+		if err := json.Unmarshal(wire.SpecBytes, &update); err != nil {
+			return err
+		}
+		spec.Spec = update
 	default:
 		return errors.New("unknown spec type: " + wire.Type)
 	}